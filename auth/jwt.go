@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+JWTVerifier is a struct that contains the keys bearer tokens are verified with
+HS256 tokens are verified with the HMAC secrets and RS256 tokens with the RSA public keys
+a token with a kid header is only verified with the key of that kid
+
+Issuer and Audience are checked when they are set
+*/
+type JWTVerifier struct {
+	HMACSecrets   map[string][]byte
+	RSAPublicKeys map[string]*rsa.PublicKey
+	Issuer        string
+	Audience      string
+}
+
+/*
+JWTOptions is a struct that contains the local files the keys of a JWTVerifier are loaded from
+HMACSecretFile 					-> a file with the HS256 secret, surrounding whitespace is ignored
+RSAPublicKeyFile 				-> a PEM file with an RSA public key (PKIX or PKCS#1) or certificate
+JWKSFile 						-> a JSON Web Key Set file with "RSA" and "oct" keys
+*/
+type JWTOptions struct {
+	HMACSecretFile   string `json:"hmacSecretFile"`
+	RSAPublicKeyFile string `json:"rsaPublicKeyFile"`
+	JWKSFile         string `json:"jwksFile"`
+	Issuer           string `json:"issuer"`
+	Audience         string `json:"audience"`
+}
+
+// Enabled reports whether any key file is configured
+func (options JWTOptions) Enabled() bool {
+	return options.HMACSecretFile != "" || options.RSAPublicKeyFile != "" || options.JWKSFile != ""
+}
+
+/*
+claims are the claims of a bearer token
+the scopes are either a space separated "scope" claim (RFC 8693) or a "scp" list
+tenant is the tenant the token belongs to, models.DefaultTenant when absent
+*/
+type claims struct {
+	jwt.RegisteredClaims
+	Scope  string   `json:"scope"`
+	Scp    []string `json:"scp"`
+	Tenant string   `json:"tenant"`
+}
+
+// NewJWTVerifier is a function that loads the keys of the options, returns an error if a file is invalid
+func NewJWTVerifier(options JWTOptions) (*JWTVerifier, error) {
+	verifier := &JWTVerifier{
+		HMACSecrets:   make(map[string][]byte),
+		RSAPublicKeys: make(map[string]*rsa.PublicKey),
+		Issuer:        options.Issuer,
+		Audience:      options.Audience,
+	}
+
+	if options.HMACSecretFile != "" {
+		content, err := os.ReadFile(options.HMACSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading HMAC secret: %w", err)
+		}
+		secret := strings.TrimSpace(string(content))
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("HMAC secret in %s is shorter than 32 bytes", options.HMACSecretFile)
+		}
+		verifier.HMACSecrets[""] = []byte(secret)
+	}
+
+	if options.RSAPublicKeyFile != "" {
+		content, err := os.ReadFile(options.RSAPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading RSA public key: %w", err)
+		}
+		publicKey, err := parseRSAPublicKey(content)
+		if err != nil {
+			return nil, fmt.Errorf("parsing RSA public key %s: %w", options.RSAPublicKeyFile, err)
+		}
+		verifier.RSAPublicKeys[""] = publicKey
+	}
+
+	if options.JWKSFile != "" {
+		if err := verifier.loadJWKS(options.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	return verifier, nil
+}
+
+/*
+Verify is a function that verifies the signature, the expiry, the issuer and the audience of a bearer token
+returns the principal of the token, the subject is required
+the token belongs to models.DefaultTenant without a tenant claim, like a partner without a tenant,
+only the admin token may act for any tenant, returns an error if the tenant is not a valid tenant id
+*/
+func (verifier *JWTVerifier) Verify(token string) (*Principal, error) {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if verifier.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(verifier.Issuer))
+	}
+	if verifier.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(verifier.Audience))
+	}
+
+	var tokenClaims claims
+	if _, err := jwt.ParseWithClaims(token, &tokenClaims, verifier.key, parserOptions...); err != nil {
+		return nil, err
+	}
+	if tokenClaims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	tenantID := tokenClaims.Tenant
+	if tenantID == "" {
+		tenantID = models.DefaultTenant
+	}
+	if !models.ValidTenantID(tenantID) {
+		return nil, fmt.Errorf("token has an invalid tenant %q", tenantID)
+	}
+
+	scopes := tokenClaims.Scp
+	if tokenClaims.Scope != "" {
+		scopes = append(scopes, strings.Fields(tokenClaims.Scope)...)
+	}
+	return &Principal{Subject: tokenClaims.Subject, Scopes: scopes, TenantID: tenantID}, nil
+}
+
+// key returns the key matching the algorithm and the kid of the token
+func (verifier *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method.Alg() {
+	case "HS256":
+		if secret, ok := verifier.HMACSecrets[kid]; ok {
+			return secret, nil
+		}
+	case "RS256":
+		if publicKey, ok := verifier.RSAPublicKeys[kid]; ok {
+			return publicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s key for kid %q", token.Method.Alg(), kid)
+}
+
+/*
+loadJWKS adds the keys of a JSON Web Key Set file
+keys without a kid are used for tokens without a kid, keys for other uses than "sig" are skipped
+*/
+func (verifier *JWTVerifier) loadJWKS(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading JWKS: %w", err)
+	}
+
+	var keySet struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &keySet); err != nil {
+		return fmt.Errorf("parsing JWKS %s: %w", path, err)
+	}
+
+	for _, key := range keySet.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			n, nErr := base64.RawURLEncoding.DecodeString(key.N)
+			e, eErr := base64.RawURLEncoding.DecodeString(key.E)
+			if nErr != nil || eErr != nil || len(n) == 0 || len(e) == 0 {
+				return fmt.Errorf("JWKS %s: invalid RSA key %q", path, key.Kid)
+			}
+			verifier.RSAPublicKeys[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) < 32 {
+				return fmt.Errorf("JWKS %s: invalid oct key %q", path, key.Kid)
+			}
+			verifier.HMACSecrets[key.Kid] = secret
+		default:
+			return fmt.Errorf("JWKS %s: unsupported key type %q", path, key.Kty)
+		}
+	}
+	return nil
+}
+
+func parseRSAPublicKey(content []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey, ok := certificate.PublicKey.(*rsa.PublicKey); ok {
+			return publicKey, nil
+		}
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if rsaPublicKey, ok := publicKey.(*rsa.PublicKey); ok {
+			return rsaPublicKey, nil
+		}
+	}
+	return nil, errors.New("not an RSA public key")
+}
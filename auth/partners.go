@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+Partner is a partner POS integration authenticated with a client certificate
+Subject is the subject of its certificate as Go prints it, e.g. "CN=pos-1,O=Acme Corp"
+TenantID is the tenant its receipts belong to, models.DefaultTenant when empty
+Scopes are the scopes granted to it, receipts:read and receipts:write when empty
+*/
+type Partner struct {
+	ID       string   `json:"id"`
+	Subject  string   `json:"subject"`
+	TenantID string   `json:"tenant"`
+	Scopes   []string `json:"scopes"`
+}
+
+// Partners maps the subjects of client certificates to the partners they identify
+type Partners struct {
+	bySubject map[string]Partner
+}
+
+/*
+LoadPartners is a function that loads the partners from a JSON file, a list of partners
+returns an error if the file cannot be read, a partner has no id or subject, a subject is listed twice,
+or a tenant or scope is invalid
+*/
+func LoadPartners(path string) (*Partners, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading partners: %w", err)
+	}
+	var list []Partner
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing partners %s: %w", path, err)
+	}
+	return NewPartners(list)
+}
+
+// NewPartners returns the partners of the list, see LoadPartners for what is rejected
+func NewPartners(list []Partner) (*Partners, error) {
+	partners := &Partners{bySubject: make(map[string]Partner, len(list))}
+	for _, partner := range list {
+		if partner.ID == "" || partner.Subject == "" {
+			return nil, fmt.Errorf("partner %q: the id and the subject are required", partner.ID)
+		}
+		if _, ok := partners.bySubject[partner.Subject]; ok {
+			return nil, fmt.Errorf("partner %s: the subject %q is already mapped", partner.ID, partner.Subject)
+		}
+		if partner.TenantID == "" {
+			partner.TenantID = models.DefaultTenant
+		}
+		if !models.ValidTenantID(partner.TenantID) {
+			return nil, fmt.Errorf("partner %s: the tenant %q is invalid", partner.ID, partner.TenantID)
+		}
+		if len(partner.Scopes) == 0 {
+			partner.Scopes = []string{ScopeReceiptsRead, ScopeReceiptsWrite}
+		}
+		for _, scope := range partner.Scopes {
+			if scope != ScopeReceiptsRead && scope != ScopeReceiptsWrite && scope != ScopeAdmin {
+				return nil, fmt.Errorf("partner %s: unknown scope %q", partner.ID, scope)
+			}
+		}
+		partners.bySubject[partner.Subject] = partner
+	}
+	return partners, nil
+}
+
+/*
+Principal is a function that returns the principal of the partner of a verified client certificate
+returns false if the subject of the certificate is not mapped to a partner
+*/
+func (partners *Partners) Principal(certificate *x509.Certificate) (*Principal, bool) {
+	partner, ok := partners.bySubject[certificate.Subject.String()]
+	if !ok {
+		return nil, false
+	}
+	return &Principal{PartnerID: partner.ID, Scopes: partner.Scopes, TenantID: partner.TenantID}, true
+}
@@ -0,0 +1,42 @@
+package auth
+
+// the scopes checked on the routes of the service
+const (
+	ScopeReceiptsWrite = "receipts:write"
+	ScopeReceiptsRead  = "receipts:read"
+	ScopeAdmin         = "admin"
+)
+
+/*
+Principal is a struct that contains who a request was authenticated as and what it may do
+APIKeyID is the id of the API key of a partner, empty for bearer tokens
+PartnerID is the id of the partner of the client certificate, see Partners
+Subject is the subject of a bearer token, the member id for member facing apps
+Scopes are the scopes granted to the request
+TenantID is the tenant the credentials belong to, empty when they may act for any tenant (the admin token)
+*/
+type Principal struct {
+	APIKeyID  string
+	PartnerID string
+	Subject   string
+	Scopes    []string
+	TenantID  string
+}
+
+// HasScope reports whether the scope is granted to the principal
+func (principal *Principal) HasScope(scope string) bool {
+	for _, granted := range principal.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+IsMember reports whether the principal is a member authenticated with a bearer token
+members can only submit and read their own receipts, unless they have the admin scope
+*/
+func (principal *Principal) IsMember() bool {
+	return principal.Subject != "" && !principal.HasScope(ScopeAdmin)
+}
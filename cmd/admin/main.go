@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+admin is the command line client of the admin endpoints of the receipt processor
+
+	ADMIN_TOKEN=... go run ./cmd/admin create-key -name "Partner POS" -tenant acme
+	ADMIN_TOKEN=... go run ./cmd/admin list-keys
+	ADMIN_TOKEN=... go run ./cmd/admin revoke-key <id>
+
+the server is http://localhost:8080 unless -server is given before the command
+*/
+
+var (
+	serverURL = flag.String("server", "http://localhost:8080", "base URL of the receipt processor")
+	client    = &http.Client{Timeout: 10 * time.Second}
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := flag.Arg(0), flag.Args()[1:]; command {
+	case "create-key":
+		err = createKey(args)
+	case "list-keys":
+		err = send(http.MethodGet, "/admin/api-keys", nil)
+	case "revoke-key":
+		if len(args) != 1 {
+			err = fmt.Errorf("revoke-key needs the id of the API key")
+			break
+		}
+		err = send(http.MethodDelete, "/admin/api-keys/"+args[0], nil)
+	default:
+		err = fmt.Errorf("unknown command %q", command)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin [-server URL] create-key -name NAME [-tenant TENANT] [-daily-quota N] | list-keys | revoke-key ID")
+	fmt.Fprintln(os.Stderr, "the admin token is read from the ADMIN_TOKEN environment variable")
+	flag.PrintDefaults()
+}
+
+// createKey creates an API key, the key is printed once and cannot be retrieved again
+func createKey(args []string) error {
+	flags := flag.NewFlagSet("create-key", flag.ContinueOnError)
+	name := flags.String("name", "", "name to recognize the API key by, e.g. the partner")
+	tenant := flags.String("tenant", "default", "tenant whose receipts the API key reads and writes")
+	dailyQuota := flags.Int("daily-quota", 0, "receipts the API key submits per UTC day, 0 for the quota of the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("create-key needs -name")
+	}
+	return send(http.MethodPost, "/admin/api-keys", map[string]interface{}{"name": *name, "tenant": *tenant, "dailyQuota": *dailyQuota})
+}
+
+// send calls an admin endpoint and prints the response body
+func send(method string, path string, body interface{}) error {
+	var requestBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(*serverURL, "/")+path, requestBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Token", os.Getenv("ADMIN_TOKEN"))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, responseBody)
+	}
+	if len(responseBody) > 0 {
+		fmt.Println(string(responseBody))
+	} else {
+		fmt.Println(resp.Status)
+	}
+	return nil
+}
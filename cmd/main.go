@@ -1,35 +1,459 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
-	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/config"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/email"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/grpcapi"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/httpserver"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/openapi"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
 )
 
-// server, database, receiptService, receiptController are the global variables
+/*
+gitCommit and buildTime are set at build time, see the Dockerfile
+go build -ldflags "-X main.gitCommit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+*/
 var (
-	server = gin.Default()
-	database = db.InMemoryDB{AllReceipts: make(map[string]int64)}
-	receiptService = services.ReceiptServiceImpl{DB: &database}
-	receiptController = controllers.ReceiptController{ReceiptService: &receiptService}
+	gitCommit string
+	buildTime string
 )
 
+/*
+main loads the configuration, see the config package for the flags, the environment variables and the config file,
+then builds the stores, the services and the controllers from it and serves until SIGINT or SIGTERM
+with -print-config it prints the configuration with the secrets masked and exits
+*/
 func main() {
+	cfg, options, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if options.PrintConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(cfg.Masked()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if options.PrintConfig {
+		return
+	}
+
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger := logging.New(os.Stdout, logging.Options{Level: level, RedactPII: cfg.Log.Redact})
+	slog.SetDefault(logger)
+
+	/*
+	database holds what is shared by all tenants (the API keys),
+	tenants creates the store, the retailer registry and the receipt service of every tenant
+	*/
+	database, newStore, err := newStores(cfg.Store)
+	if err != nil {
+		logger.Error("creating the stores", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	jobQueue := services.NewJobQueue(cfg.Jobs.Workers, cfg.Jobs.QueueSize)
+	webhookDispatcher := services.NewWebhookDispatcher(cfg.Webhooks.Workers, cfg.Webhooks.QueueSize)
+	webhookDispatcher.Client = services.NewWebhookClient(time.Duration(cfg.Webhooks.Timeout), cfg.Webhooks.AllowPrivate)
+	webhookDispatcher.MaxAttempts = cfg.Webhooks.MaxAttempts
+	webhookDispatcher.Backoff = time.Duration(cfg.Webhooks.Backoff)
+	webhookDispatcher.MaxBackoff = time.Duration(cfg.Webhooks.MaxBackoff)
+	receiptFeed := services.NewReceiptFeed(cfg.Stream.BufferSize, cfg.Stream.SubscriberBuffer)
+	tenants := services.Tenants{NewStore: newStore, Jobs: jobQueue, Webhooks: webhookDispatcher, Feed: receiptFeed}
+	apiKeyService := services.APIKeyServiceImpl{DB: database, DefaultDailyQuota: cfg.Limits.DailyQuota}
+	healthService := services.HealthServiceImpl{}
+	receiptController := controllers.ReceiptController{Tenants: &tenants}
+	retailerController := controllers.RetailerController{Tenants: &tenants}
+	apiKeyController := controllers.APIKeyController{APIKeyService: &apiKeyService}
+	jobController := controllers.JobController{Tenants: &tenants}
+	webhookController := controllers.WebhookController{Tenants: &tenants}
+	streamController := controllers.StreamController{
+		Feed:         receiptFeed,
+		Heartbeat:    time.Duration(cfg.Stream.Heartbeat),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+	}
+	graphQLController := controllers.GraphQLController{Tenants: &tenants, APIKeys: &apiKeyService}
+	healthController := controllers.HealthController{HealthService: &healthService}
+
+	shutdown := httpserver.Shutdown{
+		Delay:   time.Duration(cfg.Server.ShutdownDelay),
+		Timeout: time.Duration(cfg.Server.ShutdownTimeout),
+	}
+	if cfg.Auth.AdminToken == "" && !cfg.Auth.JWT.Enabled() {
+		logger.Warn("ADMIN_TOKEN is not set, the admin endpoints are disabled")
+	}
+	if cfg.Tracing.File != "" {
+		flushSpans, err := tracing.Setup(cfg.Tracing.File)
+		if err != nil {
+			logger.Error("setting up tracing", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		shutdown.Close = append(shutdown.Close, flushSpans)
+	}
+	server := gin.New()
+	server.Use(middleware.RequestLogger(logger), middleware.Metrics(), middleware.Tracing(), gin.Recovery())
+	if err := server.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Error("setting the trusted proxies", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	authenticator := middleware.Authenticator{APIKeys: &apiKeyService, AdminToken: cfg.Auth.AdminToken}
+	if cfg.Auth.JWT.Enabled() {
+		verifier, err := auth.NewJWTVerifier(cfg.Auth.JWT)
+		if err != nil {
+			logger.Error("loading the JWT keys", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		authenticator.JWT = verifier
+	}
+	if cfg.TLS.PartnersFile != "" {
+		partners, err := auth.LoadPartners(cfg.TLS.PartnersFile)
+		if err != nil {
+			logger.Error("loading the partners", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		authenticator.Partners = partners
+	}
+	authenticate := authenticator.Authenticate()
+
+	if cfg.Rules.File != "" {
+		rules, err := services.LoadRuleSet(cfg.Rules.File)
+		if err != nil {
+			logger.Error("loading the rules", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		tenants.Rules = rules
+	}
+	if cfg.Rules.TenantDir != "" {
+		tenantRules, err := services.LoadTenantRules(cfg.Rules.TenantDir)
+		if err != nil {
+			logger.Error("loading the tenant rules", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		tenants.TenantRules = tenantRules
+	}
+	if cfg.Rules.RatesFile != "" {
+		rates, err := services.LoadConversionTable(cfg.Rules.RatesFile)
+		if err != nil {
+			logger.Error("loading the conversion rates", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		tenants.Rates = rates
+	}
+	healthService.Build = services.NewBuildInfo(gitCommit, buildTime)
+	tenants.RulesVersions(&healthService.Build)
+	/*
+	the stores are the only readiness check, the rules are loaded before the server starts
+	and the server does not start without them, so they cannot fail a check once it serves requests
+	*/
+	healthService.Checks = []services.HealthCheck{
+		{Name: "store", Check: func(ctx context.Context) error {
+			if err := database.Ping(ctx); err != nil {
+				return err
+			}
+			return tenants.Ping(ctx)
+		}},
+	}
+	rateLimiter := &middleware.RateLimiter{}
+	if cfg.Limits.RateLimitsFile != "" {
+		limits, err := middleware.LoadRateLimits(cfg.Limits.RateLimitsFile)
+		if err != nil {
+			logger.Error("loading the rate limits", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		rateLimiter = limits
+	}
 
 	/*
 	creating a group for all the receipt related routes /receipts endpoints
+	every request needs a valid API key in the X-API-Key header or a bearer token unless -auth=false,
+	returns 401 otherwise and 403 when the scope in brackets is missing
+	members (bearer tokens without the admin scope) only find their own receipts
+	the receipts are stored per tenant, see middleware.Tenant for how the tenant of a request is chosen,
+	a tenant is created by its first write, the reads of a tenant that is not known return 404, see middleware.KnownTenant
+	every route is rate limited per API key and per client IP with the -rate-limits file, returns 429 when a limit is hit,
+	the client IP before the credentials are checked so the requests with invalid credentials are limited too,
+	the receipts an API key submits count against its daily quota, returns 429 when it is used up
 	consists of the following endpoints:
-	1. GET /receipts/:id/points         -> returns the points for a given receipt id, 
+	1. GET /receipts/:id/points         -> returns the points for a given receipt id, (receipts:read)
 											if the receipt is not found, returns 404
-	2. POST /receipts/process			-> processes the receipt and returns the id of the receipt, 
+	2. POST /receipts/process			-> processes the receipt and returns the id of the receipt, (receipts:write)
 											if the receipt is invalid, returns 400
+	3. GET /receipts/:id				-> returns the processed receipt for a given receipt id, (receipts:read)
+											if the receipt is not found, returns 404
+	4. POST /receipts/process-text		-> parses the receipt from text and processes it, (receipts:write)
+											if the parsed receipt is invalid, returns 400 with what was parsed
+	5. GET /receipts/stream				-> streams the receipts scored as Server-Sent Events, (receipts:read or admin)
+											filtered by ?tenant= and ?retailer=, resumes after the Last-Event-ID header,
+											every tenant with the admin token when none is picked
+	the POST endpoints with the Prefer: respond-async header return 202 with a job right away and process the receipt in it,
+	returns 503 when -job-queue-size jobs are already waiting for the -job-workers
 	*/
 	receiptApiRoutes := server.Group("/receipts") 
+	knownTenant := middleware.KnownTenant(&tenants)
+	requireScope := func(scopes ...string) gin.HandlerFunc {
+		return middleware.RequireScope(scopes...)
+	}
+	if cfg.Auth.Required {
+		receiptApiRoutes.Use(rateLimiter.LimitIP(), authenticate, rateLimiter.LimitKey(), middleware.Tenant())
+	} else {
+		receiptApiRoutes.Use(rateLimiter.LimitIP(), middleware.Tenant())
+		requireScope = func(...string) gin.HandlerFunc {
+			return func(c *gin.Context) { c.Next() }
+		}
+	}
+	{
+		receiptApiRoutes.GET("/stream", requireScope(auth.ScopeReceiptsRead, auth.ScopeAdmin), streamController.StreamReceipts)
+		receiptApiRoutes.GET("/:id", requireScope(auth.ScopeReceiptsRead), knownTenant, receiptController.GetReceipt)
+		receiptApiRoutes.GET("/:id/points", requireScope(auth.ScopeReceiptsRead), knownTenant, receiptController.GetReceiptPoints)
+		receiptApiRoutes.POST("/process", requireScope(auth.ScopeReceiptsWrite), middleware.DailyQuota(&apiKeyService), receiptController.ProcessReceipt)
+		receiptApiRoutes.POST("/process-text", requireScope(auth.ScopeReceiptsWrite), middleware.DailyQuota(&apiKeyService), receiptController.ProcessReceiptText)
+	}
+
+	/*
+	the jobs of the asynchronous requests, authenticated, given a tenant and rate limited like the /receipts routes
+	members only find their own jobs
+	1. GET /jobs/:id					-> returns the status of the job and, once it is done, the status and body of its response, (receipts:read)
+											if the job is not found, returns 404
+	*/
+	jobRoutes := server.Group("/jobs")
+	if cfg.Auth.Required {
+		jobRoutes.Use(rateLimiter.LimitIP(), authenticate, rateLimiter.LimitKey(), middleware.Tenant(), knownTenant)
+	} else {
+		jobRoutes.Use(rateLimiter.LimitIP(), middleware.Tenant(), knownTenant)
+	}
+	jobRoutes.GET("/:id", requireScope(auth.ScopeReceiptsRead), jobController.GetJob)
+
+	/*
+	the webhooks the events of the receipts are posted to, authenticated, given a tenant and rate limited like the /receipts routes
+	every route needs receipts:read, and the routes changing the webhooks receipts:write or admin as well,
+	members only find and manage their own webhooks and only get the events of their receipts
+	1. GET /webhooks					-> returns the webhooks, without their secrets
+	2. POST /webhooks					-> adds a webhook and returns it with its secret, returns 400 if invalid, (receipts:write or admin)
+	3. GET /webhooks/dead-letters		-> returns the deliveries whose every attempt failed
+	4. POST /webhooks/dead-letters/:id/redeliver	-> attempts the dead letter again, returns 404 if not found, (receipts:write or admin)
+	5. GET /webhooks/:id				-> returns the webhook, returns 404 if not found
+	6. DELETE /webhooks/:id				-> removes the webhook and its deliveries, (receipts:write or admin)
+	7. GET /webhooks/:id/deliveries		-> returns the delivery history of the webhook
+	*/
+	webhookRoutes := server.Group("/webhooks")
+	if cfg.Auth.Required {
+		webhookRoutes.Use(rateLimiter.LimitIP(), authenticate, rateLimiter.LimitKey(), middleware.Tenant(), requireScope(auth.ScopeReceiptsRead), knownTenant)
+	} else {
+		webhookRoutes.Use(rateLimiter.LimitIP(), middleware.Tenant(), knownTenant)
+	}
 	{
-		receiptApiRoutes.GET("/:id/points", receiptController.GetReceiptPoints)
-		receiptApiRoutes.POST("/process", receiptController.ProcessReceipt)
+		webhookRoutes.GET("", webhookController.GetAllWebhooks)
+		webhookRoutes.POST("", requireScope(auth.ScopeReceiptsWrite, auth.ScopeAdmin), webhookController.AddWebhook)
+		webhookRoutes.GET("/dead-letters", webhookController.GetDeadLetters)
+		webhookRoutes.POST("/dead-letters/:id/redeliver", requireScope(auth.ScopeReceiptsWrite, auth.ScopeAdmin), webhookController.Redeliver)
+		webhookRoutes.GET("/:id", webhookController.GetWebhook)
+		webhookRoutes.DELETE("/:id", requireScope(auth.ScopeReceiptsWrite, auth.ScopeAdmin), webhookController.DeleteWebhook)
+		webhookRoutes.GET("/:id/deliveries", webhookController.GetDeliveries)
+	}
+
+	/*
+	the GraphQL API of the receipts and members, authenticated, given a tenant and rate limited like the /receipts routes
+	the queries need receipts:read and the processReceipt mutation receipts:write, it counts against the daily quota
+	1. POST /graphql					-> executes the GraphQL request in the body
+	2. GET /graphql						-> executes the query in the query parameters, returns 405 for a mutation
+	3. GET /graphql/schema				-> returns the schema in the schema definition language, unauthenticated
+	*/
+	graphQLRoutes := server.Group("/graphql")
+	if cfg.Auth.Required {
+		graphQLRoutes.Use(rateLimiter.LimitIP(), authenticate, rateLimiter.LimitKey(), middleware.Tenant())
+	} else {
+		graphQLRoutes.Use(rateLimiter.LimitIP(), middleware.Tenant())
+	}
+	{
+		graphQLRoutes.POST("", graphQLController.Query)
+		graphQLRoutes.GET("", graphQLController.Query)
+	}
+	server.GET("/graphql/schema", graphQLController.Schema)
+
+	/*
+	creating a group for the retailer registry /retailers endpoints
+	the registry changes the points of receipts so it needs the admin scope,
+	from the admin token in the X-Admin-Token header or a bearer token
+	every tenant has its own registry, the admin token names the tenant in the X-Tenant-ID header
+	consists of the following endpoints:
+	1. GET /retailers					-> returns all the retailers
+	2. POST /retailers					-> adds a retailer, returns 400 if invalid, 409 if a name or alias is taken
+	3. GET /retailers/:id				-> returns the retailer, returns 404 if not found
+	4. PUT /retailers/:id				-> replaces the name and aliases of the retailer
+	5. DELETE /retailers/:id			-> removes the retailer from the registry
+	*/
+	retailerApiRoutes := server.Group("/retailers", rateLimiter.LimitIP(), authenticate, rateLimiter.LimitKey(), middleware.RequireScope(auth.ScopeAdmin), middleware.Tenant(), knownTenant)
+	{
+		retailerApiRoutes.GET("", retailerController.GetAllRetailers)
+		retailerApiRoutes.POST("", retailerController.AddRetailer)
+		retailerApiRoutes.GET("/:id", retailerController.GetRetailer)
+		retailerApiRoutes.PUT("/:id", retailerController.UpdateRetailer)
+		retailerApiRoutes.DELETE("/:id", retailerController.DeleteRetailer)
+	}
+
+	/*
+	creating a group for the admin endpoints used by the admin CLI (cmd/admin)
+	every request needs the admin scope, from the admin token in the X-Admin-Token header or a bearer token
+	a bearer token of a tenant only manages the API keys of its tenant
+	consists of the following endpoints:
+	1. GET /admin/api-keys				-> returns all the API keys, without the keys themselves
+	2. POST /admin/api-keys				-> creates an API key and returns the key, returns 400 if invalid
+	3. DELETE /admin/api-keys/:id		-> revokes the API key, returns 404 if not found
+	*/
+	adminApiRoutes := server.Group("/admin", rateLimiter.LimitIP(), authenticate, rateLimiter.LimitKey(), middleware.RequireScope(auth.ScopeAdmin))
+	{
+		adminApiRoutes.GET("/api-keys", apiKeyController.GetAllAPIKeys)
+		adminApiRoutes.POST("/api-keys", apiKeyController.CreateAPIKey)
+		adminApiRoutes.DELETE("/api-keys/:id", apiKeyController.RevokeAPIKey)
 	}
 	
-	server.Run(":8080")
+	/*
+	the endpoints probed by the orchestrator, unauthenticated
+	1. GET /healthz						-> returns 200 while the process serves requests
+	2. GET /readyz						-> returns 200 when the stores are reachable,
+											503 otherwise and once the server is shutting down
+	3. GET /version						-> returns the commit, the build time and the version of the rules
+	*/
+	server.GET("/healthz", healthController.Healthz)
+	server.GET("/readyz", healthController.Readyz)
+	server.GET("/version", healthController.Version)
+
+	/*
+	the Prometheus metrics, unauthenticated so they can be scraped, see the metrics package for what is exposed
+	1. GET /metrics						-> returns the metrics in the Prometheus text format
+	*/
+	server.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	/*
+	the OpenAPI 3 document of every route, unauthenticated, see the openapi package
+	1. GET /openapi.json					-> returns the document
+	*/
+	server.GET("/openapi.json", gin.WrapH(openapi.Handler()))
+
+	/*
+	on SIGINT or SIGTERM, e.g. docker stop, the server stops accepting connections and drains the requests in flight,
+	the streams of the receipts are ended as soon as it starts, they would never finish draining,
+	then the queued jobs are run, the pending webhook retries are dropped, the stores are closed and the spans are flushed last, so the spans of the drained requests are written
+	*/
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdown.BeforeDrain = healthService.ShutDown
+	shutdown.Close = append([]func(ctx context.Context) error{jobQueue.Close, webhookDispatcher.Close, tenants.Close, database.Close}, shutdown.Close...)
+	httpServer := httpserver.New(server, httpserver.Options{
+		Addr:              cfg.Server.Addr,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+	})
+	httpServer.RegisterOnShutdown(receiptFeed.Close)
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := httpserver.NewTLSConfig(httpserver.TLSOptions{
+			CertFile:       cfg.TLS.CertFile,
+			KeyFile:        cfg.TLS.KeyFile,
+			ReloadInterval: time.Duration(cfg.TLS.ReloadInterval),
+			ClientCAFile:   cfg.TLS.ClientCAFile,
+			ClientAuth:     cfg.TLS.ClientAuth,
+		})
+		if err != nil {
+			logger.Error("configuring TLS", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		httpServer.TLSConfig = tlsConfig
+	}
+
+	/*
+	the receipts e-mailed to the -maildir are ingested into the -mail-tenant, see the email package,
+	the scans stop before the stores are closed on shutdown
+	*/
+	if cfg.Mail.Maildir != "" {
+		ingester := &email.Ingester{Receipts: tenants.For(cfg.Mail.Tenant).Receipts, ParseUnmatched: cfg.Mail.ParseUnmatched}
+		if cfg.Mail.TemplatesFile != "" {
+			templates, err := email.LoadTemplates(cfg.Mail.TemplatesFile)
+			if err != nil {
+				logger.Error("loading the email templates", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			ingester.Templates = templates
+		}
+		maildir := &email.Maildir{Dir: cfg.Mail.Maildir, Interval: time.Duration(cfg.Mail.PollInterval), Ingester: ingester, Logger: logger}
+		stopMaildir, err := maildir.Start()
+		if err != nil {
+			logger.Error("watching the maildir", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		shutdown.Close = append([]func(ctx context.Context) error{stopMaildir}, shutdown.Close...)
+	}
+
+	/*
+	the gRPC API of the receipts on -grpc-addr, see proto/receipt/v1/receipt.proto
+	the calls are authenticated, scoped, counted against the daily quota and given a tenant like the /receipts routes,
+	the server shares the TLS config of the HTTP server and its calls in flight are drained after the HTTP requests
+	*/
+	if cfg.Server.GRPCAddr != "" {
+		interceptor := &grpcapi.Interceptor{Logger: logger}
+		if cfg.Auth.Required {
+			interceptor.Authenticator = &authenticator
+		}
+		grpcServer := grpcapi.New(&grpcapi.ReceiptServer{Tenants: &tenants, APIKeys: &apiKeyService}, interceptor, httpServer.TLSConfig)
+		listener, err := net.Listen("tcp", cfg.Server.GRPCAddr)
+		if err != nil {
+			logger.Error("listening for gRPC", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Error("serving gRPC", slog.String("error", err.Error()))
+				stop()
+			}
+		}()
+		shutdown.Close = append([]func(ctx context.Context) error{grpcapi.Stop(grpcServer)}, shutdown.Close...)
+	}
+	if err := httpserver.ListenAndRun(ctx, httpServer, shutdown); err != nil {
+		logger.Error("serving", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+}
+
+/*
+newStores returns the store shared by all tenants and the function creating the store of a tenant, for the backend of the configuration
+every store is instrumented so its latencies show up in /metrics, and the operations of the stores of the tenants are traced
+*/
+func newStores(store config.Store) (*metrics.InstrumentedAPIKeyStore, func(string) db.TenantStore, error) {
+	switch store.Backend {
+	case config.MemoryBackend:
+		return metrics.InstrumentAPIKeyStore(db.NewInMemoryDB()), func(string) db.TenantStore {
+			return tracing.TraceStore(metrics.InstrumentStore(db.NewInMemoryDB()))
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown store backend %q", store.Backend)
+	}
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/formats"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+)
+
+/*
+parse-receipt reads receipts from text, like POST /receipts/process-text, without a server
+
+	go run ./cmd/parse-receipt receipt.txt
+	pdftotext scan.pdf - | go run ./cmd/parse-receipt
+
+prints the receipt, the confidence of its fields and the lines it did not understand as JSON,
+and with -validate exits with 1 when the receipt would be rejected, printing the failed validations
+*/
+
+var validate = flag.Bool("validate", false, "validate the receipt like the server and exit with 1 if it is invalid")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: parse-receipt [-validate] [FILE]")
+		fmt.Fprintln(os.Stderr, "the receipt text is read from standard input when no FILE is given")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "parse-receipt:", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string) error {
+	input := io.Reader(os.Stdin)
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	text, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+
+	parsed := formats.ParseReceiptText(string(text))
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(parsed); err != nil {
+		return err
+	}
+	if *validate {
+		if err := validators.NewValidator().Struct(parsed.Receipt); err != nil {
+			return fmt.Errorf("the receipt is invalid: %w", err)
+		}
+	}
+	return nil
+}
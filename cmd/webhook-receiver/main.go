@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/webhooks"
+)
+
+/*
+webhook-receiver receives the events of a webhook like a partner app would, to try the webhooks out without a partner
+
+	go run ./cmd/webhook-receiver -secret whsec_... -addr :8090
+
+register http://localhost:8090 as the URL of a webhook with its secret, every event it receives is verified
+and printed as a JSON line, with the id of the delivery it came with,
+and with -fail-first N the first N deliveries get 503 so the retries and the dead letters can be seen
+*/
+
+var (
+	addr      = flag.String("addr", ":8090", "address the receiver listens on")
+	secret    = flag.String("secret", os.Getenv("WEBHOOK_SECRET"), "secret of the webhook, from WEBHOOK_SECRET when not given")
+	failFirst = flag.Int("fail-first", 0, "deliveries answered with 503 before the events are received")
+)
+
+func main() {
+	flag.Parse()
+	if *secret == "" {
+		fmt.Fprintln(os.Stderr, "webhook-receiver: -secret or WEBHOOK_SECRET is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	receiver := &webhooks.Receiver{
+		Secret:    *secret,
+		FailFirst: *failFirst,
+		OnEvent: func(received webhooks.Received) {
+			encoder.Encode(received)
+		},
+	}
+	log.Printf("receiving webhook events on %s", *addr)
+	if err := http.ListenAndServe(*addr, receiver); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
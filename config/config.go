@@ -0,0 +1,556 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/httpserver"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+Config is the configuration of the server
+it is loaded from the defaults, the config file, the environment variables and the flags, see Load
+the config file is the JSON form of Config, e.g. {"server": {"addr": ":9090"}, "log": {"level": "debug"}}
+*/
+type Config struct {
+	Server   Server   `json:"server"`
+	Store    Store    `json:"store"`
+	Rules    Rules    `json:"rules"`
+	Auth     Auth     `json:"auth"`
+	Limits   Limits   `json:"limits"`
+	Log      Log      `json:"log"`
+	Tracing  Tracing  `json:"tracing"`
+	TLS      TLS      `json:"tls"`
+	Mail     Mail     `json:"mail"`
+	Jobs     Jobs     `json:"jobs"`
+	Webhooks Webhooks `json:"webhooks"`
+	Stream   Stream   `json:"stream"`
+}
+
+/*
+Server is the address, the timeouts and the proxies of the HTTP server
+GRPCAddr is the address the gRPC server listens on, the gRPC server is off when it is empty
+ShutdownDelay is how long /readyz fails before the server stops accepting requests on shutdown,
+ShutdownTimeout how long the requests in flight have to finish
+*/
+type Server struct {
+	Addr              string   `json:"addr"`
+	GRPCAddr          string   `json:"grpcAddr"`
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout"`
+	ReadTimeout       Duration `json:"readTimeout"`
+	WriteTimeout      Duration `json:"writeTimeout"`
+	IdleTimeout       Duration `json:"idleTimeout"`
+	ShutdownDelay     Duration `json:"shutdownDelay"`
+	ShutdownTimeout   Duration `json:"shutdownTimeout"`
+	TrustedProxies    List     `json:"trustedProxies"`
+}
+
+/*
+Store is where the receipts, the retailers and the API keys are kept
+Backend is one of Backends, only the memory store exists, it keeps nothing once the server stops
+*/
+type Store struct {
+	Backend string `json:"backend"`
+}
+
+// the store backends
+const (
+	MemoryBackend = "memory"
+)
+
+// Backends are the store backends that can be configured
+var Backends = []string{MemoryBackend}
+
+// Rules are the files the receipts are scored with, see services.LoadRuleSet, services.LoadTenantRules and services.LoadConversionTable
+type Rules struct {
+	File      string `json:"file"`
+	TenantDir string `json:"tenantDir"`
+	RatesFile string `json:"ratesFile"`
+}
+
+/*
+Auth is how the requests are authenticated
+Required turns the authentication of the /receipts endpoints on,
+AdminToken is the token of the admin endpoints, it is a secret so it has no flag, see Load
+*/
+type Auth struct {
+	Required   bool            `json:"required"`
+	AdminToken string          `json:"adminToken"`
+	JWT        auth.JWTOptions `json:"jwt"`
+}
+
+// Limits are the rate limits file and the daily quota of the API keys without their own quota, 0 for no quota
+type Limits struct {
+	RateLimitsFile string `json:"rateLimitsFile"`
+	DailyQuota     int    `json:"dailyQuota"`
+}
+
+// Log is the lowest level logged and whether the retailer names and item descriptions are redacted
+type Log struct {
+	Level  string `json:"level"`
+	Redact bool   `json:"redact"`
+}
+
+// Tracing is the file the spans are written to, - for stdout, no tracing when empty
+type Tracing struct {
+	File string `json:"file"`
+}
+
+/*
+TLS is the certificate and its key the server serves HTTPS with, plain HTTP when both are empty
+the files are checked for a rotated certificate every ReloadInterval
+ClientAuth is none, optional or require, the client certificates are verified with the CAs of ClientCAFile
+and mapped to partners with PartnersFile, see auth.LoadPartners
+*/
+type TLS struct {
+	CertFile       string   `json:"certFile"`
+	KeyFile        string   `json:"keyFile"`
+	ReloadInterval Duration `json:"reloadInterval"`
+	ClientAuth     string   `json:"clientAuth"`
+	ClientCAFile   string   `json:"clientCaFile"`
+	PartnersFile   string   `json:"partnersFile"`
+}
+
+/*
+Mail is the maildir the e-mailed receipts are ingested from, no e-mail is ingested when Maildir is empty, see the email package
+the messages are read with the retailer templates of TemplatesFile, and like text receipts when ParseUnmatched is set and none matches,
+their receipts belong to Tenant
+*/
+type Mail struct {
+	Maildir        string   `json:"maildir"`
+	PollInterval   Duration `json:"pollInterval"`
+	TemplatesFile  string   `json:"templatesFile"`
+	ParseUnmatched bool     `json:"parseUnmatched"`
+	Tenant         string   `json:"tenant"`
+}
+
+/*
+Jobs are the workers running the requests sent with Prefer: respond-async and the jobs waiting for them,
+the requests get 503 once QueueSize jobs are waiting, see services.JobQueue
+*/
+type Jobs struct {
+	Workers   int `json:"workers"`
+	QueueSize int `json:"queueSize"`
+}
+
+/*
+Webhooks are the workers posting the events to the webhooks and how the failed deliveries are retried,
+after Backoff, doubled after every attempt up to MaxBackoff, until MaxAttempts attempts failed, see services.WebhookDispatcher
+QueueSize is how many attempts may wait for the workers, a delivery is a dead letter when its attempt finds the queue full
+Timeout is the time a webhook has to answer an attempt
+AllowPrivate lets the events be posted to loopback and private addresses, for local development, see services.NewWebhookClient
+*/
+type Webhooks struct {
+	Workers      int      `json:"workers"`
+	QueueSize    int      `json:"queueSize"`
+	MaxAttempts  int      `json:"maxAttempts"`
+	Backoff      Duration `json:"backoff"`
+	MaxBackoff   Duration `json:"maxBackoff"`
+	Timeout      Duration `json:"timeout"`
+	AllowPrivate bool     `json:"allowPrivate"`
+}
+
+/*
+Stream is the feed of the receipts scored pushed on GET /receipts/stream, see services.ReceiptFeed
+the last BufferSize receipts are kept for the streams resuming with Last-Event-ID,
+a stream is disconnected once SubscriberBuffer receipts are waiting to be written to it,
+Heartbeat is the time between the comments written to an idle stream, shorter than server.writeTimeout
+*/
+type Stream struct {
+	BufferSize       int      `json:"bufferSize"`
+	SubscriberBuffer int      `json:"subscriberBuffer"`
+	Heartbeat        Duration `json:"heartbeat"`
+}
+
+// ClientAuthModes are the client authentication modes of TLS
+var ClientAuthModes = []string{httpserver.ClientAuthNone, httpserver.ClientAuthOptional, httpserver.ClientAuthRequire}
+
+// Enabled reports whether the server serves HTTPS
+func (tls TLS) Enabled() bool {
+	return tls.CertFile != "" || tls.KeyFile != ""
+}
+
+// Default returns the configuration used for what is not set by the config file, the environment or the flags
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			GRPCAddr:          ":9090",
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(15 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(120 * time.Second),
+			ShutdownTimeout:   Duration(25 * time.Second),
+		},
+		Store: Store{Backend: MemoryBackend},
+		TLS:   TLS{ReloadInterval: Duration(10 * time.Second), ClientAuth: httpserver.ClientAuthNone},
+		Auth:  Auth{Required: true},
+		Log:   Log{Level: "info", Redact: true},
+		Mail:  Mail{PollInterval: Duration(10 * time.Second), Tenant: models.DefaultTenant},
+		Jobs:  Jobs{Workers: 4, QueueSize: 100},
+		Webhooks: Webhooks{
+			Workers:     4,
+			QueueSize:   1000,
+			MaxAttempts: 8,
+			Backoff:     Duration(5 * time.Second),
+			MaxBackoff:  Duration(time.Hour),
+			Timeout:     Duration(10 * time.Second),
+		},
+		Stream: Stream{BufferSize: 1000, SubscriberBuffer: 64, Heartbeat: Duration(15 * time.Second)},
+	}
+}
+
+/*
+EnvPrefix is the prefix of the environment variables, every flag has one,
+the flag name in upper case with - replaced by _, e.g. RECEIPT_PROCESSOR_LOG_LEVEL for -log-level
+*/
+const EnvPrefix = "RECEIPT_PROCESSOR_"
+
+// AdminTokenEnv is the environment variable of the admin token, it is kept out of the flags so it does not show up in the process list
+const AdminTokenEnv = "ADMIN_TOKEN"
+
+// EnvName returns the environment variable of a flag
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// bind defines the flags of the configuration, the defaults of the flags are the values of the configuration
+func bind(flags *flag.FlagSet, cfg *Config) {
+	flags.StringVar(&cfg.Server.Addr, "addr", cfg.Server.Addr, "address the server listens on")
+	flags.StringVar(&cfg.Server.GRPCAddr, "grpc-addr", cfg.Server.GRPCAddr, "address the gRPC server listens on, no gRPC server when empty")
+	flags.DurationVar((*time.Duration)(&cfg.Server.ReadHeaderTimeout), "read-header-timeout", time.Duration(cfg.Server.ReadHeaderTimeout), "time a client has to send the request headers")
+	flags.DurationVar((*time.Duration)(&cfg.Server.ReadTimeout), "read-timeout", time.Duration(cfg.Server.ReadTimeout), "time a client has to send the whole request")
+	flags.DurationVar((*time.Duration)(&cfg.Server.WriteTimeout), "write-timeout", time.Duration(cfg.Server.WriteTimeout), "time a request has to be handled and its response written")
+	flags.DurationVar((*time.Duration)(&cfg.Server.IdleTimeout), "idle-timeout", time.Duration(cfg.Server.IdleTimeout), "time an idle keep-alive connection is kept open")
+	flags.DurationVar((*time.Duration)(&cfg.Server.ShutdownDelay), "shutdown-delay", time.Duration(cfg.Server.ShutdownDelay), "time /readyz fails before the server stops accepting requests on shutdown")
+	flags.DurationVar((*time.Duration)(&cfg.Server.ShutdownTimeout), "shutdown-timeout", time.Duration(cfg.Server.ShutdownTimeout), "time the requests in flight have to finish on shutdown")
+	flags.Var(&cfg.Server.TrustedProxies, "trusted-proxies", "comma separated IPs or CIDRs of the proxies in front of the server, none when empty")
+
+	flags.StringVar(&cfg.Store.Backend, "store", cfg.Store.Backend, "store backend, one of "+strings.Join(Backends, ", "))
+
+	flags.StringVar(&cfg.Rules.File, "rules", cfg.Rules.File, "path to the rules file, no categories or bonuses are used when empty")
+	flags.StringVar(&cfg.Rules.TenantDir, "tenant-rules", cfg.Rules.TenantDir, "directory with a <tenant>.json rules file per tenant, replacing -rules for that tenant")
+	flags.StringVar(&cfg.Rules.RatesFile, "rates", cfg.Rules.RatesFile, "path to the currency conversion table, only USD totals earn the total based points when empty")
+
+	flags.BoolVar(&cfg.Auth.Required, "auth", cfg.Auth.Required, "require an API key or a bearer token on the /receipts endpoints")
+	flags.StringVar(&cfg.Auth.JWT.HMACSecretFile, "jwt-hmac-secret-file", cfg.Auth.JWT.HMACSecretFile, "file with the HS256 secret of bearer tokens")
+	flags.StringVar(&cfg.Auth.JWT.RSAPublicKeyFile, "jwt-rsa-public-key-file", cfg.Auth.JWT.RSAPublicKeyFile, "PEM file with the RS256 public key of bearer tokens")
+	flags.StringVar(&cfg.Auth.JWT.JWKSFile, "jwt-jwks-file", cfg.Auth.JWT.JWKSFile, "JSON Web Key Set file with the keys of bearer tokens")
+	flags.StringVar(&cfg.Auth.JWT.Issuer, "jwt-issuer", cfg.Auth.JWT.Issuer, "required issuer of bearer tokens")
+	flags.StringVar(&cfg.Auth.JWT.Audience, "jwt-audience", cfg.Auth.JWT.Audience, "required audience of bearer tokens")
+
+	flags.StringVar(&cfg.Limits.RateLimitsFile, "rate-limits", cfg.Limits.RateLimitsFile, "path to the rate limits file, requests are not rate limited when empty")
+	flags.IntVar(&cfg.Limits.DailyQuota, "daily-quota", cfg.Limits.DailyQuota, "receipts an API key without its own quota submits per UTC day, 0 for no quota")
+
+	flags.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "lowest level logged, debug, info, warn or error")
+	flags.BoolVar(&cfg.Log.Redact, "log-redact", cfg.Log.Redact, "replace retailer names and item descriptions in the logs with [REDACTED]")
+
+	flags.StringVar(&cfg.Tracing.File, "trace-file", cfg.Tracing.File, "file the OpenTelemetry spans are written to as JSON, - for stdout, no tracing when empty")
+
+	flags.StringVar(&cfg.TLS.CertFile, "tls-cert-file", cfg.TLS.CertFile, "PEM file with the certificate of the server, plain HTTP when empty")
+	flags.StringVar(&cfg.TLS.KeyFile, "tls-key-file", cfg.TLS.KeyFile, "PEM file with the private key of the certificate")
+	flags.DurationVar((*time.Duration)(&cfg.TLS.ReloadInterval), "tls-reload-interval", time.Duration(cfg.TLS.ReloadInterval), "time between the checks for a rotated certificate")
+	flags.StringVar(&cfg.TLS.ClientAuth, "tls-client-auth", cfg.TLS.ClientAuth, "client certificates, one of "+strings.Join(ClientAuthModes, ", "))
+	flags.StringVar(&cfg.TLS.ClientCAFile, "tls-client-ca-file", cfg.TLS.ClientCAFile, "PEM file with the CAs client certificates are verified with")
+	flags.StringVar(&cfg.TLS.PartnersFile, "tls-partners-file", cfg.TLS.PartnersFile, "JSON file mapping the subjects of client certificates to partners")
+
+	flags.StringVar(&cfg.Mail.Maildir, "maildir", cfg.Mail.Maildir, "maildir the e-mailed receipts are ingested from, no e-mail is ingested when empty")
+	flags.DurationVar((*time.Duration)(&cfg.Mail.PollInterval), "mail-poll-interval", time.Duration(cfg.Mail.PollInterval), "time between the scans of the maildir")
+	flags.StringVar(&cfg.Mail.TemplatesFile, "mail-templates", cfg.Mail.TemplatesFile, "path to the retailer templates the e-mailed receipts are read with")
+	flags.BoolVar(&cfg.Mail.ParseUnmatched, "mail-parse-unmatched", cfg.Mail.ParseUnmatched, "read the e-mails no template matches like text receipts instead of rejecting them")
+	flags.StringVar(&cfg.Mail.Tenant, "mail-tenant", cfg.Mail.Tenant, "tenant the e-mailed receipts belong to")
+
+	flags.IntVar(&cfg.Jobs.Workers, "job-workers", cfg.Jobs.Workers, "jobs run at the same time for the requests sent with Prefer: respond-async")
+	flags.IntVar(&cfg.Jobs.QueueSize, "job-queue-size", cfg.Jobs.QueueSize, "jobs waiting for a worker before the requests get 503")
+
+	flags.IntVar(&cfg.Webhooks.Workers, "webhook-workers", cfg.Webhooks.Workers, "events posted to the webhooks at the same time")
+	flags.IntVar(&cfg.Webhooks.QueueSize, "webhook-queue-size", cfg.Webhooks.QueueSize, "attempts waiting for a worker before the deliveries are dead letters")
+	flags.IntVar(&cfg.Webhooks.MaxAttempts, "webhook-max-attempts", cfg.Webhooks.MaxAttempts, "attempts of a delivery before it is a dead letter")
+	flags.DurationVar((*time.Duration)(&cfg.Webhooks.Backoff), "webhook-backoff", time.Duration(cfg.Webhooks.Backoff), "time before the first retry of a delivery, doubled after every retry")
+	flags.DurationVar((*time.Duration)(&cfg.Webhooks.MaxBackoff), "webhook-max-backoff", time.Duration(cfg.Webhooks.MaxBackoff), "longest time between two attempts of a delivery")
+	flags.DurationVar((*time.Duration)(&cfg.Webhooks.Timeout), "webhook-timeout", time.Duration(cfg.Webhooks.Timeout), "time a webhook has to answer an attempt")
+	flags.BoolVar(&cfg.Webhooks.AllowPrivate, "webhook-allow-private", cfg.Webhooks.AllowPrivate, "post the events to loopback and private addresses too, for local development only")
+
+	flags.IntVar(&cfg.Stream.BufferSize, "stream-buffer-size", cfg.Stream.BufferSize, "receipts kept for the streams resuming with Last-Event-ID")
+	flags.IntVar(&cfg.Stream.SubscriberBuffer, "stream-subscriber-buffer", cfg.Stream.SubscriberBuffer, "receipts waiting to be written to a stream before it is disconnected")
+	flags.DurationVar((*time.Duration)(&cfg.Stream.Heartbeat), "stream-heartbeat", time.Duration(cfg.Stream.Heartbeat), "time between the comments written to an idle stream")
+}
+
+/*
+Options are what the command line asks for besides the configuration
+ConfigFile is the config file, from -config or RECEIPT_PROCESSOR_CONFIG, PrintConfig asks to print the configuration and exit
+*/
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+/*
+Load is a function that loads the configuration, what is set later overrides what is set earlier:
+1. the defaults, see Default
+2. the config file given with -config or RECEIPT_PROCESSOR_CONFIG
+3. the environment variables, see EnvName, and ADMIN_TOKEN for the admin token
+4. the flags in args
+lookupEnv is os.LookupEnv outside of tests
+returns an error if a flag, an environment variable or the config file cannot be parsed, the configuration is not validated, see Validate
+*/
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, Options, error) {
+	cfg := Default()
+	var options Options
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	bind(flags, &cfg)
+	flags.StringVar(&options.ConfigFile, "config", "", "path to the JSON config file, see the README")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print the configuration with the secrets masked and exit")
+	if err := flags.Parse(args); err != nil {
+		return nil, options, err
+	}
+	if flags.NArg() > 0 {
+		return nil, options, fmt.Errorf("unexpected argument %s", flags.Arg(0))
+	}
+
+	// the flags are applied again last, so the values they were given are kept
+	given := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+	cfg = Default()
+
+	if options.ConfigFile == "" {
+		options.ConfigFile, _ = lookupEnv(EnvName("config"))
+	}
+	if options.ConfigFile != "" {
+		if err := loadFile(options.ConfigFile, &cfg); err != nil {
+			return nil, options, err
+		}
+	}
+
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		if value, ok := lookupEnv(EnvName(f.Name)); ok {
+			if err := flags.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", value, EnvName(f.Name), err))
+			}
+		}
+	})
+	if value, ok := lookupEnv(AdminTokenEnv); ok {
+		cfg.Auth.AdminToken = value
+	}
+	if len(errs) > 0 {
+		return nil, options, errors.Join(errs...)
+	}
+
+	for name, value := range given {
+		if err := flags.Set(name, value); err != nil {
+			return nil, options, fmt.Errorf("invalid value %q for flag -%s: %w", value, name, err)
+		}
+	}
+	return &cfg, options, nil
+}
+
+// loadFile reads the config file over the configuration, unknown fields are rejected so a typo does not go unnoticed
+func loadFile(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening the config file: %w", err)
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parsing the config file %s: %w", path, err)
+	}
+	return nil
+}
+
+/*
+Validate is a function that checks the configuration before the server starts
+returns every problem found, each prefixed with the field of the config file it is about
+*/
+func (cfg Config) Validate() error {
+	var errs []error
+	invalid := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Server.Addr); err != nil {
+		invalid("server.addr", "%q is not a host:port address", cfg.Server.Addr)
+	}
+	if cfg.Server.GRPCAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.Server.GRPCAddr); err != nil {
+			invalid("server.grpcAddr", "%q is not a host:port address", cfg.Server.GRPCAddr)
+		} else if cfg.Server.GRPCAddr == cfg.Server.Addr {
+			invalid("server.grpcAddr", "must differ from server.addr")
+		}
+	}
+	timeouts := []struct {
+		field string
+		value Duration
+	}{
+		{"server.readHeaderTimeout", cfg.Server.ReadHeaderTimeout},
+		{"server.readTimeout", cfg.Server.ReadTimeout},
+		{"server.writeTimeout", cfg.Server.WriteTimeout},
+		{"server.idleTimeout", cfg.Server.IdleTimeout},
+		{"server.shutdownDelay", cfg.Server.ShutdownDelay},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			invalid(timeout.field, "must not be negative")
+		}
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdownTimeout", "must be positive")
+	}
+	for _, proxy := range cfg.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				invalid("server.trustedProxies", "%q is neither an IP nor a CIDR", proxy)
+			}
+		}
+	}
+
+	if cfg.Store.Backend != MemoryBackend {
+		invalid("store.backend", "%q is not one of %s", cfg.Store.Backend, strings.Join(Backends, ", "))
+	}
+
+	if cfg.Limits.DailyQuota < 0 {
+		invalid("limits.dailyQuota", "must not be negative")
+	}
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		invalid("log.level", "%v", err)
+	}
+	if cfg.TLS.CertFile == "" && cfg.TLS.KeyFile != "" {
+		invalid("tls.certFile", "is required with tls.keyFile")
+	}
+	if cfg.TLS.KeyFile == "" && cfg.TLS.CertFile != "" {
+		invalid("tls.keyFile", "is required with tls.certFile")
+	}
+	if cfg.TLS.ReloadInterval < 0 {
+		invalid("tls.reloadInterval", "must not be negative")
+	}
+	switch cfg.TLS.ClientAuth {
+	case httpserver.ClientAuthNone:
+		if cfg.TLS.PartnersFile != "" {
+			invalid("tls.partnersFile", "needs client certificates, set tls.clientAuth to optional or require")
+		}
+	case httpserver.ClientAuthOptional, httpserver.ClientAuthRequire:
+		if !cfg.TLS.Enabled() {
+			invalid("tls.clientAuth", "needs HTTPS, set tls.certFile and tls.keyFile")
+		}
+		if cfg.TLS.ClientCAFile == "" {
+			invalid("tls.clientCaFile", "is required when tls.clientAuth is %s", cfg.TLS.ClientAuth)
+		}
+	default:
+		invalid("tls.clientAuth", "%q is not one of %s", cfg.TLS.ClientAuth, strings.Join(ClientAuthModes, ", "))
+	}
+	if cfg.Mail.Maildir != "" {
+		if cfg.Mail.PollInterval <= 0 {
+			invalid("mail.pollInterval", "must be positive")
+		}
+		if cfg.Mail.TemplatesFile == "" && !cfg.Mail.ParseUnmatched {
+			invalid("mail.templatesFile", "is required with mail.maildir unless mail.parseUnmatched is set")
+		}
+		if !models.ValidTenantID(cfg.Mail.Tenant) {
+			invalid("mail.tenant", "%q is not a tenant id", cfg.Mail.Tenant)
+		}
+	}
+	if cfg.Jobs.Workers < 1 {
+		invalid("jobs.workers", "must be at least 1")
+	}
+	if cfg.Jobs.QueueSize < 1 {
+		invalid("jobs.queueSize", "must be at least 1")
+	}
+	if cfg.Webhooks.Workers < 1 {
+		invalid("webhooks.workers", "must be at least 1")
+	}
+	if cfg.Webhooks.QueueSize < 1 {
+		invalid("webhooks.queueSize", "must be at least 1")
+	}
+	if cfg.Webhooks.MaxAttempts < 1 {
+		invalid("webhooks.maxAttempts", "must be at least 1")
+	}
+	if cfg.Webhooks.Backoff <= 0 {
+		invalid("webhooks.backoff", "must be positive")
+	}
+	if cfg.Webhooks.MaxBackoff < cfg.Webhooks.Backoff {
+		invalid("webhooks.maxBackoff", "must not be shorter than webhooks.backoff")
+	}
+	if cfg.Webhooks.Timeout <= 0 {
+		invalid("webhooks.timeout", "must be positive")
+	}
+	if cfg.Stream.BufferSize < 1 {
+		invalid("stream.bufferSize", "must be at least 1")
+	}
+	if cfg.Stream.SubscriberBuffer < 1 {
+		invalid("stream.subscriberBuffer", "must be at least 1")
+	}
+	if cfg.Stream.Heartbeat <= 0 {
+		invalid("stream.heartbeat", "must be positive")
+	}
+	if cfg.Server.WriteTimeout > 0 && cfg.Stream.Heartbeat >= cfg.Server.WriteTimeout {
+		invalid("stream.heartbeat", "must be shorter than server.writeTimeout")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Masked returns the configuration with the secrets replaced by [REDACTED], to be printed
+func (cfg Config) Masked() Config {
+	if cfg.Auth.AdminToken != "" {
+		cfg.Auth.AdminToken = logging.Redacted
+	}
+	return cfg
+}
+
+/*
+Duration is a time.Duration written as a string in the config file, e.g. "30s"
+*/
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+/*
+List is a list of strings, comma separated in a flag or an environment variable
+*/
+type List []string
+
+func (list *List) String() string {
+	if list == nil {
+		return ""
+	}
+	return strings.Join(*list, ",")
+}
+
+func (list *List) Set(value string) error {
+	*list = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*list = append(*list, item)
+		}
+	}
+	return nil
+}
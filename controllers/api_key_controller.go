@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+)
+
+/*
+APIKeyController is a struct that contains the APIKeyService
+it exposes the admin endpoints used by the admin CLI to create and revoke API keys
+*/
+type APIKeyController struct {
+	APIKeyService services.APIKeyService
+}
+
+/*
+CreateAPIKey is a function that creates an API key and returns it
+name 							-> must be present and should be a valid name of the form ^[\\w\\s\\-&]+$
+tenant 							-> optional, defaults to "default", should be a valid tenant id of the form ^[a-z0-9][a-z0-9_-]{0,62}$
+dailyQuota 						-> optional, the receipts the key submits per UTC day, defaults to the quota of the server
+the key is only returned in this response, only its hash is stored
+if the body is invalid, returns 400
+*/
+func (controller *APIKeyController) CreateAPIKey(c *gin.Context) {
+	var request models.APIKey
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The API key is invalid"})
+		return
+	}
+	if request.TenantID == "" {
+		request.TenantID = models.DefaultTenant
+	}
+	if tenantID := principalTenant(c); tenantID != "" && tenantID != request.TenantID {
+		c.JSON(http.StatusForbidden, gin.H{"description": "The credentials do not belong to that tenant"})
+		return
+	}
+	if err := validators.NewValidator().Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The API key is invalid"})
+		return
+	}
+
+	apiKey, key, err := controller.APIKeyService.CreateAPIKey(request.Name, request.TenantID, request.DailyQuota)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"description": "The API key could not be created"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":     apiKey.ID,
+		"name":   apiKey.Name,
+		"tenant": apiKey.TenantID,
+		"key":    key,
+	})
+}
+
+// GetAllAPIKeys is a function that returns every API key of the tenants the caller manages, without the keys themselves
+func (controller *APIKeyController) GetAllAPIKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"apiKeys": controller.manageableKeys(c),
+	})
+}
+
+/*
+RevokeAPIKey is a function that revokes the API key for the id
+if the API key is not found, returns 404
+*/
+func (controller *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	manageable := false
+	for _, apiKey := range controller.manageableKeys(c) {
+		manageable = manageable || apiKey.ID == id
+	}
+	if !manageable || !controller.APIKeyService.RevokeAPIKey(id) {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No API key found for that id"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// manageableKeys returns the API keys the caller manages, the keys of its tenant or every key for the admin token
+func (controller *APIKeyController) manageableKeys(c *gin.Context) []models.APIKey {
+	apiKeys := controller.APIKeyService.GetAllAPIKeys()
+	tenantID := principalTenant(c)
+	if tenantID == "" {
+		return apiKeys
+	}
+
+	tenantKeys := []models.APIKey{}
+	for _, apiKey := range apiKeys {
+		if apiKey.TenantID == tenantID {
+			tenantKeys = append(tenantKeys, apiKey)
+		}
+	}
+	return tenantKeys
+}
+
+// principalTenant returns the tenant of the credentials of the request, empty when they are not bound to one
+func principalTenant(c *gin.Context) string {
+	if principal := middleware.CurrentPrincipal(c); principal != nil {
+		return principal.TenantID
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/formats"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+// responseFormats are the media types of the responses of the receipt routes, JSON first for the requests without an Accept header
+var responseFormats = []string{
+	binding.MIMEJSON, binding.MIMEXML, binding.MIMEXML2, formats.CSV, binding.MIMEMSGPACK, binding.MIMEMSGPACK2,
+}
+
+// receiptID and receiptPoints are the responses of ProcessReceipt and GetReceiptPoints, their XML element is receipt
+type receiptID struct {
+	XMLName xml.Name `json:"-" xml:"receipt"`
+	ID      string   `json:"id" xml:"id"`
+}
+
+type receiptPoints struct {
+	XMLName xml.Name `json:"-" xml:"receipt"`
+	Points  int64    `json:"points" xml:"points"`
+}
+
+/*
+bindReceipt binds the body of the request to the receipt in the format of its Content-Type,
+application/xml or text/xml, text/csv (see formats.ReadReceiptCSV), and JSON for any other
+returns the name of the format, for the metrics and the logs, and the error if the body is not a receipt
+*/
+func bindReceipt(c *gin.Context, receipt *models.Receipt) (string, error) {
+	switch c.ContentType() {
+	case binding.MIMEXML, binding.MIMEXML2:
+		return "xml", c.ShouldBindXML(receipt)
+	case formats.CSV:
+		parsed, err := formats.ReadReceiptCSV(c.Request.Body)
+		if err != nil {
+			return "csv", err
+		}
+		*receipt = *parsed
+		return "csv", nil
+	default:
+		return "json", c.ShouldBindJSON(receipt)
+	}
+}
+
+/*
+negotiate writes the response in the format the Accept header of the request prefers, JSON, XML, CSV or MessagePack
+JSON when the request has no Accept header, writeCSV writes the value as CSV
+returns 406 when the request accepts none of them
+*/
+func negotiate(c *gin.Context, code int, value any, writeCSV func(w io.Writer) error) {
+	switch c.NegotiateFormat(responseFormats...) {
+	case binding.MIMEJSON:
+		c.JSON(code, value)
+	case binding.MIMEXML, binding.MIMEXML2:
+		c.XML(code, value)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		c.Render(code, render.MsgPack{Data: value})
+	case formats.CSV:
+		var body bytes.Buffer
+		if err := writeCSV(&body); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"description": "The response could not be written as CSV"})
+			return
+		}
+		c.Data(code, formats.CSV+"; charset=utf-8", body.Bytes())
+	default:
+		c.JSON(http.StatusNotAcceptable, gin.H{"description": "The response can only be JSON, XML, CSV or MessagePack"})
+	}
+}
+
+// csvRecords returns the writer of the records as CSV, the header first
+func csvRecords(records ...[]string) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		return csv.NewWriter(w).WriteAll(records)
+	}
+}
@@ -0,0 +1,478 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/graphql"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// the limits of the receipts query, like the page sizes of the gRPC API
+const (
+	DefaultReceiptsFirst = 100
+	MaxReceiptsFirst     = 1000
+	// MaxQueryDepth is the deepest a GraphQL query may nest, so member { receipts { member { ... } } } stays bounded
+	MaxQueryDepth = 10
+	// MaxQueryBytes is the longest body of a POST and the longest query parameter of a GET that Query reads
+	MaxQueryBytes = 64 << 10
+)
+
+/*
+GraphQLController is a struct that contains the services of the GraphQL API
+the receipts, their items and points breakdown and the members are read through the ReceiptService,
+the receipts of a level of the query are looked up together, so a query reads the store once per level and not once per receipt
+when Tenants is set, the ReceiptService of the tenant of the request is used instead
+APIKeys counts the receipts processed with an API key against its daily quota, no quota is counted when it is nil
+*/
+type GraphQLController struct {
+	ReceiptService services.ReceiptService
+	Tenants        services.TenantRegistry
+	APIKeys        services.APIKeyService
+
+	once   sync.Once
+	schema *graphql.Schema
+}
+
+// graphQLRequestKey is the key of the request in the context of the resolvers
+type graphQLRequestKey struct{}
+
+// graphQLRequest is what the resolvers need of the HTTP request, the gin context and the ReceiptService of its tenant
+type graphQLRequest struct {
+	c       *gin.Context
+	service services.ReceiptService
+}
+
+func currentRequest(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLRequestKey{}).(*graphQLRequest)
+}
+
+// authorize returns an error when the credentials of the request lack the scope, every scope is granted when -auth=false
+func (request *graphQLRequest) authorize(scope string) error {
+	if principal := middleware.CurrentPrincipal(request.c); principal != nil && !principal.HasScope(scope) {
+		return errors.New("The " + scope + " scope is required")
+	}
+	return nil
+}
+
+/*
+Query is a function that executes a GraphQL request
+POST takes the request as JSON, {"query": ..., "variables": {...}, "operationName": ...},
+GET takes it in the query, variables and operationName query parameters, and only runs queries
+the result is returned with 200, with the errors of the request or of its fields in errors
+the queries need receipts:read and the processReceipt mutation receipts:write
+if the request is not a GraphQL request, returns 400, and a mutation sent with GET returns 405
+if the body or the query parameter is longer than MaxQueryBytes, returns 413
+if the tenant of a query is not known, returns 404, see services.Tenants.Known
+*/
+func (controller *GraphQLController) Query(c *gin.Context) {
+	ctx, span := tracing.Start(c.Request.Context(), "GraphQLController.Query")
+	defer span.End()
+
+	var request graphql.Request
+	if c.Request.Method == http.MethodGet {
+		if len(c.Query("query")) > MaxQueryBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"description": "The GraphQL request is too long"})
+			return
+		}
+		request.Query = c.Query("query")
+		request.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"description": "The GraphQL request is invalid"})
+				return
+			}
+		}
+	} else {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxQueryBytes)
+		if err := c.ShouldBindJSON(&request); err != nil {
+			var tooLong *http.MaxBytesError
+			if errors.As(err, &tooLong) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"description": "The GraphQL request is too long"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"description": "The GraphQL request is invalid"})
+			return
+		}
+	}
+	if request.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The GraphQL request is invalid"})
+		return
+	}
+
+	operation, errs := controller.graphQLSchema().Prepare(request)
+	if errs != nil {
+		c.JSON(http.StatusOK, graphql.Response{Errors: errs})
+		return
+	}
+	if operation.Kind == "mutation" && c.Request.Method == http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"description": "Mutations are only allowed in POST requests"})
+		return
+	}
+	span.SetAttributes(attribute.String("graphql.operation", operation.Kind))
+	service := controller.ReceiptService
+	if controller.Tenants != nil {
+		// the queries are reads, they do not create the tenant, see middleware.KnownTenant
+		if operation.Kind != "mutation" && !controller.Tenants.Known(middleware.TenantID(c)) {
+			c.JSON(http.StatusNotFound, gin.H{"description": "No tenant found for that ID"})
+			return
+		}
+		service = controller.Tenants.For(middleware.TenantID(c)).Receipts
+	}
+	response := operation.Execute(context.WithValue(ctx, graphQLRequestKey{}, &graphQLRequest{c: c, service: service}))
+	c.JSON(http.StatusOK, response)
+}
+
+// Schema is a function that returns the schema of the GraphQL API in the schema definition language
+func (controller *GraphQLController) Schema(c *gin.Context) {
+	c.String(http.StatusOK, controller.graphQLSchema().String())
+}
+
+/*
+member is a member of the Member type, the receipts of a member are its receipts the caller may read
+members have no record of their own, they are the memberId of the receipts
+*/
+type member struct {
+	id       string
+	receipts []*models.Receipt
+}
+
+// graphQLSchema returns the schema, it is built once and panics if it is invalid, like openapi.Handler
+func (controller *GraphQLController) graphQLSchema() *graphql.Schema {
+	controller.once.Do(func() {
+		schema, err := newGraphQLSchema(controller)
+		if err != nil {
+			panic(err)
+		}
+		schema.MaxDepth = MaxQueryDepth
+		controller.schema = schema
+	})
+	return controller.schema
+}
+
+func newGraphQLSchema(controller *GraphQLController) (*graphql.Schema, error) {
+	receipt := func(source any) *models.Receipt { return source.(*models.Receipt) }
+	text := func(value string) any {
+		if value == "" {
+			return nil
+		}
+		return value
+	}
+	instant := func(value *time.Time) any {
+		if value == nil {
+			return nil
+		}
+		return value.Format(time.RFC3339Nano)
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: []*graphql.Field{
+			{
+				Name: "receipt", Type: "Receipt", Description: "the processed receipt of the id, null when there is none",
+				Args:    []*graphql.Arg{{Name: "id", Type: "ID!"}},
+				Resolve: controller.resolveReceipt,
+			},
+			{
+				Name: "receipts", Type: "[Receipt!]!",
+				Description: "the processed receipts of the ids, or the first receipts of the tenant, the oldest first",
+				Args: []*graphql.Arg{
+					{Name: "ids", Type: "[ID!]", Description: "the ids of the receipts, the unknown ids are left out"},
+					{Name: "memberId", Type: "ID", Description: "only the receipts of the member"},
+					{Name: "first", Type: "Int", Description: "the number of receipts, 100 by default and at most 1000"},
+				},
+				Resolve: controller.resolveReceipts,
+			},
+			{
+				Name: "member", Type: "Member", Description: "the member of the id, null when it has no receipts",
+				Args:    []*graphql.Arg{{Name: "id", Type: "ID!"}},
+				Resolve: controller.resolveMember,
+			},
+		},
+	}
+	mutation := &graphql.Object{
+		Name: "Mutation",
+		Fields: []*graphql.Field{
+			{
+				Name: "processReceipt", Type: "Receipt!",
+				Description: "processes the receipt like POST /receipts/process and returns it with its points",
+				Args:        []*graphql.Arg{{Name: "receipt", Type: "ReceiptInput!"}},
+				Resolve:     controller.processReceipt,
+			},
+		},
+	}
+
+	receiptType := &graphql.Object{
+		Name:        "Receipt",
+		Description: "a processed receipt, see GET /receipts/{id}",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: "ID!", Resolve: graphql.Each(func(source any) any { return receipt(source).ID })},
+			{Name: "retailer", Type: "String!", Resolve: graphql.Each(func(source any) any { return receipt(source).Retailer })},
+			{Name: "submittedRetailer", Type: "String", Resolve: graphql.Each(func(source any) any { return text(receipt(source).SubmittedRetailer) })},
+			{Name: "retailerId", Type: "ID", Resolve: graphql.Each(func(source any) any { return text(receipt(source).RetailerID) })},
+			{Name: "purchaseDate", Type: "String!", Resolve: graphql.Each(func(source any) any { return receipt(source).PurchaseDate })},
+			{Name: "purchaseTime", Type: "String!", Resolve: graphql.Each(func(source any) any { return receipt(source).PurchaseTime })},
+			{Name: "timezone", Type: "String", Resolve: graphql.Each(func(source any) any { return text(receipt(source).Timezone) })},
+			{Name: "purchasedAt", Type: "String", Resolve: graphql.Each(func(source any) any { return instant(receipt(source).PurchasedAt) })},
+			{Name: "createdAt", Type: "String", Resolve: graphql.Each(func(source any) any { return instant(receipt(source).CreatedAt) })},
+			{Name: "currency", Type: "String", Resolve: graphql.Each(func(source any) any { return text(receipt(source).Currency) })},
+			{Name: "total", Type: "String!", Resolve: graphql.Each(func(source any) any { return receipt(source).Total })},
+			{Name: "subtotal", Type: "String", Resolve: graphql.Each(func(source any) any { return text(receipt(source).Subtotal) })},
+			{Name: "tax", Type: "String", Resolve: graphql.Each(func(source any) any { return text(receipt(source).Tax) })},
+			{Name: "points", Type: "Int!", Resolve: graphql.Each(func(source any) any { return receipt(source).Points })},
+			{Name: "items", Type: "[Item!]!", Resolve: graphql.Each(func(source any) any { return receipt(source).Items })},
+			{Name: "discounts", Type: "[Discount!]!", Resolve: graphql.Each(func(source any) any { return receipt(source).Discounts })},
+			{
+				Name: "breakdown", Type: "[RulePoints!]!", Description: "the points every scoring rule awarded, they add up to points",
+				Resolve: graphql.Each(func(source any) any { return receipt(source).Breakdown }),
+			},
+			{Name: "apiKeyId", Type: "ID", Resolve: graphql.Each(func(source any) any { return text(receipt(source).APIKeyID) })},
+			{Name: "partnerId", Type: "ID", Resolve: graphql.Each(func(source any) any { return text(receipt(source).PartnerID) })},
+			{Name: "memberId", Type: "ID", Resolve: graphql.Each(func(source any) any { return text(receipt(source).MemberID) })},
+			{Name: "member", Type: "Member", Description: "the member the receipt belongs to", Resolve: controller.resolveReceiptMember},
+		},
+	}
+	item := func(source any) models.Item { return source.(models.Item) }
+	itemType := &graphql.Object{
+		Name: "Item",
+		Fields: []*graphql.Field{
+			{Name: "shortDescription", Type: "String!", Resolve: graphql.Each(func(source any) any { return item(source).ShortDescription })},
+			{Name: "price", Type: "String!", Resolve: graphql.Each(func(source any) any { return item(source).Price })},
+			{Name: "quantity", Type: "String", Resolve: graphql.Each(func(source any) any { return text(item(source).Quantity) })},
+			{Name: "unitPrice", Type: "String", Resolve: graphql.Each(func(source any) any { return text(item(source).UnitPrice) })},
+			{Name: "category", Type: "String", Resolve: graphql.Each(func(source any) any { return text(item(source).Category) })},
+		},
+	}
+	discountType := &graphql.Object{
+		Name: "Discount",
+		Fields: []*graphql.Field{
+			{Name: "description", Type: "String!", Resolve: graphql.Each(func(source any) any { return source.(models.Discount).Description })},
+			{Name: "amount", Type: "String!", Resolve: graphql.Each(func(source any) any { return source.(models.Discount).Amount })},
+		},
+	}
+	rulePointsType := &graphql.Object{
+		Name: "RulePoints",
+		Fields: []*graphql.Field{
+			{Name: "rule", Type: "String!", Resolve: graphql.Each(func(source any) any { return source.(models.RulePoints).Rule })},
+			{Name: "points", Type: "Int!", Resolve: graphql.Each(func(source any) any { return source.(models.RulePoints).Points })},
+		},
+	}
+	memberType := &graphql.Object{
+		Name:        "Member",
+		Description: "a member, the subject of the bearer token its receipts were submitted with",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: "ID!", Resolve: graphql.Each(func(source any) any { return source.(*member).id })},
+			{Name: "receipts", Type: "[Receipt!]!", Description: "the receipts of the member, the oldest first", Resolve: graphql.Each(func(source any) any { return source.(*member).receipts })},
+			{Name: "receiptCount", Type: "Int!", Resolve: graphql.Each(func(source any) any { return len(source.(*member).receipts) })},
+			{Name: "totalPoints", Type: "Int!", Resolve: graphql.Each(func(source any) any {
+				var points int64
+				for _, receipt := range source.(*member).receipts {
+					points += receipt.Points
+				}
+				return points
+			})},
+		},
+	}
+
+	receiptInput := &graphql.InputObject{
+		Name:        "ReceiptInput",
+		Description: "a receipt to process, validated like the body of POST /receipts/process",
+		Fields: []*graphql.Arg{
+			{Name: "retailer", Type: "String!"},
+			{Name: "purchaseDate", Type: "String!"},
+			{Name: "purchaseTime", Type: "String!"},
+			{Name: "items", Type: "[ItemInput!]!"},
+			{Name: "total", Type: "String!"},
+			{Name: "subtotal", Type: "String"},
+			{Name: "discounts", Type: "[DiscountInput!]"},
+			{Name: "tax", Type: "String"},
+			{Name: "currency", Type: "String"},
+			{Name: "timezone", Type: "String"},
+			{Name: "memberId", Type: "ID"},
+		},
+	}
+	itemInput := &graphql.InputObject{
+		Name: "ItemInput",
+		Fields: []*graphql.Arg{
+			{Name: "shortDescription", Type: "String!"},
+			{Name: "price", Type: "String!"},
+			{Name: "quantity", Type: "String"},
+			{Name: "unitPrice", Type: "String"},
+		},
+	}
+	discountInput := &graphql.InputObject{
+		Name: "DiscountInput",
+		Fields: []*graphql.Arg{
+			{Name: "description", Type: "String!"},
+			{Name: "amount", Type: "String!"},
+		},
+	}
+
+	return graphql.NewSchema(query, mutation,
+		receiptType, itemType, discountType, rulePointsType, memberType, receiptInput, itemInput, discountInput)
+}
+
+// resolveReceipt resolves Query.receipt, members only find their own receipts
+func (controller *GraphQLController) resolveReceipt(ctx context.Context, sources []any, args map[string]any) ([]any, error) {
+	request := currentRequest(ctx)
+	if err := request.authorize(auth.ScopeReceiptsRead); err != nil {
+		return nil, err
+	}
+	receipt, ok := request.service.GetReceiptDetails(ctx, args["id"].(string))
+	if !ok || !canRead(request.c, receipt) {
+		return []any{nil}, nil
+	}
+	return []any{receipt}, nil
+}
+
+/*
+resolveReceipts resolves Query.receipts, the receipts of the ids are looked up together
+members only find their own receipts
+*/
+func (controller *GraphQLController) resolveReceipts(ctx context.Context, sources []any, args map[string]any) ([]any, error) {
+	request := currentRequest(ctx)
+	if err := request.authorize(auth.ScopeReceiptsRead); err != nil {
+		return nil, err
+	}
+	first := DefaultReceiptsFirst
+	if value, ok := args["first"].(int); ok {
+		first = value
+	}
+	if first < 0 {
+		return nil, errors.New("first must not be negative")
+	}
+	first = min(first, MaxReceiptsFirst)
+	memberID, filterMember := args["memberId"].(string)
+	keep := func(receipt *models.Receipt) bool {
+		return canRead(request.c, receipt) && (!filterMember || receipt.MemberID == memberID)
+	}
+
+	receipts := []*models.Receipt{}
+	if ids, ok := args["ids"].([]any); ok {
+		lookup := make([]string, len(ids))
+		for i, id := range ids {
+			lookup[i] = id.(string)
+		}
+		found := request.service.GetReceiptsDetails(ctx, lookup)
+		for _, id := range lookup {
+			if receipt, ok := found[id]; ok && keep(receipt) && len(receipts) < first {
+				receipts = append(receipts, receipt)
+			}
+		}
+		return []any{receipts}, nil
+	}
+	all := request.service.ListReceipts(ctx)
+	for i := range all {
+		if keep(&all[i]) && len(receipts) < first {
+			receipts = append(receipts, &all[i])
+		}
+	}
+	return []any{receipts}, nil
+}
+
+// resolveMember resolves Query.member, a member only finds itself
+func (controller *GraphQLController) resolveMember(ctx context.Context, sources []any, args map[string]any) ([]any, error) {
+	request := currentRequest(ctx)
+	if err := request.authorize(auth.ScopeReceiptsRead); err != nil {
+		return nil, err
+	}
+	members := request.members(ctx, []string{args["id"].(string)})
+	if found, ok := members[args["id"].(string)]; ok {
+		return []any{found}, nil
+	}
+	return []any{nil}, nil
+}
+
+// resolveReceiptMember resolves Receipt.member for all the receipts of a level with one read of the receipts of their members
+func (controller *GraphQLController) resolveReceiptMember(ctx context.Context, sources []any, args map[string]any) ([]any, error) {
+	request := currentRequest(ctx)
+	var ids []string
+	for _, source := range sources {
+		if id := source.(*models.Receipt).MemberID; id != "" {
+			ids = append(ids, id)
+		}
+	}
+	members := request.members(ctx, ids)
+	values := make([]any, len(sources))
+	for i, source := range sources {
+		if found, ok := members[source.(*models.Receipt).MemberID]; ok {
+			values[i] = found
+		}
+	}
+	return values, nil
+}
+
+/*
+members returns the members of the ids with their receipts, read with one ListReceipts
+the members without receipts the caller may read are left out
+*/
+func (request *graphQLRequest) members(ctx context.Context, ids []string) map[string]*member {
+	members := map[string]*member{}
+	if len(ids) == 0 {
+		return members
+	}
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	receipts := request.service.ListReceipts(ctx)
+	for i := range receipts {
+		receipt := &receipts[i]
+		if !wanted[receipt.MemberID] || !canRead(request.c, receipt) {
+			continue
+		}
+		if members[receipt.MemberID] == nil {
+			members[receipt.MemberID] = &member{id: receipt.MemberID}
+		}
+		members[receipt.MemberID].receipts = append(members[receipt.MemberID].receipts, receipt)
+	}
+	return members
+}
+
+/*
+processReceipt resolves Mutation.processReceipt, the receipt is validated, attributed and processed like in ProcessReceipt
+and counts against the daily quota of the API key of the request, the X-Daily-Quota headers are set like on POST /receipts/process
+*/
+func (controller *GraphQLController) processReceipt(ctx context.Context, sources []any, args map[string]any) ([]any, error) {
+	request := currentRequest(ctx)
+	if err := request.authorize(auth.ScopeReceiptsWrite); err != nil {
+		return nil, err
+	}
+	if apiKeyID := request.c.GetString(middleware.APIKeyIDKey); apiKeyID != "" && controller.APIKeys != nil {
+		quota, ok := controller.APIKeys.UseDailyQuota(apiKeyID, time.Now())
+		if quota.Limit > 0 {
+			request.c.Header(middleware.DailyQuotaLimitHeader, strconv.Itoa(quota.Limit))
+			request.c.Header(middleware.DailyQuotaRemainingHeader, strconv.Itoa(quota.Remaining))
+		}
+		if !ok {
+			return nil, errors.New("The daily quota of the API key is used up")
+		}
+	}
+
+	// the fields of ReceiptInput have the JSON names of the fields of the receipt
+	var receipt models.Receipt
+	body, err := json.Marshal(args["receipt"])
+	if err == nil {
+		err = json.Unmarshal(body, &receipt)
+	}
+	if err == nil {
+		err = validateReceipt(logging.FromContext(ctx), &receipt)
+	}
+	if err != nil {
+		return nil, errors.New("The receipt is invalid")
+	}
+	receipt.ID = addReceipt(request.c, ctx, request.service, &receipt)
+	return []any{&receipt}, nil
+}
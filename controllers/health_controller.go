@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+)
+
+/*
+HealthController is a struct that contains the HealthService
+it exposes the endpoints the orchestrator probes, they need no credentials
+*/
+type HealthController struct {
+	HealthService services.HealthService
+}
+
+// Healthz is a function that returns 200 as long as the process serves requests
+func (controller *HealthController) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+/*
+Readyz is a function that returns whether the service is ready to serve requests, with the result of every check
+if a check fails or the service is shutting down, returns 503
+*/
+func (controller *HealthController) Readyz(c *gin.Context) {
+	checks, ready := controller.HealthService.Ready(c.Request.Context())
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+// Version is a function that returns the commit and build time of the service and the versions of its rules
+func (controller *HealthController) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, controller.HealthService.Version())
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+)
+
+// RetryAfterQueueFull is the Retry-After of the 503 returned when the job queue is full, in seconds
+const RetryAfterQueueFull = "1"
+
+/*
+JobController is a struct that contains the JobService
+it returns the status and the result of the asynchronous requests, see submitJob
+when Tenants is set, the JobService of the tenant of the request is used instead
+*/
+type JobController struct {
+	JobService services.JobService
+	Tenants    services.TenantRegistry
+}
+
+// service returns the JobService for the tenant of the request, nil when the server runs no jobs
+func (controller *JobController) service(c *gin.Context) services.JobService {
+	if controller.Tenants != nil {
+		return controller.Tenants.For(middleware.TenantID(c)).Jobs
+	}
+	return controller.JobService
+}
+
+/*
+GetJob is a function that returns the job, with its status and, once it is done, the status code and the body of its response
+if the job is not found, returns 404
+members only find their own jobs
+*/
+func (controller *JobController) GetJob(c *gin.Context) {
+	jobs := controller.service(c)
+	if jobs == nil {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No job found for that ID"})
+		return
+	}
+	job, ok := jobs.GetJob(c.Request.Context(), c.Param("id"))
+	if principal := middleware.CurrentPrincipal(c); ok && principal != nil && principal.IsMember() && job.MemberID != principal.Subject {
+		ok = false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No job found for that ID"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+/*
+preferAsync reports whether the request asks to be processed asynchronously with the respond-async preference of RFC 7240,
+e.g. Prefer: respond-async, wait=10
+*/
+func preferAsync(c *gin.Context) bool {
+	for _, header := range c.Request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+submitJob submits the work of the request as a job of the kind and returns 202 with the job and its URL in Location
+the job is attributed to the submitter of the request so members only find their own jobs
+returns 503 with Retry-After when the queue is full, or when the server is shutting down, so the client sheds the load
+*/
+func submitJob(c *gin.Context, ctx context.Context, jobs services.JobService, kind string, run services.JobFunc) {
+	submitter := submitterOf(c)
+	job := &models.Job{Kind: kind, APIKeyID: submitter.apiKeyID, MemberID: submitter.memberID}
+	if err := jobs.Submit(ctx, job, run); err != nil {
+		logging.FromContext(ctx).Warn("job rejected", slog.String("kind", kind), slog.String("reason", err.Error()))
+		c.Header("Retry-After", RetryAfterQueueFull)
+		if errors.Is(err, services.ErrQueueFull) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"description": "Too many receipts are waiting to be processed, retry later"})
+		} else {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"description": "The server is shutting down, retry later"})
+		}
+		return
+	}
+	c.Header("Location", "/jobs/"+job.ID)
+	c.Header("Preference-Applied", "respond-async")
+	c.JSON(http.StatusAccepted, job)
+}
@@ -1,19 +1,54 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/formats"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
-	"github.com/go-playground/validator/v10"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
 	"net/http"
 )
 /*
 ReceiptController is a struct that contains the ReceiptService
 perfoming dependency injection on the ReceiptService
+when Tenants is set, the ReceiptService of the tenant of the request is used instead
+JobService runs the receipts of the requests with Prefer: respond-async, they are processed right away without it
 */
 type ReceiptController struct {
 	ReceiptService services.ReceiptService
+	JobService     services.JobService
+	Tenants        services.TenantRegistry
+}
+
+// service returns the ReceiptService for the tenant of the request
+func (controller *ReceiptController) service(c *gin.Context) services.ReceiptService {
+	if controller.Tenants != nil {
+		return controller.Tenants.For(middleware.TenantID(c)).Receipts
+	}
+	return controller.ReceiptService
+}
+
+// jobs returns the JobService for the tenant of the request when the request asks to be processed asynchronously, nil otherwise
+func (controller *ReceiptController) jobs(c *gin.Context) services.JobService {
+	if !preferAsync(c) {
+		return nil
+	}
+	if controller.Tenants != nil {
+		return controller.Tenants.For(middleware.TenantID(c)).Jobs
+	}
+	return controller.JobService
 }
 
 /*
@@ -28,46 +63,231 @@ total 			  				-> must be present and should be a valid total of the form ^\\d+\
 items 			  				-> must have atleast one item and should be a valid array of items
 		shortDescription		-> must be present and should be a valid name of the form ^[\\w\\s\\-&]+$
 		price					-> must be present and should be a valid price of the form ^\\d+\\.\\d{2}$
+the receipt is attributed to the API key the request was authenticated with
+a member authenticated with a bearer token always submits the receipt as itself
+the failed validations are counted in the receipt_validation_failures_total metric
+and logged with the field, the tag and the value that failed
+the receipt may be sent as JSON, XML or CSV, see bindReceipt, and the id is returned in the format of the Accept header
+with Prefer: respond-async the valid receipt is processed by a job, returns 202 with the job, see submitJob
 */
 func (controller *ReceiptController) ProcessReceipt(c *gin.Context) {
-	var validate = validator.New()
-	validate.RegisterValidation("receiptDate", validators.ValidateReceiptDate)
-	validate.RegisterValidation("receiptTime", validators.ValidateReceiptTime)
-	validate.RegisterValidation("decimal", validators.ValidateDecimal)
-	validate.RegisterValidation("alphanumeric", validators.ValidateAlphanumeric)
+	ctx, span := tracing.Start(c.Request.Context(), "ReceiptController.ProcessReceipt")
+	defer span.End()
+	logger := logging.FromContext(ctx)
 	var newReceipt models.Receipt
 
-	if err := c.ShouldBindJSON(&newReceipt); err != nil {
+	if format, err := bindReceipt(c, &newReceipt); err != nil {
+		metrics.ValidationFailures.WithLabelValues("body", format).Inc()
+		logger.Warn("receipt rejected", slog.String("reason", "the body is not a receipt"), slog.String("error", err.Error()))
+		span.SetStatus(codes.Error, "invalid receipt")
 		c.JSON(http.StatusBadRequest, gin.H{"description": "The receipt is invalid"})
 		return
 	}
 
-	if err := validate.Struct(&newReceipt); err != nil {
+	if err := validateReceipt(logger, &newReceipt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid receipt")
 		c.JSON(http.StatusBadRequest, gin.H{"description": "The receipt is invalid"})
 		return
 	}
 	
-	id,_ := controller.ReceiptService.AddNewReceipt(&newReceipt)
+	if jobs := controller.jobs(c); jobs != nil {
+		service := controller.service(c)
+		submitterOf(c).attribute(&newReceipt)
+		submitJob(c, ctx, jobs, "process", func(ctx context.Context) (int, any) {
+			return http.StatusOK, receiptID{ID: storeReceipt(ctx, service, &newReceipt)}
+		})
+		return
+	}
+
+	id := addReceipt(c, ctx, controller.service(c), &newReceipt)
+	negotiate(c, http.StatusOK, receiptID{ID: id}, csvRecords([]string{"id"}, []string{id}))
+}
+
+// MaxReceiptTextBytes is the longest text ProcessReceiptText reads, receipts are a few kilobytes
+const MaxReceiptTextBytes = 64 << 10
 
-	c.JSON(http.StatusOK, gin.H{
-		"id": id,
-	})
+// processedText is the response of ProcessReceiptText, the id with what the parser read, description is set when it is rejected
+type processedText struct {
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	*formats.TextReceipt
+}
+
+/*
+ProcessReceiptText is a function that processes a receipt sent as text, e.g. from OCR or an e-mail, see formats.ParseReceiptText
+returns the id of the receipt with the receipt, the confidence of its fields and the lines the parser did not understand
+if the parsed receipt is invalid, returns 400 with what the parser read so the text can be fixed
+if the text is longer than MaxReceiptTextBytes, returns 413
+the receipt is validated, attributed and counted like the receipts of ProcessReceipt
+with Prefer: respond-async the text is parsed and processed by a job, returns 202 with the job, see submitJob
+*/
+func (controller *ReceiptController) ProcessReceiptText(c *gin.Context) {
+	ctx, span := tracing.Start(c.Request.Context(), "ReceiptController.ProcessReceiptText")
+	defer span.End()
+
+	text, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxReceiptTextBytes))
+	if err != nil {
+		metrics.ValidationFailures.WithLabelValues("body", "text").Inc()
+		span.SetStatus(codes.Error, "invalid receipt")
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"description": "The receipt text is too long"})
+		return
+	}
+
+	service, submitter := controller.service(c), submitterOf(c)
+	process := func(ctx context.Context) (int, any) {
+		parsed := formats.ParseReceiptText(string(text))
+		if err := validateReceipt(logging.FromContext(ctx), parsed.Receipt); err != nil {
+			trace.SpanFromContext(ctx).RecordError(err)
+			return http.StatusBadRequest, processedText{Description: "The receipt is invalid", TextReceipt: parsed}
+		}
+		submitter.attribute(parsed.Receipt)
+		return http.StatusOK, processedText{ID: storeReceipt(ctx, service, parsed.Receipt), TextReceipt: parsed}
+	}
+	if jobs := controller.jobs(c); jobs != nil {
+		submitJob(c, ctx, jobs, "process-text", process)
+		return
+	}
+
+	code, body := process(ctx)
+	if code != http.StatusOK {
+		span.SetStatus(codes.Error, "invalid receipt")
+	}
+	c.JSON(code, body)
+}
+
+/*
+validateReceipt validates the receipt like ProcessReceipt does, the processReceipt mutation of the GraphQL API shares it
+the failed validations are counted and logged, see validationFailures
+*/
+func validateReceipt(logger *slog.Logger, receipt *models.Receipt) error {
+	if err := validators.NewValidator().Struct(receipt); err != nil {
+		logger.Warn("receipt rejected", slog.String("reason", "the receipt is invalid"), validationFailures(err))
+		return err
+	}
+	return nil
+}
+
+/*
+addReceipt attributes the valid receipt to the API key, the partner or the member of the request,
+adds it with the ReceiptService and logs it, returns the id of the receipt
+a member authenticated with a bearer token always submits the receipt as itself
+*/
+func addReceipt(c *gin.Context, ctx context.Context, service services.ReceiptService, receipt *models.Receipt) string {
+	submitterOf(c).attribute(receipt)
+	return storeReceipt(ctx, service, receipt)
+}
+
+// submitter is the API key, the partner and the member that submitted a receipt, see addReceipt
+type submitter struct {
+	apiKeyID  string
+	partnerID string
+	memberID  string
+}
+
+// submitterOf returns the submitter of the request, it is read before the request is done so jobs can attribute their receipts
+func submitterOf(c *gin.Context) submitter {
+	submitter := submitter{apiKeyID: c.GetString(middleware.APIKeyIDKey), partnerID: c.GetString(middleware.PartnerIDKey)}
+	if principal := middleware.CurrentPrincipal(c); principal != nil && principal.IsMember() {
+		submitter.memberID = principal.Subject
+	}
+	return submitter
+}
+
+// attribute attributes the receipt to the submitter, the member is only replaced when the submitter is a member
+func (submitter submitter) attribute(receipt *models.Receipt) {
+	receipt.APIKeyID = submitter.apiKeyID
+	receipt.PartnerID = submitter.partnerID
+	if submitter.memberID != "" {
+		receipt.MemberID = submitter.memberID
+	}
+}
+
+// storeReceipt adds the valid and attributed receipt with the ReceiptService and logs it, returns the id of the receipt
+func storeReceipt(ctx context.Context, service services.ReceiptService, receipt *models.Receipt) string {
+	id, points := service.AddNewReceipt(ctx, receipt)
+	logging.FromContext(ctx).Info("receipt processed",
+		slog.String("receiptId", id),
+		slog.Int64("points", points),
+		slog.String("retailer", receipt.Retailer),
+		slog.Int("items", len(receipt.Items)))
+	return id
 }
 
 /*
 GetReceiptPoints is a function that returns the points of the receipt
 if the receipt is not found, returns 404
+members only find their own receipts
+the points are returned in the format of the Accept header, see negotiate
 */
 func (controller *ReceiptController) GetReceiptPoints(c *gin.Context) {
+	ctx, span := tracing.Start(c.Request.Context(), "ReceiptController.GetReceiptPoints")
+	defer span.End()
 	id := c.Param("id")
 
-	points, ok := controller.ReceiptService.GetReceipt(id)
+	points, ok := controller.service(c).GetReceipt(ctx, id)
+	if principal := middleware.CurrentPrincipal(c); ok && principal != nil && principal.IsMember() {
+		receipt, found := controller.service(c).GetReceiptDetails(ctx, id)
+		ok = found && canRead(c, receipt)
+	}
 	if !ok {
 		c.JSON(http.StatusNotFound, gin.H{"description": "No receipt found for that id"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"points": points,
-	})
-}
\ No newline at end of file
+	negotiate(c, http.StatusOK, receiptPoints{Points: points}, csvRecords([]string{"points"}, []string{strconv.FormatInt(points, 10)}))
+}
+
+/*
+GetReceipt is a function that returns the processed receipt
+including the submitted retailer name and the canonical one from the retailer registry
+if the receipt is not found, returns 404
+members only find their own receipts
+the receipt is returned in the format of the Accept header, see negotiate
+*/
+func (controller *ReceiptController) GetReceipt(c *gin.Context) {
+	ctx, span := tracing.Start(c.Request.Context(), "ReceiptController.GetReceipt")
+	defer span.End()
+	id := c.Param("id")
+
+	receipt, ok := controller.service(c).GetReceiptDetails(ctx, id)
+	if !ok || !canRead(c, receipt) {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No receipt found for that id"})
+		return
+	}
+
+	negotiate(c, http.StatusOK, receipt, func(w io.Writer) error { return formats.WriteReceiptCSV(w, receipt) })
+}
+
+/*
+canRead reports whether the caller may read the receipt
+members may only read their own receipts, the receipts of other members are reported as not found
+*/
+func canRead(c *gin.Context, receipt *models.Receipt) bool {
+	principal := middleware.CurrentPrincipal(c)
+	return principal == nil || !principal.IsMember() || receipt.MemberID == principal.Subject
+}
+
+/*
+validationFailures counts every failed validation of a receipt by the JSON name of the field and tag, e.g. purchaseDate and receiptDate
+and returns them as the validation group of a log line, with the tag and the value of every field,
+e.g. "Receipt.Items[0].Price": {"tag": "decimal", "value": "1.5"}
+only the values of text and number fields are logged, the items of an invalid item list are not
+*/
+func validationFailures(err error) slog.Attr {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return slog.String("validation", err.Error())
+	}
+	failures := make([]any, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		metrics.ValidationFailures.WithLabelValues(fieldError.Field(), fieldError.Tag()).Inc()
+		attrs := []any{slog.String("tag", fieldError.Tag())}
+		switch value := fieldError.Value().(type) {
+		case string, int, int64, float64:
+			attrs = append(attrs, slog.Any("value", value))
+		}
+		failures = append(failures, slog.Group(fieldError.StructNamespace(), attrs...))
+	}
+	return slog.Group("validation", failures...)
+}
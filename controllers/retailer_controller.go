@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+)
+
+/*
+RetailerController is a struct that contains the RetailerService
+it exposes the retailer registry used to normalize the retailer name of receipts
+when Tenants is set, the registry of the tenant of the request is used instead
+*/
+type RetailerController struct {
+	RetailerService services.RetailerService
+	Tenants         services.TenantRegistry
+}
+
+// service returns the RetailerService for the tenant of the request
+func (controller *RetailerController) service(c *gin.Context) services.RetailerService {
+	if controller.Tenants != nil {
+		return controller.Tenants.For(middleware.TenantID(c)).Retailers
+	}
+	return controller.RetailerService
+}
+
+/*
+AddRetailer is a function that adds a retailer to the registry and returns its id
+name 							-> must be present and should be a valid name of the form ^[\\w\\s\\-&]+$
+aliases 						-> optional, every alias should be a valid name of the form ^[\\w\\s\\-&]+$
+if the retailer is invalid, returns 400
+if the name or an alias already belongs to another retailer, returns 409
+*/
+func (controller *RetailerController) AddRetailer(c *gin.Context) {
+	var newRetailer models.Retailer
+	if !bindRetailer(c, &newRetailer) {
+		return
+	}
+
+	id, err := controller.service(c).AddRetailer(&newRetailer)
+	if err != nil {
+		respondRetailerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id": id,
+	})
+}
+
+// GetAllRetailers is a function that returns every retailer in the registry
+func (controller *RetailerController) GetAllRetailers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"retailers": controller.service(c).GetAllRetailers(),
+	})
+}
+
+/*
+GetRetailer is a function that returns the retailer for the id
+if the retailer is not found, returns 404
+*/
+func (controller *RetailerController) GetRetailer(c *gin.Context) {
+	retailer, ok := controller.service(c).GetRetailer(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No retailer found for that id"})
+		return
+	}
+
+	c.JSON(http.StatusOK, retailer)
+}
+
+/*
+UpdateRetailer is a function that replaces the name and aliases of the retailer for the id
+the body is validated the same way as for AddRetailer
+if the retailer is not found, returns 404
+*/
+func (controller *RetailerController) UpdateRetailer(c *gin.Context) {
+	var retailer models.Retailer
+	if !bindRetailer(c, &retailer) {
+		return
+	}
+	retailer.ID = c.Param("id")
+
+	if err := controller.service(c).UpdateRetailer(&retailer); err != nil {
+		respondRetailerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, retailer)
+}
+
+/*
+DeleteRetailer is a function that removes the retailer for the id from the registry
+if the retailer is not found, returns 404
+*/
+func (controller *RetailerController) DeleteRetailer(c *gin.Context) {
+	if !controller.service(c).DeleteRetailer(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No retailer found for that id"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// bindRetailer binds and validates the retailer in the body, responding with 400 when it is invalid
+func bindRetailer(c *gin.Context, retailer *models.Retailer) bool {
+	if err := c.ShouldBindJSON(retailer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The retailer is invalid"})
+		return false
+	}
+
+	if err := validators.NewValidator().Struct(retailer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The retailer is invalid"})
+		return false
+	}
+	return true
+}
+
+func respondRetailerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"description": "No retailer found for that id"})
+	case errors.Is(err, db.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"description": "The retailer name or an alias is already registered"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"description": "The retailer could not be saved"})
+	}
+}
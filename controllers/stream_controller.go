@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+)
+
+// LastEventIDHeader is the header a stream resumes with, browsers send it when they reconnect
+const LastEventIDHeader = "Last-Event-ID"
+
+/*
+StreamController is a struct that contains the ReceiptFeed the receipts scored are streamed from
+Heartbeat is the time between the comments written to an idle stream, so the proxies and the clients know it is alive
+WriteTimeout is the time every write to a stream has, the write timeout of the server would cut every stream off after it otherwise,
+a stream that stops reading is cut off after it instead, none when it is zero
+*/
+type StreamController struct {
+	Feed         *services.ReceiptFeed
+	Heartbeat    time.Duration
+	WriteTimeout time.Duration
+}
+
+/*
+StreamReceipts is a function that streams the receipts scored as Server-Sent Events, one receipt.scored event per receipt
+tenant 						-> the tenant of the receipts, the X-Tenant-ID header when absent so EventSource clients can pick one,
+every tenant when neither is given with the admin token, or when the route is not authenticated
+retailer 					-> the name or id of the retailer of the receipts, may be repeated, every retailer when absent
+Last-Event-ID 				-> the id of the last event received, or the lastEventId query parameter, the receipts kept after it are sent first,
+preceded by an events.missed event when some of them are no longer kept, see services.ReceiptFeed
+members only get their own receipts
+the stream ends when it does not keep up with the receipts or the server shuts down, clients reconnect with Last-Event-ID
+if the tenant or the Last-Event-ID is invalid, returns 400, and 403 if the credentials belong to another tenant
+*/
+func (controller *StreamController) StreamReceipts(c *gin.Context) {
+	if controller.Feed == nil {
+		c.JSON(http.StatusNotFound, gin.H{"description": "The stream is not enabled"})
+		return
+	}
+	filter, ok := receiptFilter(c)
+	if !ok {
+		return
+	}
+	lastEventID := c.GetHeader(LastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+	if lastEventID != "" && err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The Last-Event-ID is invalid"})
+		return
+	}
+
+	subscription, err := controller.Feed.Subscribe(filter, lastEventID != "", lastID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"description": "The server is shutting down"})
+		return
+	}
+	defer controller.Feed.Unsubscribe(subscription)
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	writer := http.NewResponseController(c.Writer)
+	deadline := func() {
+		if controller.WriteTimeout > 0 {
+			writer.SetWriteDeadline(time.Now().Add(controller.WriteTimeout))
+		}
+	}
+	write := func(event sse.Event) bool {
+		deadline()
+		return sse.Encode(c.Writer, event) == nil && writer.Flush() == nil
+	}
+
+	sse.Event{}.WriteContentType(c.Writer)
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if subscription.Missed && !write(sse.Event{Event: models.EventsMissed, Data: gin.H{"description": "Some receipts after the Last-Event-ID are no longer kept"}}) {
+		return
+	}
+	for _, receipt := range subscription.Replay {
+		if !write(receiptEvent(receipt)) {
+			return
+		}
+	}
+	// the headers are sent right away, so the client knows it is subscribed before the first receipt
+	deadline()
+	if writer.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(controller.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case receipt, ok := <-subscription.Receipts:
+			if !ok {
+				if errors.Is(subscription.Err(), services.ErrSlowConsumer) {
+					logger.Warn("receipt stream disconnected", slog.String("reason", subscription.Err().Error()))
+				}
+				return
+			}
+			if !write(receiptEvent(receipt)) {
+				return
+			}
+		case <-heartbeat.C:
+			deadline()
+			if _, err := io.WriteString(c.Writer, ":\n\n"); err != nil || writer.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// receiptEvent returns the receipt.scored event of the receipt
+func receiptEvent(receipt models.StreamedReceipt) sse.Event {
+	return sse.Event{Id: strconv.FormatUint(receipt.ID, 10), Event: models.EventReceiptScored, Data: receipt}
+}
+
+/*
+receiptFilter returns the receipts the request streams, see StreamReceipts,
+the tenant is resolved like the X-Tenant-ID header, see middleware.ResolveTenant,
+responding with 400 or 403 when it cannot be
+*/
+func receiptFilter(c *gin.Context) (services.ReceiptFilter, bool) {
+	principal := middleware.CurrentPrincipal(c)
+	filter := services.ReceiptFilter{Retailers: c.QueryArray("retailer")}
+	if principal != nil && principal.IsMember() {
+		filter.MemberID = principal.Subject
+	}
+
+	requested, header := c.Query("tenant"), c.GetHeader(middleware.TenantHeader)
+	if requested != "" && header != "" && requested != header {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The tenant is invalid"})
+		return filter, false
+	}
+	if requested == "" {
+		requested = header
+	}
+	// only the admin token streams every tenant, an admin bearer token belongs to a tenant like any other credentials
+	if requested == "" && (principal == nil || (principal.HasScope(auth.ScopeAdmin) && principal.TenantID == "")) {
+		return filter, true
+	}
+	tenantID, err := middleware.ResolveTenant(principal, requested)
+	if errors.Is(err, middleware.ErrOtherTenant) {
+		c.JSON(http.StatusForbidden, gin.H{"description": "The credentials do not belong to that tenant"})
+		return filter, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The tenant is invalid"})
+		return filter, false
+	}
+	filter.TenantID = tenantID
+	return filter, true
+}
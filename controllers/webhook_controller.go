@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+)
+
+/*
+WebhookController is a struct that contains the WebhookService
+it manages the webhooks the events of the receipts are posted to, with their delivery history and dead letters
+when Tenants is set, the WebhookService of the tenant of the request is used instead
+members only find and manage their own webhooks, the other credentials every webhook of the tenant
+*/
+type WebhookController struct {
+	WebhookService services.WebhookService
+	Tenants        services.TenantRegistry
+}
+
+// service returns the WebhookService for the tenant of the request, responding with 404 when the server posts no events
+func (controller *WebhookController) service(c *gin.Context) (services.WebhookService, bool) {
+	service := controller.WebhookService
+	if controller.Tenants != nil {
+		service = controller.Tenants.For(middleware.TenantID(c)).Webhooks
+	}
+	if service == nil {
+		c.JSON(http.StatusNotFound, gin.H{"description": "Webhooks are not enabled"})
+		return nil, false
+	}
+	return service, true
+}
+
+/*
+AddWebhook is a function that adds a webhook and returns it with its secret
+url 							-> must be present and should be an absolute http or https URL
+events 							-> must have at least one of receipt.scored and points.changed
+secret 							-> optional, 16 to 256 characters, a random secret is generated when it is absent
+the secret is only returned in this response
+the webhook is attributed to the submitter of the request, the webhooks of a member only get the events of its receipts
+if the webhook is invalid, returns 400
+*/
+func (controller *WebhookController) AddWebhook(c *gin.Context) {
+	service, ok := controller.service(c)
+	if !ok {
+		return
+	}
+	var webhook models.Webhook
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The webhook is invalid"})
+		return
+	}
+	if err := validators.NewValidator().Struct(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"description": "The webhook is invalid"})
+		return
+	}
+	submitter := submitterOf(c)
+	webhook.APIKeyID, webhook.PartnerID, webhook.MemberID = submitter.apiKeyID, submitter.partnerID, submitter.memberID
+
+	if _, err := service.AddWebhook(c.Request.Context(), &webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"description": "The webhook could not be saved"})
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// GetAllWebhooks is a function that returns the webhooks the caller manages, without their secrets
+func (controller *WebhookController) GetAllWebhooks(c *gin.Context) {
+	service, ok := controller.service(c)
+	if !ok {
+		return
+	}
+	webhooks := []models.Webhook{}
+	for _, webhook := range service.ListWebhooks(c.Request.Context()) {
+		if canManageWebhook(c, &webhook) {
+			webhook.Secret = ""
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+/*
+GetWebhook is a function that returns the webhook for the id, without its secret
+if the webhook is not found, returns 404
+*/
+func (controller *WebhookController) GetWebhook(c *gin.Context) {
+	webhook, service := controller.webhook(c)
+	if service == nil {
+		return
+	}
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, webhook)
+}
+
+/*
+DeleteWebhook is a function that removes the webhook for the id with its deliveries, no more events are posted to it
+if the webhook is not found, returns 404
+*/
+func (controller *WebhookController) DeleteWebhook(c *gin.Context) {
+	webhook, service := controller.webhook(c)
+	if service == nil {
+		return
+	}
+	if !service.DeleteWebhook(c.Request.Context(), webhook.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No webhook found for that id"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+/*
+GetDeliveries is a function that returns the delivery history of the webhook for the id, the oldest first,
+every delivery with its event, its status and its attempts
+if the webhook is not found, returns 404
+*/
+func (controller *WebhookController) GetDeliveries(c *gin.Context) {
+	webhook, service := controller.webhook(c)
+	if service == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": service.ListDeliveries(c.Request.Context(), webhook.ID)})
+}
+
+// GetDeadLetters is a function that returns the deliveries to the webhooks the caller manages whose every attempt failed
+func (controller *WebhookController) GetDeadLetters(c *gin.Context) {
+	service, ok := controller.service(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": controller.deadLetters(c, service)})
+}
+
+/*
+Redeliver is a function that attempts the dead letter for the id again, it gets as many attempts as a new delivery
+returns 202 with the delivery, pending again
+if the dead letter is not found, returns 404
+*/
+func (controller *WebhookController) Redeliver(c *gin.Context) {
+	service, ok := controller.service(c)
+	if !ok {
+		return
+	}
+	found := false
+	for _, delivery := range controller.deadLetters(c, service) {
+		found = found || delivery.ID == c.Param("id")
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No dead letter found for that id"})
+		return
+	}
+
+	delivery, err := service.Redeliver(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No dead letter found for that id"})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// webhook returns the webhook of the id in the path with the service, responding with 404 when the caller does not manage it
+func (controller *WebhookController) webhook(c *gin.Context) (*models.Webhook, services.WebhookService) {
+	service, ok := controller.service(c)
+	if !ok {
+		return nil, nil
+	}
+	webhook, ok := service.GetWebhook(c.Request.Context(), c.Param("id"))
+	if !ok || !canManageWebhook(c, webhook) {
+		c.JSON(http.StatusNotFound, gin.H{"description": "No webhook found for that id"})
+		return nil, nil
+	}
+	return webhook, service
+}
+
+// deadLetters returns the dead letters of the webhooks the caller manages
+func (controller *WebhookController) deadLetters(c *gin.Context, service services.WebhookService) []models.WebhookDelivery {
+	ctx := c.Request.Context()
+	managed := map[string]bool{}
+	for _, webhook := range service.ListWebhooks(ctx) {
+		managed[webhook.ID] = canManageWebhook(c, &webhook)
+	}
+	dead := []models.WebhookDelivery{}
+	for _, delivery := range service.DeadLetters(ctx) {
+		if managed[delivery.WebhookID] {
+			dead = append(dead, delivery)
+		}
+	}
+	return dead
+}
+
+// canManageWebhook reports whether the caller manages the webhook, members only manage their own
+func canManageWebhook(c *gin.Context, webhook *models.Webhook) bool {
+	principal := middleware.CurrentPrincipal(c)
+	return principal == nil || !principal.IsMember() || webhook.MemberID == principal.Subject
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+APIKeyDB is an interface that contains the methods to interact with the API keys
+AddAPIKey adds a new API key and returns its id
+FindAPIKey returns the API key with the given hash
+GetAllAPIKeys returns every API key, including the revoked ones
+RevokeAPIKey marks the API key as revoked, returns false if there is no such key
+GetAPIKey returns the API key with the given id
+AddUsage counts a request of the API key on the day (YYYY-MM-DD) and returns the requests of that day,
+unless limit is positive and the day already has limit requests, then it returns false and counts nothing
+*/
+type APIKeyDB interface {
+	AddAPIKey(key *models.APIKey) string
+	FindAPIKey(hash string) (*models.APIKey, bool)
+	GetAllAPIKeys() []models.APIKey
+	RevokeAPIKey(id string) bool
+	GetAPIKey(id string) (*models.APIKey, bool)
+	AddUsage(id string, day string, limit int) (int, bool)
+}
+
+/*
+APIKeyUsage is the number of requests of an API key on a day
+only the current day of every key is kept, the count starts again when the day changes
+*/
+type APIKeyUsage struct {
+	Day   string
+	Count int
+}
+
+// APIKeyHashes is kept next to APIKeys as an index from the hash of the key to its id
+
+func (db *InMemoryDB) AddAPIKey(key *models.APIKey) string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	key.ID = uuid.New().String()
+	db.APIKeys[key.ID] = *key
+	db.APIKeyHashes[key.Hash] = key.ID
+	return key.ID
+}
+
+func (db *InMemoryDB) FindAPIKey(hash string) (*models.APIKey, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	id, ok := db.APIKeyHashes[hash]
+	if !ok {
+		return nil, false
+	}
+	key := db.APIKeys[id]
+	return &key, true
+}
+
+func (db *InMemoryDB) GetAllAPIKeys() []models.APIKey {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	keys := make([]models.APIKey, 0, len(db.APIKeys))
+	for _, key := range db.APIKeys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (db *InMemoryDB) RevokeAPIKey(id string) bool {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	key, ok := db.APIKeys[id]
+	if !ok {
+		return false
+	}
+	if key.RevokedAt == nil {
+		revokedAt := time.Now().UTC()
+		key.RevokedAt = &revokedAt
+		db.APIKeys[id] = key
+	}
+	return true
+}
+
+func (db *InMemoryDB) GetAPIKey(id string) (*models.APIKey, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	key, ok := db.APIKeys[id]
+	if !ok {
+		return nil, false
+	}
+	return &key, true
+}
+
+func (db *InMemoryDB) AddUsage(id string, day string, limit int) (int, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	usage := db.APIKeyUsage[id]
+	if usage.Day != day {
+		usage = APIKeyUsage{Day: day}
+	}
+	if limit > 0 && usage.Count >= limit {
+		return usage.Count, false
+	}
+	usage.Count++
+	db.APIKeyUsage[id] = usage
+	return usage.Count, true
+}
@@ -1,19 +1,63 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"sort"
 	"sync"
+	"time"
 )
 
 /*
 DB is an interface that contains the methods to interact with the database
 GetReceipt is a method that returns the points of the receipt
+GetReceiptDetails is a method that returns the whole stored receipt
+GetReceiptsDetails is a method that returns the stored receipts of the ids in one read, by id, the unknown ids are left out
 AddNewReceipt is a method that adds a new receipt to the database
+ListReceipts is a method that returns every stored receipt in the order they were created
+MemberPoints is a method that returns the points of all the stored receipts of the member, kept up to date as the receipts are added
+every method takes the context of the request so the implementations can trace and cancel their work
 
 */
 type DB interface {
-	GetReceipt(id string) (int64, bool)
-	AddNewReceipt(points int64) string
+	GetReceipt(ctx context.Context, id string) (int64, bool)
+	GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool)
+	GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt
+	AddNewReceipt(ctx context.Context, receipt *models.Receipt) string
+	ListReceipts(ctx context.Context) []models.Receipt
+	MemberPoints(ctx context.Context, memberID string) int64
+}
+
+/*
+Pinger is an interface implemented by the stores that can tell whether they are reachable
+Ping is a method that returns an error when the store cannot serve requests, it is used by the readiness check
+*/
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+/*
+Closer is an interface implemented by the stores that hold resources
+Close is a method that releases the store, it is called once on shutdown, the store is not reachable from then on
+*/
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// ErrClosed is returned by Ping once the store is closed
+var ErrClosed = errors.New("the store is closed")
+
+/*
+TenantStore is an interface that contains everything stored per tenant
+the receipts, the retailer registry, the jobs and the webhooks of a tenant are never visible to another tenant
+*/
+type TenantStore interface {
+	DB
+	RetailerDB
+	JobDB
+	WebhookDB
 }
 
 
@@ -21,33 +65,168 @@ type DB interface {
 Just trying to replicate the in memory database
 
 InMemoryDB is a struct that contains the AllReceipts map
-AllReceipts is a map that contains the id of the receipt and the points of the receipt
-in a thread safe manner
+AllReceipts is a map that contains the id of the receipt and the processed receipt
+MemberTotals is a map that contains the id of a member and the points of all of its receipts
+in a thread safe manner, every InMemoryDB has its own lock so the stores of different tenants do not contend
+Retailers and RetailerKeys hold the retailer registry, see retailers.go
+APIKeys and APIKeyHashes hold the API keys and APIKeyUsage their daily usage, see api_keys.go
+Jobs holds the asynchronous jobs, see jobs.go, the jobs that are done are kept for JobRetention,
+and only the last MaxFinishedJobs of them
+Webhooks and Deliveries hold the webhooks and the deliveries of their events, see webhooks.go
 
 InMemoryDB implements the DB interface
-for AddNewReceipt, it generates a new UUID id and adds the points to the AllReceipts map
+for AddNewReceipt, it generates a new UUID id and adds the receipt to the AllReceipts map
 
-assumming that the receipt is valid, the points are added to the AllReceipts map
+assumming that the receipt is valid, the receipt is added to the AllReceipts map
 and the id generated is random and unique
 */
 
-var lock = &sync.Mutex{}
-
 type InMemoryDB struct {
-	AllReceipts map[string]int64
+	lock   sync.Mutex
+	closed bool
+
+	AllReceipts  map[string]models.Receipt
+	MemberTotals map[string]int64
+	Retailers    map[string]models.Retailer
+	RetailerKeys map[string]string
+	APIKeys      map[string]models.APIKey
+	APIKeyHashes map[string]string
+	APIKeyUsage  map[string]APIKeyUsage
+	Jobs         map[string]models.Job
+	Webhooks     map[string]models.Webhook
+	Deliveries   map[string]models.WebhookDelivery
+
+	JobRetention    time.Duration
+	MaxFinishedJobs int
+	finishedJobs    []string
+}
+
+// NewInMemoryDB returns an InMemoryDB with all of its maps initialised
+func NewInMemoryDB() *InMemoryDB {
+	return &InMemoryDB{
+		AllReceipts:  make(map[string]models.Receipt),
+		MemberTotals: make(map[string]int64),
+		Retailers:    make(map[string]models.Retailer),
+		RetailerKeys: make(map[string]string),
+		APIKeys:      make(map[string]models.APIKey),
+		APIKeyHashes: make(map[string]string),
+		APIKeyUsage:  make(map[string]APIKeyUsage),
+		Jobs:         make(map[string]models.Job),
+		Webhooks:     make(map[string]models.Webhook),
+		Deliveries:   make(map[string]models.WebhookDelivery),
+
+		JobRetention:    DefaultJobRetention,
+		MaxFinishedJobs: DefaultMaxFinishedJobs,
+	}
+}
+
+// Ping succeeds until the store is closed, the in memory store is reachable as long as the process runs
+func (db *InMemoryDB) Ping(ctx context.Context) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close marks the store as closed, the in memory store has nothing to write
+func (db *InMemoryDB) Close(ctx context.Context) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.closed = true
+	return nil
+}
+
+func (db *InMemoryDB) GetReceipt(ctx context.Context, id string) (int64, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	receipt, ok := db.AllReceipts[id]
+	return receipt.Points, ok
+}
+
+func (db *InMemoryDB) GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	receipt, ok := db.AllReceipts[id]
+	if !ok {
+		return nil, false
+	}
+	return copyReceipt(&receipt), true
 }
 
-func (db *InMemoryDB) GetReceipt(id string) (int64, bool) {
-	lock.Lock()
-	defer lock.Unlock()
-	points, ok := db.AllReceipts[id]
-	return points, ok
+// GetReceiptsDetails copies the receipts under a single lock, so they are read at the same point in time
+func (db *InMemoryDB) GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	receipts := make(map[string]*models.Receipt, len(ids))
+	for _, id := range ids {
+		if receipt, ok := db.AllReceipts[id]; ok {
+			receipts[id] = copyReceipt(&receipt)
+		}
+	}
+	return receipts
 }
 
-func (db *InMemoryDB) AddNewReceipt(points int64) string {
-	lock.Lock()
-	defer lock.Unlock()
+func (db *InMemoryDB) AddNewReceipt(ctx context.Context, receipt *models.Receipt) string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
 	var id string = uuid.New().String()
-	db.AllReceipts[id] = points
+	receipt.ID = id
+	db.AllReceipts[id] = *copyReceipt(receipt)
+	if receipt.MemberID != "" {
+		db.MemberTotals[receipt.MemberID] += receipt.Points
+	}
 	return id
-}
\ No newline at end of file
+}
+
+// MemberPoints returns the running total of the points of the receipts of the member, 0 for a member without receipts
+func (db *InMemoryDB) MemberPoints(ctx context.Context, memberID string) int64 {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.MemberTotals[memberID]
+}
+
+// ListReceipts returns the receipts ordered by createdAt, receipts created at the same time by id
+func (db *InMemoryDB) ListReceipts(ctx context.Context) []models.Receipt {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	receipts := make([]models.Receipt, 0, len(db.AllReceipts))
+	for _, receipt := range db.AllReceipts {
+		receipts = append(receipts, *copyReceipt(&receipt))
+	}
+	sort.Slice(receipts, func(i, j int) bool {
+		created, otherCreated := createdAt(&receipts[i]), createdAt(&receipts[j])
+		if !created.Equal(otherCreated) {
+			return created.Before(otherCreated)
+		}
+		return receipts[i].ID < receipts[j].ID
+	})
+	return receipts
+}
+
+func createdAt(receipt *models.Receipt) time.Time {
+	if receipt.CreatedAt == nil {
+		return time.Time{}
+	}
+	return *receipt.CreatedAt
+}
+
+// copyReceipt copies the receipt along with its items, its discounts, its breakdown and its timestamps so the stored receipt cannot be changed from outside
+func copyReceipt(receipt *models.Receipt) *models.Receipt {
+	copied := *receipt
+	copied.Items = append([]models.Item(nil), receipt.Items...)
+	if receipt.Discounts != nil {
+		copied.Discounts = append([]models.Discount(nil), receipt.Discounts...)
+	}
+	copied.Breakdown = append([]models.RulePoints(nil), receipt.Breakdown...)
+	if receipt.PurchasedAt != nil {
+		purchasedAt := *receipt.PurchasedAt
+		copied.PurchasedAt = &purchasedAt
+	}
+	if receipt.CreatedAt != nil {
+		createdAt := *receipt.CreatedAt
+		copied.CreatedAt = &createdAt
+	}
+	return &copied
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+JobDB is an interface that contains the methods to interact with the asynchronous jobs
+AddJob adds a new job and returns its id
+UpdateJob replaces the status, the result and the timestamps of an existing job, returns ErrNotFound if there is no such job
+GetJob returns the job with the given id
+the jobs that are done are not kept forever, see InMemoryDB.JobRetention, GetJob does not find them once they expired
+*/
+type JobDB interface {
+	AddJob(ctx context.Context, job *models.Job) string
+	UpdateJob(ctx context.Context, job *models.Job) error
+	GetJob(ctx context.Context, id string) (*models.Job, bool)
+}
+
+// the defaults of the jobs kept by an InMemoryDB
+const (
+	DefaultJobRetention    = time.Hour
+	DefaultMaxFinishedJobs = 10000
+)
+
+/*
+evictJobs removes the jobs that are done and expired, the oldest first, and the oldest ones above MaxFinishedJobs
+the done jobs are kept in finishedJobs in the order they finished, so only the expired ones are looked at
+*/
+func (db *InMemoryDB) evictJobs(now time.Time) {
+	for len(db.finishedJobs) > 0 {
+		job, ok := db.Jobs[db.finishedJobs[0]]
+		if ok && len(db.finishedJobs) <= db.MaxFinishedJobs && job.ExpiresAt != nil && now.Before(*job.ExpiresAt) {
+			return
+		}
+		delete(db.Jobs, db.finishedJobs[0])
+		db.finishedJobs = db.finishedJobs[1:]
+	}
+}
+
+func (db *InMemoryDB) AddJob(ctx context.Context, job *models.Job) string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.evictJobs(time.Now())
+	job.ID = uuid.New().String()
+	db.Jobs[job.ID] = *copyJob(job)
+	return job.ID
+}
+
+func (db *InMemoryDB) UpdateJob(ctx context.Context, job *models.Job) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	stored, ok := db.Jobs[job.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := copyJob(job)
+	if updated.Done() && !stored.Done() {
+		expiresAt := time.Now().UTC().Add(db.JobRetention)
+		updated.ExpiresAt = &expiresAt
+		db.finishedJobs = append(db.finishedJobs, job.ID)
+	}
+	db.Jobs[job.ID] = *updated
+	db.evictJobs(time.Now())
+	return nil
+}
+
+func (db *InMemoryDB) GetJob(ctx context.Context, id string) (*models.Job, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.evictJobs(time.Now())
+	job, ok := db.Jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return copyJob(&job), true
+}
+
+// copyJob copies the job along with its result and its timestamps so the stored job cannot be changed from outside
+func copyJob(job *models.Job) *models.Job {
+	copied := *job
+	copied.Result = append(json.RawMessage(nil), job.Result...)
+	if job.StartedAt != nil {
+		startedAt := *job.StartedAt
+		copied.StartedAt = &startedAt
+	}
+	if job.FinishedAt != nil {
+		finishedAt := *job.FinishedAt
+		copied.FinishedAt = &finishedAt
+	}
+	if job.ExpiresAt != nil {
+		expiresAt := *job.ExpiresAt
+		copied.ExpiresAt = &expiresAt
+	}
+	return &copied
+}
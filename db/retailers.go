@@ -0,0 +1,135 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+var (
+	// ErrNotFound is returned when the record to update does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned when a retailer name or alias is already used by another retailer
+	ErrConflict = errors.New("record conflicts with an existing record")
+)
+
+/*
+RetailerDB is an interface that contains the methods to interact with the retailer registry
+AddRetailer adds a new retailer and returns its id
+GetRetailer returns the retailer for an id
+GetAllRetailers returns every retailer in the registry
+UpdateRetailer replaces the name and aliases of an existing retailer
+DeleteRetailer removes a retailer from the registry
+FindRetailer returns the retailer whose name or alias normalizes to the given key
+*/
+type RetailerDB interface {
+	AddRetailer(retailer *models.Retailer) (string, error)
+	GetRetailer(id string) (*models.Retailer, bool)
+	GetAllRetailers() []models.Retailer
+	UpdateRetailer(retailer *models.Retailer) error
+	DeleteRetailer(id string) bool
+	FindRetailer(key string) (*models.Retailer, bool)
+}
+
+/*
+RetailerKeys is kept next to Retailers as an index from normalized name or alias to retailer id
+so resolving the retailer of every incoming receipt is a single map lookup
+a key can only belong to one retailer, adding or updating a retailer with a taken key returns ErrConflict
+*/
+
+func (db *InMemoryDB) AddRetailer(retailer *models.Retailer) (string, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	retailer.ID = uuid.New().String()
+	if err := db.indexRetailer(retailer); err != nil {
+		return "", err
+	}
+	db.Retailers[retailer.ID] = *copyRetailer(retailer)
+	return retailer.ID, nil
+}
+
+func (db *InMemoryDB) GetRetailer(id string) (*models.Retailer, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	retailer, ok := db.Retailers[id]
+	if !ok {
+		return nil, false
+	}
+	return copyRetailer(&retailer), true
+}
+
+func (db *InMemoryDB) GetAllRetailers() []models.Retailer {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	retailers := make([]models.Retailer, 0, len(db.Retailers))
+	for _, retailer := range db.Retailers {
+		retailers = append(retailers, *copyRetailer(&retailer))
+	}
+	return retailers
+}
+
+func (db *InMemoryDB) UpdateRetailer(retailer *models.Retailer) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	existing, ok := db.Retailers[retailer.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	db.unindexRetailer(&existing)
+	if err := db.indexRetailer(retailer); err != nil {
+		db.indexRetailer(&existing)
+		return err
+	}
+	db.Retailers[retailer.ID] = *copyRetailer(retailer)
+	return nil
+}
+
+func (db *InMemoryDB) DeleteRetailer(id string) bool {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	existing, ok := db.Retailers[id]
+	if !ok {
+		return false
+	}
+	db.unindexRetailer(&existing)
+	delete(db.Retailers, id)
+	return true
+}
+
+func (db *InMemoryDB) FindRetailer(key string) (*models.Retailer, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	id, ok := db.RetailerKeys[key]
+	if !ok {
+		return nil, false
+	}
+	retailer := db.Retailers[id]
+	return copyRetailer(&retailer), true
+}
+
+// indexRetailer adds every key of the retailer to RetailerKeys, nothing is added if one of them is taken
+func (db *InMemoryDB) indexRetailer(retailer *models.Retailer) error {
+	keys := retailer.Keys()
+	for _, key := range keys {
+		if id, ok := db.RetailerKeys[key]; ok && id != retailer.ID {
+			return ErrConflict
+		}
+	}
+	for _, key := range keys {
+		db.RetailerKeys[key] = retailer.ID
+	}
+	return nil
+}
+
+func (db *InMemoryDB) unindexRetailer(retailer *models.Retailer) {
+	for _, key := range retailer.Keys() {
+		delete(db.RetailerKeys, key)
+	}
+}
+
+func copyRetailer(retailer *models.Retailer) *models.Retailer {
+	copied := *retailer
+	copied.Aliases = append([]string(nil), retailer.Aliases...)
+	return &copied
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+WebhookDB is an interface that contains the methods to interact with the webhooks and their deliveries
+AddWebhook adds a new webhook and returns its id
+GetWebhook returns the webhook with the given id
+ListWebhooks returns every webhook in the order they were created
+DeleteWebhook removes the webhook along with its deliveries
+AddDelivery adds a new delivery and returns its id
+UpdateDelivery replaces the status and the attempts of an existing delivery, returns ErrNotFound if there is no such delivery
+GetDelivery returns the delivery with the given id
+ListDeliveries returns the deliveries of the webhook in the order they were created, the deliveries of every webhook when webhookID is empty
+*/
+type WebhookDB interface {
+	AddWebhook(ctx context.Context, webhook *models.Webhook) string
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, bool)
+	ListWebhooks(ctx context.Context) []models.Webhook
+	DeleteWebhook(ctx context.Context, id string) bool
+	AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) string
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, bool)
+	ListDeliveries(ctx context.Context, webhookID string) []models.WebhookDelivery
+}
+
+func (db *InMemoryDB) AddWebhook(ctx context.Context, webhook *models.Webhook) string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	webhook.ID = uuid.New().String()
+	db.Webhooks[webhook.ID] = *copyWebhook(webhook)
+	return webhook.ID
+}
+
+func (db *InMemoryDB) GetWebhook(ctx context.Context, id string) (*models.Webhook, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	webhook, ok := db.Webhooks[id]
+	if !ok {
+		return nil, false
+	}
+	return copyWebhook(&webhook), true
+}
+
+// ListWebhooks returns the webhooks ordered by createdAt, webhooks created at the same time by id
+func (db *InMemoryDB) ListWebhooks(ctx context.Context) []models.Webhook {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	webhooks := make([]models.Webhook, 0, len(db.Webhooks))
+	for _, webhook := range db.Webhooks {
+		webhooks = append(webhooks, *copyWebhook(&webhook))
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
+
+func (db *InMemoryDB) DeleteWebhook(ctx context.Context, id string) bool {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if _, ok := db.Webhooks[id]; !ok {
+		return false
+	}
+	delete(db.Webhooks, id)
+	for deliveryID, delivery := range db.Deliveries {
+		if delivery.WebhookID == id {
+			delete(db.Deliveries, deliveryID)
+		}
+	}
+	return true
+}
+
+func (db *InMemoryDB) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	delivery.ID = uuid.New().String()
+	db.Deliveries[delivery.ID] = *copyDelivery(delivery)
+	return delivery.ID
+}
+
+func (db *InMemoryDB) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if _, ok := db.Deliveries[delivery.ID]; !ok {
+		return ErrNotFound
+	}
+	db.Deliveries[delivery.ID] = *copyDelivery(delivery)
+	return nil
+}
+
+func (db *InMemoryDB) GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	delivery, ok := db.Deliveries[id]
+	if !ok {
+		return nil, false
+	}
+	return copyDelivery(&delivery), true
+}
+
+// ListDeliveries returns the deliveries ordered by createdAt, deliveries created at the same time by id
+func (db *InMemoryDB) ListDeliveries(ctx context.Context, webhookID string) []models.WebhookDelivery {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range db.Deliveries {
+		if webhookID == "" || delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, *copyDelivery(&delivery))
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}
+
+// copyWebhook copies the webhook along with its events so the stored webhook cannot be changed from outside
+func copyWebhook(webhook *models.Webhook) *models.Webhook {
+	copied := *webhook
+	copied.Events = append([]string(nil), webhook.Events...)
+	return &copied
+}
+
+// copyDelivery copies the delivery along with its event data, its attempts and its next attempt
+func copyDelivery(delivery *models.WebhookDelivery) *models.WebhookDelivery {
+	copied := *delivery
+	copied.Event.Data = append(json.RawMessage(nil), delivery.Event.Data...)
+	copied.Attempts = append([]models.WebhookAttempt{}, delivery.Attempts...)
+	if delivery.NextAttemptAt != nil {
+		nextAttemptAt := *delivery.NextAttemptAt
+		copied.NextAttemptAt = &nextAttemptAt
+	}
+	return &copied
+}
@@ -0,0 +1,103 @@
+package email
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blockElements start a new line of the text of an HTML part
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Br: true, atom.Div: true, atom.Footer: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Header: true,
+	atom.Hr: true, atom.Li: true, atom.Ol: true, atom.P: true, atom.Section: true, atom.Table: true, atom.Tr: true, atom.Ul: true,
+}
+
+// hiddenElements are not rendered, their text is dropped
+var hiddenElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Template: true, atom.Title: true,
+}
+
+/*
+htmlText is a function that returns the text of an HTML part as it would be read, a line per block element or table row
+the cells of a row are separated by two spaces, so a row with the description and the price of an item is one line
+ending with the price, like on a printed receipt, and the entities are unescaped
+*/
+func htmlText(document string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	var text strings.Builder
+	hidden := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		name, _ := tokenizer.TagName()
+		element := atom.Lookup(name)
+		switch tokenType {
+		case html.TextToken:
+			if hidden == 0 {
+				text.WriteString(collapseSpaces(string(tokenizer.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if hiddenElements[element] && tokenType == html.StartTagToken {
+				hidden++
+			}
+			if blockElements[element] {
+				text.WriteByte('\n')
+			}
+			if element == atom.Td || element == atom.Th {
+				text.WriteString("  ")
+			}
+		case html.EndTagToken:
+			if hiddenElements[element] && hidden > 0 {
+				hidden--
+			}
+			if blockElements[element] {
+				text.WriteByte('\n')
+			}
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(text.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapseSpaces replaces every run of white space, &nbsp; included, by one space, as a browser does
+func collapseSpaces(text string) string {
+	var collapsed strings.Builder
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			collapsed.WriteByte(' ')
+			space = false
+		}
+		collapsed.WriteRune(r)
+	}
+	if space {
+		collapsed.WriteByte(' ')
+	}
+	return collapsed.String()
+}
+
+/*
+Body is a function that returns the text of the message, the text/plain part,
+or the text of the text/html part when the message has no text/plain part
+*/
+func (message *Message) Body() string {
+	if strings.TrimSpace(message.Text) != "" || message.HTML == "" {
+		return message.Text
+	}
+	return htmlText(message.HTML)
+}
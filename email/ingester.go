@@ -0,0 +1,106 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/formats"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ErrNoTemplate is returned for the messages no template matches when the unmatched messages are not parsed
+var ErrNoTemplate = errors.New("no template matches the message")
+
+/*
+Ingester is a struct that reads the receipts of e-mail messages and processes them
+Receipts is the ReceiptService the receipts are added with, the receipts of one tenant
+Templates are the templates of the retailers, see Templates
+ParseUnmatched parses the messages no template matches like POST /receipts/process-text, see formats.ParseReceiptText,
+they are rejected with ErrNoTemplate otherwise
+*/
+type Ingester struct {
+	Receipts       services.ReceiptService
+	Templates      *Templates
+	ParseUnmatched bool
+}
+
+/*
+Ingest is a function that reads the receipt of the message and processes it, returns the id of the receipt
+the receipt is validated like the receipts of POST /receipts/process,
+it belongs to the member of the plus address it was sent to, receipts+alice@example.com is alice's, see Member
+returns an error if the message cannot be parsed, no receipt is found in it or the receipt is invalid
+*/
+func (ingester *Ingester) Ingest(ctx context.Context, r io.Reader) (string, error) {
+	ctx, span := tracing.Start(ctx, "email.Ingest")
+	defer span.End()
+
+	receipt, err := ingester.read(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "message rejected")
+		return "", err
+	}
+	if err := validators.NewValidator().Struct(receipt); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid receipt")
+		return "", fmt.Errorf("the receipt is invalid: %w", err)
+	}
+
+	id, points := ingester.Receipts.AddNewReceipt(ctx, receipt)
+	span.SetAttributes(attribute.String("receipt.id", id))
+	logging.FromContext(ctx).Info("receipt processed",
+		slog.String("receiptId", id),
+		slog.Int64("points", points),
+		slog.String("retailer", receipt.Retailer),
+		slog.Int("items", len(receipt.Items)),
+		slog.String("source", "email"))
+	return id, nil
+}
+
+// read parses the message and reads its receipt with the template of its retailer
+func (ingester *Ingester) read(r io.Reader) (*models.Receipt, error) {
+	message, err := ParseMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt *models.Receipt
+	if template, ok := ingester.Templates.Match(message); ok {
+		if receipt, err = template.Receipt(message); err != nil {
+			return nil, fmt.Errorf("reading the receipt with the template of %s: %w", template.Retailer, err)
+		}
+	} else if ingester.ParseUnmatched {
+		receipt = formats.ParseReceiptText(message.Body()).Receipt
+	} else {
+		return nil, fmt.Errorf("%w from %s", ErrNoTemplate, message.From)
+	}
+	receipt.MemberID = Member(message.To)
+	return receipt, nil
+}
+
+/*
+Member is a function that returns the member of the first plus address of the recipients, empty when there is none
+the tag of the address is the member, receipts+alice@example.com is alice
+*/
+func Member(recipients []string) string {
+	for _, recipient := range recipients {
+		local, _, found := strings.Cut(recipient, "@")
+		if !found {
+			continue
+		}
+		if _, tag, ok := strings.Cut(local, "+"); ok && tag != "" {
+			return tag
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+)
+
+// MaxMessageBytes is the size of the largest message read from the maildir, the larger messages are rejected
+const MaxMessageBytes = 10 << 20
+
+// the flags of the messages moved to cur, S (seen) for the processed messages and FS (flagged, seen) for the rejected ones
+const (
+	processedFlags = ":2,S"
+	rejectedFlags  = ":2,FS"
+)
+
+/*
+Maildir is a struct that ingests the messages delivered to a maildir, a directory with the new, cur and tmp directories
+every message of new is ingested and moved to cur, flagged when it is rejected so it can be found with any mail client,
+the directory is scanned again every Interval
+the mail server (or fetchmail, getmail, offlineimap, ...) delivers to new, so no mail service is needed by the server itself
+*/
+type Maildir struct {
+	Dir      string
+	Interval time.Duration
+	Ingester *Ingester
+	Logger   *slog.Logger
+}
+
+/*
+Start is a function that creates the directories of the maildir and scans it every Interval until the returned function is called
+the returned function stops the scans and waits for the scan in progress until ctx is done, it is one of the httpserver.Shutdown Close functions
+*/
+func (maildir *Maildir) Start() (func(ctx context.Context) error, error) {
+	for _, dir := range []string{"new", "cur", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(maildir.Dir, dir), 0o700); err != nil {
+			return nil, fmt.Errorf("creating the maildir: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(maildir.Interval)
+		defer ticker.Stop()
+		for {
+			if _, _, err := maildir.Scan(ctx); err != nil {
+				maildir.logger().Error("scanning the maildir", slog.String("dir", maildir.Dir), slog.String("error", err.Error()))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func(ctx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil
+}
+
+/*
+Scan is a function that ingests the messages of new in the order of their names, the order they were delivered in
+returns the number of messages processed and rejected, and an error if new cannot be read or a message cannot be moved to cur
+the scan stops between two messages when ctx is done
+*/
+func (maildir *Maildir) Scan(ctx context.Context) (int, int, error) {
+	entries, err := os.ReadDir(filepath.Join(maildir.Dir, "new"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	processed, rejected := 0, 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		logger := maildir.logger().With(slog.String("message", entry.Name()))
+		flags := processedFlags
+		if err := maildir.ingest(logging.WithLogger(ctx, logger), entry.Name()); err != nil {
+			logger.Warn("message rejected", slog.String("reason", err.Error()))
+			flags = rejectedFlags
+			rejected++
+		} else {
+			processed++
+		}
+
+		// the info of a message is after the colon of its name, the messages of new should have none
+		name, _, _ := strings.Cut(entry.Name(), ":")
+		if err := os.Rename(filepath.Join(maildir.Dir, "new", entry.Name()), filepath.Join(maildir.Dir, "cur", name+flags)); err != nil {
+			return processed, rejected, err
+		}
+	}
+	return processed, rejected, nil
+}
+
+// ingest ingests the message of new with the name, the receipt is logged with the name of the message
+func (maildir *Maildir) ingest(ctx context.Context, name string) error {
+	file, err := os.Open(filepath.Join(maildir.Dir, "new", name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil {
+		return err
+	} else if info.Size() > MaxMessageBytes {
+		return fmt.Errorf("the message is larger than %d bytes", MaxMessageBytes)
+	}
+	_, err = maildir.Ingester.Ingest(ctx, io.LimitReader(file, MaxMessageBytes))
+	return err
+}
+
+func (maildir *Maildir) logger() *slog.Logger {
+	if maildir.Logger != nil {
+		return maildir.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,151 @@
+package email
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+/*
+Message is the part of an e-mail the receipts are read from
+From is the address of the sender and To the addresses of the To, Cc and Delivered-To headers, in lower case
+Text and HTML are the first text/plain and text/html parts that are not attachments, decoded to UTF-8
+*/
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Date    time.Time
+	Text    string
+	HTML    string
+}
+
+// maxPartDepth is how deep multipart parts are nested at most, the deeper parts are ignored
+const maxPartDepth = 10
+
+// wordDecoder decodes the =?charset?encoding?text?= words of the headers
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+/*
+ParseMessage is a function that parses an RFC 822 message
+the multipart parts are walked depth first, their quoted-printable or base64 bodies decoded and their charset converted to UTF-8
+returns an error if the headers cannot be read or a part is malformed
+*/
+func ParseMessage(r io.Reader) (*Message, error) {
+	raw, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading the message: %w", err)
+	}
+
+	message := &Message{Subject: raw.Header.Get("Subject")}
+	if subject, err := wordDecoder.DecodeHeader(message.Subject); err == nil {
+		message.Subject = subject
+	}
+	message.Date, _ = raw.Header.Date()
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := parser.Parse(raw.Header.Get("From")); err == nil {
+		message.From = strings.ToLower(from.Address)
+	}
+	for _, name := range []string{"To", "Cc", "Delivered-To"} {
+		for _, value := range raw.Header[name] {
+			addresses, err := parser.ParseList(value)
+			if err != nil {
+				continue
+			}
+			for _, address := range addresses {
+				message.To = append(message.To, strings.ToLower(address.Address))
+			}
+		}
+	}
+
+	if err := message.readPart(textproto.MIMEHeader(raw.Header), raw.Body, 0); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+/*
+readPart reads the body of a part into the message, walking the parts of a multipart body
+a part without a Content-Type is text/plain in US-ASCII, attachments are skipped
+*/
+func (message *Message) readPart(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxPartDepth {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition")); disposition == "attachment" {
+		return nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading a %s part: %w", mediaType, err)
+			}
+			if err := message.readPart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	var target *string
+	switch {
+	case mediaType == "text/plain" && message.Text == "":
+		target = &message.Text
+	case mediaType == "text/html" && message.HTML == "":
+		target = &message.HTML
+	default:
+		return nil
+	}
+	content, err := decode(body, header.Get("Content-Transfer-Encoding"), params["charset"])
+	if err != nil {
+		return fmt.Errorf("decoding a %s part: %w", mediaType, err)
+	}
+	*target = content
+	return nil
+}
+
+/*
+decode returns the body decoded from its transfer encoding and converted from its charset to UTF-8
+the parts of a multipart body come without their quoted-printable encoding already, see multipart.Reader.NextPart
+*/
+func decode(body io.Reader, transferEncoding string, charsetLabel string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	switch strings.ToLower(charsetLabel) {
+	case "", "utf-8", "utf8", "us-ascii":
+	default:
+		converted, err := charset.NewReaderLabel(charsetLabel, body)
+		if err != nil {
+			return "", err
+		}
+		body = converted
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(string(content), "\r\n", "\n"), nil
+}
@@ -0,0 +1,318 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+Templates is a struct that contains the templates the receipts are read from the messages of the retailers with
+it is loaded from a JSON file, see email-templates.json in the root of the repository
+the first template matching the message is used, see Template.Matches
+*/
+type Templates struct {
+	Templates []Template `json:"templates"`
+}
+
+/*
+Template is a struct that describes how the receipt of a retailer is read from its messages
+Retailer is the retailer name of the receipts
+From are the sender addresses (receipts@target.com) or domains (@target.com) of the messages,
+Subject is a regular expression the subject matches, a message has to match both when both are set
+Part is the part the patterns are matched against, text or html (the text of the HTML part), the text part when it has one when empty
+
+Items is a regular expression matched against every line of the part, with the named groups description and price
+and the optional groups quantity and unitPrice, Discounts is one with the groups description and amount
+Total, Subtotal and Tax are regular expressions whose first group is the amount, see amount for the amounts
+Date and Time are matched like Total and parsed with their layout, the Date header of the message is used for the one that is not set
+*/
+type Template struct {
+	Retailer  string   `json:"retailer"`
+	From      []string `json:"from"`
+	Subject   string   `json:"subject"`
+	Part      string   `json:"part"`
+	Date      Field    `json:"date"`
+	Time      Field    `json:"time"`
+	Items     string   `json:"items"`
+	Discounts string   `json:"discounts"`
+	Subtotal  string   `json:"subtotal"`
+	Tax       string   `json:"tax"`
+	Total     string   `json:"total"`
+
+	subject   *regexp.Regexp
+	items     *regexp.Regexp
+	discounts *regexp.Regexp
+	subtotal  *regexp.Regexp
+	tax       *regexp.Regexp
+	total     *regexp.Regexp
+}
+
+// Field is a regular expression whose first group is parsed with the layout of time.Parse, e.g. "January 2, 2006" or "3:04 PM"
+type Field struct {
+	Pattern string `json:"pattern"`
+	Layout  string `json:"layout"`
+
+	pattern *regexp.Regexp
+}
+
+// the parts of a message a template reads
+const (
+	TextPart = "text"
+	HTMLPart = "html"
+)
+
+/*
+LoadTemplates is a function that reads the templates file at path and compiles it
+returns an error if the file cannot be read or a template is invalid
+*/
+func LoadTemplates(path string) (*Templates, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading templates file: %w", err)
+	}
+
+	var templates Templates
+	if err := json.Unmarshal(content, &templates); err != nil {
+		return nil, fmt.Errorf("parsing templates file %s: %w", path, err)
+	}
+	if err := templates.Compile(); err != nil {
+		return nil, fmt.Errorf("invalid templates file %s: %w", path, err)
+	}
+	return &templates, nil
+}
+
+/*
+Compile is a function that checks the templates and compiles their regular expressions
+it has to be called before Match when the Templates are not created with LoadTemplates
+*/
+func (templates *Templates) Compile() error {
+	for i := range templates.Templates {
+		template := &templates.Templates[i]
+		if err := template.compile(); err != nil {
+			return fmt.Errorf("template %d (%s): %w", i, template.Retailer, err)
+		}
+	}
+	return nil
+}
+
+func (template *Template) compile() error {
+	if strings.TrimSpace(template.Retailer) == "" {
+		return errors.New("the retailer is required")
+	}
+	if len(template.From) == 0 && template.Subject == "" {
+		return errors.New("from or subject is required, the template would match every message")
+	}
+	if template.Part != "" && template.Part != TextPart && template.Part != HTMLPart {
+		return fmt.Errorf("part %q is not %s or %s", template.Part, TextPart, HTMLPart)
+	}
+	for i, from := range template.From {
+		template.From[i] = strings.ToLower(strings.TrimSpace(from))
+	}
+
+	var errs []error
+	compile := func(name string, pattern string, groups ...string) *regexp.Regexp {
+		if pattern == "" {
+			return nil
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return nil
+		}
+		for _, group := range groups {
+			if compiled.SubexpIndex(group) < 0 {
+				errs = append(errs, fmt.Errorf("%s: the group (?P<%s>) is missing", name, group))
+			}
+		}
+		return compiled
+	}
+	compileValue := func(name string, pattern string) *regexp.Regexp {
+		compiled := compile(name, pattern)
+		if compiled != nil && compiled.NumSubexp() == 0 {
+			errs = append(errs, fmt.Errorf("%s: the group with the value is missing", name))
+		}
+		return compiled
+	}
+	if template.Items == "" {
+		errs = append(errs, errors.New("items is required"))
+	}
+	if template.Total == "" {
+		errs = append(errs, errors.New("total is required"))
+	}
+	template.subject = compile("subject", template.Subject)
+	template.items = compile("items", template.Items, "description", "price")
+	template.discounts = compile("discounts", template.Discounts, "description", "amount")
+	template.subtotal = compileValue("subtotal", template.Subtotal)
+	template.tax = compileValue("tax", template.Tax)
+	template.total = compileValue("total", template.Total)
+	for _, field := range []struct {
+		name  string
+		field *Field
+	}{{"date", &template.Date}, {"time", &template.Time}} {
+		if field.field.Pattern != "" && field.field.Layout == "" {
+			errs = append(errs, fmt.Errorf("%s: the layout is required with the pattern", field.name))
+		}
+		field.field.pattern = compileValue(field.name, field.field.Pattern)
+	}
+	return errors.Join(errs...)
+}
+
+// Match is a function that returns the first template matching the message, false when none does
+func (templates *Templates) Match(message *Message) (*Template, bool) {
+	if templates == nil {
+		return nil, false
+	}
+	for i := range templates.Templates {
+		if templates.Templates[i].Matches(message) {
+			return &templates.Templates[i], true
+		}
+	}
+	return nil, false
+}
+
+/*
+Matches is a function that reports whether the message is from one of the senders of the template and its subject matches
+a domain matches its subdomains too, @target.com matches receipts@email.target.com
+*/
+func (template *Template) Matches(message *Message) bool {
+	if len(template.From) > 0 && !slices.ContainsFunc(template.From, func(from string) bool {
+		if strings.HasPrefix(from, "@") {
+			return strings.HasSuffix(message.From, from) || strings.HasSuffix(message.From, "."+from[1:])
+		}
+		return message.From == from
+	}) {
+		return false
+	}
+	return template.subject == nil || template.subject.MatchString(message.Subject)
+}
+
+/*
+Receipt is a function that reads the receipt of the message with the template
+returns an error naming the first field that is not found or cannot be parsed, the receipt is not validated
+*/
+func (template *Template) Receipt(message *Message) (*models.Receipt, error) {
+	var text string
+	switch template.Part {
+	case TextPart:
+		text = message.Text
+	case HTMLPart:
+		text = htmlText(message.HTML)
+	default:
+		text = message.Body()
+	}
+
+	receipt := &models.Receipt{Retailer: template.Retailer}
+	var err error
+	if receipt.PurchaseDate, err = template.Date.read("date", text, message.Date, "2006-01-02"); err != nil {
+		return nil, err
+	}
+	if receipt.PurchaseTime, err = template.Time.read("time", text, message.Date, "15:04"); err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if groups, ok := namedGroups(template.items, line); ok {
+			receipt.Items = append(receipt.Items, models.Item{
+				ShortDescription: groups["description"],
+				Price:            amount(groups["price"]),
+				Quantity:         groups["quantity"],
+				UnitPrice:        amount(groups["unitPrice"]),
+			})
+		}
+		if groups, ok := namedGroups(template.discounts, line); ok {
+			receipt.Discounts = append(receipt.Discounts, models.Discount{Description: groups["description"], Amount: amount(groups["amount"])})
+		}
+	}
+	if len(receipt.Items) == 0 {
+		return nil, errors.New("no item is found")
+	}
+
+	total, ok := find(template.total, text)
+	if !ok {
+		return nil, errors.New("the total is not found")
+	}
+	receipt.Total = amount(total)
+	if subtotal, ok := find(template.subtotal, text); ok {
+		receipt.Subtotal = amount(subtotal)
+	}
+	if tax, ok := find(template.tax, text); ok {
+		receipt.Tax = amount(tax)
+	}
+	return receipt, nil
+}
+
+/*
+read is a function that returns the value of the field in the text, parsed with its layout and formatted with format
+when the template has no pattern for the field, the date of the message is used
+*/
+func (field Field) read(name string, text string, date time.Time, format string) (string, error) {
+	if field.pattern == nil {
+		if date.IsZero() {
+			return "", fmt.Errorf("the template has no %s and the message has no Date header", name)
+		}
+		return date.Format(format), nil
+	}
+	value, ok := find(field.pattern, text)
+	if !ok {
+		return "", fmt.Errorf("the %s is not found", name)
+	}
+	parsed, err := time.Parse(field.Layout, value)
+	if err != nil {
+		return "", fmt.Errorf("the %s %q does not match the layout %q", name, value, field.Layout)
+	}
+	return parsed.Format(format), nil
+}
+
+// find returns the first group of the first match of the pattern in the text, trimmed
+func find(pattern *regexp.Regexp, text string) (string, bool) {
+	if pattern == nil {
+		return "", false
+	}
+	match := pattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+	for _, group := range match[1:] {
+		if group = strings.TrimSpace(group); group != "" {
+			return group, true
+		}
+	}
+	return "", false
+}
+
+// namedGroups returns the named groups of the match of the pattern in the line, trimmed
+func namedGroups(pattern *regexp.Regexp, line string) (map[string]string, bool) {
+	if pattern == nil {
+		return nil, false
+	}
+	match := pattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+	groups := make(map[string]string)
+	for i, name := range pattern.SubexpNames() {
+		if name != "" {
+			groups[name] = strings.TrimSpace(match[i])
+		}
+	}
+	return groups, true
+}
+
+// amount returns the amount without its currency symbol, sign, spaces and thousands separators, "$1,234.50" is 1234.50
+func amount(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) || r == '.' {
+			return r
+		}
+		return -1
+	}, value)
+}
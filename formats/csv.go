@@ -0,0 +1,186 @@
+package formats
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+// CSV is the media type of receipts written as CSV
+const CSV = "text/csv"
+
+/*
+the columns of a receipt as CSV, named like the JSON fields
+one receipt per file, every row is an item, a discount or both, the receipt columns are repeated on every row
+or only given on the first, e.g.
+
+	retailer,purchaseDate,purchaseTime,total,shortDescription,price
+	Target,2022-01-01,13:01,6.49,Mountain Dew 12PK,6.49
+
+discounts have their own columns, discountDescription and discountAmount
+*/
+var (
+	receiptColumns = []column[models.Receipt]{
+		{"retailer", func(r *models.Receipt) *string { return &r.Retailer }},
+		{"purchaseDate", func(r *models.Receipt) *string { return &r.PurchaseDate }},
+		{"purchaseTime", func(r *models.Receipt) *string { return &r.PurchaseTime }},
+		{"total", func(r *models.Receipt) *string { return &r.Total }},
+		{"subtotal", func(r *models.Receipt) *string { return &r.Subtotal }},
+		{"tax", func(r *models.Receipt) *string { return &r.Tax }},
+		{"currency", func(r *models.Receipt) *string { return &r.Currency }},
+		{"timezone", func(r *models.Receipt) *string { return &r.Timezone }},
+		{"memberId", func(r *models.Receipt) *string { return &r.MemberID }},
+	}
+	itemColumns = []column[models.Item]{
+		{"shortDescription", func(i *models.Item) *string { return &i.ShortDescription }},
+		{"price", func(i *models.Item) *string { return &i.Price }},
+		{"quantity", func(i *models.Item) *string { return &i.Quantity }},
+		{"unitPrice", func(i *models.Item) *string { return &i.UnitPrice }},
+	}
+	discountColumns = []column[models.Discount]{
+		{"discountDescription", func(d *models.Discount) *string { return &d.Description }},
+		{"discountAmount", func(d *models.Discount) *string { return &d.Amount }},
+	}
+)
+
+// column is a column of the CSV and the field of T it holds
+type column[T any] struct {
+	name  string
+	field func(*T) *string
+}
+
+/*
+ReadReceiptCSV reads a receipt written as CSV, the first row is the header
+the columns are matched by name, in any order, and the columns it does not know are ignored,
+so the CSV written by WriteReceiptCSV reads back as the receipt it was written from
+returns an error if the CSV is malformed, a column is named twice, or a receipt column has two different values
+the receipt is not validated, a receipt without rows has no items
+*/
+func ReadReceiptCSV(r io.Reader) (*models.Receipt, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the CSV has no header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := map[string]int{}
+	for i, name := range header {
+		// spreadsheets save CSV with a byte order mark
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF"))
+		if _, ok := indexes[name]; ok {
+			return nil, fmt.Errorf("the column %s is named twice", name)
+		}
+		indexes[name] = i
+	}
+
+	receipt := &models.Receipt{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if i, ok := indexes[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		for _, column := range receiptColumns {
+			field := column.field(receipt)
+			if v := value(column.name); v != "" && *field == "" {
+				*field = v
+			} else if v != "" && v != *field {
+				return nil, fmt.Errorf("row %d: the %s %q differs from %q", line, column.name, v, *field)
+			}
+		}
+		var item models.Item
+		if readRow(itemColumns, &item, value) {
+			receipt.Items = append(receipt.Items, item)
+		}
+		var discount models.Discount
+		if readRow(discountColumns, &discount, value) {
+			receipt.Discounts = append(receipt.Discounts, discount)
+		}
+	}
+	return receipt, nil
+}
+
+// readRow reads the columns of the row into the value, reports whether any of them has a value
+func readRow[T any](columns []column[T], into *T, value func(name string) string) bool {
+	found := false
+	for _, column := range columns {
+		if v := value(column.name); v != "" {
+			*column.field(into) = v
+			found = true
+		}
+	}
+	return found
+}
+
+/*
+WriteReceiptCSV writes the receipt as CSV, with a row per item followed by a row per discount
+the processed fields id, points, retailerId, submittedRetailer, purchasedAt, createdAt, apiKeyId and partnerId
+and the category of the items have columns too, the breakdown of the points has none
+every column is written, empty when the receipt has no value for it, so the header is the same for every receipt
+*/
+func WriteReceiptCSV(w io.Writer, receipt *models.Receipt) error {
+	header := []string{"id"}
+	for _, column := range receiptColumns {
+		header = append(header, column.name)
+	}
+	header = append(header, "points", "retailerId", "submittedRetailer", "purchasedAt", "createdAt", "apiKeyId", "partnerId")
+	for _, column := range itemColumns {
+		header = append(header, column.name)
+	}
+	header = append(header, "category")
+	for _, column := range discountColumns {
+		header = append(header, column.name)
+	}
+
+	fields := []string{receipt.ID}
+	for _, column := range receiptColumns {
+		fields = append(fields, *column.field(receipt))
+	}
+	fields = append(fields, strconv.FormatInt(receipt.Points, 10), receipt.RetailerID, receipt.SubmittedRetailer,
+		formatTime(receipt.PurchasedAt), formatTime(receipt.CreatedAt), receipt.APIKeyID, receipt.PartnerID)
+
+	records := [][]string{header}
+	for i := range receipt.Items {
+		record := append([]string{}, fields...)
+		for _, column := range itemColumns {
+			record = append(record, *column.field(&receipt.Items[i]))
+		}
+		record = append(record, receipt.Items[i].Category, "", "")
+		records = append(records, record)
+	}
+	for i := range receipt.Discounts {
+		record := append([]string{}, fields...)
+		record = append(record, make([]string, len(itemColumns)+1)...)
+		for _, column := range discountColumns {
+			record = append(record, *column.field(&receipt.Discounts[i]))
+		}
+		records = append(records, record)
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
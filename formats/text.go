@@ -0,0 +1,314 @@
+package formats
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+)
+
+/*
+TextReceipt is a receipt read from free-form text, e.g. the text OCR finds on a scanned receipt
+Confidence is how sure the parser is of every field, from 0 (not found) to 1, by the JSON name of the field,
+e.g. retailer, purchaseDate, items[0] and discounts[0], retailer, purchaseDate, purchaseTime and total are always there
+Unparsed are the lines before the total that were not read into any field, in their order
+*/
+type TextReceipt struct {
+	Receipt    *models.Receipt    `json:"receipt"`
+	Confidence map[string]float64 `json:"confidence"`
+	Unparsed   []string           `json:"unparsed"`
+}
+
+// quantityPattern is a quantity and a unit price, e.g. 2 @ 2.25, 3 x $1.00 or 1.250 kg @ 3.20/kg
+const quantityPattern = `(\d+(?:\.\d{1,3})?)\s*(?:lbs?|kg|oz)?\s*(?:@|x)\s*\$?(\d+\.\d{2})(?:\s*/\s*(?:lbs?|kg|oz|ea))?`
+
+var (
+	// an amount at the end of a line, e.g. 6.49, $1,234.00 or 0.50-, followed by the tax flags some stores print
+	trailingAmount = regexp.MustCompile(`(-)?\$?\s?(\d{1,3}(?:,\d{3})+|\d+)\.(\d{2})(-)?(?:\s+[A-Z]{1,2})?$`)
+	// a quantity and a unit price in an item line, or on a line of its own above the item
+	quantityPrice = regexp.MustCompile(`(?i)` + quantityPattern)
+	quantityLine  = regexp.MustCompile(`(?i)^` + quantityPattern + `$`)
+	// the UPC or SKU printed with an item, with the flag that may follow it
+	itemCode = regexp.MustCompile(`\b\d{8,}\b(\s+[A-Z]\b)?`)
+
+	isoDate   = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	slashDate = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4}|\d{2})\b`)
+	namedDate = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+(\d{1,2}),?\s+(\d{4})\b`)
+	clockTime = regexp.MustCompile(`\b(\d{1,2}):(\d{2})(?::\d{2})?(?:\s*([AaPp])\.?[Mm]\b\.?)?`)
+
+	totalLabel    = regexp.MustCompile(`^(GRAND\s+)?TOTAL\b|^(AMOUNT|BALANCE)\s+(DUE|TO\s+PAY)\b`)
+	subtotalLabel = regexp.MustCompile(`^SUB\s*-?\s*TOTAL\b`)
+	taxLabel      = regexp.MustCompile(`^(SALES\s+)?TAX\b|^(HST|GST|VAT)\b`)
+	paymentLabel  = regexp.MustCompile(`\b(CASH|CHANGE|VISA|MASTERCARD|AMEX|DEBIT|CREDIT|CARD|TEND|TENDERED|PAYMENT|PAID)\b`)
+	discountLabel = regexp.MustCompile(`\b(COUPON|DISCOUNT|SAVINGS|PROMO)\b`)
+	// the characters the alphanumeric validation does not allow
+	disallowed = regexp.MustCompile(`[^\w\s\-&]+`)
+)
+
+/*
+ParseReceiptText reads a receipt from text, a line at a time:
+the first line with letters before the items is the retailer, the first date and time found anywhere are the purchase date and time,
+the lines ending with an amount are items, discounts (negative amounts or coupons), the subtotal, the tax or the total,
+and the lines after the total only give the date and time, the payment lines are skipped
+a quantity and unit price, e.g. 2 @ 2.25, is read from the item line or from the line above it
+the receipt is not validated, the fields that were not found are left empty
+*/
+func ParseReceiptText(text string) *TextReceipt {
+	parsed := &TextReceipt{
+		Receipt:    &models.Receipt{},
+		Confidence: map[string]float64{"retailer": 0, "purchaseDate": 0, "purchaseTime": 0, "total": 0},
+		Unparsed:   []string{},
+	}
+	receipt := parsed.Receipt
+	var pendingQuantity []string
+	totalSeen := false
+	firstLine := true
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(strings.TrimPrefix(line, "\uFEFF")), " ")
+		if line == "" {
+			continue
+		}
+		first := firstLine
+		firstLine = false
+
+		used := parsed.readDateTime(line)
+		if totalSeen {
+			continue
+		}
+		if match := quantityLine.FindStringSubmatch(line); match != nil {
+			pendingQuantity = match[1:]
+			continue
+		}
+
+		match := trailingAmount.FindStringSubmatchIndex(line)
+		if match == nil {
+			if !used && receipt.Retailer == "" && len(receipt.Items) == 0 && strings.IndexFunc(line, isLetter) >= 0 {
+				parsed.readRetailer(line, first)
+			} else if !used {
+				parsed.Unparsed = append(parsed.Unparsed, line)
+			}
+			continue
+		}
+		label := strings.TrimSpace(line[:match[0]])
+		upper := strings.ToUpper(label)
+		cents, _ := strconv.ParseInt(strings.ReplaceAll(line[match[4]:match[5]], ",", "")+line[match[6]:match[7]], 10, 64)
+		negative := match[2] >= 0 || match[8] >= 0
+
+		switch {
+		case totalLabel.MatchString(upper):
+			receipt.Total = formatCents(cents)
+			totalSeen = true
+		case subtotalLabel.MatchString(upper):
+			receipt.Subtotal = formatCents(cents)
+		case taxLabel.MatchString(upper):
+			receipt.Tax = formatCents(cents)
+		case paymentLabel.MatchString(upper):
+		case negative || discountLabel.MatchString(upper):
+			description, changed := clean(label)
+			confidence := 0.9
+			if changed {
+				confidence = 0.7
+			}
+			if description == "" {
+				description, confidence = "Discount", 0.5
+			}
+			parsed.Confidence[fmt.Sprintf("discounts[%d]", len(receipt.Discounts))] = confidence
+			receipt.Discounts = append(receipt.Discounts, models.Discount{Description: description, Amount: formatCents(cents)})
+		case label == "" && pendingQuantity == nil:
+			parsed.Unparsed = append(parsed.Unparsed, line)
+		default:
+			parsed.readItem(label, cents, pendingQuantity)
+		}
+		pendingQuantity = nil
+	}
+
+	parsed.scoreAmounts()
+	return parsed
+}
+
+// readRetailer reads the retailer from the line, less sure when it is not the first line or had to be cleaned up
+func (parsed *TextReceipt) readRetailer(line string, first bool) {
+	retailer, changed := clean(line)
+	if retailer == "" {
+		parsed.Unparsed = append(parsed.Unparsed, line)
+		return
+	}
+	confidence := 0.9
+	if !first {
+		confidence -= 0.2
+	}
+	if changed {
+		confidence -= 0.2
+	}
+	parsed.Receipt.Retailer = retailer
+	parsed.Confidence["retailer"] = round(confidence)
+}
+
+// readItem reads an item from the label and the price of its line, with the quantity of the line above when it had one
+func (parsed *TextReceipt) readItem(label string, cents int64, quantity []string) {
+	item := models.Item{Price: formatCents(cents)}
+	if match := quantityPrice.FindStringSubmatchIndex(label); match != nil {
+		quantity = []string{label[match[2]:match[3]], label[match[4]:match[5]]}
+		label = label[:match[0]] + " " + label[match[1]:]
+	}
+	label = itemCode.ReplaceAllString(label, " ")
+	description, changed := clean(label)
+	item.ShortDescription = description
+
+	confidence := 0.9
+	if changed {
+		confidence = 0.7
+	}
+	if quantity != nil {
+		item.Quantity, item.UnitPrice = quantity[0], quantity[1]
+		thousandths, _ := validators.ParseFixed(item.Quantity, 3)
+		unitPrice, _ := validators.ParseFixed(item.UnitPrice, 2)
+		if (thousandths*unitPrice+500)/1000 != cents {
+			confidence = 0.5
+		}
+	}
+	if description == "" {
+		item.ShortDescription, confidence = "Item", 0.2
+	}
+	parsed.Confidence[fmt.Sprintf("items[%d]", len(parsed.Receipt.Items))] = confidence
+	parsed.Receipt.Items = append(parsed.Receipt.Items, item)
+}
+
+/*
+readDateTime reads the purchase date and time from the line when they were not found yet, reports whether it found either
+an ISO date is certain, a month name nearly, a date with slashes is read as month/day/year
+unless the month cannot be one, and is less sure with a two digit year or when the day could be the month
+*/
+func (parsed *TextReceipt) readDateTime(line string) bool {
+	found := false
+	if parsed.Receipt.PurchaseDate == "" {
+		var year, month, day int
+		confidence := 0.0
+		if match := isoDate.FindStringSubmatch(line); match != nil {
+			year, month, day, confidence = atoi(match[1]), atoi(match[2]), atoi(match[3]), 1
+		} else if match := namedDate.FindStringSubmatch(line); match != nil {
+			parsedMonth, _ := time.Parse("Jan", strings.ToUpper(match[1][:1])+strings.ToLower(match[1][1:3]))
+			year, month, day, confidence = atoi(match[3]), int(parsedMonth.Month()), atoi(match[2]), 0.95
+		} else if match := slashDate.FindStringSubmatch(line); match != nil {
+			month, day, year, confidence = atoi(match[1]), atoi(match[2]), atoi(match[3]), 0.9
+			if len(match[3]) == 2 {
+				year, confidence = 2000+year, confidence-0.1
+			}
+			if month > 12 {
+				month, day, confidence = day, month, confidence-0.2
+			} else if day <= 12 && day != month {
+				confidence -= 0.1
+			}
+		}
+		date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if confidence > 0 && date.Year() == year && int(date.Month()) == month && date.Day() == day {
+			parsed.Receipt.PurchaseDate = date.Format("2006-01-02")
+			parsed.Confidence["purchaseDate"] = round(confidence)
+			found = true
+		}
+	}
+
+	if parsed.Receipt.PurchaseTime == "" {
+		if match := clockTime.FindStringSubmatch(line); match != nil {
+			hour, minute, meridiem := atoi(match[1]), atoi(match[2]), strings.ToUpper(match[3])
+			confidence := 0.9
+			if meridiem != "" || hour > 12 {
+				confidence = 1
+			}
+			if meridiem == "P" && hour < 12 {
+				hour += 12
+			} else if meridiem == "A" && hour == 12 {
+				hour = 0
+			}
+			if hour < 24 && minute < 60 && (meridiem == "" || atoi(match[1]) <= 12) {
+				parsed.Receipt.PurchaseTime = fmt.Sprintf("%02d:%02d", hour, minute)
+				parsed.Confidence["purchaseTime"] = confidence
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+/*
+scoreAmounts scores the subtotal, the tax and the total once every line is read
+the subtotal is certain when it is the sum of the items, the total when it is the subtotal less the discounts plus the tax,
+a receipt without a total line gets the sum of its items with a low confidence
+*/
+func (parsed *TextReceipt) scoreAmounts() {
+	receipt := parsed.Receipt
+	var items int64
+	for _, item := range receipt.Items {
+		price, _ := validators.ParseFixed(item.Price, 2)
+		items += price
+	}
+	expected := items
+	if receipt.Subtotal != "" {
+		subtotal, _ := validators.ParseFixed(receipt.Subtotal, 2)
+		parsed.Confidence["subtotal"] = agreement(subtotal, items)
+		expected = subtotal
+	}
+	for _, discount := range receipt.Discounts {
+		amount, _ := validators.ParseFixed(discount.Amount, 2)
+		expected -= amount
+	}
+	if receipt.Tax != "" {
+		tax, _ := validators.ParseFixed(receipt.Tax, 2)
+		parsed.Confidence["tax"] = 0.9
+		expected += tax
+	}
+
+	if receipt.Total == "" {
+		if len(receipt.Items) > 0 {
+			receipt.Total = formatCents(expected)
+			parsed.Confidence["total"] = 0.4
+		}
+		return
+	}
+	total, _ := validators.ParseFixed(receipt.Total, 2)
+	parsed.Confidence["total"] = agreement(total, expected)
+}
+
+// agreement is the confidence of an amount that should equal the expected one
+func agreement(amount int64, expected int64) float64 {
+	if amount == expected {
+		return 1
+	}
+	return 0.6
+}
+
+// clean removes the characters the alphanumeric validation does not allow, apostrophes go, the others become spaces
+// reports whether it changed anything but the spacing
+func clean(text string) (string, bool) {
+	cleaned := disallowed.ReplaceAllStringFunc(text, func(s string) string {
+		if strings.Trim(s, "'’") == "" {
+			return ""
+		}
+		return " "
+	})
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+	return cleaned, cleaned != strings.Join(strings.Fields(text), " ")
+}
+
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// round rounds a confidence to two decimals, so the sums of the scores do not print as 0.49999999999999994
+func round(confidence float64) float64 {
+	return float64(int64(confidence*100+0.5)) / 100
+}
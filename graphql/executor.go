@@ -0,0 +1,848 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Request is a GraphQL request, the body of a POST or the query parameters of a GET
+type Request struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+}
+
+/*
+Response is the result of a request
+Data is left out when the request could not be executed, and is null when a non-null field of the root is null
+*/
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+/*
+Error is an error of a request, Locations are the places in the query it is about
+and Path is the response key and list index of every level down to the field that failed
+*/
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	Path      []any      `json:"path,omitempty"`
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+/*
+Operation is a request that is parsed and validated against the schema and ready to be executed
+Kind is query or mutation
+*/
+type Operation struct {
+	Kind string
+
+	schema    *Schema
+	document  *document
+	operation *operation
+	variables map[string]any
+	args      map[*field]map[string]any
+}
+
+// Execute prepares the request and executes its operation
+func (schema *Schema) Execute(ctx context.Context, request Request) *Response {
+	operation, errs := schema.Prepare(request)
+	if errs != nil {
+		return &Response{Errors: errs}
+	}
+	return operation.Execute(ctx)
+}
+
+/*
+Prepare parses the query of the request, picks its operation, coerces its variables and the arguments of its fields
+and validates its selections against the schema, returns the errors when the request cannot be executed
+*/
+func (schema *Schema) Prepare(request Request) (*Operation, []*Error) {
+	document, err := parse(request.Query, schema.MaxDepth)
+	if err != nil {
+		return nil, []*Error{asError(err)}
+	}
+	var selected *operation
+	for _, operation := range document.operations {
+		switch {
+		case request.OperationName == "" && selected != nil:
+			return nil, []*Error{{Message: "Must provide operation name if query contains multiple operations."}}
+		case request.OperationName == "" || request.OperationName == operation.name:
+			selected = operation
+		}
+	}
+	if selected == nil {
+		return nil, []*Error{{Message: fmt.Sprintf("Unknown operation named %q.", request.OperationName)}}
+	}
+	switch {
+	case selected.kind == "subscription":
+		return nil, []*Error{{Message: "Subscriptions are not supported.", Locations: []Location{selected.location}}}
+	case selected.kind == "mutation" && schema.mutation == nil:
+		return nil, []*Error{{Message: "Schema is not configured for mutations.", Locations: []Location{selected.location}}}
+	}
+
+	operation := &Operation{
+		Kind:      selected.kind,
+		schema:    schema,
+		document:  document,
+		operation: selected,
+		variables: map[string]any{},
+		args:      map[*field]map[string]any{},
+	}
+	validator := &validator{Operation: operation, defined: map[string]bool{}}
+	validator.coerceVariables(request.Variables)
+	validator.fragmentCycles()
+	if len(validator.errors) == 0 {
+		root := schema.query
+		if selected.kind == "mutation" {
+			root = schema.mutation
+		}
+		validator.selectionSet(root, selected.selections, 1)
+	}
+	if len(validator.errors) > 0 {
+		return nil, validator.errors
+	}
+	return operation, nil
+}
+
+func asError(err error) *Error {
+	if graphqlError, ok := err.(*Error); ok {
+		return graphqlError
+	}
+	return &Error{Message: err.Error()}
+}
+
+// validator checks an operation before it is executed, and keeps the coerced arguments of its fields
+type validator struct {
+	*Operation
+	errors  []*Error
+	defined map[string]bool
+	tooDeep bool
+}
+
+func (validator *validator) report(location Location, format string, args ...any) {
+	validator.errors = append(validator.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{location}})
+}
+
+// coerceVariables coerces the values of the variables to the types of their definitions, the defaults fill in the missing ones
+func (validator *validator) coerceVariables(values map[string]any) {
+	for _, definition := range validator.operation.variables {
+		if validator.defined[definition.name] {
+			validator.report(definition.location, "There can be only one variable named \"$%s\".", definition.name)
+			continue
+		}
+		validator.defined[definition.name] = true
+		named := definition.typ
+		for named.elem != nil {
+			named = named.elem
+		}
+		if _, ok := validator.schema.types[named.name].(*InputObject); !ok && !scalars[named.name] {
+			validator.report(definition.location, "Variable \"$%s\" cannot be non-input type \"%s\".", definition.name, definition.typ)
+			continue
+		}
+
+		value, ok := values[definition.name]
+		if !ok && definition.hasDefault {
+			value, ok = definition.defaultValue, true
+		}
+		if !ok {
+			if definition.typ.nonNull {
+				validator.report(definition.location, "Variable \"$%s\" of required type \"%s\" was not provided.", definition.name, definition.typ)
+			}
+			continue
+		}
+		coerced, err := validator.coerce(definition.typ, value)
+		if err != nil {
+			validator.report(definition.location, "Variable \"$%s\" got invalid value; %v", definition.name, err)
+			continue
+		}
+		validator.variables[definition.name] = coerced
+	}
+}
+
+// fragmentCycles reports the fragments that spread themselves, directly or through other fragments at any depth
+func (validator *validator) fragmentCycles() {
+	var spreads func(selections []selection) []*fragmentSpread
+	spreads = func(selections []selection) []*fragmentSpread {
+		var found []*fragmentSpread
+		for _, selection := range selections {
+			switch selection := selection.(type) {
+			case *field:
+				found = append(found, spreads(selection.selections)...)
+			case *inlineFragment:
+				found = append(found, spreads(selection.selections)...)
+			case *fragmentSpread:
+				found = append(found, selection)
+			}
+		}
+		return found
+	}
+	// done are the fragments without cycles, visiting the fragments on the path of the search
+	done, visiting := map[string]bool{}, map[string]bool{}
+	var visit func(fragment *fragment) bool
+	visit = func(fragment *fragment) bool {
+		if done[fragment.name] {
+			return true
+		}
+		visiting[fragment.name] = true
+		defer delete(visiting, fragment.name)
+		for _, spread := range spreads(fragment.selections) {
+			if visiting[spread.name] {
+				validator.report(spread.location, "Cannot spread fragment %q within itself.", spread.name)
+				return false
+			}
+			if next, ok := validator.document.fragments[spread.name]; ok && !visit(next) {
+				return false
+			}
+		}
+		done[fragment.name] = true
+		return true
+	}
+	for _, fragment := range validator.document.fragments {
+		if !visit(fragment) {
+			return
+		}
+	}
+}
+
+// selectionSet validates the selections of an object type, the fields of the same response key are validated together
+func (validator *validator) selectionSet(object *Object, selections []selection, depth int) {
+	if max := validator.schema.MaxDepth; max > 0 && depth > max {
+		if !validator.tooDeep {
+			validator.tooDeep = true
+			validator.errors = append(validator.errors, &Error{Message: fmt.Sprintf("The query is nested deeper than %d levels.", max)})
+		}
+		return
+	}
+	for _, group := range validator.collectFields(object, selections, validator.report) {
+		first := group.fields[0]
+		if first.name == "__typename" {
+			for _, field := range group.fields {
+				if len(field.arguments) > 0 || len(field.selections) > 0 {
+					validator.report(field.location, "Field \"__typename\" has no arguments and no subfields.")
+				}
+			}
+			continue
+		}
+		definition := object.field(first.name)
+		if definition == nil {
+			validator.report(first.location, "Cannot query field %q on type %q.", first.name, object.Name)
+			continue
+		}
+		for _, field := range group.fields {
+			if field.name != first.name {
+				validator.report(field.location, "Fields %q conflict because %s and %s are different fields.", group.key, first.name, field.name)
+				continue
+			}
+			validator.arguments(object, definition, field)
+			if !reflect.DeepEqual(validator.args[field], validator.args[first]) {
+				validator.report(field.location, "Fields %q conflict because they have differing arguments.", group.key)
+			}
+		}
+
+		named := definition.typ
+		for named.elem != nil {
+			named = named.elem
+		}
+		child := validator.schema.object(named.name)
+		selections := group.selections()
+		switch {
+		case child == nil && len(selections) > 0:
+			validator.report(first.location, "Field %q must not have a selection since type %q has no subfields.", first.name, definition.Type)
+		case child != nil && len(selections) == 0:
+			validator.report(first.location, "Field %q of type %q must have a selection of subfields.", first.name, definition.Type)
+		case child != nil:
+			validator.selectionSet(child, selections, depth+1)
+		}
+	}
+}
+
+// arguments coerces the arguments of the field to the types of the definition
+func (validator *validator) arguments(object *Object, definition *Field, field *field) {
+	args := map[string]any{}
+	validator.args[field] = args
+	for _, argument := range field.arguments {
+		arg := definition.args[argument.name]
+		if arg == nil {
+			validator.report(argument.location, "Unknown argument %q on field \"%s.%s\".", argument.name, object.Name, field.name)
+			continue
+		}
+		if _, ok := args[argument.name]; ok {
+			validator.report(argument.location, "There can be only one argument named %q.", argument.name)
+			continue
+		}
+		value, ok, err := validator.literal(argument.value)
+		if err == nil && ok {
+			value, err = validator.coerce(arg.typ, value)
+		}
+		if err != nil {
+			validator.report(argument.location, "Argument %q has invalid value; %v", argument.name, err)
+			continue
+		}
+		if ok {
+			args[argument.name] = value
+		}
+	}
+	for _, arg := range definition.Args {
+		if _, ok := args[arg.Name]; !ok && arg.typ.nonNull {
+			validator.report(field.location, "Field %q argument %q of type %q is required, but it was not provided.", field.name, arg.Name, arg.Type)
+		}
+	}
+}
+
+// fieldGroup are the fields selected under the same response key, they are resolved once
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// selections returns the selections of all the fields of the group, which are merged
+func (group *fieldGroup) selections() []selection {
+	var selections []selection
+	for _, field := range group.fields {
+		selections = append(selections, field.selections...)
+	}
+	return selections
+}
+
+/*
+collectFields returns the fields of the selections by response key, in the order they are first selected
+the fragments on the object type are expanded and the fields skipped by @skip and @include are left out
+the fragments that are unknown, on another type or spread within themselves are reported and left out
+*/
+func (operation *Operation) collectFields(object *Object, selections []selection, report func(Location, string, ...any)) []*fieldGroup {
+	var groups []*fieldGroup
+	index := map[string]*fieldGroup{}
+	visiting := map[string]bool{}
+	var collect func(selections []selection)
+	collect = func(selections []selection) {
+		for _, selection := range selections {
+			switch selection := selection.(type) {
+			case *field:
+				if !operation.include(selection.directives, report) {
+					continue
+				}
+				key := selection.responseKey()
+				if group, ok := index[key]; ok {
+					group.fields = append(group.fields, selection)
+					continue
+				}
+				index[key] = &fieldGroup{key: key, fields: []*field{selection}}
+				groups = append(groups, index[key])
+			case *inlineFragment:
+				if operation.include(selection.directives, report) && operation.applies(object, selection.typeCondition, "", selection.location, report) {
+					collect(selection.selections)
+				}
+			case *fragmentSpread:
+				if !operation.include(selection.directives, report) {
+					continue
+				}
+				fragment, ok := operation.document.fragments[selection.name]
+				switch {
+				case !ok:
+					report(selection.location, "Unknown fragment %q.", selection.name)
+				case visiting[selection.name]:
+					report(selection.location, "Cannot spread fragment %q within itself.", selection.name)
+				case operation.applies(object, fragment.typeCondition, selection.name, selection.location, report):
+					visiting[selection.name] = true
+					collect(fragment.selections)
+					visiting[selection.name] = false
+				}
+			}
+		}
+	}
+	collect(selections)
+	return groups
+}
+
+// applies reports whether a fragment with the type condition applies to the object type, there are no interfaces or unions
+func (operation *Operation) applies(object *Object, typeCondition string, fragment string, location Location, report func(Location, string, ...any)) bool {
+	if typeCondition == "" || typeCondition == object.Name {
+		return true
+	}
+	if operation.schema.object(typeCondition) == nil {
+		report(location, "Unknown type %q.", typeCondition)
+	} else if fragment != "" {
+		report(location, "Fragment %q cannot be spread here as objects of type %q can never be of type %q.", fragment, object.Name, typeCondition)
+	} else {
+		report(location, "Fragment cannot be spread here as objects of type %q can never be of type %q.", object.Name, typeCondition)
+	}
+	return false
+}
+
+// include evaluates the @skip and @include directives, the other directives are reported
+func (operation *Operation) include(directives []*directive, report func(Location, string, ...any)) bool {
+	include := true
+	for _, directive := range directives {
+		if directive.name != "skip" && directive.name != "include" {
+			report(directive.location, "Unknown directive \"@%s\".", directive.name)
+			continue
+		}
+		var condition any
+		var ok bool
+		var err error
+		if len(directive.arguments) == 1 && directive.arguments[0].name == "if" {
+			condition, ok, err = operation.literal(directive.arguments[0].value)
+		}
+		value, isBool := condition.(bool)
+		if err != nil || !ok || !isBool {
+			report(directive.location, "Directive \"@%s\" argument \"if\" of type \"Boolean!\" is required.", directive.name)
+			continue
+		}
+		if value == (directive.name == "skip") {
+			include = false
+		}
+	}
+	return include
+}
+
+/*
+literal returns the value of an argument with the values of its variables
+returns false when the value is a variable that is not given, such a variable in a list is null and in an object left out
+*/
+func (operation *Operation) literal(value any) (any, bool, error) {
+	switch value := value.(type) {
+	case variable:
+		if !operation.defines(string(value)) {
+			return nil, false, fmt.Errorf("variable \"$%s\" is not defined", value)
+		}
+		variableValue, ok := operation.variables[string(value)]
+		return variableValue, ok, nil
+	case []any:
+		list := make([]any, len(value))
+		for i, item := range value {
+			itemValue, _, err := operation.literal(item)
+			if err != nil {
+				return nil, false, err
+			}
+			list[i] = itemValue
+		}
+		return list, true, nil
+	case map[string]any:
+		object := map[string]any{}
+		for name, fieldValue := range value {
+			fieldValue, ok, err := operation.literal(fieldValue)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				object[name] = fieldValue
+			}
+		}
+		return object, true, nil
+	}
+	return value, true, nil
+}
+
+func (operation *Operation) defines(name string) bool {
+	for _, definition := range operation.operation.variables {
+		if definition.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+coerce coerces an input value to the type, see Field for the Go types of the values
+a single value is coerced to a list of one, and an integer to a Float or an ID, like the spec does
+*/
+func (operation *Operation) coerce(typ *typeRef, value any) (any, error) {
+	if value == nil {
+		if typ.nonNull {
+			return nil, fmt.Errorf("expected a value of type %q, found null", typ)
+		}
+		return nil, nil
+	}
+	if typ.elem != nil {
+		items, ok := value.([]any)
+		if !ok {
+			item, err := operation.coerce(typ.elem, value)
+			return []any{item}, err
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			coerced, err := operation.coerce(typ.elem, item)
+			if err != nil {
+				return nil, fmt.Errorf("at index %d: %w", i, err)
+			}
+			list[i] = coerced
+		}
+		return list, nil
+	}
+
+	input, ok := operation.schema.types[typ.name].(*InputObject)
+	if !ok {
+		return coerceScalar(typ.name, value)
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected an object of type %q", typ.name)
+	}
+	object := map[string]any{}
+	for name := range fields {
+		if input.fields[name] == nil {
+			return nil, fmt.Errorf("field %q is not defined by type %q", name, typ.name)
+		}
+	}
+	for _, field := range input.Fields {
+		fieldValue, ok := fields[field.Name]
+		if !ok {
+			if field.typ.nonNull {
+				return nil, fmt.Errorf("field \"%s.%s\" of required type %q was not provided", typ.name, field.Name, field.Type)
+			}
+			continue
+		}
+		coerced, err := operation.coerce(field.typ, fieldValue)
+		if err != nil {
+			return nil, fmt.Errorf("in field %q: %w", field.Name, err)
+		}
+		object[field.Name] = coerced
+	}
+	return object, nil
+}
+
+// coerceScalar coerces an input value to a built-in scalar, the numbers of the JSON variables are float64
+func coerceScalar(name string, value any) (any, error) {
+	switch name {
+	case "Int":
+		integer, ok := toInteger(value)
+		if ok && integer >= math.MinInt32 && integer <= math.MaxInt32 {
+			return int(integer), nil
+		}
+	case "Float":
+		switch value := value.(type) {
+		case float64:
+			return value, nil
+		case int64:
+			return float64(value), nil
+		case int:
+			return float64(value), nil
+		}
+	case "String":
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+	case "ID":
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+		if integer, ok := toInteger(value); ok {
+			return strconv.FormatInt(integer, 10), nil
+		}
+	case "Boolean":
+		if boolean, ok := value.(bool); ok {
+			return boolean, nil
+		}
+	}
+	return nil, fmt.Errorf("%s cannot represent %s", name, describe(value))
+}
+
+func toInteger(value any) (int64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return value, true
+	case int:
+		return int64(value), true
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value), true
+		}
+	}
+	return 0, false
+}
+
+func describe(value any) string {
+	switch value := value.(type) {
+	case enumValue:
+		return "the enum value " + string(value)
+	case string:
+		return strconv.Quote(value)
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprint(value)
+}
+
+// failed is the value of a field that is null because of an error, it makes the nearest nullable parent null
+var failed any = struct{ failed bool }{true}
+
+// executor executes a prepared operation and collects the errors of its fields
+type executor struct {
+	*Operation
+	ctx    context.Context
+	errors []*Error
+}
+
+/*
+Execute executes the operation, the fields of a mutation are executed one after the other
+the fields that fail are null, with their errors in the response
+*/
+func (operation *Operation) Execute(ctx context.Context) *Response {
+	executor := &executor{Operation: operation, ctx: ctx}
+	root := operation.schema.query
+	if operation.Kind == "mutation" {
+		root = operation.schema.mutation
+	}
+	data := executor.selectionSet(root, []any{nil}, [][]any{nil}, operation.operation.selections)[0]
+	if data == failed {
+		return &Response{Data: json.RawMessage("null"), Errors: executor.errors}
+	}
+	return &Response{Data: data, Errors: executor.errors}
+}
+
+func (executor *executor) fail(path []any, field *field, message string) {
+	executor.errors = append(executor.errors, &Error{Message: message, Locations: []Location{field.location}, Path: path})
+}
+
+// selectionSet resolves the selections of the sources of an object type, each field of all the sources at once
+func (executor *executor) selectionSet(object *Object, sources []any, paths [][]any, selections []selection) []any {
+	results := make([]any, len(sources))
+	objects := make([]*responseObject, len(sources))
+	for i := range sources {
+		objects[i] = &responseObject{}
+		results[i] = objects[i]
+	}
+	ignore := func(Location, string, ...any) {}
+	for _, group := range executor.collectFields(object, selections, ignore) {
+		first := group.fields[0]
+		if first.name == "__typename" {
+			for _, result := range objects {
+				result.set(group.key, object.Name)
+			}
+			continue
+		}
+		definition := object.field(first.name)
+		fieldPaths := make([][]any, len(sources))
+		for i := range sources {
+			fieldPaths[i] = appendPath(paths[i], group.key)
+		}
+		values := executor.resolve(definition, first, sources, fieldPaths)
+		values = executor.complete(definition.typ, first, values, fieldPaths, group.selections())
+		for i, value := range values {
+			if value == failed {
+				results[i] = failed
+			} else {
+				objects[i].set(group.key, value)
+			}
+		}
+	}
+	return results
+}
+
+// resolve calls the resolver of the field, its error or panic is the error of the field of every source
+func (executor *executor) resolve(definition *Field, field *field, sources []any, paths [][]any) (values []any) {
+	fail := func(message string) []any {
+		values := make([]any, len(sources))
+		for i := range sources {
+			executor.fail(paths[i], field, message)
+			values[i] = failed
+		}
+		return values
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			values = fail(fmt.Sprintf("Internal error: %v", recovered))
+		}
+	}()
+	values, err := definition.Resolve(executor.ctx, sources, executor.args[field])
+	if err != nil {
+		return fail(err.Error())
+	}
+	if len(values) != len(sources) {
+		return fail(fmt.Sprintf("Internal error: %d values resolved for %d objects", len(values), len(sources)))
+	}
+	return values
+}
+
+// complete completes the values of a field to its type, a null of a non-null type fails
+func (executor *executor) complete(typ *typeRef, field *field, values []any, paths [][]any, selections []selection) []any {
+	completed := executor.completeValues(typ, field, values, paths, selections)
+	for i, value := range completed {
+		switch {
+		case typ.nonNull && value == nil:
+			executor.fail(paths[i], field, fmt.Sprintf("Cannot return null for non-nullable field %s.", field.name))
+			completed[i] = failed
+		case !typ.nonNull && value == failed:
+			completed[i] = nil
+		}
+	}
+	return completed
+}
+
+// completeValues completes the values to the type regardless of its non-null modifier, the items of all the lists at once
+func (executor *executor) completeValues(typ *typeRef, field *field, values []any, paths [][]any, selections []selection) []any {
+	completed := make([]any, len(values))
+	var present []int
+	for i, value := range values {
+		if value == failed {
+			completed[i] = failed
+			continue
+		}
+		if isNull(value) {
+			continue
+		}
+		present = append(present, i)
+	}
+
+	switch object := executor.schema.object(typ.name); {
+	case typ.elem != nil:
+		var items []any
+		var itemPaths [][]any
+		var owners []int
+		for _, i := range present {
+			list := reflect.ValueOf(values[i])
+			if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+				executor.fail(paths[i], field, fmt.Sprintf("Internal error: %s resolved to %T, not a list.", field.name, values[i]))
+				completed[i] = failed
+				continue
+			}
+			completed[i] = []any{}
+			for j := 0; j < list.Len(); j++ {
+				items = append(items, list.Index(j).Interface())
+				itemPaths = append(itemPaths, appendPath(paths[i], j))
+				owners = append(owners, i)
+			}
+		}
+		for k, item := range executor.complete(typ.elem, field, items, itemPaths, selections) {
+			owner := owners[k]
+			switch {
+			case completed[owner] == failed:
+			case item == failed:
+				completed[owner] = failed
+			default:
+				completed[owner] = append(completed[owner].([]any), item)
+			}
+		}
+	case object != nil:
+		sources := make([]any, len(present))
+		sourcePaths := make([][]any, len(present))
+		for k, i := range present {
+			sources[k], sourcePaths[k] = values[i], paths[i]
+		}
+		for k, result := range executor.selectionSet(object, sources, sourcePaths, selections) {
+			completed[present[k]] = result
+		}
+	default:
+		for _, i := range present {
+			value, err := serializeScalar(typ.name, values[i])
+			if err != nil {
+				executor.fail(paths[i], field, err.Error())
+				value = failed
+			}
+			completed[i] = value
+		}
+	}
+	return completed
+}
+
+// isNull reports whether a resolved value is null, a nil slice is an empty list
+func isNull(value any) bool {
+	if value == nil {
+		return true
+	}
+	switch reflected := reflect.ValueOf(value); reflected.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface, reflect.Func:
+		return reflected.IsNil()
+	}
+	return false
+}
+
+// serializeScalar returns the value of a built-in scalar in the response
+func serializeScalar(name string, value any) (any, error) {
+	reflected := reflect.ValueOf(value)
+	switch name {
+	case "Int":
+		var integer int64
+		switch reflected.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			integer = reflected.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if reflected.Uint() > math.MaxInt32 {
+				return nil, fmt.Errorf("Int cannot represent %v", value)
+			}
+			integer = int64(reflected.Uint())
+		default:
+			return nil, fmt.Errorf("Int cannot represent %s", describe(value))
+		}
+		if integer < math.MinInt32 || integer > math.MaxInt32 {
+			return nil, fmt.Errorf("Int cannot represent %v", value)
+		}
+		return integer, nil
+	case "Float":
+		switch reflected.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return reflected.Float(), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(reflected.Int()), nil
+		}
+	case "String", "ID":
+		if reflected.Kind() == reflect.String {
+			return reflected.String(), nil
+		}
+		if name == "ID" && reflected.CanInt() {
+			return strconv.FormatInt(reflected.Int(), 10), nil
+		}
+	case "Boolean":
+		if reflected.Kind() == reflect.Bool {
+			return reflected.Bool(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s cannot represent %s", name, describe(value))
+}
+
+// appendPath returns a copy of the path with the key or index added, the paths of the siblings share their parent
+func appendPath(path []any, element any) []any {
+	return append(append(make([]any, 0, len(path)+1), path...), element)
+}
+
+// responseObject is an object of the response, its fields are written in the order they were selected
+type responseObject struct {
+	keys   []string
+	values []any
+}
+
+func (object *responseObject) set(key string, value any) {
+	object.keys = append(object.keys, key)
+	object.values = append(object.values, value)
+}
+
+func (object *responseObject) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, key := range object.keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(object.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,837 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+the parser of the executable documents of the GraphQL spec (October 2021):
+operations with variables, fields with aliases and arguments, fragments, inline fragments and directives
+the type system definitions are not parsed, the schema is written in Go, see Schema
+*/
+
+// document is a parsed request, its operations and fragments
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is a query or a mutation, its name is empty for the shorthand query { ... }
+type operation struct {
+	kind       string
+	name       string
+	variables  []*variableDefinition
+	selections []selection
+	location   Location
+}
+
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue any
+	hasDefault   bool
+	location     Location
+}
+
+// selection is a *field, a *fragmentSpread or an *inlineFragment
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []*argument
+	directives []*directive
+	selections []selection
+	location   Location
+}
+
+// responseKey is the key of the field in the response, its alias when it has one
+func (field *field) responseKey() string {
+	if field.alias != "" {
+		return field.alias
+	}
+	return field.name
+}
+
+type argument struct {
+	name     string
+	value    any
+	location Location
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+	location  Location
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	location   Location
+}
+
+// inlineFragment is a ... on Type { ... }, typeCondition is empty when it has no type condition
+type inlineFragment struct {
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+	location      Location
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	selections    []selection
+	location      Location
+}
+
+/*
+the values of the arguments are parsed into int64, float64, string, bool, nil, []any and map[string]any
+a variable is a variable and an enum value an enumValue, so they are not taken for strings
+*/
+type variable string
+
+type enumValue string
+
+// typeRef is a type of a variable or of a field, a list when elem is set and a named type otherwise
+type typeRef struct {
+	name    string
+	elem    *typeRef
+	nonNull bool
+}
+
+func (typ *typeRef) String() string {
+	name := typ.name
+	if typ.elem != nil {
+		name = "[" + typ.elem.String() + "]"
+	}
+	if typ.nonNull {
+		name += "!"
+	}
+	return name
+}
+
+// nullable returns the type without its non-null modifier
+func (typ *typeRef) nullable() *typeRef {
+	nullable := *typ
+	nullable.nonNull = false
+	return &nullable
+}
+
+// the kinds of the tokens, a punctuator is its own kind
+const (
+	tokenEOF    = "<EOF>"
+	tokenName   = "Name"
+	tokenInt    = "Int"
+	tokenFloat  = "Float"
+	tokenString = "String"
+)
+
+type token struct {
+	kind     string
+	value    string
+	location Location
+}
+
+type lexer struct {
+	source string
+	offset int
+	line   int
+	column int
+}
+
+// parseError is an error of the syntax of a document at a location
+func parseError(location Location, format string, args ...any) *Error {
+	return &Error{Message: "Syntax Error: " + fmt.Sprintf(format, args...), Locations: []Location{location}}
+}
+
+func (lexer *lexer) advance(n int) {
+	for _, char := range lexer.source[lexer.offset : lexer.offset+n] {
+		if char == '\n' {
+			lexer.line++
+			lexer.column = 1
+		} else {
+			lexer.column++
+		}
+	}
+	lexer.offset += n
+}
+
+// skipIgnored skips the white space, the line terminators, the commas, the comments and the byte order mark
+func (lexer *lexer) skipIgnored() {
+	for lexer.offset < len(lexer.source) {
+		switch char := lexer.source[lexer.offset]; {
+		case char == ' ' || char == '\t' || char == ',' || char == '\r' || char == '\n':
+			lexer.advance(1)
+		case strings.HasPrefix(lexer.source[lexer.offset:], "\uFEFF"):
+			lexer.offset += len("\uFEFF")
+		case char == '#':
+			for lexer.offset < len(lexer.source) && lexer.source[lexer.offset] != '\n' {
+				lexer.advance(1)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (lexer *lexer) next() (token, error) {
+	lexer.skipIgnored()
+	location := Location{Line: lexer.line, Column: lexer.column}
+	if lexer.offset >= len(lexer.source) {
+		return token{kind: tokenEOF, location: location}, nil
+	}
+	rest := lexer.source[lexer.offset:]
+	char := rest[0]
+	switch {
+	case strings.HasPrefix(rest, "..."):
+		lexer.advance(3)
+		return token{kind: "...", location: location}, nil
+	case strings.ContainsRune("!$&()[]{}:=@|", rune(char)):
+		lexer.advance(1)
+		return token{kind: string(char), location: location}, nil
+	case char == '_' || isLetter(char):
+		end := 1
+		for end < len(rest) && (rest[end] == '_' || isLetter(rest[end]) || isDigit(rest[end])) {
+			end++
+		}
+		lexer.advance(end)
+		return token{kind: tokenName, value: rest[:end], location: location}, nil
+	case char == '-' || isDigit(char):
+		return lexer.number(location)
+	case strings.HasPrefix(rest, `"""`):
+		return lexer.blockString(location)
+	case char == '"':
+		return lexer.string(location)
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return token{}, parseError(location, "Unexpected character %q.", r)
+}
+
+func (lexer *lexer) number(location Location) (token, error) {
+	rest := lexer.source[lexer.offset:]
+	end := 0
+	if rest[end] == '-' {
+		end++
+	}
+	digits := func() int {
+		start := end
+		for end < len(rest) && isDigit(rest[end]) {
+			end++
+		}
+		return end - start
+	}
+	integer := digits()
+	if integer == 0 || (integer > 1 && rest[end-integer] == '0') {
+		return token{}, parseError(location, "Invalid number %q.", rest[:end])
+	}
+	kind := tokenInt
+	if end < len(rest) && rest[end] == '.' {
+		end++
+		kind = tokenFloat
+		if digits() == 0 {
+			return token{}, parseError(location, "Invalid number %q.", rest[:end])
+		}
+	}
+	if end < len(rest) && (rest[end] == 'e' || rest[end] == 'E') {
+		end++
+		kind = tokenFloat
+		if end < len(rest) && (rest[end] == '+' || rest[end] == '-') {
+			end++
+		}
+		if digits() == 0 {
+			return token{}, parseError(location, "Invalid number %q.", rest[:end])
+		}
+	}
+	if end < len(rest) && (rest[end] == '_' || rest[end] == '.' || isLetter(rest[end])) {
+		return token{}, parseError(location, "Invalid number %q.", rest[:end+1])
+	}
+	lexer.advance(end)
+	return token{kind: kind, value: rest[:end], location: location}, nil
+}
+
+func (lexer *lexer) string(location Location) (token, error) {
+	var value strings.Builder
+	lexer.advance(1)
+	for lexer.offset < len(lexer.source) {
+		char := lexer.source[lexer.offset]
+		switch {
+		case char == '"':
+			lexer.advance(1)
+			return token{kind: tokenString, value: value.String(), location: location}, nil
+		case char == '\n' || char == '\r':
+			return token{}, parseError(location, "Unterminated string.")
+		case char == '\\':
+			escape, n, ok := unescape(lexer.source[lexer.offset:])
+			if !ok {
+				return token{}, parseError(Location{Line: lexer.line, Column: lexer.column}, "Invalid escape sequence.")
+			}
+			value.WriteString(escape)
+			lexer.advance(n)
+		default:
+			r, n := utf8.DecodeRuneInString(lexer.source[lexer.offset:])
+			value.WriteRune(r)
+			lexer.advance(n)
+		}
+	}
+	return token{}, parseError(location, "Unterminated string.")
+}
+
+// unescape returns the character of the escape sequence at the start of text and the length of the sequence
+func unescape(text string) (string, int, bool) {
+	if len(text) < 2 {
+		return "", 0, false
+	}
+	simple := map[byte]string{'"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}
+	if escape, ok := simple[text[1]]; ok {
+		return escape, 2, true
+	}
+	if text[1] != 'u' || len(text) < 6 {
+		return "", 0, false
+	}
+	code, err := strconv.ParseUint(text[2:6], 16, 32)
+	if err != nil {
+		return "", 0, false
+	}
+	return string(rune(code)), 6, true
+}
+
+// blockString returns the """block string""" with the common indentation of its lines and its blank first and last lines removed
+func (lexer *lexer) blockString(location Location) (token, error) {
+	lexer.advance(3)
+	var raw strings.Builder
+	for lexer.offset < len(lexer.source) {
+		rest := lexer.source[lexer.offset:]
+		switch {
+		case strings.HasPrefix(rest, `"""`):
+			lexer.advance(3)
+			return token{kind: tokenString, value: blockStringValue(raw.String()), location: location}, nil
+		case strings.HasPrefix(rest, `\"""`):
+			raw.WriteString(`"""`)
+			lexer.advance(4)
+		default:
+			r, n := utf8.DecodeRuneInString(rest)
+			raw.WriteRune(r)
+			lexer.advance(n)
+		}
+	}
+	return token{}, parseError(location, "Unterminated string.")
+}
+
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		} else {
+			lines[i] = ""
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(char byte) bool {
+	return ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z')
+}
+
+func isDigit(char byte) bool {
+	return '0' <= char && char <= '9'
+}
+
+// maxNesting is how deep the selection sets, the values and the types nest when the schema sets no MaxDepth
+const maxNesting = 100
+
+/*
+parser is a recursive descent parser with one token of lookahead
+the parser recurses into every selection set, list, input object and list type,
+so it stops once they nest deeper than maxDepth rather than overflow the stack on a hostile query
+*/
+type parser struct {
+	lexer    *lexer
+	token    token
+	maxDepth int
+	depth    int
+}
+
+// enter descends into a nested selection set, value or type, or returns an error once they nest deeper than maxDepth
+func (parser *parser) enter() error {
+	parser.depth++
+	if parser.depth > parser.maxDepth {
+		return &Error{Message: fmt.Sprintf("The query is nested deeper than %d levels.", parser.maxDepth), Locations: []Location{parser.token.location}}
+	}
+	return nil
+}
+
+// leave returns from a nested selection set, value or type
+func (parser *parser) leave() {
+	parser.depth--
+}
+
+/*
+parse returns the document of the source, or the first syntax error
+the selection sets, the inline fragments included, may nest maxDepth deep, and so may the values, maxNesting when it is 0
+*/
+func parse(source string, maxDepth int) (*document, error) {
+	if maxDepth <= 0 {
+		maxDepth = maxNesting
+	}
+	parser := &parser{lexer: &lexer{source: source, line: 1, column: 1}, maxDepth: maxDepth}
+	if err := parser.advance(); err != nil {
+		return nil, err
+	}
+	document := &document{fragments: map[string]*fragment{}}
+	if parser.token.kind == tokenEOF {
+		return nil, parseError(parser.token.location, "Unexpected %s.", tokenEOF)
+	}
+	for parser.token.kind != tokenEOF {
+		if parser.token.kind == tokenName && parser.token.value == "fragment" {
+			fragment, err := parser.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := document.fragments[fragment.name]; ok {
+				return nil, &Error{Message: fmt.Sprintf("There can be only one fragment named %q.", fragment.name), Locations: []Location{fragment.location}}
+			}
+			document.fragments[fragment.name] = fragment
+			continue
+		}
+		operation, err := parser.operation()
+		if err != nil {
+			return nil, err
+		}
+		document.operations = append(document.operations, operation)
+	}
+	return document, nil
+}
+
+func (parser *parser) advance() error {
+	token, err := parser.lexer.next()
+	if err != nil {
+		return err
+	}
+	parser.token = token
+	return nil
+}
+
+// peek reports whether the current token is of the kind
+func (parser *parser) peek(kind string) bool {
+	return parser.token.kind == kind
+}
+
+// skip consumes the current token if it is of the kind
+func (parser *parser) skip(kind string) (bool, error) {
+	if !parser.peek(kind) {
+		return false, nil
+	}
+	return true, parser.advance()
+}
+
+// expect consumes the current token, or returns an error if it is not of the kind
+func (parser *parser) expect(kind string) (token, error) {
+	current := parser.token
+	if current.kind != kind {
+		return current, parser.unexpected(kind)
+	}
+	return current, parser.advance()
+}
+
+func (parser *parser) name() (string, error) {
+	name, err := parser.expect(tokenName)
+	return name.value, err
+}
+
+// keyword consumes the name, or returns an error if the current token is another one
+func (parser *parser) keyword(keyword string) error {
+	if !parser.peek(tokenName) || parser.token.value != keyword {
+		return parser.unexpected(strconv.Quote(keyword))
+	}
+	return parser.advance()
+}
+
+func (parser *parser) unexpected(expected string) error {
+	found := parser.token.kind
+	switch found {
+	case tokenName, tokenInt, tokenFloat, tokenString:
+		found += " " + strconv.Quote(parser.token.value)
+	}
+	return parseError(parser.token.location, "Expected %s, found %s.", expected, found)
+}
+
+func (parser *parser) operation() (*operation, error) {
+	operation := &operation{kind: "query", location: parser.token.location}
+	if parser.peek("{") {
+		selections, err := parser.selectionSet()
+		operation.selections = selections
+		return operation, err
+	}
+	if !parser.peek(tokenName) || (parser.token.value != "query" && parser.token.value != "mutation" && parser.token.value != "subscription") {
+		return nil, parser.unexpected(`"query", "mutation", "fragment" or "{"`)
+	}
+	operation.kind = parser.token.value
+	if err := parser.advance(); err != nil {
+		return nil, err
+	}
+	if parser.peek(tokenName) {
+		name, err := parser.name()
+		if err != nil {
+			return nil, err
+		}
+		operation.name = name
+	}
+	if ok, err := parser.skip("("); err != nil {
+		return nil, err
+	} else if ok {
+		for !parser.peek(")") {
+			definition, err := parser.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			operation.variables = append(operation.variables, definition)
+		}
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := parser.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := parser.selectionSet()
+	operation.selections = selections
+	return operation, err
+}
+
+func (parser *parser) variableDefinition() (*variableDefinition, error) {
+	definition := &variableDefinition{location: parser.token.location}
+	if _, err := parser.expect("$"); err != nil {
+		return nil, err
+	}
+	name, err := parser.name()
+	if err != nil {
+		return nil, err
+	}
+	definition.name = name
+	if _, err := parser.expect(":"); err != nil {
+		return nil, err
+	}
+	if definition.typ, err = parser.typeRef(); err != nil {
+		return nil, err
+	}
+	if ok, err := parser.skip("="); err != nil {
+		return nil, err
+	} else if ok {
+		definition.hasDefault = true
+		if definition.defaultValue, err = parser.value(true); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := parser.directives(); err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+func (parser *parser) typeRef() (*typeRef, error) {
+	if err := parser.enter(); err != nil {
+		return nil, err
+	}
+	defer parser.leave()
+	typ := &typeRef{}
+	if ok, err := parser.skip("["); err != nil {
+		return nil, err
+	} else if ok {
+		if typ.elem, err = parser.typeRef(); err != nil {
+			return nil, err
+		}
+		if _, err := parser.expect("]"); err != nil {
+			return nil, err
+		}
+	} else {
+		name, err := parser.name()
+		if err != nil {
+			return nil, err
+		}
+		typ.name = name
+	}
+	nonNull, err := parser.skip("!")
+	typ.nonNull = nonNull
+	return typ, err
+}
+
+func (parser *parser) selectionSet() ([]selection, error) {
+	if _, err := parser.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := parser.enter(); err != nil {
+		return nil, err
+	}
+	defer parser.leave()
+	var selections []selection
+	for {
+		if ok, err := parser.skip("}"); err != nil {
+			return nil, err
+		} else if ok && len(selections) > 0 {
+			return selections, nil
+		} else if ok {
+			return nil, parseError(parser.token.location, "A selection set must not be empty.")
+		}
+		selection, err := parser.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+}
+
+func (parser *parser) selection() (selection, error) {
+	location := parser.token.location
+	if ok, err := parser.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		return parser.fragmentSelection(location)
+	}
+
+	field := &field{location: location}
+	name, err := parser.name()
+	if err != nil {
+		return nil, err
+	}
+	field.name = name
+	if ok, err := parser.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		field.alias = name
+		if field.name, err = parser.name(); err != nil {
+			return nil, err
+		}
+	}
+	if field.arguments, err = parser.arguments(); err != nil {
+		return nil, err
+	}
+	if field.directives, err = parser.directives(); err != nil {
+		return nil, err
+	}
+	if parser.peek("{") {
+		if field.selections, err = parser.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// fragmentSelection parses what follows the ... of a fragment spread or of an inline fragment
+func (parser *parser) fragmentSelection(location Location) (selection, error) {
+	if parser.peek(tokenName) && parser.token.value != "on" {
+		spread := &fragmentSpread{name: parser.token.value, location: location}
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		directives, err := parser.directives()
+		spread.directives = directives
+		return spread, err
+	}
+	inline := &inlineFragment{location: location}
+	if parser.peek(tokenName) {
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		typeCondition, err := parser.name()
+		if err != nil {
+			return nil, err
+		}
+		inline.typeCondition = typeCondition
+	}
+	var err error
+	if inline.directives, err = parser.directives(); err != nil {
+		return nil, err
+	}
+	inline.selections, err = parser.selectionSet()
+	return inline, err
+}
+
+func (parser *parser) fragment() (*fragment, error) {
+	fragment := &fragment{location: parser.token.location}
+	if err := parser.keyword("fragment"); err != nil {
+		return nil, err
+	}
+	if parser.peek(tokenName) && parser.token.value == "on" {
+		return nil, parser.unexpected("a fragment name")
+	}
+	var err error
+	if fragment.name, err = parser.name(); err != nil {
+		return nil, err
+	}
+	if err := parser.keyword("on"); err != nil {
+		return nil, err
+	}
+	if fragment.typeCondition, err = parser.name(); err != nil {
+		return nil, err
+	}
+	if _, err := parser.directives(); err != nil {
+		return nil, err
+	}
+	fragment.selections, err = parser.selectionSet()
+	return fragment, err
+}
+
+func (parser *parser) arguments() ([]*argument, error) {
+	if ok, err := parser.skip("("); err != nil || !ok {
+		return nil, err
+	}
+	var arguments []*argument
+	for !parser.peek(")") {
+		argument := &argument{location: parser.token.location}
+		var err error
+		if argument.name, err = parser.name(); err != nil {
+			return nil, err
+		}
+		if _, err := parser.expect(":"); err != nil {
+			return nil, err
+		}
+		if argument.value, err = parser.value(false); err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+	}
+	if len(arguments) == 0 {
+		return nil, parser.unexpected("an argument")
+	}
+	return arguments, parser.advance()
+}
+
+func (parser *parser) directives() ([]*directive, error) {
+	var directives []*directive
+	for parser.peek("@") {
+		directive := &directive{location: parser.token.location}
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if directive.name, err = parser.name(); err != nil {
+			return nil, err
+		}
+		if directive.arguments, err = parser.arguments(); err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// value parses a value, constant values (the defaults of the variables) must not have variables
+func (parser *parser) value(constant bool) (any, error) {
+	current := parser.token
+	switch current.kind {
+	case "$":
+		if constant {
+			return nil, parser.unexpected("a constant value")
+		}
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		name, err := parser.name()
+		return variable(name), err
+	case tokenInt:
+		value, err := strconv.ParseInt(current.value, 10, 64)
+		if err != nil {
+			return nil, parseError(current.location, "Invalid number %q.", current.value)
+		}
+		return value, parser.advance()
+	case tokenFloat:
+		value, err := strconv.ParseFloat(current.value, 64)
+		if err != nil {
+			return nil, parseError(current.location, "Invalid number %q.", current.value)
+		}
+		return value, parser.advance()
+	case tokenString:
+		return current.value, parser.advance()
+	case tokenName:
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		switch current.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return enumValue(current.value), nil
+	case "[":
+		if err := parser.enter(); err != nil {
+			return nil, err
+		}
+		defer parser.leave()
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !parser.peek("]") {
+			value, err := parser.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, parser.advance()
+	case "{":
+		if err := parser.enter(); err != nil {
+			return nil, err
+		}
+		defer parser.leave()
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		object := map[string]any{}
+		for !parser.peek("}") {
+			name, err := parser.name()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := object[name]; ok {
+				return nil, &Error{Message: fmt.Sprintf("There can be only one input field named %q.", name), Locations: []Location{current.location}}
+			}
+			if _, err := parser.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = parser.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, parser.advance()
+	}
+	return nil, parser.unexpected("a value")
+}
+
+// parseType parses a type written in the schema, e.g. [Receipt!]!
+func parseType(source string) (*typeRef, error) {
+	parser := &parser{lexer: &lexer{source: source, line: 1, column: 1}, maxDepth: maxNesting}
+	if err := parser.advance(); err != nil {
+		return nil, err
+	}
+	typ, err := parser.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.peek(tokenEOF) {
+		return nil, parser.unexpected(tokenEOF)
+	}
+	return typ, nil
+}
@@ -0,0 +1,235 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+Resolver resolves a field of many objects at once, it returns the value of the field of every source, in the same order
+the objects of a list, and the same field of the objects of every list on the same level, are resolved with one call
+so a resolver can read the store once for all of them instead of once per object (the N+1 reads)
+an error is the error of the field of every source
+*/
+type Resolver func(ctx context.Context, sources []any, args map[string]any) ([]any, error)
+
+// Each returns the Resolver of a field that is resolved one source at a time, for the fields that need no store reads
+func Each(resolve func(source any) any) Resolver {
+	return func(ctx context.Context, sources []any, args map[string]any) ([]any, error) {
+		values := make([]any, len(sources))
+		for i, source := range sources {
+			values[i] = resolve(source)
+		}
+		return values, nil
+	}
+}
+
+/*
+Object is an object type, its fields are listed in the order of the schema
+Field is a field, its Type is written like in the schema, e.g. [Receipt!]!, and its arguments are the Args
+the arguments given to the Resolver are coerced to their types, Int to int, Float to float64, String and ID to string,
+Boolean to bool, lists to []any and input objects to map[string]any, the arguments that are not given are left out
+the values a Resolver returns for Int, Float, String, ID and Boolean are Go integers, floats, strings and bools,
+for an object type whatever the resolvers of its fields take as source, for a list any slice, and nil for null
+*/
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+type Field struct {
+	Name        string
+	Type        string
+	Description string
+	Args        []*Arg
+	Resolve     Resolver
+
+	typ  *typeRef
+	args map[string]*Arg
+}
+
+type Arg struct {
+	Name        string
+	Type        string
+	Description string
+
+	typ *typeRef
+}
+
+// InputObject is an input object type, the fields of an input object have no Resolve and no Args
+type InputObject struct {
+	Name        string
+	Description string
+	Fields      []*Arg
+
+	fields map[string]*Arg
+}
+
+// the built-in scalar types
+var scalars = map[string]bool{"Int": true, "Float": true, "String": true, "ID": true, "Boolean": true}
+
+/*
+Schema is the schema of a GraphQL API, the root types of its operations and the types they reach
+MaxDepth is the deepest a selection may nest, so the lists of lists of a query cannot grow without bounds,
+the parser stops at MaxDepth too, and at 100 levels when it is 0, so a hostile query cannot overflow the stack
+*/
+type Schema struct {
+	MaxDepth int
+
+	query    *Object
+	mutation *Object
+	objects  []*Object
+	inputs   []*InputObject
+	types    map[string]any
+}
+
+/*
+NewSchema returns the schema with the query type, the mutation type (nil for none) and the object and input object types they reach
+returns an error if a type is unknown or defined twice, or a field has no Resolve
+*/
+func NewSchema(query *Object, mutation *Object, types ...any) (*Schema, error) {
+	schema := &Schema{query: query, mutation: mutation, types: map[string]any{}}
+	all := append([]any{query}, types...)
+	if mutation != nil {
+		all = append([]any{query, mutation}, types...)
+	}
+	for _, typ := range all {
+		var name string
+		switch typ := typ.(type) {
+		case *Object:
+			name = typ.Name
+			schema.objects = append(schema.objects, typ)
+		case *InputObject:
+			name = typ.Name
+			schema.inputs = append(schema.inputs, typ)
+		default:
+			return nil, fmt.Errorf("%T is not a type", typ)
+		}
+		if _, ok := schema.types[name]; ok || scalars[name] {
+			return nil, fmt.Errorf("the type %s is defined twice", name)
+		}
+		schema.types[name] = typ
+	}
+
+	for _, object := range schema.objects {
+		for _, field := range object.Fields {
+			var err error
+			if field.Resolve == nil {
+				return nil, fmt.Errorf("%s.%s has no Resolve", object.Name, field.Name)
+			}
+			if field.typ, err = schema.resolveType(field.Type, false); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", object.Name, field.Name, err)
+			}
+			field.args = map[string]*Arg{}
+			for _, arg := range field.Args {
+				if arg.typ, err = schema.resolveType(arg.Type, true); err != nil {
+					return nil, fmt.Errorf("%s.%s(%s): %w", object.Name, field.Name, arg.Name, err)
+				}
+				field.args[arg.Name] = arg
+			}
+		}
+	}
+	for _, input := range schema.inputs {
+		input.fields = map[string]*Arg{}
+		for _, field := range input.Fields {
+			var err error
+			if field.typ, err = schema.resolveType(field.Type, true); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", input.Name, field.Name, err)
+			}
+			input.fields[field.Name] = field
+		}
+	}
+	return schema, nil
+}
+
+// resolveType parses the type and checks its named type exists, an input type for the arguments and an output type otherwise
+func (schema *Schema) resolveType(source string, input bool) (*typeRef, error) {
+	typ, err := parseType(source)
+	if err != nil {
+		return nil, fmt.Errorf("the type %q: %w", source, err)
+	}
+	named := typ
+	for named.elem != nil {
+		named = named.elem
+	}
+	switch schema.types[named.name].(type) {
+	case *Object:
+		if input {
+			return nil, fmt.Errorf("%s is not an input type", named.name)
+		}
+	case *InputObject:
+		if !input {
+			return nil, fmt.Errorf("%s is not an output type", named.name)
+		}
+	default:
+		if !scalars[named.name] {
+			return nil, fmt.Errorf("unknown type %s", named.name)
+		}
+	}
+	return typ, nil
+}
+
+// object returns the object type of the name, nil for a scalar or an input object
+func (schema *Schema) object(name string) *Object {
+	object, _ := schema.types[name].(*Object)
+	return object
+}
+
+// field returns the field of the object type, nil when it has none of the name
+func (object *Object) field(name string) *Field {
+	for _, field := range object.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// String returns the schema in the schema definition language, the descriptions of the types and fields included
+func (schema *Schema) String() string {
+	var sdl strings.Builder
+	if schema.mutation != nil {
+		fmt.Fprintf(&sdl, "schema {\n  query: %s\n  mutation: %s\n}\n", schema.query.Name, schema.mutation.Name)
+	}
+	for _, object := range schema.objects {
+		sdl.WriteString("\n")
+		writeDescription(&sdl, object.Description, "")
+		fmt.Fprintf(&sdl, "type %s {\n", object.Name)
+		for _, field := range object.Fields {
+			writeDescription(&sdl, field.Description, "  ")
+			sdl.WriteString("  " + field.Name)
+			if len(field.Args) > 0 {
+				args := make([]string, len(field.Args))
+				for i, arg := range field.Args {
+					args[i] = arg.Name + ": " + arg.Type
+					if arg.Description != "" {
+						args[i] = strconv.Quote(arg.Description) + " " + args[i]
+					}
+				}
+				sdl.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			sdl.WriteString(": " + field.Type + "\n")
+		}
+		sdl.WriteString("}\n")
+	}
+	for _, input := range schema.inputs {
+		sdl.WriteString("\n")
+		writeDescription(&sdl, input.Description, "")
+		fmt.Fprintf(&sdl, "input %s {\n", input.Name)
+		for _, field := range input.Fields {
+			writeDescription(&sdl, field.Description, "  ")
+			fmt.Fprintf(&sdl, "  %s: %s\n", field.Name, field.Type)
+		}
+		sdl.WriteString("}\n")
+	}
+	return strings.TrimPrefix(sdl.String(), "\n")
+}
+
+func writeDescription(sdl *strings.Builder, description string, indent string) {
+	if description != "" {
+		sdl.WriteString(indent + strconv.Quote(description) + "\n")
+	}
+}
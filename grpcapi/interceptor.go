@@ -0,0 +1,158 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	receiptv1 "github.com/rapolunagarjuna/receipt-processor-challenge/proto/receipt/v1"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes are the scopes the methods need, like the scopes of the HTTP routes
+var methodScopes = map[string]string{
+	receiptv1.ReceiptService_ProcessReceipt_FullMethodName: auth.ScopeReceiptsWrite,
+	receiptv1.ReceiptService_GetPoints_FullMethodName:      auth.ScopeReceiptsRead,
+	receiptv1.ReceiptService_GetReceipt_FullMethodName:     auth.ScopeReceiptsRead,
+	receiptv1.ReceiptService_ListReceipts_FullMethodName:   auth.ScopeReceiptsRead,
+}
+
+/*
+Interceptor is a struct that does for every gRPC call what the middlewares do for an HTTP request
+it starts the server span, authenticates the call and checks the scope of its method (Authenticate and RequireScope),
+sets its tenant (Tenant) and writes one log line for it (RequestLogger)
+the credentials and the tenant are read from the metadata, which carry the headers of the HTTP API in lower case
+Authenticator is nil when the authentication is off, then every call is let through
+Logger is the logger of the log lines, slog.Default() when it is nil
+*/
+type Interceptor struct {
+	Authenticator *middleware.Authenticator
+	Logger        *slog.Logger
+}
+
+// callKey is the key of the call in its context
+type callKey struct{}
+
+// call is the principal and the tenant of a call
+type call struct {
+	principal *auth.Principal
+	tenantID  string
+}
+
+// Unary is the unary server interceptor
+func (interceptor *Interceptor) Unary(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+	ctx, span := tracing.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	logger := interceptor.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With(slog.String("requestId", uuid.New().String()))
+	ctx = logging.WithLogger(ctx, logger)
+
+	current, err := interceptor.authorize(ctx, header, info.FullMethod)
+	var response any
+	if err == nil {
+		response, err = handler(context.WithValue(ctx, callKey{}, current), request)
+	}
+
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+		span.SetStatus(otelcodes.Error, code.String())
+	default:
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("method", info.FullMethod),
+		slog.String("code", code.String()),
+		slog.Float64("latencyMs", float64(time.Since(start).Microseconds())/1000),
+	}
+	if current != nil && current.principal != nil && current.principal.APIKeyID != "" {
+		attrs = append(attrs, slog.String("apiKeyId", current.principal.APIKeyID))
+	}
+	if current != nil && current.principal != nil && current.principal.PartnerID != "" {
+		attrs = append(attrs, slog.String("partnerId", current.principal.PartnerID))
+	}
+	if current != nil {
+		attrs = append(attrs, slog.String("tenant", current.tenantID))
+	}
+	if spanContext := span.SpanContext(); spanContext.HasTraceID() {
+		attrs = append(attrs, slog.String("traceId", spanContext.TraceID().String()))
+	}
+	logger.LogAttrs(ctx, level, "grpc call", attrs...)
+	return response, err
+}
+
+/*
+authorize returns the principal and the tenant of the call
+returns Unauthenticated if the credentials are missing or invalid, PermissionDenied if they lack the scope of the method
+or belong to another tenant than the x-tenant-id metadata, and InvalidArgument if the tenant is not a valid tenant id
+*/
+func (interceptor *Interceptor) authorize(ctx context.Context, header http.Header, method string) (*call, error) {
+	var principal *auth.Principal
+	if interceptor.Authenticator != nil {
+		var state *tls.ConnectionState
+		if caller, ok := peer.FromContext(ctx); ok {
+			if info, ok := caller.AuthInfo.(credentials.TLSInfo); ok {
+				state = &info.State
+			}
+		}
+		var ok bool
+		principal, ok = interceptor.Authenticator.Principal(header, state)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "Valid credentials are required")
+		}
+		if scope := methodScopes[method]; !principal.HasScope(scope) {
+			return nil, status.Error(codes.PermissionDenied, "The "+scope+" scope is required")
+		}
+	}
+
+	tenantID, err := middleware.ResolveTenant(principal, header.Get(middleware.TenantHeader))
+	if errors.Is(err, middleware.ErrOtherTenant) {
+		return nil, status.Error(codes.PermissionDenied, "The credentials do not belong to that tenant")
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "The tenant is invalid")
+	}
+	return &call{principal: principal, tenantID: tenantID}, nil
+}
+
+// currentCall returns the principal and the tenant of the call, an unauthenticated call of the default tenant without the interceptor
+func currentCall(ctx context.Context) *call {
+	if current, ok := ctx.Value(callKey{}).(*call); ok {
+		return current
+	}
+	return &call{tenantID: models.DefaultTenant}
+}
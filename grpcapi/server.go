@@ -0,0 +1,284 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	receiptv1 "github.com/rapolunagarjuna/receipt-processor-challenge/proto/receipt/v1"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// the page sizes of ListReceipts
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+/*
+ReceiptServer is a struct that implements the gRPC ReceiptService with the same services as the ReceiptController
+when Tenants is set, the ReceiptService of the tenant of the call is used instead
+APIKeys counts the receipts processed with an API key against its daily quota, no quota is counted when it is nil
+*/
+type ReceiptServer struct {
+	receiptv1.UnimplementedReceiptServiceServer
+	ReceiptService services.ReceiptService
+	Tenants        services.TenantRegistry
+	APIKeys        services.APIKeyService
+}
+
+/*
+New returns the gRPC server of the receipts, the calls go through the interceptor
+with a TLS config the server only accepts TLS connections, and verifies the client certificates like the HTTPS server
+*/
+func New(receipts *ReceiptServer, interceptor *Interceptor, tlsConfig *tls.Config) *grpc.Server {
+	options := []grpc.ServerOption{grpc.UnaryInterceptor(interceptor.Unary)}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	receiptv1.RegisterReceiptServiceServer(server, receipts)
+	return server
+}
+
+/*
+Stop returns a function that stops the server gracefully, for httpserver.Shutdown.Close
+the calls in flight have until ctx is done to finish, then they are cancelled and an error is returned
+*/
+func Stop(server *grpc.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			server.Stop()
+			return fmt.Errorf("draining gRPC calls: %w", ctx.Err())
+		}
+	}
+}
+
+// service returns the ReceiptService for the tenant of the call
+func (server *ReceiptServer) service(ctx context.Context) services.ReceiptService {
+	if server.Tenants != nil {
+		return server.Tenants.For(currentCall(ctx).tenantID).Receipts
+	}
+	return server.ReceiptService
+}
+
+// known reports whether the tenant of the call is known, the reads do not create the other tenants, see services.Tenants.Known
+func (server *ReceiptServer) known(ctx context.Context) bool {
+	return server.Tenants == nil || server.Tenants.Known(currentCall(ctx).tenantID)
+}
+
+/*
+ProcessReceipt is a function that processes the receipt and returns the id of the receipt
+the receipt is validated with the validators of the HTTP API, so both reject the same receipts
+if the receipt is invalid, returns InvalidArgument
+if the daily quota of the API key is used up, returns ResourceExhausted, every call counts like in the HTTP API
+*/
+func (server *ReceiptServer) ProcessReceipt(ctx context.Context, request *receiptv1.ProcessReceiptRequest) (*receiptv1.ProcessReceiptResponse, error) {
+	logger := logging.FromContext(ctx)
+	principal := currentCall(ctx).principal
+	if principal != nil && principal.APIKeyID != "" && server.APIKeys != nil {
+		if _, ok := server.APIKeys.UseDailyQuota(principal.APIKeyID, time.Now()); !ok {
+			return nil, status.Error(codes.ResourceExhausted, "The daily quota of the API key is used up")
+		}
+	}
+
+	receipt := fromProto(request.GetReceipt())
+	if err := validators.NewValidator().Struct(receipt); err != nil {
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			for _, fieldError := range validationErrors {
+				metrics.ValidationFailures.WithLabelValues(fieldError.Field(), fieldError.Tag()).Inc()
+			}
+		}
+		logger.Warn("receipt rejected", slog.String("reason", "the receipt is invalid"), slog.String("error", err.Error()))
+		return nil, status.Error(codes.InvalidArgument, "The receipt is invalid")
+	}
+	if principal != nil {
+		receipt.APIKeyID = principal.APIKeyID
+		receipt.PartnerID = principal.PartnerID
+		if principal.IsMember() {
+			receipt.MemberID = principal.Subject
+		}
+	}
+
+	id, points := server.service(ctx).AddNewReceipt(ctx, receipt)
+	logger.Info("receipt processed",
+		slog.String("receiptId", id),
+		slog.Int64("points", points),
+		slog.String("retailer", receipt.Retailer),
+		slog.Int("items", len(receipt.Items)))
+	return &receiptv1.ProcessReceiptResponse{Id: id}, nil
+}
+
+/*
+GetPoints is a function that returns the points of the receipt
+if the receipt is not found, returns NotFound, members only find their own receipts
+*/
+func (server *ReceiptServer) GetPoints(ctx context.Context, request *receiptv1.GetPointsRequest) (*receiptv1.GetPointsResponse, error) {
+	if !server.known(ctx) {
+		return nil, status.Error(codes.NotFound, "No receipt found for that id")
+	}
+	points, ok := server.service(ctx).GetReceipt(ctx, request.GetId())
+	if principal := currentCall(ctx).principal; ok && principal != nil && principal.IsMember() {
+		receipt, found := server.service(ctx).GetReceiptDetails(ctx, request.GetId())
+		ok = found && canRead(ctx, receipt)
+	}
+	if !ok {
+		return nil, status.Error(codes.NotFound, "No receipt found for that id")
+	}
+	return &receiptv1.GetPointsResponse{Points: points}, nil
+}
+
+/*
+GetReceipt is a function that returns the processed receipt
+if the receipt is not found, returns NotFound, members only find their own receipts
+*/
+func (server *ReceiptServer) GetReceipt(ctx context.Context, request *receiptv1.GetReceiptRequest) (*receiptv1.GetReceiptResponse, error) {
+	if !server.known(ctx) {
+		return nil, status.Error(codes.NotFound, "No receipt found for that id")
+	}
+	receipt, ok := server.service(ctx).GetReceiptDetails(ctx, request.GetId())
+	if !ok || !canRead(ctx, receipt) {
+		return nil, status.Error(codes.NotFound, "No receipt found for that id")
+	}
+	return &receiptv1.GetReceiptResponse{Receipt: toProto(receipt)}, nil
+}
+
+/*
+ListReceipts is a function that returns a page of the processed receipts of the tenant, the oldest first
+members only get their own receipts
+the page token is the position of the first receipt of the page
+if the page size is negative or the page token is not one of a previous page, returns InvalidArgument
+if the tenant is not known, returns NotFound
+*/
+func (server *ReceiptServer) ListReceipts(ctx context.Context, request *receiptv1.ListReceiptsRequest) (*receiptv1.ListReceiptsResponse, error) {
+	pageSize := int(request.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "The page size is invalid")
+	case pageSize == 0:
+		pageSize = DefaultPageSize
+	case pageSize > MaxPageSize:
+		pageSize = MaxPageSize
+	}
+	start := 0
+	if token := request.GetPageToken(); token != "" {
+		var err error
+		if start, err = strconv.Atoi(token); err != nil || start < 0 {
+			return nil, status.Error(codes.InvalidArgument, "The page token is invalid")
+		}
+	}
+
+	if !server.known(ctx) {
+		return nil, status.Error(codes.NotFound, "No tenant found for that id")
+	}
+	var receipts []models.Receipt
+	for _, receipt := range server.service(ctx).ListReceipts(ctx) {
+		if canRead(ctx, &receipt) {
+			receipts = append(receipts, receipt)
+		}
+	}
+	response := &receiptv1.ListReceiptsResponse{}
+	for i := start; i < len(receipts) && i < start+pageSize; i++ {
+		response.Receipts = append(response.Receipts, toProto(&receipts[i]))
+	}
+	if start+pageSize < len(receipts) {
+		response.NextPageToken = strconv.Itoa(start + pageSize)
+	}
+	return response, nil
+}
+
+// canRead reports whether the caller may read the receipt, members may only read their own receipts
+func canRead(ctx context.Context, receipt *models.Receipt) bool {
+	principal := currentCall(ctx).principal
+	return principal == nil || !principal.IsMember() || receipt.MemberID == principal.Subject
+}
+
+// fromProto returns the receipt of the message, the fields filled in when a receipt is processed are left out
+func fromProto(message *receiptv1.Receipt) *models.Receipt {
+	receipt := &models.Receipt{
+		Retailer:     message.GetRetailer(),
+		PurchaseDate: message.GetPurchaseDate(),
+		PurchaseTime: message.GetPurchaseTime(),
+		Total:        message.GetTotal(),
+		Subtotal:     message.GetSubtotal(),
+		Tax:          message.GetTax(),
+		Currency:     message.GetCurrency(),
+		Timezone:     message.GetTimezone(),
+		MemberID:     message.GetMemberId(),
+	}
+	for _, item := range message.GetItems() {
+		receipt.Items = append(receipt.Items, models.Item{
+			ShortDescription: item.GetShortDescription(),
+			Price:            item.GetPrice(),
+			Quantity:         item.GetQuantity(),
+			UnitPrice:        item.GetUnitPrice(),
+		})
+	}
+	for _, discount := range message.GetDiscounts() {
+		receipt.Discounts = append(receipt.Discounts, models.Discount{Description: discount.GetDescription(), Amount: discount.GetAmount()})
+	}
+	return receipt
+}
+
+// toProto returns the message of the processed receipt
+func toProto(receipt *models.Receipt) *receiptv1.Receipt {
+	message := &receiptv1.Receipt{
+		Id:                receipt.ID,
+		Retailer:          receipt.Retailer,
+		PurchaseDate:      receipt.PurchaseDate,
+		PurchaseTime:      receipt.PurchaseTime,
+		Total:             receipt.Total,
+		Subtotal:          receipt.Subtotal,
+		Tax:               receipt.Tax,
+		Currency:          receipt.Currency,
+		Timezone:          receipt.Timezone,
+		MemberId:          receipt.MemberID,
+		Points:            receipt.Points,
+		RetailerId:        receipt.RetailerID,
+		SubmittedRetailer: receipt.SubmittedRetailer,
+		ApiKeyId:          receipt.APIKeyID,
+		PartnerId:         receipt.PartnerID,
+	}
+	if receipt.PurchasedAt != nil {
+		message.PurchasedAt = timestamppb.New(*receipt.PurchasedAt)
+	}
+	if receipt.CreatedAt != nil {
+		message.CreatedAt = timestamppb.New(*receipt.CreatedAt)
+	}
+	for _, item := range receipt.Items {
+		message.Items = append(message.Items, &receiptv1.Item{
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+			Quantity:         item.Quantity,
+			UnitPrice:        item.UnitPrice,
+			Category:         item.Category,
+		})
+	}
+	for _, discount := range receipt.Discounts {
+		message.Discounts = append(message.Discounts, &receiptv1.Discount{Description: discount.Description, Amount: discount.Amount})
+	}
+	return message
+}
@@ -0,0 +1,107 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+/*
+Options are the address and the timeouts of the server
+ReadHeaderTimeout and ReadTimeout bound how long a client takes to send the request,
+WriteTimeout how long the handler and the response take, IdleTimeout how long a keep-alive connection waits
+*/
+type Options struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+/*
+Shutdown is what happens once the server is asked to stop
+BeforeDrain is called first, e.g. to fail the readiness check, then the server waits Delay
+so the load balancer stops sending requests, then the requests in flight get Timeout to finish
+Close is called last, in order, even when the requests did not finish in time, e.g. to close the store
+*/
+type Shutdown struct {
+	BeforeDrain func()
+	Delay       time.Duration
+	Timeout     time.Duration
+	Close       []func(ctx context.Context) error
+}
+
+// New returns the server of the handler with the address and the timeouts of the options
+func New(handler http.Handler, options Options) *http.Server {
+	return &http.Server{
+		Addr:              options.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		ReadTimeout:       options.ReadTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+	}
+}
+
+/*
+Run is a function that serves on the listener until ctx is done, e.g. on SIGTERM, then shuts the server down gracefully
+serves HTTPS with the certificates of the TLS config of the server when it has one
+returns the error of serving, or the errors of draining and closing
+*/
+func Run(ctx context.Context, server *http.Server, listener net.Listener, shutdown Shutdown) error {
+	served := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			served <- server.ServeTLS(listener, "", "")
+			return
+		}
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", slog.Duration("timeout", shutdown.Timeout))
+	if shutdown.BeforeDrain != nil {
+		shutdown.BeforeDrain()
+	}
+	time.Sleep(shutdown.Delay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdown.Timeout)
+	defer cancel()
+	var errs []error
+	if err := server.Shutdown(drainCtx); err != nil {
+		errs = append(errs, fmt.Errorf("draining requests: %w", err))
+		server.Close()
+	}
+	if err := <-served; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), shutdown.Timeout)
+	defer cancelClose()
+	for _, close := range shutdown.Close {
+		if err := close(closeCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	slog.Info("shut down")
+	return errors.Join(errs...)
+}
+
+// ListenAndRun listens on the address of the server and runs it, see Run
+func ListenAndRun(ctx context.Context, server *http.Server, shutdown Shutdown) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	return Run(ctx, server, listener, shutdown)
+}
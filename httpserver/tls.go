@@ -0,0 +1,160 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// the client authentication modes of TLSOptions
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+/*
+TLSOptions are the files the server serves HTTPS with
+CertFile and KeyFile are the PEM certificate and key, reloaded when they change, see CertificateReloader
+ClientCAFile is the PEM bundle of the CAs client certificates are verified with, read once at startup
+ClientAuth is ClientAuthNone, ClientAuthOptional (a client certificate is verified when one is sent)
+or ClientAuthRequire (connections without a valid client certificate are refused)
+*/
+type TLSOptions struct {
+	CertFile       string
+	KeyFile        string
+	ReloadInterval time.Duration
+	ClientCAFile   string
+	ClientAuth     string
+}
+
+/*
+NewTLSConfig is a function that returns the TLS config of the options
+the certificate is taken from a CertificateReloader and HTTP/2 is offered before HTTP/1.1
+returns an error if the certificate, its key or the client CAs cannot be read
+*/
+func NewTLSConfig(options TLSOptions) (*tls.Config, error) {
+	reloader, err := NewCertificateReloader(options.CertFile, options.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	reloader.Interval = options.ReloadInterval
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	switch options.ClientAuth {
+	case "", ClientAuthNone:
+		return config, nil
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client authentication %q", options.ClientAuth)
+	}
+	data, err := os.ReadFile(options.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CAs: %w", err)
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CAs %s: no PEM certificate found", options.ClientCAFile)
+	}
+	return config, nil
+}
+
+/*
+CertificateReloader is a struct that serves a certificate and reloads it when its files change,
+so a rotated certificate is used without restarting the server
+the files are checked during a handshake at most every Interval (10 seconds when zero),
+a certificate that fails to load is logged and the previous one is kept
+Now is the clock of the checks, time.Now when it is nil
+*/
+type CertificateReloader struct {
+	Interval time.Duration
+	Now      func() time.Time
+
+	certFile    string
+	keyFile     string
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	loaded      [2]os.FileInfo
+	checked     time.Time
+}
+
+// NewCertificateReloader returns the reloader of the certificate and key files, returns an error if they cannot be loaded
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate, it is the GetCertificate of the TLS config
+func (reloader *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	now := time.Now()
+	if reloader.Now != nil {
+		now = reloader.Now()
+	}
+	interval := reloader.Interval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+	if now.Sub(reloader.checked) >= interval {
+		reloader.checked = now
+		if reloader.changed() {
+			if err := reloader.loadLocked(); err != nil {
+				slog.Error("reloading the TLS certificate", slog.String("error", err.Error()))
+			} else {
+				slog.Info("reloaded the TLS certificate", slog.String("certFile", reloader.certFile))
+			}
+		}
+	}
+	return reloader.certificate, nil
+}
+
+func (reloader *CertificateReloader) load() error {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+	return reloader.loadLocked()
+}
+
+// loadLocked loads the certificate and remembers the files it was loaded from, the lock is held
+func (reloader *CertificateReloader) loadLocked() error {
+	certInfo, certErr := os.Stat(reloader.certFile)
+	keyInfo, keyErr := os.Stat(reloader.keyFile)
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading the TLS certificate: %w", err)
+	}
+	if certErr == nil && keyErr == nil {
+		reloader.loaded = [2]os.FileInfo{certInfo, keyInfo}
+	}
+	reloader.certificate = &certificate
+	return nil
+}
+
+// changed reports whether the certificate or the key file was modified since it was loaded, the lock is held
+func (reloader *CertificateReloader) changed() bool {
+	for i, path := range []string{reloader.certFile, reloader.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false
+		}
+		if loaded := reloader.loaded[i]; loaded == nil || !info.ModTime().Equal(loaded.ModTime()) || info.Size() != loaded.Size() {
+			return true
+		}
+	}
+	return false
+}
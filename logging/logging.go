@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted is the value logged in place of the text of a receipt when the PII is redacted
+const Redacted = "[REDACTED]"
+
+/*
+piiKeys are the keys, lower case, whose values are free text written by the store or the customer,
+the retailer names and the item and discount descriptions, they are redacted wherever they appear in a log line,
+as an attribute or as the last part of the field of a validation failure, e.g. Receipt.Items[0].ShortDescription
+*/
+var piiKeys = map[string]bool{
+	"retailer":          true,
+	"submittedretailer": true,
+	"shortdescription":  true,
+	"description":       true,
+}
+
+// fieldIndex matches the index of a field in a slice, e.g. [0] in Items[0]
+var fieldIndex = regexp.MustCompile(`\[\d+\]$`)
+
+/*
+Options are the options of the logger
+Level is the lowest level that is logged
+RedactPII replaces the retailer names and item descriptions with [REDACTED]
+*/
+type Options struct {
+	Level     slog.Level
+	RedactPII bool
+}
+
+/*
+New returns a logger that writes one JSON object per line to w
+every log line has time, level and msg, followed by its attributes
+*/
+func New(w io.Writer, options Options) *slog.Logger {
+	handlerOptions := &slog.HandlerOptions{Level: options.Level}
+	if options.RedactPII {
+		handlerOptions.ReplaceAttr = redactPII
+	}
+	return slog.New(slog.NewJSONHandler(w, handlerOptions))
+}
+
+// ParseLevel parses a log level, debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return parsed, fmt.Errorf("invalid log level %q, must be debug, info, warn or error", level)
+	}
+	return parsed, nil
+}
+
+// IsPII reports whether the values of the key or of the field are free text of a receipt
+func IsPII(key string) bool {
+	if dot := strings.LastIndex(key, "."); dot >= 0 {
+		key = key[dot+1:]
+	}
+	return piiKeys[strings.ToLower(fieldIndex.ReplaceAllString(key, ""))]
+}
+
+/*
+redactPII replaces the values of the PII keys, and the value of a validation failure of a PII field,
+the value attribute in the group of the field
+*/
+func redactPII(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindGroup {
+		return attr
+	}
+	if IsPII(attr.Key) || (attr.Key == "value" && len(groups) > 0 && IsPII(groups[len(groups)-1])) {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// loggerKey is the key of the logger of a request in its context
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx that carries the logger, see FromContext
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+/*
+FromContext returns the logger of the request of ctx, it logs the request id with every line
+returns slog.Default() outside of a request
+*/
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+Registry is the registry of every metric of the service, served by Handler on /metrics
+it has the Go runtime and process metrics next to the ones below
+*/
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts the requests by method, route as registered and status
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration is the latency of the requests by method, route as registered and status
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// ReceiptsProcessed counts the receipts that were scored and stored
+	ReceiptsProcessed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "receipts_processed_total",
+		Help: "Receipts scored and stored.",
+	})
+
+	// ValidationFailures counts the rejected receipts by field and validation tag, e.g. purchaseDate and receiptDate
+	ValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "receipt_validation_failures_total",
+		Help: "Validation failures of submitted receipts by field and validation tag.",
+	}, []string{"field", "tag"})
+
+	// ReceiptPoints is the distribution of the points awarded to the receipts
+	ReceiptPoints = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "receipt_points",
+		Help:    "Points awarded per receipt.",
+		Buckets: []float64{0, 10, 25, 50, 75, 100, 150, 200, 300, 500, 1000},
+	})
+
+	// RulePoints counts the points awarded by every scoring rule
+	RulePoints = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "receipt_rule_points_total",
+		Help: "Points awarded by scoring rule.",
+	}, []string{"rule"})
+
+	// StoreOperationDuration is the latency of the store operations by store implementation and operation
+	StoreOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "store_operation_duration_seconds",
+		Help:    "Latency of the store operations by store implementation and operation.",
+		Buckets: []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .1},
+	}, []string{"store", "operation"})
+
+	// JobsQueued is the number of asynchronous jobs waiting for a worker
+	JobsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "jobs_queued",
+		Help: "Asynchronous jobs waiting for a worker.",
+	})
+
+	// JobsRejected counts the asynchronous jobs turned away because the queue was full
+	JobsRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jobs_rejected_total",
+		Help: "Asynchronous jobs rejected because the queue was full.",
+	})
+
+	// JobDuration is the time the asynchronous jobs ran by kind and final status, the time they waited is not included
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_duration_seconds",
+		Help:    "Run time of the asynchronous jobs by kind and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"kind", "status"})
+
+	// WebhookAttempts counts the attempts to deliver the events to the webhooks by event type and result, delivered, retried or dead
+	WebhookAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_attempts_total",
+		Help: "Attempts to deliver the events to the webhooks by event type and result.",
+	}, []string{"event", "result"})
+
+	// StreamSubscribers is the number of streams of the receipts scored, GET /receipts/stream, connected
+	StreamSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "receipt_stream_subscribers",
+		Help: "Streams of the receipts scored connected.",
+	})
+
+	// StreamSlowDisconnects counts the streams disconnected because they did not keep up with the receipts scored
+	StreamSlowDisconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "receipt_stream_slow_disconnects_total",
+		Help: "Streams of the receipts scored disconnected because they did not keep up.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		ReceiptsProcessed,
+		ValidationFailures,
+		ReceiptPoints,
+		RulePoints,
+		StoreOperationDuration,
+		JobsQueued,
+		JobsRejected,
+		JobDuration,
+		WebhookAttempts,
+		StreamSubscribers,
+		StreamSlowDisconnects,
+	)
+}
+
+// Handler returns the handler of /metrics, the metrics of Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+InstrumentedStore is a db.TenantStore that observes the latency of every operation of the store it wraps
+in StoreOperationDuration, labelled with the type of the wrapped store, e.g. *db.InMemoryDB
+so every store implementation is measured the same way without instrumenting it
+*/
+type InstrumentedStore struct {
+	store db.TenantStore
+	name  string
+}
+
+// InstrumentStore wraps a store so the latency of its operations is observed
+func InstrumentStore(store db.TenantStore) *InstrumentedStore {
+	return &InstrumentedStore{store: store, name: fmt.Sprintf("%T", store)}
+}
+
+// observe records the latency of an operation started at start
+func (store *InstrumentedStore) observe(operation string, start time.Time) {
+	StoreOperationDuration.WithLabelValues(store.name, operation).Observe(time.Since(start).Seconds())
+}
+
+// Ping pings the wrapped store if it can be pinged, see db.Pinger
+func (store *InstrumentedStore) Ping(ctx context.Context) error {
+	if pinger, ok := store.store.(db.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped store if it can be closed, see db.Closer
+func (store *InstrumentedStore) Close(ctx context.Context) error {
+	if closer, ok := store.store.(db.Closer); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
+
+func (store *InstrumentedStore) GetReceipt(ctx context.Context, id string) (int64, bool) {
+	defer store.observe("GetReceipt", time.Now())
+	return store.store.GetReceipt(ctx, id)
+}
+
+func (store *InstrumentedStore) GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool) {
+	defer store.observe("GetReceiptDetails", time.Now())
+	return store.store.GetReceiptDetails(ctx, id)
+}
+
+func (store *InstrumentedStore) AddNewReceipt(ctx context.Context, receipt *models.Receipt) string {
+	defer store.observe("AddNewReceipt", time.Now())
+	return store.store.AddNewReceipt(ctx, receipt)
+}
+
+func (store *InstrumentedStore) GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt {
+	defer store.observe("GetReceiptsDetails", time.Now())
+	return store.store.GetReceiptsDetails(ctx, ids)
+}
+
+func (store *InstrumentedStore) ListReceipts(ctx context.Context) []models.Receipt {
+	defer store.observe("ListReceipts", time.Now())
+	return store.store.ListReceipts(ctx)
+}
+
+func (store *InstrumentedStore) MemberPoints(ctx context.Context, memberID string) int64 {
+	defer store.observe("MemberPoints", time.Now())
+	return store.store.MemberPoints(ctx, memberID)
+}
+
+func (store *InstrumentedStore) AddRetailer(retailer *models.Retailer) (string, error) {
+	defer store.observe("AddRetailer", time.Now())
+	return store.store.AddRetailer(retailer)
+}
+
+func (store *InstrumentedStore) GetRetailer(id string) (*models.Retailer, bool) {
+	defer store.observe("GetRetailer", time.Now())
+	return store.store.GetRetailer(id)
+}
+
+func (store *InstrumentedStore) GetAllRetailers() []models.Retailer {
+	defer store.observe("GetAllRetailers", time.Now())
+	return store.store.GetAllRetailers()
+}
+
+func (store *InstrumentedStore) UpdateRetailer(retailer *models.Retailer) error {
+	defer store.observe("UpdateRetailer", time.Now())
+	return store.store.UpdateRetailer(retailer)
+}
+
+func (store *InstrumentedStore) DeleteRetailer(id string) bool {
+	defer store.observe("DeleteRetailer", time.Now())
+	return store.store.DeleteRetailer(id)
+}
+
+func (store *InstrumentedStore) FindRetailer(key string) (*models.Retailer, bool) {
+	defer store.observe("FindRetailer", time.Now())
+	return store.store.FindRetailer(key)
+}
+
+func (store *InstrumentedStore) AddJob(ctx context.Context, job *models.Job) string {
+	defer store.observe("AddJob", time.Now())
+	return store.store.AddJob(ctx, job)
+}
+
+func (store *InstrumentedStore) UpdateJob(ctx context.Context, job *models.Job) error {
+	defer store.observe("UpdateJob", time.Now())
+	return store.store.UpdateJob(ctx, job)
+}
+
+func (store *InstrumentedStore) GetJob(ctx context.Context, id string) (*models.Job, bool) {
+	defer store.observe("GetJob", time.Now())
+	return store.store.GetJob(ctx, id)
+}
+
+func (store *InstrumentedStore) AddWebhook(ctx context.Context, webhook *models.Webhook) string {
+	defer store.observe("AddWebhook", time.Now())
+	return store.store.AddWebhook(ctx, webhook)
+}
+
+func (store *InstrumentedStore) GetWebhook(ctx context.Context, id string) (*models.Webhook, bool) {
+	defer store.observe("GetWebhook", time.Now())
+	return store.store.GetWebhook(ctx, id)
+}
+
+func (store *InstrumentedStore) ListWebhooks(ctx context.Context) []models.Webhook {
+	defer store.observe("ListWebhooks", time.Now())
+	return store.store.ListWebhooks(ctx)
+}
+
+func (store *InstrumentedStore) DeleteWebhook(ctx context.Context, id string) bool {
+	defer store.observe("DeleteWebhook", time.Now())
+	return store.store.DeleteWebhook(ctx, id)
+}
+
+func (store *InstrumentedStore) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) string {
+	defer store.observe("AddDelivery", time.Now())
+	return store.store.AddDelivery(ctx, delivery)
+}
+
+func (store *InstrumentedStore) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	defer store.observe("UpdateDelivery", time.Now())
+	return store.store.UpdateDelivery(ctx, delivery)
+}
+
+func (store *InstrumentedStore) GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, bool) {
+	defer store.observe("GetDelivery", time.Now())
+	return store.store.GetDelivery(ctx, id)
+}
+
+func (store *InstrumentedStore) ListDeliveries(ctx context.Context, webhookID string) []models.WebhookDelivery {
+	defer store.observe("ListDeliveries", time.Now())
+	return store.store.ListDeliveries(ctx, webhookID)
+}
+
+/*
+InstrumentedAPIKeyStore is a db.APIKeyDB that observes the latency of every operation of the store it wraps,
+the store shared by all tenants, like InstrumentedStore does for the stores of the tenants
+*/
+type InstrumentedAPIKeyStore struct {
+	store db.APIKeyDB
+	name  string
+}
+
+// InstrumentAPIKeyStore wraps the store of the API keys so the latency of its operations is observed
+func InstrumentAPIKeyStore(store db.APIKeyDB) *InstrumentedAPIKeyStore {
+	return &InstrumentedAPIKeyStore{store: store, name: fmt.Sprintf("%T", store)}
+}
+
+// observe records the latency of an operation started at start
+func (store *InstrumentedAPIKeyStore) observe(operation string, start time.Time) {
+	StoreOperationDuration.WithLabelValues(store.name, operation).Observe(time.Since(start).Seconds())
+}
+
+// Ping pings the wrapped store if it can be pinged, see db.Pinger
+func (store *InstrumentedAPIKeyStore) Ping(ctx context.Context) error {
+	if pinger, ok := store.store.(db.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped store if it can be closed, see db.Closer
+func (store *InstrumentedAPIKeyStore) Close(ctx context.Context) error {
+	if closer, ok := store.store.(db.Closer); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
+
+func (store *InstrumentedAPIKeyStore) AddAPIKey(key *models.APIKey) string {
+	defer store.observe("AddAPIKey", time.Now())
+	return store.store.AddAPIKey(key)
+}
+
+func (store *InstrumentedAPIKeyStore) FindAPIKey(hash string) (*models.APIKey, bool) {
+	defer store.observe("FindAPIKey", time.Now())
+	return store.store.FindAPIKey(hash)
+}
+
+func (store *InstrumentedAPIKeyStore) GetAllAPIKeys() []models.APIKey {
+	defer store.observe("GetAllAPIKeys", time.Now())
+	return store.store.GetAllAPIKeys()
+}
+
+func (store *InstrumentedAPIKeyStore) RevokeAPIKey(id string) bool {
+	defer store.observe("RevokeAPIKey", time.Now())
+	return store.store.RevokeAPIKey(id)
+}
+
+func (store *InstrumentedAPIKeyStore) GetAPIKey(id string) (*models.APIKey, bool) {
+	defer store.observe("GetAPIKey", time.Now())
+	return store.store.GetAPIKey(id)
+}
+
+func (store *InstrumentedAPIKeyStore) AddUsage(id string, day string, limit int) (int, bool) {
+	defer store.observe("AddUsage", time.Now())
+	return store.store.AddUsage(id, day, limit)
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+)
+
+const (
+	// APIKeyHeader is the header partners send their API key in
+	APIKeyHeader = "X-API-Key"
+	// AdminTokenHeader is the header the admin token is sent in
+	AdminTokenHeader = "X-Admin-Token"
+	// APIKeyIDKey is the key of the id of the authenticated API key in the gin context
+	APIKeyIDKey = "apiKeyId"
+	// PartnerIDKey is the key of the id of the partner of the client certificate in the gin context
+	PartnerIDKey = "partnerId"
+	// PrincipalKey is the key of the *auth.Principal of the request in the gin context
+	PrincipalKey = "principal"
+)
+
+/*
+Authenticator is a struct that contains the ways a request can authenticate
+APIKeys 						-> API keys of partners in the X-API-Key header, granted receipts:read and receipts:write
+JWT 							-> bearer tokens in the Authorization header, granted the scopes of the token
+AdminToken 						-> the admin token in the X-Admin-Token header, granted admin
+Partners 						-> the verified client certificate of a mutual TLS connection, granted the scopes of its partner
+the client certificate is only used when the request has none of the headers above
+every field is optional, a way without a field is not accepted
+*/
+type Authenticator struct {
+	APIKeys    services.APIKeyService
+	JWT        *auth.JWTVerifier
+	AdminToken string
+	Partners   *auth.Partners
+}
+
+/*
+Authenticate is a middleware that only lets authenticated requests through
+the principal of the request is set in the gin context under PrincipalKey
+and the id of the API key under APIKeyIDKey (of the partner under PartnerIDKey), for the access log and the stored receipts
+if the credentials are missing or invalid, returns 401
+*/
+func (authenticator *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := authenticator.Principal(c.Request.Header, c.Request.TLS)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"description": "Valid credentials are required"})
+			return
+		}
+		c.Set(PrincipalKey, principal)
+		if principal.APIKeyID != "" {
+			c.Set(APIKeyIDKey, principal.APIKeyID)
+		}
+		if principal.PartnerID != "" {
+			c.Set(PartnerIDKey, principal.PartnerID)
+		}
+		c.Next()
+	}
+}
+
+/*
+Principal returns the principal of the credentials in the headers, or of the verified client certificate of the connection
+state is nil for connections without TLS, it is shared with the gRPC API whose metadata are given as headers
+returns false if the credentials are missing or invalid
+*/
+func (authenticator *Authenticator) Principal(header http.Header, state *tls.ConnectionState) (*auth.Principal, bool) {
+	if bearer, ok := bearerToken(header); ok {
+		if authenticator.JWT == nil {
+			return nil, false
+		}
+		principal, err := authenticator.JWT.Verify(bearer)
+		return principal, err == nil
+	}
+
+	if key := header.Get(APIKeyHeader); key != "" {
+		if authenticator.APIKeys == nil {
+			return nil, false
+		}
+		apiKey, ok := authenticator.APIKeys.Authenticate(key)
+		if !ok {
+			return nil, false
+		}
+		return &auth.Principal{
+			APIKeyID: apiKey.ID,
+			Scopes:   []string{auth.ScopeReceiptsRead, auth.ScopeReceiptsWrite},
+			TenantID: apiKey.TenantID,
+		}, true
+	}
+
+	if token := header.Get(AdminTokenHeader); token != "" {
+		if authenticator.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(authenticator.AdminToken)) != 1 {
+			return nil, false
+		}
+		return &auth.Principal{Scopes: []string{auth.ScopeAdmin}}, true
+	}
+
+	if state != nil && len(state.VerifiedChains) > 0 && authenticator.Partners != nil {
+		return authenticator.Partners.Principal(state.VerifiedChains[0][0])
+	}
+	return nil, false
+}
+
+/*
+RequireScope is a middleware that only lets requests with the scope, or with one of the scopes, through
+it has to run after Authenticate, if the principal has none of the scopes, returns 403
+*/
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := CurrentPrincipal(c)
+		if principal == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"description": "Valid credentials are required"})
+			return
+		}
+		for _, scope := range scopes {
+			if principal.HasScope(scope) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"description": "The " + strings.Join(scopes, " or ") + " scope is required"})
+	}
+}
+
+// CurrentPrincipal returns the principal of the request, nil when the route is not authenticated
+func CurrentPrincipal(c *gin.Context) *auth.Principal {
+	principal, _ := c.Get(PrincipalKey)
+	authenticated, _ := principal.(*auth.Principal)
+	return authenticated
+}
+
+func bearerToken(header http.Header) (string, bool) {
+	scheme, token, found := strings.Cut(header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
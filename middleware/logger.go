@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader is the header with the id of the request, echoed in every response
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the key of the id of the request in the gin context
+	RequestIDKey = "requestId"
+)
+
+// validRequestID matches the request ids accepted from clients, anything else is replaced by a generated one
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+/*
+RequestLogger is a middleware that writes one structured log line for every request
+the request id is taken from the X-Request-ID header or generated, it is echoed in the response
+and carried by the logger in the context of the request, see logging.FromContext,
+so every line logged while handling the request has it
+the line has the method, route as registered, path, status, latency in milliseconds, client IP,
+API key or partner, tenant and trace id of the request, at error level for 5xx, warn for 4xx and info otherwise
+*/
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		requestLogger := logger.With(slog.String("requestId", requestID))
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), requestLogger))
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latencyMs", float64(time.Since(start).Microseconds())/1000),
+			slog.String("clientIp", c.ClientIP()),
+		}
+		if apiKeyID := c.GetString(APIKeyIDKey); apiKeyID != "" {
+			attrs = append(attrs, slog.String("apiKeyId", apiKeyID))
+		}
+		if partnerID := c.GetString(PartnerIDKey); partnerID != "" {
+			attrs = append(attrs, slog.String("partnerId", partnerID))
+		}
+		if tenantID := c.GetString(TenantIDKey); tenantID != "" {
+			attrs = append(attrs, slog.String("tenant", tenantID))
+		}
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.HasTraceID() {
+			attrs = append(attrs, slog.String("traceId", spanContext.TraceID().String()))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		requestLogger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+)
+
+const (
+	// DailyQuotaLimitHeader is the header with the daily quota of the API key
+	DailyQuotaLimitHeader = "X-Daily-Quota-Limit"
+	// DailyQuotaRemainingHeader is the header with the submissions the API key has left today
+	DailyQuotaRemainingHeader = "X-Daily-Quota-Remaining"
+)
+
+/*
+DailyQuota is a middleware that counts the request against the daily quota of its API key
+it runs after Authenticate, requests without an API key (bearer tokens, -auth=false) have no quota
+every request counts, including the ones rejected afterwards as invalid
+responses of keys with a quota have the X-Daily-Quota-Limit and X-Daily-Quota-Remaining headers
+if the quota of the day is used up, returns 429 with Retry-After, the seconds until the next UTC day
+*/
+func DailyQuota(apiKeys services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKeyID := c.GetString(APIKeyIDKey)
+		if apiKeyID == "" {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		quota, ok := apiKeys.UseDailyQuota(apiKeyID, now)
+		if quota.Limit > 0 {
+			c.Header(DailyQuotaLimitHeader, strconv.Itoa(quota.Limit))
+			c.Header(DailyQuotaRemainingHeader, strconv.Itoa(quota.Remaining))
+		}
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(seconds(quota.Reset.Sub(now))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"description": "The daily quota of the API key is used up"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+Limit is a token bucket, RequestsPerSecond refill the bucket up to Burst requests
+a Limit with no RequestsPerSecond does not limit anything
+*/
+type Limit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"`
+}
+
+// enabled returns whether the limit limits anything
+func (limit Limit) enabled() bool {
+	return limit.RequestsPerSecond > 0 && limit.Burst > 0
+}
+
+/*
+RouteLimits are the limits of a route
+PerKey is the limit of every API key (or bearer token subject), PerIP the limit of every client IP
+*/
+type RouteLimits struct {
+	PerKey Limit `json:"perKey"`
+	PerIP  Limit `json:"perIP"`
+}
+
+/*
+RateLimiter is a struct that limits the requests of every API key and every client IP with token buckets
+Routes are the limits of the routes by "METHOD /path" as registered, e.g. "POST /receipts/process",
+the routes that are not in it use Default
+Now is the clock of the buckets, time.Now when it is nil
+
+every route has its own buckets so a partner reading receipts does not use up its submissions
+*/
+type RateLimiter struct {
+	Default RouteLimits            `json:"default"`
+	Routes  map[string]RouteLimits `json:"routes"`
+	Now     func() time.Time       `json:"-"`
+
+	lock     sync.Mutex
+	buckets  map[string]*tokenBucket
+	requests int
+}
+
+// pruneEvery is the number of requests after which the buckets that refilled are dropped
+const pruneEvery = 1024
+
+// tokenBucket is the state of a bucket, its tokens at the time it was last updated
+type tokenBucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens of the time since the bucket was last updated
+func (bucket *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(bucket.updated).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(bucket.limit.Burst), bucket.tokens+elapsed*bucket.limit.RequestsPerSecond)
+		bucket.updated = now
+	}
+}
+
+// wait returns the time until the bucket has the given number of tokens
+func (bucket *tokenBucket) wait(tokens float64) time.Duration {
+	if bucket.tokens >= tokens {
+		return 0
+	}
+	return time.Duration((tokens - bucket.tokens) / bucket.limit.RequestsPerSecond * float64(time.Second))
+}
+
+/*
+LoadRateLimits is a function that loads the rate limits from a JSON file
+returns an error if the file cannot be read or a limit is negative
+*/
+func LoadRateLimits(path string) (*RateLimiter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rate limits: %w", err)
+	}
+	var limiter RateLimiter
+	if err := json.Unmarshal(data, &limiter); err != nil {
+		return nil, fmt.Errorf("parsing rate limits %s: %w", path, err)
+	}
+
+	routes := map[string]RouteLimits{"default": limiter.Default}
+	for route, limits := range limiter.Routes {
+		routes[route] = limits
+	}
+	for route, limits := range routes {
+		for _, limit := range []Limit{limits.PerKey, limits.PerIP} {
+			if limit.RequestsPerSecond < 0 || limit.Burst < 0 {
+				return nil, fmt.Errorf("rate limits %s: %s has a negative limit", path, route)
+			}
+		}
+	}
+	return &limiter, nil
+}
+
+// rateLimitIPBucketKey is the key of the bucket of the client IP the request took a token from in the gin context
+const rateLimitIPBucketKey = "rateLimitIPBucket"
+
+// rateLimitTokensKey is the key of the tokens left in the tightest bucket of the request in the gin context
+const rateLimitTokensKey = "rateLimitTokens"
+
+/*
+LimitIP is a middleware that takes a token from the bucket of the client IP of the request
+it runs before Authenticate, so the requests with invalid credentials are limited too
+if the bucket is empty, returns 429 with Retry-After, the seconds until the request is allowed
+*/
+func (limiter *RateLimiter) LimitIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, limits := limiter.routeLimits(c)
+		key := route + "|ip|" + c.ClientIP()
+		if !limiter.limit(c, key, limits.PerIP) {
+			return
+		}
+		if limits.PerIP.enabled() {
+			c.Set(rateLimitIPBucketKey, key)
+		}
+		c.Next()
+	}
+}
+
+/*
+LimitKey is a middleware that takes a token from the bucket of the API key of the request
+it runs after Authenticate so the API key is known, requests without credentials only use the bucket of LimitIP
+a request it rejects gets back the token LimitIP took, so a rejected request takes no token from the other bucket
+*/
+func (limiter *RateLimiter) LimitKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := rateLimitClient(c)
+		if client == "" {
+			c.Next()
+			return
+		}
+		route, limits := limiter.routeLimits(c)
+		if !limiter.limit(c, route+"|"+client, limits.PerKey) {
+			if key := c.GetString(rateLimitIPBucketKey); key != "" {
+				limiter.refund(key)
+			}
+			return
+		}
+		c.Next()
+	}
+}
+
+// routeLimits returns the route of the request as Routes names it, and its limits, Default when it is not in Routes
+func (limiter *RateLimiter) routeLimits(c *gin.Context) (string, RouteLimits) {
+	route := c.Request.Method + " " + c.FullPath()
+	limits, ok := limiter.Routes[route]
+	if !ok {
+		limits = limiter.Default
+	}
+	return route, limits
+}
+
+/*
+limit is a function that takes a token from the bucket of the key, it does nothing when the limit is not enabled
+every response has the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers of the bucket
+closest to being empty, RateLimit-Reset is the seconds until it is full again
+if the bucket is empty, responds with 429 with Retry-After, the seconds until the request is allowed, and returns false
+*/
+func (limiter *RateLimiter) limit(c *gin.Context, key string, limit Limit) bool {
+	if !limit.enabled() {
+		return true
+	}
+	bucket, retryAfter := limiter.take(key, limit)
+	if tokens, ok := c.Get(rateLimitTokensKey); !ok || bucket.tokens < tokens.(float64) {
+		c.Set(rateLimitTokensKey, bucket.tokens)
+		c.Header("RateLimit-Limit", strconv.Itoa(bucket.limit.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(int(bucket.tokens)))
+		c.Header("RateLimit-Reset", strconv.Itoa(seconds(bucket.wait(float64(bucket.limit.Burst)))))
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(seconds(retryAfter)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"description": "Too many requests, retry later"})
+		return false
+	}
+	return true
+}
+
+// now returns the time of the clock of the buckets
+func (limiter *RateLimiter) now() time.Time {
+	if limiter.Now != nil {
+		return limiter.Now()
+	}
+	return time.Now()
+}
+
+/*
+take is a function that takes a token from the bucket of the key, or none if it is empty
+returns a copy of the bucket and, when it is empty, the time until it has a token again
+*/
+func (limiter *RateLimiter) take(key string, limit Limit) (tokenBucket, time.Duration) {
+	now := limiter.now()
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if limiter.buckets == nil {
+		limiter.buckets = make(map[string]*tokenBucket)
+	}
+	limiter.requests++
+	if limiter.requests%pruneEvery == 0 {
+		limiter.prune(now)
+	}
+
+	bucket, ok := limiter.buckets[key]
+	if !ok || bucket.limit != limit {
+		bucket = &tokenBucket{limit: limit, tokens: float64(limit.Burst), updated: now}
+		limiter.buckets[key] = bucket
+	}
+	bucket.refill(now)
+	retryAfter := bucket.wait(1)
+	if retryAfter == 0 {
+		bucket.tokens--
+	}
+	return *bucket, retryAfter
+}
+
+// refund gives the bucket of the key back the token a request took
+func (limiter *RateLimiter) refund(key string) {
+	now := limiter.now()
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if bucket, ok := limiter.buckets[key]; ok {
+		bucket.refill(now)
+		bucket.tokens = math.Min(float64(bucket.limit.Burst), bucket.tokens+1)
+	}
+}
+
+// prune drops the buckets that are full again, they are the same as new ones
+func (limiter *RateLimiter) prune(now time.Time) {
+	for key, bucket := range limiter.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.limit.Burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// rateLimitClient returns the API key, the partner or the bearer token subject of the request, empty without credentials
+func rateLimitClient(c *gin.Context) string {
+	if apiKeyID := c.GetString(APIKeyIDKey); apiKeyID != "" {
+		return "key|" + apiKeyID
+	}
+	if partnerID := c.GetString(PartnerIDKey); partnerID != "" {
+		return "partner|" + partnerID
+	}
+	if principal := CurrentPrincipal(c); principal != nil && principal.Subject != "" {
+		return "sub|" + principal.TenantID + "|" + principal.Subject
+	}
+	return ""
+}
+
+// seconds rounds a duration up to whole seconds, as the Retry-After and RateLimit-Reset headers use
+func seconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
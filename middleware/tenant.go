@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+)
+
+const (
+	// TenantHeader is the header a request names its tenant in
+	TenantHeader = "X-Tenant-ID"
+	// TenantIDKey is the key of the tenant id of the request in the gin context
+	TenantIDKey = "tenantId"
+)
+
+/*
+Tenant is a middleware that sets the tenant of the request in the gin context under TenantIDKey
+the tenant of the credentials (API key or bearer token) wins, the X-Tenant-ID header is used
+for credentials without a tenant (the admin token) and when the route is not authenticated
+requests without either belong to models.DefaultTenant
+if the header names another tenant than the credentials, returns 403
+if the header is not a valid tenant id, returns 400
+*/
+func Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID, err := ResolveTenant(CurrentPrincipal(c), c.GetHeader(TenantHeader))
+		if errors.Is(err, ErrOtherTenant) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"description": "The credentials do not belong to that tenant"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"description": "The tenant is invalid"})
+			return
+		}
+		c.Set(TenantIDKey, tenantID)
+		c.Next()
+	}
+}
+
+/*
+KnownTenant is a middleware that only lets the reads (GET and HEAD) of the tenants the registry knows through, see services.Tenants.Known
+a tenant is created by the first request writing to it, so reading any tenant id never creates its store
+it runs after Tenant
+if the tenant of a read is not known, returns 404
+*/
+func KnownTenant(tenants services.TenantRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) && !tenants.Known(TenantID(c)) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"description": "No tenant found for that ID"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// the errors of ResolveTenant
+var (
+	ErrOtherTenant   = errors.New("the credentials do not belong to that tenant")
+	ErrInvalidTenant = errors.New("the tenant is invalid")
+)
+
+/*
+ResolveTenant returns the tenant of a request of the principal, nil when it is not authenticated,
+that names the requested tenant, empty when it names none, see Tenant
+returns ErrOtherTenant if the principal belongs to another tenant and ErrInvalidTenant if it is not a valid tenant id
+*/
+func ResolveTenant(principal *auth.Principal, requested string) (string, error) {
+	tenantID := requested
+	if principal != nil && principal.TenantID != "" {
+		if tenantID != "" && tenantID != principal.TenantID {
+			return "", ErrOtherTenant
+		}
+		tenantID = principal.TenantID
+	}
+
+	if tenantID == "" {
+		tenantID = models.DefaultTenant
+	}
+	if !models.ValidTenantID(tenantID) {
+		return "", ErrInvalidTenant
+	}
+	return tenantID, nil
+}
+
+// TenantID returns the tenant of the request, models.DefaultTenant when the Tenant middleware did not run
+func TenantID(c *gin.Context) string {
+	if tenantID := c.GetString(TenantIDKey); tenantID != "" {
+		return tenantID
+	}
+	return models.DefaultTenant
+}
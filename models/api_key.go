@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+/*
+APIKey is a struct that contains an API key of a partner
+only the SHA-256 hash of the key is stored, the key itself is returned once when it is created
+a revoked key stays in the store so receipts keep pointing to a known key id
+TenantID is the tenant the key belongs to, requests with the key only see the receipts of that tenant
+DailyQuota is the number of receipts the key submits per UTC day, 0 uses the default quota of the server
+*/
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name" validate:"required,alphanumeric"`
+	TenantID   string     `json:"tenant" validate:"required,tenant"`
+	DailyQuota int        `json:"dailyQuota,omitempty" validate:"min=0"`
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// Discount is a struct that contains a discount line of the receipt, the amount is subtracted from the subtotal
+type Discount struct {
+	Description string `json:"description" xml:"description" validate:"required,alphanumeric"`
+	Amount      string `json:"amount" xml:"amount" validate:"required,decimal"`
+}
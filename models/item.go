@@ -1,8 +1,17 @@
 package models
 
-// Item is a struct that contains the shortDescription and the price of the item
+/*
+Item is a struct that contains the shortDescription and the price of the item
+category is assigned from the shortDescription by the item classifier of the rules file when the receipt is processed
+
+quantity and unitPrice are optional, when both are present price must be quantity * unitPrice
+rounded to the cent, a quantity with decimals is a weighed item (e.g. 1.250 kg)
+*/
 
 type Item struct {
-	ShortDescription string `json:"shortDescription" validate:"required,alphanumeric"`
-	Price            string `json:"price" validate:"required,decimal"`
-}
\ No newline at end of file
+	ShortDescription string `json:"shortDescription" xml:"shortDescription" validate:"required,alphanumeric"`
+	Price            string `json:"price" xml:"price" validate:"required,decimal"`
+	Quantity         string `json:"quantity,omitempty" xml:"quantity,omitempty" validate:"omitempty,quantity"`
+	UnitPrice        string `json:"unitPrice,omitempty" xml:"unitPrice,omitempty" validate:"omitempty,decimal"`
+	Category         string `json:"category,omitempty" xml:"category,omitempty"`
+}
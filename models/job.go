@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/*
+Job is a struct that contains a request processed asynchronously, see services.JobQueue
+Kind is what the job does, e.g. process for POST /receipts/process
+Status is queued until a worker runs it, running while it runs, and succeeded or failed once it is done
+Code and Result are the status and the body of the response the request would have had if it was processed right away,
+e.g. 200 and {"id": "..."} for a processed receipt or 400 and {"description": "The receipt is invalid"} for an invalid one
+ExpiresAt is when a job that is done is forgotten, GET /jobs/{id} returns 404 from then on, jobs are also forgotten earlier,
+the oldest first, when too many are done, see db.InMemoryDB.JobRetention
+the API key and the member that submitted the job are kept so members only find their own jobs
+*/
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	Code       int             `json:"code,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	ExpiresAt  *time.Time      `json:"expiresAt,omitempty"`
+	APIKeyID   string          `json:"-"`
+	MemberID   string          `json:"-"`
+}
+
+// the statuses of a job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobStatuses are the statuses of a job in the order a job goes through them
+var JobStatuses = []string{JobQueued, JobRunning, JobSucceeded, JobFailed}
+
+// Done reports whether the job succeeded or failed
+func (job *Job) Done() bool {
+	return job.Status == JobSucceeded || job.Status == JobFailed
+}
@@ -1,11 +1,62 @@
 package models
 
+import (
+	"encoding/xml"
+	"time"
+)
 
-// Receipt is a struct that contains the retailer, purchaseDate, purchaseTime, items and total of the receipt
+/*
+Receipt is a struct that contains the retailer, purchaseDate, purchaseTime, items and total of the receipt
+
+id, points, breakdown, retailerId and submittedRetailer are filled in when the receipt is processed
+breakdown has the points every scoring rule awarded, in the order the rules were evaluated
+submittedRetailer keeps the retailer name exactly as it was submitted
+while retailer is replaced by the canonical name when the retailer registry knows it
+
+subtotal, discounts and tax are optional, when any of them is present
+subtotal must be the sum of the item prices and total must be subtotal - discounts + tax
+
+currency is the ISO 4217 code of all the amounts of the receipt, USD when absent
+the amounts must have exactly as many decimals as the currency has minor units, e.g. none for JPY
+
+timezone is the IANA name or UTC offset purchaseDate and purchaseTime were written in,
+the timezone of the retailer when absent
+purchasedAt (the instant of the purchase) and createdAt (when the receipt was processed) are stored in UTC
+
+apiKeyId is the id of the API key the receipt was submitted with
+partnerId is the partner whose client certificate the receipt was submitted with
+memberId is the member the receipt belongs to, the subject of the bearer token for receipts submitted by members
+
+in XML the receipt is a receipt element with an element per field, the items are item elements in items,
+the discounts discount elements in discounts and the breakdown rule elements in breakdown
+*/
 type Receipt struct {
-	Retailer     string `json:"retailer" validate:"required,alphanumeric"`
-	PurchaseDate string `json:"purchaseDate" validate:"required,receiptDate"`
-	PurchaseTime string `json:"purchaseTime" validate:"required,receiptTime"`
-	Items        []Item `json:"items" validate:"required,min=1,dive"`
-	Total        string `json:"total" validate:"required,decimal"`
+	XMLName           xml.Name     `json:"-" xml:"receipt"`
+	ID                string       `json:"id,omitempty" xml:"id,omitempty"`
+	Retailer          string       `json:"retailer" xml:"retailer" validate:"required,alphanumeric"`
+	PurchaseDate      string       `json:"purchaseDate" xml:"purchaseDate" validate:"required,receiptDate"`
+	PurchaseTime      string       `json:"purchaseTime" xml:"purchaseTime" validate:"required,receiptTime"`
+	Items             []Item       `json:"items" xml:"items>item" validate:"required,min=1,dive"`
+	Total             string       `json:"total" xml:"total" validate:"required,decimal"`
+	Subtotal          string       `json:"subtotal,omitempty" xml:"subtotal,omitempty" validate:"omitempty,decimal"`
+	Discounts         []Discount   `json:"discounts,omitempty" xml:"discounts>discount,omitempty" validate:"omitempty,dive"`
+	Tax               string       `json:"tax,omitempty" xml:"tax,omitempty" validate:"omitempty,decimal"`
+	Currency          string       `json:"currency,omitempty" xml:"currency,omitempty" validate:"omitempty,currency"`
+	Timezone          string       `json:"timezone,omitempty" xml:"timezone,omitempty" validate:"omitempty,timezone"`
+	Points            int64        `json:"points,omitempty" xml:"points,omitempty"`
+	Breakdown         []RulePoints `json:"breakdown,omitempty" xml:"breakdown>rule,omitempty"`
+	RetailerID        string       `json:"retailerId,omitempty" xml:"retailerId,omitempty"`
+	SubmittedRetailer string       `json:"submittedRetailer,omitempty" xml:"submittedRetailer,omitempty"`
+	PurchasedAt       *time.Time   `json:"purchasedAt,omitempty" xml:"purchasedAt,omitempty"`
+	CreatedAt         *time.Time   `json:"createdAt,omitempty" xml:"createdAt,omitempty"`
+	APIKeyID          string       `json:"apiKeyId,omitempty" xml:"apiKeyId,omitempty"`
+	PartnerID         string       `json:"partnerId,omitempty" xml:"partnerId,omitempty"`
+	MemberID          string       `json:"memberId,omitempty" xml:"memberId,omitempty" validate:"max=255"`
+}
+
+// RulePoints are the points a scoring rule awarded to a receipt, rule is the label of the rule in the metrics
+// in XML a rule element with the rule in its name attribute, e.g. <rule name="retailerName">6</rule>
+type RulePoints struct {
+	Rule   string `json:"rule" xml:"name,attr"`
+	Points int64  `json:"points" xml:",chardata"`
 }
@@ -0,0 +1,47 @@
+package models
+
+import "strings"
+
+/*
+Retailer is a struct that contains the canonical name of a retailer
+and the aliases it is known by on submitted receipts
+
+"M&M Corner Market" with the alias "M & M CORNER MKT" makes receipts submitted
+with either name resolve to the same retailer
+Timezone is the local timezone of the stores of the retailer, used for receipts submitted without one
+*/
+type Retailer struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name" validate:"required,alphanumeric"`
+	Aliases  []string `json:"aliases" validate:"dive,alphanumeric"`
+	Timezone string   `json:"timezone,omitempty" validate:"omitempty,timezone"`
+}
+
+/*
+NormalizeRetailerName reduces a retailer name to the key used for matching
+only letters and digits are kept and they are upper cased
+so "M&M Corner Market", "m & m corner market" and "M&M CORNER MARKET" share the key "MMCORNERMARKET"
+*/
+func NormalizeRetailerName(name string) string {
+	var key strings.Builder
+	for _, char := range strings.ToUpper(name) {
+		if ('A' <= char && char <= 'Z') || ('0' <= char && char <= '9') {
+			key.WriteRune(char)
+		}
+	}
+	return key.String()
+}
+
+/*
+Keys returns the normalized keys of the canonical name and of every alias of the retailer
+names without any letter or digit have no key and are left out
+*/
+func (r *Retailer) Keys() []string {
+	var keys []string
+	for _, name := range append([]string{r.Name}, r.Aliases...) {
+		if key := NormalizeRetailerName(name); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
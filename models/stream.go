@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// EventsMissed is the type of the event a stream starts with when some of the events after its Last-Event-ID are no longer kept
+const EventsMissed = "events.missed"
+
+/*
+StreamedReceipt is a struct that contains a receipt scored as it is pushed on GET /receipts/stream, see services.ReceiptFeed
+ID is the id of the event, one more than the one of the receipt scored before it, a stream resumes after it with Last-Event-ID
+the receipts of every tenant are in the same feed, TenantID is the tenant the receipt belongs to
+*/
+type StreamedReceipt struct {
+	ID         uint64    `json:"-"`
+	TenantID   string    `json:"tenantId"`
+	ReceiptID  string    `json:"receiptId"`
+	Retailer   string    `json:"retailer"`
+	RetailerID string    `json:"retailerId,omitempty"`
+	Total      string    `json:"total"`
+	Currency   string    `json:"currency,omitempty"`
+	Points     int64     `json:"points"`
+	MemberID   string    `json:"memberId,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
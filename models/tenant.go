@@ -0,0 +1,16 @@
+package models
+
+import "regexp"
+
+// DefaultTenant is the tenant of requests that do not name one
+const DefaultTenant = "default"
+
+// TenantIDPattern is the pattern of tenant ids
+const TenantIDPattern = "^[a-z0-9][a-z0-9_-]{0,62}$"
+
+var tenantIDRegexp = regexp.MustCompile(TenantIDPattern)
+
+// ValidTenantID reports whether the tenant id is lower case letters, digits, "-" and "_", at most 63 characters
+func ValidTenantID(tenantID string) bool {
+	return tenantIDRegexp.MatchString(tenantID)
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	// the alpine image has no zoneinfo, embedding the database keeps IANA names working everywhere
+	_ "time/tzdata"
+)
+
+var offsetRegexp = regexp.MustCompile("^([+-])(\\d{2}):?(\\d{2})$")
+
+/*
+ParseTimezone is a function that returns the location for a timezone of a receipt or a retailer
+the timezone is either an IANA name (America/New_York, Europe/Berlin, UTC)
+or a fixed offset from UTC (Z, +05:30, -0400)
+*/
+func ParseTimezone(name string) (*time.Location, error) {
+	if name == "Z" {
+		return time.UTC, nil
+	}
+	if match := offsetRegexp.FindStringSubmatch(name); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		minutes, _ := strconv.Atoi(match[3])
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("invalid offset %q", name)
+		}
+		offset := hours*60*60 + minutes*60
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("invalid timezone %q", name)
+	}
+	return time.LoadLocation(name)
+}
+
+/*
+PurchaseInstant is a function that returns the instant of a purchase made at the wall clock
+purchaseDate (YYYY-MM-DD) and purchaseTime (HH:MM) in location
+
+around daylight saving time changes
+a wall clock time skipped when the clocks go forward is moved forward by the gap (02:30 becomes 03:30)
+a wall clock time repeated when the clocks go back is the first of the two (before the change)
+*/
+func PurchaseInstant(purchaseDate string, purchaseTime string, location *time.Location) (time.Time, error) {
+	const layout = "2006-01-02 15:04"
+	wallClock, err := time.Parse(layout, purchaseDate+" "+purchaseTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+	year, month, day := wallClock.Date()
+	hour, minute := wallClock.Hour(), wallClock.Minute()
+
+	// the offsets a day before and a day after are the two offsets around a daylight saving time change
+	_, offsetBefore := time.Date(year, month, day-1, hour, minute, 0, 0, location).Zone()
+	_, offsetAfter := time.Date(year, month, day+1, hour, minute, 0, 0, location).Zone()
+	for _, offset := range []int{offsetBefore, offsetAfter} {
+		instant := wallClock.Add(-time.Duration(offset) * time.Second).In(location)
+		if instant.Format(layout) == wallClock.Format(layout) {
+			return instant, nil
+		}
+	}
+	// skipped wall clock time, the offset before the clocks went forward moves it forward by the gap
+	return wallClock.Add(-time.Duration(offsetBefore) * time.Second).In(location), nil
+}
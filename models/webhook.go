@@ -0,0 +1,123 @@
+package models
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// the types of the events posted to the webhooks
+const (
+	// EventReceiptScored is posted when a receipt is scored and stored, see ReceiptScored
+	EventReceiptScored = "receipt.scored"
+	// EventPointsChanged is posted when the points of a member change because one of its receipts was scored, see PointsChanged
+	EventPointsChanged = "points.changed"
+)
+
+// WebhookEvents are the types of the events a webhook can subscribe to
+var WebhookEvents = []string{EventReceiptScored, EventPointsChanged}
+
+/*
+Webhook is a struct that contains a subscription of a URL to the events of a tenant, see services.WebhookDispatcher
+Events are the types of the events posted to the URL, see WebhookEvents
+Secret signs every delivery, see webhooks.Sign, it is generated when it is not given and only returned when the webhook is created
+the API key, the partner and the member that created the webhook are kept, the webhooks of a member only get the events of its receipts
+*/
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url" validate:"required,webhookURL"`
+	Events    []string  `json:"events" validate:"required,min=1,dive,webhookEvent"`
+	Secret    string    `json:"secret,omitempty" validate:"omitempty,min=16,max=256"`
+	CreatedAt time.Time `json:"createdAt"`
+	APIKeyID  string    `json:"-"`
+	PartnerID string    `json:"-"`
+	MemberID  string    `json:"-"`
+}
+
+// Subscribes reports whether the webhook subscribes to the events of the type
+func (webhook *Webhook) Subscribes(eventType string) bool {
+	for _, subscribed := range webhook.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ValidWebhookURL reports whether the URL is an absolute http or https URL the events can be posted to
+the address it resolves to is checked when the events are posted, see services.NewWebhookClient,
+checking it here would not do as the name may resolve to another address by then
+*/
+func ValidWebhookURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" && parsed.User == nil
+}
+
+/*
+WebhookEvent is a struct that contains an event posted to the webhooks, it is the body of every delivery
+the same event is posted to every webhook subscribed to it, so its id tells the retries and the other deliveries apart
+Data is ReceiptScored or PointsChanged depending on the type
+the member of the receipt is kept so the webhooks of other members do not get the event
+*/
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+	MemberID  string          `json:"-"`
+}
+
+// ReceiptScored is the data of a receipt.scored event
+type ReceiptScored struct {
+	ReceiptID string `json:"receiptId"`
+	Retailer  string `json:"retailer"`
+	Total     string `json:"total"`
+	Currency  string `json:"currency,omitempty"`
+	Points    int64  `json:"points"`
+	MemberID  string `json:"memberId,omitempty"`
+}
+
+/*
+PointsChanged is the data of a points.changed event
+Points are the points of the receipt that changed them and TotalPoints the points of all the receipts of the member
+*/
+type PointsChanged struct {
+	MemberID    string `json:"memberId"`
+	ReceiptID   string `json:"receiptId"`
+	Points      int64  `json:"points"`
+	TotalPoints int64  `json:"totalPoints"`
+}
+
+/*
+WebhookDelivery is a struct that contains the posting of an event to a webhook
+Status is pending until the webhook answers with a 2xx, delivered then, and dead once every attempt failed,
+the dead deliveries are the dead letters of the tenant, they are only attempted again when they are redelivered
+Attempts are every attempt so far, NextAttemptAt is when the next one is made while the delivery is pending
+*/
+type WebhookDelivery struct {
+	ID            string           `json:"id"`
+	WebhookID     string           `json:"webhookId"`
+	Event         WebhookEvent     `json:"event"`
+	Status        string           `json:"status"`
+	Attempts      []WebhookAttempt `json:"attempts"`
+	NextAttemptAt *time.Time       `json:"nextAttemptAt,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+}
+
+// WebhookAttempt is an attempt of a delivery, with the status of the response or the error when there was no response
+type WebhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// the statuses of a delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// DeliveryStatuses are the statuses of a delivery
+var DeliveryStatuses = []string{DeliveryPending, DeliveryDelivered, DeliveryDead}
@@ -0,0 +1,738 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+)
+
+/*
+Document is an OpenAPI 3.0 document, with the objects the document of the service uses
+the paths are keyed by path and then by lower case method
+*/
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+/*
+Operation is an endpoint, Security lists the alternative ways to authenticate,
+an empty list means the endpoint needs no credentials
+*/
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// JSON is the media type of the request and response bodies
+const JSON = "application/json"
+
+// the other media types of the receipt routes, see controllers.negotiate
+const (
+	XML     = "application/xml"
+	CSV     = "text/csv"
+	MsgPack = "application/msgpack"
+)
+
+// EventStream is the media type of the Server-Sent Events of /receipts/stream
+const EventStream = "text/event-stream"
+
+// the ways to authenticate, see middleware.Authenticator
+var (
+	partnerSecurity = []map[string][]string{{"apiKey": {}}, {"bearerToken": {}}}
+	adminSecurity   = []map[string][]string{{"adminToken": {}}, {"bearerToken": {}}}
+	noSecurity      = []map[string][]string{}
+)
+
+// readOnly are the fields of the models filled in by the server
+var readOnly = map[string]bool{
+	"Receipt.id": true, "Receipt.points": true, "Receipt.breakdown": true, "Receipt.retailerId": true, "Receipt.submittedRetailer": true,
+	"Receipt.purchasedAt": true, "Receipt.createdAt": true, "Receipt.apiKeyId": true, "Receipt.partnerId": true,
+	"Retailer.id": true, "APIKey.id": true, "APIKey.createdAt": true, "APIKey.revokedAt": true,
+	"Webhook.id": true, "Webhook.createdAt": true,
+}
+
+// descriptions are the descriptions of the fields of the models
+var descriptions = map[string]string{
+	"Receipt.retailer":          "the name of the retailer, replaced by the canonical name when the retailer registry knows it",
+	"Receipt.submittedRetailer": "the name of the retailer as it was submitted",
+	"Receipt.breakdown":         "the points every scoring rule awarded, they add up to points",
+	"Receipt.subtotal":          "the sum of the item prices",
+	"Receipt.total":             "subtotal - discounts + tax when any of them is present",
+	"Receipt.timezone":          "the timezone purchaseDate and purchaseTime were written in, the timezone of the retailer when absent",
+	"Receipt.purchasedAt":       "the instant of the purchase in UTC",
+	"Receipt.createdAt":         "when the receipt was processed, in UTC",
+	"Receipt.apiKeyId":          "the API key the receipt was submitted with",
+	"Receipt.partnerId":         "the partner whose client certificate the receipt was submitted with",
+	"Receipt.memberId":          "the member the receipt belongs to, the subject of the bearer token of a member",
+	"Item.price":                "unitPrice times quantity, rounded half up, when unitPrice is present",
+	"Item.category":             "the category of the item in the rules of the tenant",
+	"Retailer.aliases":          "the other names the retailer is submitted with",
+	"APIKey.tenant":             "the tenant of the key, default when absent",
+	"APIKey.dailyQuota":         "the receipts the key submits per UTC day, the quota of the server when absent",
+	"Webhook.events":            "the types of the events posted to the URL",
+	"Webhook.secret":            "the secret the deliveries are signed with, generated when absent, only returned when the webhook is created",
+}
+
+// Build returns the document of the service, with the schemas of the models, or an error if a model has a field it cannot describe
+func Build() (*Document, error) {
+	generator := &schemaGenerator{schemas: map[string]*Schema{}, readOnly: readOnly, descriptions: descriptions, tagsRequired: true}
+	for _, model := range []interface{}{models.Receipt{}, models.Retailer{}, models.APIKey{}, models.Webhook{}} {
+		if _, err := generator.ref(reflect.TypeOf(model)); err != nil {
+			return nil, err
+		}
+	}
+	// the tenant of a new API key defaults to models.DefaultTenant, see controllers.APIKeyController.CreateAPIKey
+	apiKey := generator.schemas["APIKey"]
+	apiKey.Required = remove(apiKey.Required, "tenant")
+	generator.tagsRequired = false
+	if _, err := generator.ref(reflect.TypeOf(services.BuildInfo{})); err != nil {
+		return nil, err
+	}
+
+	schemas := generator.schemas
+	text := &Schema{Type: "string"}
+	schemas["Error"] = object(map[string]*Schema{"description": text})
+	schemas["ReceiptID"] = object(map[string]*Schema{"id": text})
+	schemas["Points"] = object(map[string]*Schema{"points": {Type: "integer", Format: "int64"}})
+	schemas["RetailerID"] = object(map[string]*Schema{"id": text})
+	schemas["Retailers"] = object(map[string]*Schema{"retailers": {Type: "array", Items: ref("Retailer")}})
+	schemas["APIKeys"] = object(map[string]*Schema{"apiKeys": {Type: "array", Items: ref("APIKey")}})
+	schemas["CreatedAPIKey"] = object(map[string]*Schema{
+		"id": text, "name": text, "tenant": text,
+		"key": {Type: "string", Description: "the API key, it is only returned once"},
+	})
+	confidence := &Schema{
+		Type:                 "object",
+		Description:          "how sure the parser is of every field, from 0 (not found) to 1, e.g. retailer, purchaseDate and items[0]",
+		AdditionalProperties: &Schema{Type: "number"},
+	}
+	unparsed := &Schema{Type: "array", Description: "the lines before the total the parser did not understand", Items: text}
+	schemas["ProcessedText"] = object(map[string]*Schema{"id": text, "receipt": ref("Receipt"), "confidence": confidence, "unparsed": unparsed})
+	schemas["RejectedText"] = object(map[string]*Schema{
+		"description": text,
+		"receipt":     {Type: "object", Description: "the receipt the parser read, with the fields it did not find empty"},
+		"confidence":  confidence,
+		"unparsed":    unparsed,
+	})
+	schemas["GraphQLRequest"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"query":         text,
+			"variables":     {Type: "object", Description: "the values of the variables of the operation"},
+			"operationName": text,
+		},
+		Required: []string{"query"},
+	}
+	graphQLError := object(map[string]*Schema{
+		"message":   text,
+		"locations": {Type: "array", Items: object(map[string]*Schema{"line": {Type: "integer"}, "column": {Type: "integer"}})},
+		"path":      {Type: "array", Description: "the response keys and list indexes down to the field", Items: &Schema{}},
+	})
+	graphQLError.Required = []string{"message"}
+	schemas["GraphQLResponse"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"data": {
+				Type: "object", Nullable: true,
+				Description: "the result of the operation, absent when the request is invalid, null when a non-null field of the root is null",
+			},
+			"errors": {Type: "array", Items: graphQLError},
+		},
+	}
+	timestamp := &Schema{Type: "string", Format: "date-time"}
+	schemas["Job"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":         text,
+			"kind":       {Type: "string", Enum: []string{"process", "process-text"}, Description: "the route the job was submitted to"},
+			"status":     {Type: "string", Enum: models.JobStatuses},
+			"code":       {Type: "integer", Description: "the status of the response of the request, once the job is done"},
+			"result":     {Description: "the body of the response of the request, once the job is done, e.g. a ReceiptID or an Error"},
+			"createdAt":  timestamp,
+			"startedAt":  timestamp,
+			"finishedAt": timestamp,
+			"expiresAt":  {Type: "string", Format: "date-time", Description: "when the job is forgotten once it is done, /jobs/{id} returns 404 from then on"},
+		},
+		Required: []string{"createdAt", "id", "kind", "status"},
+	}
+	schemas["Webhooks"] = object(map[string]*Schema{"webhooks": {Type: "array", Items: ref("Webhook")}})
+	schemas["WebhookEvent"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":        {Type: "string", Description: "the id of the event, the same in every delivery of the event"},
+			"type":      {Type: "string", Enum: models.WebhookEvents},
+			"createdAt": timestamp,
+			"data":      {Type: "object", Description: "the receipt id, retailer, total, currency, points and member id of a receipt.scored event, the member id, receipt id, points and total points of a points.changed event"},
+		},
+		Required: []string{"createdAt", "data", "id", "type"},
+	}
+	attempt := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"at":         timestamp,
+			"statusCode": {Type: "integer", Description: "the status of the response of the webhook"},
+			"error":      {Type: "string", Description: "why there was no response, e.g. a timeout"},
+		},
+		Required: []string{"at"},
+	}
+	schemas["WebhookDelivery"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":            text,
+			"webhookId":     text,
+			"event":         ref("WebhookEvent"),
+			"status":        {Type: "string", Enum: models.DeliveryStatuses, Description: "pending until a 2xx response, dead once every attempt failed"},
+			"attempts":      {Type: "array", Items: attempt},
+			"nextAttemptAt": timestamp,
+			"createdAt":     timestamp,
+		},
+		Required: []string{"attempts", "createdAt", "event", "id", "status", "webhookId"},
+	}
+	schemas["WebhookDeliveries"] = object(map[string]*Schema{"deliveries": {Type: "array", Items: ref("WebhookDelivery")}})
+	schemas["StreamedReceipt"] = &Schema{
+		Type:        "object",
+		Description: "the data of a receipt.scored event of /receipts/stream, the id of the event is the one to resume after",
+		Properties: map[string]*Schema{
+			"tenantId":   text,
+			"receiptId":  text,
+			"retailer":   text,
+			"retailerId": text,
+			"total":      text,
+			"currency":   text,
+			"points":     {Type: "integer", Format: "int64"},
+			"memberId":   text,
+			"createdAt":  timestamp,
+		},
+		Required: []string{"createdAt", "points", "receiptId", "retailer", "tenantId", "total"},
+	}
+	schemas["Health"] = object(map[string]*Schema{"status": {Type: "string", Enum: []string{"ok"}}})
+	schemas["Readiness"] = object(map[string]*Schema{
+		"status": {Type: "string", Enum: []string{"ready", "unavailable"}},
+		"checks": {Type: "object", Description: "ok or the error of every check", AdditionalProperties: text},
+	})
+
+	return &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   "Receipt Processor",
+			Version: "1.0.0",
+			Description: "Scores receipts with points. Partners authenticate with an API key, a bearer token " +
+				"or a client certificate mapped to a partner (mutual TLS), the admin endpoints need the admin scope.",
+		},
+		Paths: paths(),
+		Components: Components{
+			Schemas: schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				"apiKey":      {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "the API key of a partner"},
+				"adminToken":  {Type: "apiKey", In: "header", Name: "X-Admin-Token", Description: "the admin token of the server"},
+				"bearerToken": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "granted the scopes of its scope claim"},
+			},
+		},
+	}, nil
+}
+
+/*
+Handler returns the handler of the document as JSON
+the document is built once, it panics if the document cannot be built, like regexp.MustCompile
+*/
+func Handler() http.Handler {
+	document, err := Build()
+	if err != nil {
+		panic(err)
+	}
+	body, err := json.Marshal(document)
+	if err != nil {
+		panic(err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", JSON)
+		w.Write(body)
+	})
+}
+
+// paths returns the operations of every route of the service
+func paths() map[string]map[string]*Operation {
+	receiptID := []Parameter{pathParameter("id", "the id of the receipt"), tenantParameter}
+	retailerID := []Parameter{pathParameter("id", "the id of the retailer"), tenantParameter}
+	return map[string]map[string]*Operation{
+		"/receipts/process": {
+			"post": {
+				OperationID: "processReceipt",
+				Summary:     "Processes a receipt and returns its id, needs receipts:write, counts against the daily quota of the API key",
+				Tags:        []string{"receipts"},
+				Parameters:  []Parameter{tenantParameter, preferParameter},
+				RequestBody: &RequestBody{Required: true, Content: receiptContent(ref("Receipt"))},
+				Responses:   responses(negotiated("the id of the receipt", "ReceiptID"), accepted, 400, 401, 403, 406, 429, 503),
+				Security:    partnerSecurity,
+			},
+		},
+		"/receipts/process-text": {
+			"post": {
+				OperationID: "processReceiptText",
+				Summary:     "Parses a receipt from text, e.g. from OCR or an e-mail, and processes it like /receipts/process, needs receipts:write",
+				Tags:        []string{"receipts"},
+				Parameters:  []Parameter{tenantParameter, preferParameter},
+				RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}},
+				Responses: responses(ok("the id of the receipt, the receipt and the confidence of its fields", "ProcessedText"), accepted,
+					status(http.StatusBadRequest, "the parsed receipt is invalid, with what the parser read", "RejectedText"), 401, 403, 413, 429, 503),
+				Security: partnerSecurity,
+			},
+		},
+		"/receipts/stream": {
+			"get": {
+				OperationID: "streamReceipts",
+				Summary: "Streams the receipts scored as Server-Sent Events, a receipt.scored event with a StreamedReceipt per receipt, needs receipts:read or admin, " +
+					"members only get their own receipts, the stream ends when it does not keep up and resumes after the Last-Event-ID",
+				Tags: []string{"receipts"},
+				Parameters: []Parameter{
+					{Name: "tenant", In: "query", Description: "the tenant of the receipts, the X-Tenant-ID header when absent, every tenant for the admin token when neither is given", Schema: &Schema{Type: "string", Pattern: models.TenantIDPattern}},
+					{Name: "retailer", In: "query", Description: "the name or id of the retailer of the receipts, may be repeated", Schema: &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+					{Name: "Last-Event-ID", In: "header", Description: "the id of the last event received, the receipts still kept after it are sent first", Schema: &Schema{Type: "string"}},
+					{Name: "lastEventId", In: "query", Description: "the Last-Event-ID, for the clients that cannot send it", Schema: &Schema{Type: "string"}},
+					tenantParameter,
+				},
+				Responses: responses(statusResponse{http.StatusOK, Response{
+					Description: "the stream, an events.missed event first when some receipts after the Last-Event-ID are no longer kept",
+					Content:     map[string]MediaType{EventStream: {Schema: &Schema{Type: "string"}}},
+				}}, 400, 401, 403, 404, 429, 503),
+				Security: append([]map[string][]string{{"adminToken": {}}}, partnerSecurity...),
+			},
+		},
+		"/receipts/{id}/points": {
+			"get": {
+				OperationID: "getReceiptPoints",
+				Summary:     "Returns the points of a receipt, needs receipts:read",
+				Tags:        []string{"receipts"},
+				Parameters:  receiptID,
+				Responses:   responses(negotiated("the points of the receipt", "Points"), 400, 401, 403, 404, 406, 429),
+				Security:    partnerSecurity,
+			},
+		},
+		"/receipts/{id}": {
+			"get": {
+				OperationID: "getReceipt",
+				Summary:     "Returns a processed receipt, needs receipts:read, members only find their own receipts",
+				Tags:        []string{"receipts"},
+				Parameters:  receiptID,
+				Responses:   responses(negotiated("the receipt", "Receipt"), 400, 401, 403, 404, 406, 429),
+				Security:    partnerSecurity,
+			},
+		},
+		"/retailers": {
+			"get": {
+				OperationID: "getAllRetailers",
+				Summary:     "Returns every retailer of the registry of the tenant",
+				Tags:        []string{"retailers"},
+				Parameters:  []Parameter{tenantParameter},
+				Responses:   responses(ok("the retailers", "Retailers"), 400, 401, 403, 404, 429),
+				Security:    adminSecurity,
+			},
+			"post": {
+				OperationID: "addRetailer",
+				Summary:     "Adds a retailer to the registry of the tenant",
+				Tags:        []string{"retailers"},
+				Parameters:  []Parameter{tenantParameter},
+				RequestBody: &RequestBody{Required: true, Content: content(ref("Retailer"))},
+				Responses:   responses(status(http.StatusCreated, "the id of the retailer", "RetailerID"), 400, 401, 403, 409, 429, 500),
+				Security:    adminSecurity,
+			},
+		},
+		"/retailers/{id}": {
+			"get": {
+				OperationID: "getRetailer",
+				Summary:     "Returns a retailer",
+				Tags:        []string{"retailers"},
+				Parameters:  retailerID,
+				Responses:   responses(ok("the retailer", "Retailer"), 400, 401, 403, 404, 429),
+				Security:    adminSecurity,
+			},
+			"put": {
+				OperationID: "updateRetailer",
+				Summary:     "Replaces the name, aliases and timezone of a retailer",
+				Tags:        []string{"retailers"},
+				Parameters:  retailerID,
+				RequestBody: &RequestBody{Required: true, Content: content(ref("Retailer"))},
+				Responses:   responses(ok("the retailer", "Retailer"), 400, 401, 403, 404, 409, 429, 500),
+				Security:    adminSecurity,
+			},
+			"delete": {
+				OperationID: "deleteRetailer",
+				Summary:     "Removes a retailer from the registry",
+				Tags:        []string{"retailers"},
+				Parameters:  retailerID,
+				Responses:   responses(noContent("the retailer is removed"), 400, 401, 403, 404, 429),
+				Security:    adminSecurity,
+			},
+		},
+		"/admin/api-keys": {
+			"get": {
+				OperationID: "getAllAPIKeys",
+				Summary:     "Returns the API keys of the tenants the caller manages, without the keys themselves",
+				Tags:        []string{"admin"},
+				Responses:   responses(ok("the API keys", "APIKeys"), 401, 403, 429),
+				Security:    adminSecurity,
+			},
+			"post": {
+				OperationID: "createAPIKey",
+				Summary:     "Creates an API key and returns it, only its hash is stored",
+				Tags:        []string{"admin"},
+				RequestBody: &RequestBody{Required: true, Content: content(ref("APIKey"))},
+				Responses:   responses(status(http.StatusCreated, "the API key", "CreatedAPIKey"), 400, 401, 403, 429, 500),
+				Security:    adminSecurity,
+			},
+		},
+		"/admin/api-keys/{id}": {
+			"delete": {
+				OperationID: "revokeAPIKey",
+				Summary:     "Revokes an API key",
+				Tags:        []string{"admin"},
+				Parameters:  []Parameter{pathParameter("id", "the id of the API key")},
+				Responses:   responses(noContent("the API key is revoked"), 401, 403, 404, 429),
+				Security:    adminSecurity,
+			},
+		},
+		"/graphql": {
+			"post": {
+				OperationID: "graphql",
+				Summary: "Executes a GraphQL request over the receipts, their items and points breakdown and the members, " +
+					"queries need receipts:read and mutations receipts:write, see /graphql/schema",
+				Tags:        []string{"graphql"},
+				Parameters:  []Parameter{tenantParameter},
+				RequestBody: &RequestBody{Required: true, Content: content(ref("GraphQLRequest"))},
+				Responses:   responses(ok("the result, with the errors of the request or of its fields", "GraphQLResponse"), 400, 401, 403, 404, 413, 429),
+				Security:    partnerSecurity,
+			},
+			"get": {
+				OperationID: "graphqlQuery",
+				Summary:     "Executes a GraphQL query, mutations are only allowed in POST requests",
+				Tags:        []string{"graphql"},
+				Parameters: []Parameter{
+					{Name: "query", In: "query", Required: true, Description: "the GraphQL query", Schema: &Schema{Type: "string"}},
+					{Name: "variables", In: "query", Description: "the variables as a JSON object", Schema: &Schema{Type: "string"}},
+					{Name: "operationName", In: "query", Description: "the operation to execute", Schema: &Schema{Type: "string"}},
+					tenantParameter,
+				},
+				Responses: responses(ok("the result, with the errors of the request or of its fields", "GraphQLResponse"), 400, 401, 403, 404, 405, 413, 429),
+				Security:  partnerSecurity,
+			},
+		},
+		"/graphql/schema": {
+			"get": {
+				OperationID: "graphqlSchema",
+				Summary:     "Returns the schema of the GraphQL API in the schema definition language",
+				Tags:        []string{"graphql"},
+				Responses: map[string]Response{"200": {
+					Description: "the schema",
+					Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+				}},
+				Security: noSecurity,
+			},
+		},
+		"/jobs/{id}": {
+			"get": {
+				OperationID: "getJob",
+				Summary: "Returns a job of a request sent with Prefer: respond-async and its result once it is done, needs receipts:read, members only find their own jobs, " +
+					"a job that is done is kept until its expiresAt, an hour later, and only the last 10000 done jobs of a tenant are kept",
+				Tags:       []string{"receipts"},
+				Parameters: []Parameter{pathParameter("id", "the id of the job"), tenantParameter},
+				Responses:  responses(ok("the job", "Job"), 400, 401, 403, 404, 429),
+				Security:   partnerSecurity,
+			},
+		},
+		"/webhooks": {
+			"get": {
+				OperationID: "getAllWebhooks",
+				Summary:     "Returns the webhooks, without their secrets, needs receipts:read, members only find their own webhooks",
+				Tags:        []string{"webhooks"},
+				Parameters:  []Parameter{tenantParameter},
+				Responses:   responses(ok("the webhooks", "Webhooks"), 400, 401, 403, 404, 429),
+				Security:    partnerSecurity,
+			},
+			"post": {
+				OperationID: "addWebhook",
+				Summary:     "Adds a webhook the events of the receipts are posted to and returns it with its secret, needs receipts:read and receipts:write or admin",
+				Tags:        []string{"webhooks"},
+				Parameters:  []Parameter{tenantParameter},
+				RequestBody: &RequestBody{Required: true, Content: content(ref("Webhook"))},
+				Responses:   responses(status(http.StatusCreated, "the webhook with its secret", "Webhook"), 400, 401, 403, 404, 429, 500),
+				Security:    partnerSecurity,
+			},
+		},
+		"/webhooks/dead-letters": {
+			"get": {
+				OperationID: "getDeadLetters",
+				Summary:     "Returns the deliveries whose every attempt failed, needs receipts:read",
+				Tags:        []string{"webhooks"},
+				Parameters:  []Parameter{tenantParameter},
+				Responses:   responses(ok("the dead letters, the oldest first", "WebhookDeliveries"), 400, 401, 403, 404, 429),
+				Security:    partnerSecurity,
+			},
+		},
+		"/webhooks/dead-letters/{id}/redeliver": {
+			"post": {
+				OperationID: "redeliver",
+				Summary:     "Attempts a dead letter again with as many attempts as a new delivery, needs receipts:read and receipts:write or admin",
+				Tags:        []string{"webhooks"},
+				Parameters:  []Parameter{pathParameter("id", "the id of the delivery"), tenantParameter},
+				Responses:   responses(status(http.StatusAccepted, "the delivery, pending again", "WebhookDelivery"), 400, 401, 403, 404, 429),
+				Security:    partnerSecurity,
+			},
+		},
+		"/webhooks/{id}": {
+			"get": {
+				OperationID: "getWebhook",
+				Summary:     "Returns a webhook, without its secret",
+				Tags:        []string{"webhooks"},
+				Parameters:  []Parameter{pathParameter("id", "the id of the webhook"), tenantParameter},
+				Responses:   responses(ok("the webhook", "Webhook"), 400, 401, 403, 404, 429),
+				Security:    partnerSecurity,
+			},
+			"delete": {
+				OperationID: "deleteWebhook",
+				Summary:     "Removes a webhook with its deliveries, no more events are posted to it, needs receipts:read and receipts:write or admin",
+				Tags:        []string{"webhooks"},
+				Parameters:  []Parameter{pathParameter("id", "the id of the webhook"), tenantParameter},
+				Responses:   responses(noContent("the webhook is removed"), 400, 401, 403, 404, 429),
+				Security:    partnerSecurity,
+			},
+		},
+		"/webhooks/{id}/deliveries": {
+			"get": {
+				OperationID: "getWebhookDeliveries",
+				Summary:     "Returns the delivery history of a webhook, every delivery with its event, its status and its attempts",
+				Tags:        []string{"webhooks"},
+				Parameters:  []Parameter{pathParameter("id", "the id of the webhook"), tenantParameter},
+				Responses:   responses(ok("the deliveries, the oldest first", "WebhookDeliveries"), 400, 401, 403, 404, 429),
+				Security:    partnerSecurity,
+			},
+		},
+		"/healthz": {
+			"get": {
+				OperationID: "healthz",
+				Summary:     "Returns 200 while the process serves requests",
+				Tags:        []string{"health"},
+				Responses:   responses(ok("the process is alive", "Health")),
+				Security:    noSecurity,
+			},
+		},
+		"/readyz": {
+			"get": {
+				OperationID: "readyz",
+				Summary:     "Returns whether the service is ready to serve requests, with the result of every check",
+				Tags:        []string{"health"},
+				Responses: responses(ok("the service is ready", "Readiness"),
+					status(http.StatusServiceUnavailable, "a check fails or the service is shutting down", "Readiness")),
+				Security: noSecurity,
+			},
+		},
+		"/version": {
+			"get": {
+				OperationID: "version",
+				Summary:     "Returns the build of the service and the versions of its rules",
+				Tags:        []string{"health"},
+				Responses:   responses(ok("the build info", "BuildInfo")),
+				Security:    noSecurity,
+			},
+		},
+		"/metrics": {
+			"get": {
+				OperationID: "metrics",
+				Summary:     "Returns the Prometheus metrics",
+				Tags:        []string{"health"},
+				Responses: map[string]Response{"200": {
+					Description: "the metrics in the Prometheus text format",
+					Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+				}},
+				Security: noSecurity,
+			},
+		},
+		"/openapi.json": {
+			"get": {
+				OperationID: "openapi",
+				Summary:     "Returns this document",
+				Tags:        []string{"health"},
+				Responses:   map[string]Response{"200": {Description: "the OpenAPI document", Content: content(&Schema{Type: "object"})}},
+				Security:    noSecurity,
+			},
+		},
+	}
+}
+
+// tenantParameter is the header the admin token names the tenant of a request in, see middleware.Tenant
+var tenantParameter = Parameter{
+	Name:        "X-Tenant-ID",
+	In:          "header",
+	Description: "the tenant of the request when the credentials do not belong to one, default when absent, a tenant is created by its first write",
+	Schema:      &Schema{Type: "string", Pattern: models.TenantIDPattern},
+}
+
+// preferParameter asks for the request to be processed by a job, see controllers.submitJob
+var preferParameter = Parameter{
+	Name:        "Prefer",
+	In:          "header",
+	Description: "respond-async to get 202 with a job right away, the receipt is processed by the job",
+	Schema:      &Schema{Type: "string"},
+}
+
+// accepted is the response of the requests sent with Prefer: respond-async
+var accepted = statusResponse{http.StatusAccepted, Response{
+	Description: "the job processing the request, its result is returned by /jobs/{id}",
+	Headers:     map[string]Header{"Location": {Description: "the URL of the job", Schema: &Schema{Type: "string"}}},
+	Content:     content(ref("Job")),
+}}
+
+// errorDescriptions are the descriptions of the error responses by status
+var errorDescriptions = map[int]string{
+	http.StatusBadRequest:            "the request or the X-Tenant-ID header is invalid",
+	http.StatusUnauthorized:          "valid credentials are required",
+	http.StatusForbidden:             "the credentials lack the scope or belong to another tenant",
+	http.StatusNotFound:              "not found, or the tenant of a read is not known",
+	http.StatusMethodNotAllowed:      "the method is not allowed for the request",
+	http.StatusNotAcceptable:         "the Accept header accepts none of JSON, XML, CSV and MessagePack",
+	http.StatusConflict:              "the name or an alias belongs to another retailer",
+	http.StatusRequestEntityTooLarge: "the body is too long",
+	http.StatusTooManyRequests:       "a rate limit is hit or the daily quota is used up, retry after Retry-After seconds",
+	http.StatusInternalServerError:   "the change could not be saved",
+	http.StatusServiceUnavailable:    "too many jobs are waiting or the server is shutting down, retry after Retry-After seconds",
+}
+
+// statusResponse is a response of a status
+type statusResponse struct {
+	status   int
+	response Response
+}
+
+// responses returns the responses of an operation, the success response and the error responses of the statuses
+func responses(success statusResponse, statuses ...interface{}) map[string]Response {
+	all := map[string]Response{strconv.Itoa(success.status): success.response}
+	for _, status := range statuses {
+		switch status := status.(type) {
+		case int:
+			response := Response{Description: errorDescriptions[status], Content: content(ref("Error"))}
+			if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+				response.Headers = map[string]Header{"Retry-After": {Description: "the seconds until the request is allowed", Schema: &Schema{Type: "integer"}}}
+			}
+			all[strconv.Itoa(status)] = response
+		case statusResponse:
+			all[strconv.Itoa(status.status)] = status.response
+		}
+	}
+	return all
+}
+
+func ok(description string, schema string) statusResponse {
+	return status(http.StatusOK, description, schema)
+}
+
+func status(code int, description string, schema string) statusResponse {
+	return statusResponse{code, Response{Description: description, Content: content(ref(schema))}}
+}
+
+func noContent(description string) statusResponse {
+	return statusResponse{http.StatusNoContent, Response{Description: description}}
+}
+
+func content(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{JSON: {Schema: schema}}
+}
+
+// receiptContent returns the content of a receipt body, JSON, XML with the same fields, or CSV with a row per item
+func receiptContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{JSON: {Schema: schema}, XML: {Schema: schema}, CSV: {Schema: &Schema{Type: "string"}}}
+}
+
+// negotiated returns the success response of a receipt route, in the format of the Accept header
+func negotiated(description string, schema string) statusResponse {
+	response := receiptContent(ref(schema))
+	response[MsgPack] = MediaType{Schema: ref(schema)}
+	return statusResponse{http.StatusOK, Response{Description: description, Content: response}}
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// object returns the schema of an object whose properties are all required
+func object(properties map[string]*Schema) *Schema {
+	schema := &Schema{Type: "object", Properties: properties}
+	for name := range properties {
+		schema.Required = append(schema.Required, name)
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func remove(values []string, value string) []string {
+	var kept []string
+	for _, candidate := range values {
+		if candidate != value {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+func pathParameter(name string, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &Schema{Type: "string"}}
+}
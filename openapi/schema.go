@@ -0,0 +1,241 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+)
+
+/*
+Schema is an OpenAPI 3.0 schema object, with the keywords the document uses
+Ref is a reference to a schema of the components, the other fields are empty when it is set
+*/
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// the patterns of the validations that are done by parsing, the parsing is stricter than the pattern
+const (
+	receiptDatePattern = "^\\d{4}-\\d{2}-\\d{2}$"
+	receiptTimePattern = "^\\d{1,2}:\\d{2}$"
+	decimalPattern     = "^\\d+(\\.\\d+)?$"
+)
+
+/*
+schemaGenerator is a struct that derives the schemas of the components from the models
+the properties come from the json tags of the fields and their restrictions from the validate tags,
+a struct field is a reference to the schema of its type, which is generated once
+*/
+type schemaGenerator struct {
+	schemas map[string]*Schema
+	// readOnly are the fields filled in by the server by "Type.field", they are ignored in requests
+	readOnly map[string]bool
+	// descriptions are the descriptions of the fields by "Type.field"
+	descriptions map[string]string
+	// tagsRequired makes the fields required by their validate tag instead of the absence of omitempty
+	tagsRequired bool
+}
+
+// ref returns a reference to the schema of the struct type, generating it the first time
+func (generator *schemaGenerator) ref(t reflect.Type) (*Schema, error) {
+	if _, ok := generator.schemas[t.Name()]; !ok {
+		generator.schemas[t.Name()] = &Schema{}
+		schema, err := generator.object(t)
+		if err != nil {
+			return nil, err
+		}
+		generator.schemas[t.Name()] = schema
+	}
+	return &Schema{Ref: "#/components/schemas/" + t.Name()}, nil
+}
+
+// object returns the schema of a struct type
+func (generator *schemaGenerator) object(t reflect.Type) (*Schema, error) {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		rules := strings.Split(field.Tag.Get("validate"), ",")
+		if field.Tag.Get("validate") == "" {
+			rules = nil
+		}
+		fieldRules, elementRules := rules, []string(nil)
+		for i, rule := range rules {
+			if rule == "dive" {
+				fieldRules, elementRules = rules[:i], rules[i+1:]
+				break
+			}
+		}
+
+		property, err := generator.schema(field.Type, fieldRules, elementRules)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		// the siblings of a reference are ignored in OpenAPI 3.0, so only the other properties are described
+		key := t.Name() + "." + name
+		if property.Ref == "" {
+			if description := generator.descriptions[key]; description != "" {
+				property.Description = description
+			}
+			property.ReadOnly = generator.readOnly[key]
+		}
+		schema.Properties[name] = property
+
+		required := !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer
+		if generator.tagsRequired {
+			required = contains(fieldRules, "required")
+		}
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema, nil
+}
+
+// schema returns the schema of a field of the type, with the validate rules of the field and of its elements
+func (generator *schemaGenerator) schema(t reflect.Type, rules []string, elementRules []string) (*Schema, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var schema *Schema
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		schema = &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		return generator.ref(t)
+	case t.Kind() == reflect.Slice:
+		items, err := generator.schema(t.Elem(), elementRules, nil)
+		if err != nil {
+			return nil, err
+		}
+		schema = &Schema{Type: "array", Items: items}
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		values, err := generator.schema(t.Elem(), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		schema = &Schema{Type: "object", AdditionalProperties: values}
+	case t.Kind() == reflect.String:
+		schema = &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		schema = &Schema{Type: "boolean"}
+	case t.Kind() == reflect.Int64:
+		schema = &Schema{Type: "integer", Format: "int64"}
+	case t.Kind() == reflect.Int:
+		schema = &Schema{Type: "integer"}
+	case t.Kind() == reflect.Float64:
+		schema = &Schema{Type: "number"}
+	default:
+		return nil, fmt.Errorf("no schema for the type %s", t)
+	}
+	for _, rule := range rules {
+		if err := applyRule(schema, rule); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+/*
+applyRule is a function that restricts the schema with a rule of a validate tag, see validators.NewValidator
+returns an error for a rule it does not know, so a new validation is not left out of the document
+*/
+func applyRule(schema *Schema, rule string) error {
+	name, param, _ := strings.Cut(rule, "=")
+	switch name {
+	case "required", "omitempty":
+	case "alphanumeric":
+		schema.Pattern = validators.AlphanumericPattern
+	case "receiptDate":
+		schema.Format = "date"
+		schema.Pattern = receiptDatePattern
+	case "receiptTime":
+		schema.Pattern = receiptTimePattern
+		schema.Description = "the time of the day on a 24 hour clock, HH:MM"
+	case "decimal":
+		schema.Pattern = decimalPattern
+		schema.Description = "a decimal amount with exactly as many decimals as the currency of the receipt has minor units, e.g. 6.49 in USD and 649 in JPY"
+	case "quantity":
+		schema.Pattern = validators.QuantityPattern
+		schema.Description = "a positive quantity with up to three decimals, 1 when absent"
+	case "currency":
+		schema.Enum = currencies()
+		schema.Description = "the ISO 4217 code of all the amounts of the receipt, USD when absent"
+	case "timezone":
+		schema.Description = "an IANA timezone name (America/New_York) or an offset from UTC (+05:30, -0400, Z)"
+	case "tenant":
+		schema.Pattern = models.TenantIDPattern
+	case "webhookURL":
+		schema.Format = "uri"
+		schema.Description = "an absolute http or https URL the events are posted to"
+	case "webhookEvent":
+		schema.Enum = models.WebhookEvents
+	case "min", "max":
+		value, err := strconv.Atoi(param)
+		if err != nil {
+			return fmt.Errorf("the rule %s has no number", rule)
+		}
+		switch {
+		case schema.Type == "string" && name == "min":
+			schema.MinLength = &value
+		case schema.Type == "string":
+			schema.MaxLength = &value
+		case schema.Type == "array" && name == "min":
+			schema.MinItems = &value
+		case schema.Type == "integer" && name == "min":
+			schema.Minimum = &value
+		default:
+			return fmt.Errorf("the rule %s is not supported on %s", rule, schema.Type)
+		}
+	default:
+		return fmt.Errorf("the rule %s has no schema", rule)
+	}
+	return nil
+}
+
+// currencies returns the currency codes in alphabetical order
+func currencies() []string {
+	codes := make([]string, 0, len(models.CurrencyMinorUnits))
+	for code := range models.CurrencyMinorUnits {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+// apiKeyPrefix makes the API keys of the service recognizable, e.g. in secret scanners
+const apiKeyPrefix = "rpk_"
+
+/*
+APIKeyService is an interface that contains the methods to manage the API keys of partners
+CreateAPIKey is a method that creates a new API key and returns it along with the key itself
+Authenticate is a method that returns the API key for a key sent by a client, if it is valid and not revoked
+UseDailyQuota is a method that counts a submission of the API key against its daily quota,
+returns false when the quota of the day is used up
+*/
+type APIKeyService interface {
+	CreateAPIKey(name string, tenantID string, dailyQuota int) (*models.APIKey, string, error)
+	GetAllAPIKeys() []models.APIKey
+	RevokeAPIKey(id string) bool
+	Authenticate(key string) (*models.APIKey, bool)
+	UseDailyQuota(id string, now time.Time) (Quota, bool)
+}
+
+/*
+Quota is the daily quota of an API key after a submission
+Limit is 0 when the key has no quota, Reset is the start of the next UTC day
+*/
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+/*
+APIKeyServiceImpl is a struct that contains the APIKeyDB
+the keys are 32 random bytes, only their SHA-256 hash is stored
+a slow password hash is not needed because the keys are random and not chosen by people
+DefaultDailyQuota is the daily quota of the keys created without one, 0 means no quota
+*/
+type APIKeyServiceImpl struct {
+	DB                db.APIKeyDB
+	DefaultDailyQuota int
+}
+
+/*
+CreateAPIKey is a function that creates a new API key of a tenant with a name to recognize it by
+dailyQuota is the number of receipts the key submits per day, 0 uses DefaultDailyQuota
+the key itself is only returned here, it cannot be retrieved afterwards
+*/
+func (apiKeyService *APIKeyServiceImpl) CreateAPIKey(name string, tenantID string, dailyQuota int) (*models.APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		Name:       name,
+		TenantID:   tenantID,
+		DailyQuota: dailyQuota,
+		Hash:       HashAPIKey(key),
+		CreatedAt:  time.Now().UTC(),
+	}
+	apiKeyService.DB.AddAPIKey(&apiKey)
+	return &apiKey, key, nil
+}
+
+// GetAllAPIKeys is a function that returns every API key sorted by creation time
+func (apiKeyService *APIKeyServiceImpl) GetAllAPIKeys() []models.APIKey {
+	keys := apiKeyService.DB.GetAllAPIKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// RevokeAPIKey is a function that revokes an API key, requests with it are rejected from then on
+func (apiKeyService *APIKeyServiceImpl) RevokeAPIKey(id string) bool {
+	return apiKeyService.DB.RevokeAPIKey(id)
+}
+
+func (apiKeyService *APIKeyServiceImpl) Authenticate(key string) (*models.APIKey, bool) {
+	if key == "" {
+		return nil, false
+	}
+	apiKey, ok := apiKeyService.DB.FindAPIKey(HashAPIKey(key))
+	if !ok || apiKey.RevokedAt != nil {
+		return nil, false
+	}
+	return apiKey, true
+}
+
+/*
+UseDailyQuota is a function that counts a submission of the API key on the UTC day of now
+the quota of the key is its DailyQuota or DefaultDailyQuota, keys without either are only counted
+returns false without counting the submission when the quota of the day is used up
+*/
+func (apiKeyService *APIKeyServiceImpl) UseDailyQuota(id string, now time.Time) (Quota, bool) {
+	now = now.UTC()
+	quota := Quota{
+		Limit: apiKeyService.DefaultDailyQuota,
+		Reset: time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+	}
+	if apiKey, ok := apiKeyService.DB.GetAPIKey(id); ok && apiKey.DailyQuota > 0 {
+		quota.Limit = apiKey.DailyQuota
+	}
+
+	used, ok := apiKeyService.DB.AddUsage(id, now.Format("2006-01-02"), quota.Limit)
+	if quota.Limit > 0 {
+		quota.Remaining = quota.Limit - used
+	}
+	return quota, ok
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash an API key is stored as
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+ConversionTable is a struct that contains the exchange rates used by the total based rules
+it is loaded from a JSON file, see rates.json in the root of the repository
+
+Base is the currency the total based rules are defined in, USD when empty
+Rates maps a currency code to the amount of Base one unit of the currency is worth, e.g. "CAD": "0.73"
+*/
+type ConversionTable struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+
+	rates map[string]*big.Rat
+}
+
+/*
+LoadConversionTable is a function that reads the conversion table at path and checks it
+returns an error if the file cannot be read, a currency is not an ISO 4217 code or a rate is not a positive number
+*/
+func LoadConversionTable(path string) (*ConversionTable, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading conversion table: %w", err)
+	}
+
+	var table ConversionTable
+	if err := json.Unmarshal(content, &table); err != nil {
+		return nil, fmt.Errorf("parsing conversion table %s: %w", path, err)
+	}
+	if err := table.Compile(); err != nil {
+		return nil, fmt.Errorf("invalid conversion table %s: %w", path, err)
+	}
+	return &table, nil
+}
+
+// Compile is a function that checks the currencies and parses the rates of the table
+func (table *ConversionTable) Compile() error {
+	if table.Base == "" {
+		table.Base = models.DefaultCurrency
+	}
+	if _, ok := models.CurrencyMinorUnits[table.Base]; !ok {
+		return fmt.Errorf("unknown base currency %q", table.Base)
+	}
+
+	table.rates = make(map[string]*big.Rat)
+	for currency, rate := range table.Rates {
+		if _, ok := models.CurrencyMinorUnits[currency]; !ok {
+			return fmt.Errorf("unknown currency %q", currency)
+		}
+		parsedRate, ok := new(big.Rat).SetString(rate)
+		if !ok || parsedRate.Sign() <= 0 {
+			return fmt.Errorf("invalid rate %q for %s", rate, currency)
+		}
+		table.rates[currency] = parsedRate
+	}
+	return nil
+}
+
+/*
+Convert is a function that converts an amount in currency to the base currency of the table
+the result is rounded half up to the minor unit of the base currency and formatted with its decimals
+returns false when there is no rate for the currency
+a nil table only knows the default currency
+*/
+func (table *ConversionTable) Convert(amount string, currency string) (string, bool) {
+	base := models.DefaultCurrency
+	if table != nil {
+		base = table.Base
+	}
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	if currency == base {
+		return amount, true
+	}
+	if table == nil || table.rates[currency] == nil {
+		return "", false
+	}
+
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return "", false
+	}
+	value.Mul(value, table.rates[currency])
+	return value.FloatString(models.CurrencyMinorUnits[base]), true
+}
+
+/*
+PointsForReceiptTotalInCurrency applies the total based rules of PointsForReceiptTotal
+to the total converted to the base currency of the conversion table
+so a round amount of euros only earns the round dollar points when it is worth a round amount of dollars
+no points are awarded when there is no rate for the currency
+*/
+func PointsForReceiptTotalInCurrency(receiptTotal string, currency string, table *ConversionTable) int64 {
+	total, ok := table.Convert(receiptTotal, currency)
+	if !ok {
+		return 0
+	}
+	return PointsForReceiptTotal(total)
+}
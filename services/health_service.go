@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+/*
+HealthService is an interface that contains the methods behind the health endpoints
+Ready is a method that runs the readiness checks and returns the result of every check, and whether all passed
+ShutDown is a method that marks the service as shutting down, it is not ready from then on
+Version is a method that returns the build info of the service
+*/
+type HealthService interface {
+	Ready(ctx context.Context) (map[string]string, bool)
+	ShutDown()
+	Version() BuildInfo
+}
+
+/*
+HealthCheck is a readiness check, Check returns an error when the service cannot serve requests
+e.g. the store is unreachable
+*/
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+/*
+BuildInfo is the build of the service and the rules it scores receipts with
+Commit and BuildTime are set at build time with -ldflags, or taken from the VCS info Go stamps into the binary
+RulesVersion is the version of the rules file, TenantRulesVersions the versions of the rules files of the tenants
+*/
+type BuildInfo struct {
+	Commit              string            `json:"commit"`
+	BuildTime           string            `json:"buildTime"`
+	GoVersion           string            `json:"goVersion"`
+	RulesVersion        string            `json:"rulesVersion"`
+	TenantRulesVersions map[string]string `json:"tenantRulesVersions,omitempty"`
+}
+
+/*
+HealthServiceImpl is a struct that implements the HealthService
+Checks are the readiness checks, every check gets Timeout to pass, 2 seconds when it is zero
+Build is the build info returned by Version
+*/
+type HealthServiceImpl struct {
+	Checks  []HealthCheck
+	Build   BuildInfo
+	Timeout time.Duration
+
+	shuttingDown atomic.Bool
+}
+
+// ShuttingDownCheck is the name of the check that fails once the service is shutting down
+const ShuttingDownCheck = "shutdown"
+
+/*
+Ready is a function that runs every readiness check and returns "ok" or the error of every check
+the service is not ready once ShutDown was called, without running the checks,
+so the load balancer stops sending requests while the requests in flight are drained
+*/
+func (healthService *HealthServiceImpl) Ready(ctx context.Context) (map[string]string, bool) {
+	if healthService.shuttingDown.Load() {
+		return map[string]string{ShuttingDownCheck: "shutting down"}, false
+	}
+
+	timeout := healthService.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	results := make(map[string]string, len(healthService.Checks))
+	ready := true
+	for _, check := range healthService.Checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := check.Check(checkCtx)
+		cancel()
+		if err != nil {
+			results[check.Name] = err.Error()
+			ready = false
+			continue
+		}
+		results[check.Name] = "ok"
+	}
+	return results, ready
+}
+
+func (healthService *HealthServiceImpl) ShutDown() {
+	healthService.shuttingDown.Store(true)
+}
+
+func (healthService *HealthServiceImpl) Version() BuildInfo {
+	return healthService.Build
+}
+
+/*
+NewBuildInfo is a function that returns the build info of the running binary
+commit and buildTime are the values set with -ldflags, when empty they are taken from the VCS info of the binary,
+"unknown" when the binary was built without it, e.g. by go run
+*/
+func NewBuildInfo(commit string, buildTime string) BuildInfo {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && commit == "":
+				commit = setting.Value
+			case setting.Key == "vcs.time" && buildTime == "":
+				buildTime = setting.Value
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if buildTime == "" {
+		buildTime = "unknown"
+	}
+	return BuildInfo{Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when as many jobs as the queue holds are waiting for a worker
+	ErrQueueFull = errors.New("the job queue is full")
+	// ErrQueueClosed is returned by Submit once the queue is closed, when the server shuts down
+	ErrQueueClosed = errors.New("the job queue is closed")
+)
+
+/*
+JobFunc is the work of a job, it returns the status code and the body of the response of the request the job was created for
+the context carries the logger and the span of the request, it is not canceled when the request is done
+*/
+type JobFunc func(ctx context.Context) (int, any)
+
+/*
+JobService is an interface that contains the methods to run requests asynchronously
+Submit is a method that stores the job and queues it, the job is run by a worker of the queue later
+GetJob is a method that returns the job with its status and, once it is done, its result
+*/
+type JobService interface {
+	Submit(ctx context.Context, job *models.Job, run JobFunc) error
+	GetJob(ctx context.Context, id string) (*models.Job, bool)
+}
+
+/*
+JobServiceImpl is a struct that contains the DB the jobs of a tenant are kept in and the queue they are run by
+the queue is shared by every tenant, so the workers are bounded for the whole server
+*/
+type JobServiceImpl struct {
+	DB    db.JobDB
+	Queue *JobQueue
+}
+
+func (jobService *JobServiceImpl) Submit(ctx context.Context, job *models.Job, run JobFunc) error {
+	return jobService.Queue.Submit(ctx, jobService.DB, job, run)
+}
+
+func (jobService *JobServiceImpl) GetJob(ctx context.Context, id string) (*models.Job, bool) {
+	return jobService.DB.GetJob(ctx, id)
+}
+
+/*
+JobQueue is a struct that runs the jobs with a bounded pool of workers
+at most the size of the queue jobs wait for a worker, Submit returns ErrQueueFull instead of queueing more
+so the callers shed the load they cannot keep up with rather than piling it up
+the state of every job is kept in the store it was submitted with, see db.JobDB, so any request can look it up
+*/
+type JobQueue struct {
+	lock    sync.Mutex
+	closed  bool
+	queue   chan queuedJob
+	workers sync.WaitGroup
+}
+
+// queuedJob is a job waiting for a worker with the store it is kept in
+type queuedJob struct {
+	ctx   context.Context
+	store db.JobDB
+	job   *models.Job
+	run   JobFunc
+}
+
+// NewJobQueue returns a queue with workers workers running its jobs and room for size jobs waiting for them
+func NewJobQueue(workers int, size int) *JobQueue {
+	queue := &JobQueue{queue: make(chan queuedJob, size)}
+	queue.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go queue.work()
+	}
+	return queue
+}
+
+/*
+Submit is a function that stores the job as queued and queues it
+the job gets its id and stays as it was queued, the worker runs a copy of it, so the caller may still read it, e.g. to respond with it
+returns ErrQueueFull when the queue is full and ErrQueueClosed once it is closed, the job is not stored then
+*/
+func (queue *JobQueue) Submit(ctx context.Context, store db.JobDB, job *models.Job, run JobFunc) error {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.closed {
+		return ErrQueueClosed
+	}
+	// only Submit sends to the queue and it holds the lock, so the send below never blocks
+	if len(queue.queue) == cap(queue.queue) {
+		metrics.JobsRejected.Inc()
+		return ErrQueueFull
+	}
+
+	job.Status = models.JobQueued
+	job.CreatedAt = time.Now().UTC()
+	store.AddJob(ctx, job)
+	queued := *job
+	queue.queue <- queuedJob{ctx: context.WithoutCancel(ctx), store: store, job: &queued, run: run}
+	metrics.JobsQueued.Inc()
+	return nil
+}
+
+/*
+Close is a function that stops the queue from accepting jobs and waits for the workers to run the jobs already queued
+returns the error of ctx if it is done first, it is one of the httpserver.Shutdown Close functions
+*/
+func (queue *JobQueue) Close(ctx context.Context) error {
+	queue.lock.Lock()
+	if !queue.closed {
+		queue.closed = true
+		close(queue.queue)
+	}
+	queue.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		queue.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (queue *JobQueue) work() {
+	defer queue.workers.Done()
+	for queued := range queue.queue {
+		metrics.JobsQueued.Dec()
+		queue.run(queued)
+	}
+}
+
+/*
+run runs a job and stores its result, a job that panics fails with 500
+the job is stored as running first, so its status shows it has left the queue
+*/
+func (queue *JobQueue) run(queued queuedJob) {
+	job := queued.job
+	ctx, span := tracing.Start(queued.ctx, "job."+job.Kind)
+	defer span.End()
+	span.SetAttributes(attribute.String("job.id", job.ID))
+
+	started := time.Now().UTC()
+	job.Status = models.JobRunning
+	job.StartedAt = &started
+	if err := queued.store.UpdateJob(ctx, job); err != nil {
+		span.RecordError(err)
+	}
+
+	code, body := runJob(ctx, queued.run)
+	result, err := json.Marshal(body)
+	if err != nil {
+		code, result = http.StatusInternalServerError, []byte(`{"description":"The result of the job could not be written"}`)
+	}
+	finished := time.Now().UTC()
+	job.Code, job.Result, job.FinishedAt = code, result, &finished
+	job.Status = models.JobSucceeded
+	if code >= http.StatusBadRequest {
+		job.Status = models.JobFailed
+		span.SetStatus(codes.Error, "job failed")
+	}
+	if err := queued.store.UpdateJob(ctx, job); err != nil {
+		span.RecordError(err)
+	}
+
+	metrics.JobDuration.WithLabelValues(job.Kind, job.Status).Observe(finished.Sub(started).Seconds())
+	logging.FromContext(ctx).Info("job done",
+		slog.String("jobId", job.ID),
+		slog.String("kind", job.Kind),
+		slog.String("status", job.Status),
+		slog.Int("code", code),
+		slog.Duration("waited", started.Sub(job.CreatedAt)),
+		slog.Duration("ran", finished.Sub(started)))
+}
+
+// runJob runs the work of a job, a panic is logged and turned into a 500
+func runJob(ctx context.Context, run JobFunc) (code int, body any) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logging.FromContext(ctx).Error("job panicked", slog.String("error", fmt.Sprint(recovered)))
+			code, body = http.StatusInternalServerError, map[string]string{"description": "The job failed"}
+		}
+	}()
+	return run(ctx)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+// the reasons a subscription to the ReceiptFeed ends, see ReceiptSubscription.Err
+var (
+	// ErrSlowConsumer ends a subscription that let as many receipts as it has room for pile up
+	ErrSlowConsumer = errors.New("the subscription did not keep up with the receipts")
+	// ErrFeedClosed ends the subscriptions once the feed is closed, when the server shuts down, and is returned by Subscribe after
+	ErrFeedClosed = errors.New("the receipt feed is closed")
+)
+
+/*
+ReceiptFeed is a struct that pushes the receipts scored by every tenant to its subscriptions, see GET /receipts/stream
+the last receipts are kept in a bounded buffer so a subscription resuming after an event gets the ones it missed
+
+Publish never waits for a subscription, every subscription has room for a few receipts, see NewReceiptFeed,
+and a subscription that lets them pile up is a slow consumer, it is ended with ErrSlowConsumer and can resume after its last event
+so one slow stream never stalls the receipts being scored
+*/
+type ReceiptFeed struct {
+	lock             sync.Mutex
+	closed           bool
+	bufferSize       int
+	subscriberBuffer int
+	buffer           []models.StreamedReceipt // a ring, oldest is the index of the oldest receipt once it is full
+	oldest           int
+	lastID           uint64
+	subscriptions    map[*ReceiptSubscription]bool
+}
+
+// NewReceiptFeed returns a feed keeping the last bufferSize receipts with room for subscriberBuffer receipts in every subscription
+func NewReceiptFeed(bufferSize int, subscriberBuffer int) *ReceiptFeed {
+	return &ReceiptFeed{
+		bufferSize:       bufferSize,
+		subscriberBuffer: subscriberBuffer,
+		subscriptions:    make(map[*ReceiptSubscription]bool),
+	}
+}
+
+/*
+ReceiptFilter is a struct that contains the receipts a subscription gets
+TenantID is the tenant of the receipts, every tenant when empty
+Retailers are the retailers of the receipts, their names or ids in any case, every retailer when empty
+MemberID is the member of the receipts, every member when empty
+*/
+type ReceiptFilter struct {
+	TenantID  string
+	Retailers []string
+	MemberID  string
+}
+
+// Matches reports whether the receipt passes the filter
+func (filter *ReceiptFilter) Matches(receipt *models.StreamedReceipt) bool {
+	if filter.TenantID != "" && receipt.TenantID != filter.TenantID {
+		return false
+	}
+	if filter.MemberID != "" && receipt.MemberID != filter.MemberID {
+		return false
+	}
+	if len(filter.Retailers) == 0 {
+		return true
+	}
+	for _, retailer := range filter.Retailers {
+		if strings.EqualFold(retailer, receipt.Retailer) || (receipt.RetailerID != "" && strings.EqualFold(retailer, receipt.RetailerID)) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ReceiptSubscription is a struct that contains the receipts pushed to a subscriber
+Replay are the receipts kept in the buffer after the event the subscription resumed after, to be sent before the ones of Receipts
+Missed is set when some of the receipts after that event are no longer kept, or the event is not one of this feed, e.g. before a restart
+Receipts is closed when the subscription ends, Err tells why
+*/
+type ReceiptSubscription struct {
+	Replay   []models.StreamedReceipt
+	Missed   bool
+	Receipts <-chan models.StreamedReceipt
+
+	filter   ReceiptFilter
+	receipts chan models.StreamedReceipt
+	err      error
+}
+
+// Err returns why the subscription ended once Receipts is closed, ErrSlowConsumer or ErrFeedClosed, nil when it was unsubscribed
+func (subscription *ReceiptSubscription) Err() error {
+	return subscription.err
+}
+
+/*
+Subscribe is a function that subscribes to the receipts of the filter scored from now on
+with resume the subscription also replays the receipts kept after the event of lastID, see ReceiptSubscription
+returns ErrFeedClosed once the feed is closed, the subscription must be ended with Unsubscribe
+*/
+func (feed *ReceiptFeed) Subscribe(filter ReceiptFilter, resume bool, lastID uint64) (*ReceiptSubscription, error) {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	if feed.closed {
+		return nil, ErrFeedClosed
+	}
+
+	receipts := make(chan models.StreamedReceipt, feed.subscriberBuffer)
+	subscription := &ReceiptSubscription{Receipts: receipts, filter: filter, receipts: receipts}
+	if resume {
+		oldestID := feed.lastID + 1 - uint64(len(feed.buffer))
+		if lastID > feed.lastID {
+			subscription.Missed = true
+			lastID = 0
+		} else if lastID+1 < oldestID {
+			subscription.Missed = true
+		}
+		for i := range feed.buffer {
+			receipt := feed.buffer[(feed.oldest+i)%len(feed.buffer)]
+			if receipt.ID > lastID && filter.Matches(&receipt) {
+				subscription.Replay = append(subscription.Replay, receipt)
+			}
+		}
+	}
+	feed.subscriptions[subscription] = true
+	metrics.StreamSubscribers.Inc()
+	return subscription, nil
+}
+
+// Unsubscribe is a function that ends the subscription, it does nothing when it already ended
+func (feed *ReceiptFeed) Unsubscribe(subscription *ReceiptSubscription) {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	feed.end(subscription, nil)
+}
+
+/*
+Publish is a function that pushes the receipt of the tenant to the subscriptions it matches and keeps it in the buffer
+the oldest receipt is dropped from the buffer once it is full
+the subscriptions without room for the receipt are ended with ErrSlowConsumer
+*/
+func (feed *ReceiptFeed) Publish(tenantID string, r *models.Receipt) {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+
+	feed.lastID++
+	receipt := models.StreamedReceipt{
+		ID:         feed.lastID,
+		TenantID:   tenantID,
+		ReceiptID:  r.ID,
+		Retailer:   r.Retailer,
+		RetailerID: r.RetailerID,
+		Total:      r.Total,
+		Currency:   r.Currency,
+		Points:     r.Points,
+		MemberID:   r.MemberID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if r.CreatedAt != nil {
+		receipt.CreatedAt = *r.CreatedAt
+	}
+	if len(feed.buffer) < feed.bufferSize {
+		feed.buffer = append(feed.buffer, receipt)
+	} else {
+		feed.buffer[feed.oldest] = receipt
+		feed.oldest = (feed.oldest + 1) % feed.bufferSize
+	}
+
+	for subscription := range feed.subscriptions {
+		if !subscription.filter.Matches(&receipt) {
+			continue
+		}
+		select {
+		case subscription.receipts <- receipt:
+		default:
+			metrics.StreamSlowDisconnects.Inc()
+			feed.end(subscription, ErrSlowConsumer)
+		}
+	}
+}
+
+/*
+Close is a function that ends every subscription with ErrFeedClosed and refuses the new ones
+the streams are endless, so it is called when the server starts shutting down rather than after the requests are drained
+*/
+func (feed *ReceiptFeed) Close() {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	feed.closed = true
+	for subscription := range feed.subscriptions {
+		feed.end(subscription, ErrFeedClosed)
+	}
+}
+
+// end removes the subscription and closes its receipts with the reason it ended, the lock must be held
+func (feed *ReceiptFeed) end(subscription *ReceiptSubscription, err error) {
+	if !feed.subscriptions[subscription] {
+		return
+	}
+	delete(feed.subscriptions, subscription)
+	metrics.StreamSubscribers.Dec()
+	subscription.err = err
+	close(subscription.receipts)
+}
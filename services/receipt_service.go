@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"math"
 	"strconv"
 	"strings"
@@ -8,22 +9,37 @@ import (
 
 	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 /*
 ReceiptService is an interface that contains the methods to interact with the receipt
 AddNewReceipt is a method that adds a new receipt to the database
 GetReceipt is a method that returns the points of the receipt
+GetReceiptDetails is a method that returns the processed receipt
+GetReceiptsDetails is a method that returns the processed receipts of the ids by id, in one read of the store
+ListReceipts is a method that returns the processed receipts in the order they were processed
+every method takes the context of the request, the spans of the service are children of its span
 */
 
 type ReceiptService interface {
-	AddNewReceipt(r *models.Receipt) (string, int64)
-	GetReceipt(id string) (int64, bool)
+	AddNewReceipt(ctx context.Context, r *models.Receipt) (string, int64)
+	GetReceipt(ctx context.Context, id string) (int64, bool)
+	GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool)
+	GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt
+	ListReceipts(ctx context.Context) []models.Receipt
 }
 
 /*
 ReceiptServiceImpl is a struct that contains the DB
 DB is an interface that contains the methods to interact with the database
+Retailers is the retailer registry used to normalize the retailer name, it is optional
+Rules are the configurable rules loaded from the rules file, it is optional
+Rates is the conversion table used by the total based rules, without it only USD totals earn them
+Webhooks are told about every receipt that is scored, it is optional
+Feed is pushed every receipt that is scored as a receipt of TenantID, see GET /receipts/stream, it is optional
 AddNewReceipt is a method that adds a new receipt to the database
 GetReceipt is a method that returns the points of the receipt
 
@@ -31,7 +47,13 @@ The reason for using an Implementation of the interface is to make the code more
 and to make the code more testable
 */
 type ReceiptServiceImpl struct {
-	DB db.DB
+	DB        db.DB
+	Retailers RetailerService
+	Rules     *RuleSet
+	Rates     *ConversionTable
+	Webhooks  WebhookService
+	Feed      *ReceiptFeed
+	TenantID  string
 }
 
 /*
@@ -41,32 +63,186 @@ it calculates the points of the receipt and adds the points to the database
 assumption here is that the receipt is valid
 and the conversions are successful
 because the receipt is validated before calling this function
+
+the submitted retailer name is kept in SubmittedRetailer and, when the retailer registry
+knows the name, Retailer is replaced by the canonical name before the points are calculated
+every item is assigned its category before the category bonuses of the rules are added
+the purchase date and time rules are evaluated in the local time of the store, see localPurchaseTime
+every scoring rule has its own span with the points it awarded, and its points are kept in the breakdown of the receipt
+once the receipt is stored its events are posted to the webhooks, see WebhookService.ReceiptScored,
+and it is pushed to the streams of the receipts, see ReceiptFeed.Publish
 */
-func (receiptService *ReceiptServiceImpl) AddNewReceipt(r *models.Receipt) (string, int64) {
+func (receiptService *ReceiptServiceImpl) AddNewReceipt(ctx context.Context, r *models.Receipt) (string, int64) {
+	ctx, span := tracing.Start(ctx, "ReceiptService.AddNewReceipt")
+	defer span.End()
 	var points int64
+	var breakdown []models.RulePoints
+
+	retailer := receiptService.normalizeRetailer(r)
+	receiptService.Rules.CategorizeItems(r.Items)
+	purchaseDate, purchaseTime := localPurchaseTime(r, retailer)
+
+	for _, rule := range receiptService.scoringRules(r, purchaseDate, purchaseTime) {
+		_, ruleSpan := tracing.Start(ctx, "rule."+rule.name)
+		rulePoints := rule.points()
+		ruleSpan.SetAttributes(attribute.Int64("points", rulePoints))
+		ruleSpan.End()
+		metrics.RulePoints.WithLabelValues(rule.name).Add(float64(rulePoints))
+		points += rulePoints
+		breakdown = append(breakdown, models.RulePoints{Rule: rule.name, Points: rulePoints})
+	}
 
-	points += PointsForRetailerName(r.Retailer)
-	points += PointsForReceiptTotal(r.Total)
-	points += PointsForItems(r.Items)
-	points += PointsForItemDescription(r.Items)
-	points += PointsForReceiptPurchaseDate(r.PurchaseDate)
-	points += PointsForReceiptPurchaseTime(r.PurchaseTime)
-	
-	id := receiptService.DB.AddNewReceipt(points)
+	r.Points = points
+	r.Breakdown = breakdown
+	createdAt := time.Now().UTC()
+	r.CreatedAt = &createdAt
+	id := receiptService.DB.AddNewReceipt(ctx, r)
+	span.SetAttributes(attribute.String("receipt.id", id), attribute.Int64("points", points))
+	metrics.ReceiptsProcessed.Inc()
+	metrics.ReceiptPoints.Observe(float64(points))
+	if receiptService.Webhooks != nil {
+		receiptService.Webhooks.ReceiptScored(ctx, r)
+	}
+	if receiptService.Feed != nil {
+		receiptService.Feed.Publish(receiptService.TenantID, r)
+	}
 	return id, points
 }
 
+// scoringRule is a rule the points of a receipt are the sum of, name is its label in the metrics
+type scoringRule struct {
+	name   string
+	points func() int64
+}
+
+/*
+scoringRules returns the rules that apply to the receipt, in the order they are evaluated
+the item count rule counts the item quantities when the rules say so
+and the category bonuses only apply with a rules file
+*/
+func (receiptService *ReceiptServiceImpl) scoringRules(r *models.Receipt, purchaseDate string, purchaseTime string) []scoringRule {
+	rules := receiptService.Rules
+	countQuantities := rules != nil && rules.CountItemQuantities
+
+	scoringRules := []scoringRule{
+		{"retailerName", func() int64 { return PointsForRetailerName(r.Retailer) }},
+		{"total", func() int64 { return PointsForReceiptTotalInCurrency(r.Total, r.Currency, receiptService.Rates) }},
+		{"itemCount", func() int64 {
+			if countQuantities {
+				return PointsForItemQuantities(r.Items)
+			}
+			return PointsForItems(r.Items)
+		}},
+		{"itemDescription", func() int64 { return PointsForItemDescription(r.Items) }},
+		{"purchaseDate", func() int64 { return PointsForReceiptPurchaseDate(purchaseDate) }},
+		{"purchaseTime", func() int64 { return PointsForReceiptPurchaseTime(purchaseTime) }},
+	}
+	if rules != nil {
+		scoringRules = append(scoringRules, scoringRule{"itemCategories", func() int64 {
+			return PointsForItemCategories(r.Items, rules.CategoryBonuses, countQuantities)
+		}})
+	}
+	return scoringRules
+}
+
 /*
 GetReceipt is a function that returns the points of the receipt
 if the receipt is not found, returns 404
 */
-func (receiptService *ReceiptServiceImpl) GetReceipt(id string) (int64, bool) {
-	if points, ok := receiptService.DB.GetReceipt(id); ok {
+func (receiptService *ReceiptServiceImpl) GetReceipt(ctx context.Context, id string) (int64, bool) {
+	ctx, span := tracing.Start(ctx, "ReceiptService.GetReceipt")
+	defer span.End()
+	if points, ok := receiptService.DB.GetReceipt(ctx, id); ok {
 		return points, true
 	}
 	return int64(0), false
 }
 
+/*
+GetReceiptDetails is a function that returns the processed receipt
+including the submitted and canonical retailer name and the points
+*/
+func (receiptService *ReceiptServiceImpl) GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool) {
+	ctx, span := tracing.Start(ctx, "ReceiptService.GetReceiptDetails")
+	defer span.End()
+	return receiptService.DB.GetReceiptDetails(ctx, id)
+}
+
+/*
+GetReceiptsDetails is a function that returns the processed receipts of the ids by id
+the unknown ids are left out, used to look up many receipts without a read of the store for each
+*/
+func (receiptService *ReceiptServiceImpl) GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt {
+	ctx, span := tracing.Start(ctx, "ReceiptService.GetReceiptsDetails")
+	defer span.End()
+	return receiptService.DB.GetReceiptsDetails(ctx, ids)
+}
+
+// ListReceipts is a function that returns every processed receipt, the oldest first
+func (receiptService *ReceiptServiceImpl) ListReceipts(ctx context.Context) []models.Receipt {
+	ctx, span := tracing.Start(ctx, "ReceiptService.ListReceipts")
+	defer span.End()
+	return receiptService.DB.ListReceipts(ctx)
+}
+
+/*
+normalizeRetailer replaces the retailer name with the canonical one from the retailer registry
+returns the registered retailer, nil when the registry does not know it
+*/
+func (receiptService *ReceiptServiceImpl) normalizeRetailer(r *models.Receipt) *models.Retailer {
+	r.SubmittedRetailer = r.Retailer
+	r.RetailerID = ""
+	if receiptService.Retailers == nil {
+		return nil
+	}
+	retailer, ok := receiptService.Retailers.ResolveRetailer(r.Retailer)
+	if !ok {
+		return nil
+	}
+	r.Retailer = retailer.Name
+	r.RetailerID = retailer.ID
+	return retailer
+}
+
+/*
+localPurchaseTime returns the purchase date and time in the local time of the store
+and stores the instant of the purchase in UTC in PurchasedAt
+
+the purchase date and time were written in the timezone of the receipt, or of the retailer when absent
+the local time of the store is the timezone of the retailer, or of the receipt when the retailer has none
+so a receipt written in UTC by an online POS is scored at the wall clock time of the store
+when neither has a timezone the purchase date and time are used as submitted and PurchasedAt stays empty
+*/
+func localPurchaseTime(r *models.Receipt, retailer *models.Retailer) (string, string) {
+	r.PurchasedAt = nil
+	var storeZone, receiptZone *time.Location
+	if retailer != nil && retailer.Timezone != "" {
+		storeZone, _ = models.ParseTimezone(retailer.Timezone)
+	}
+	if r.Timezone != "" {
+		receiptZone, _ = models.ParseTimezone(r.Timezone)
+	}
+	if receiptZone == nil {
+		receiptZone = storeZone
+	}
+	if storeZone == nil {
+		storeZone = receiptZone
+	}
+	if receiptZone == nil {
+		return r.PurchaseDate, r.PurchaseTime
+	}
+
+	instant, err := models.PurchaseInstant(r.PurchaseDate, r.PurchaseTime, receiptZone)
+	if err != nil {
+		return r.PurchaseDate, r.PurchaseTime
+	}
+	purchasedAt := instant.UTC()
+	r.PurchasedAt = &purchasedAt
+
+	local := instant.In(storeZone)
+	return local.Format("2006-01-02"), local.Format("15:04")
+}
+
 // One point for every alphanumeric character in the retailer name.
 func PointsForRetailerName(retailerName string) int64 {
 	var points int64
@@ -101,6 +277,30 @@ func PointsForItems(items []models.Item) int64 {
 	return int64(len(items)) / 2 * 5
 }
 
+/*
+5 points for every two units on the receipt.
+used instead of PointsForItems when countItemQuantities is set in the rules file
+*/
+func PointsForItemQuantities(items []models.Item) int64 {
+	var units int64
+	for _, item := range items {
+		units += ItemUnits(item)
+	}
+	return units / 2 * 5
+}
+
+/*
+ItemUnits is the number of units an item line counts for
+an item without a quantity and a weighed item with a fractional quantity (e.g. 1.250 kg) count as one unit
+*/
+func ItemUnits(item models.Item) int64 {
+	quantity, err := strconv.ParseFloat(item.Quantity, 64)
+	if err != nil || quantity < 1 || quantity != math.Floor(quantity) {
+		return 1
+	}
+	return int64(quantity)
+}
+
 /*
 If the trimmed length of the item description is a multiple of 3,
 multiply the price by 0.2 and round up to the nearest integer.
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+RetailerService is an interface that contains the methods to manage the retailer registry
+ResolveRetailer is a method that returns the registered retailer a submitted retailer name belongs to
+*/
+type RetailerService interface {
+	AddRetailer(retailer *models.Retailer) (string, error)
+	GetRetailer(id string) (*models.Retailer, bool)
+	GetAllRetailers() []models.Retailer
+	UpdateRetailer(retailer *models.Retailer) error
+	DeleteRetailer(id string) bool
+	ResolveRetailer(name string) (*models.Retailer, bool)
+}
+
+/*
+RetailerServiceImpl is a struct that contains the RetailerDB
+the registry maps the canonical name and the aliases of a retailer to the retailer
+so receipts typed differently by different POS systems are treated as the same retailer
+*/
+type RetailerServiceImpl struct {
+	DB db.RetailerDB
+}
+
+/*
+AddRetailer is a function that adds a new retailer to the registry and returns its id
+returns db.ErrConflict if the name or one of the aliases already belongs to another retailer
+*/
+func (retailerService *RetailerServiceImpl) AddRetailer(retailer *models.Retailer) (string, error) {
+	return retailerService.DB.AddRetailer(retailer)
+}
+
+func (retailerService *RetailerServiceImpl) GetRetailer(id string) (*models.Retailer, bool) {
+	return retailerService.DB.GetRetailer(id)
+}
+
+// GetAllRetailers is a function that returns every retailer in the registry sorted by name
+func (retailerService *RetailerServiceImpl) GetAllRetailers() []models.Retailer {
+	retailers := retailerService.DB.GetAllRetailers()
+	sort.Slice(retailers, func(i, j int) bool {
+		return retailers[i].Name < retailers[j].Name
+	})
+	return retailers
+}
+
+/*
+UpdateRetailer is a function that replaces the name and aliases of the retailer with the same id
+returns db.ErrNotFound if there is no such retailer and db.ErrConflict as for AddRetailer
+
+receipts processed before the update keep the retailer they were resolved to
+*/
+func (retailerService *RetailerServiceImpl) UpdateRetailer(retailer *models.Retailer) error {
+	return retailerService.DB.UpdateRetailer(retailer)
+}
+
+func (retailerService *RetailerServiceImpl) DeleteRetailer(id string) bool {
+	return retailerService.DB.DeleteRetailer(id)
+}
+
+/*
+ResolveRetailer is a function that looks up the retailer a submitted name belongs to
+the name is normalized with models.NormalizeRetailerName before the lookup
+*/
+func (retailerService *RetailerServiceImpl) ResolveRetailer(name string) (*models.Retailer, bool) {
+	key := models.NormalizeRetailerName(name)
+	if key == "" {
+		return nil, false
+	}
+	return retailerService.DB.FindRetailer(key)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+RuleSet is a struct that contains the configurable scoring rules
+it is loaded from a JSON rules file, see rules.json in the root of the repository
+
+Version identifies the rules file that was loaded
+Categories is the item classifier, the first category matching the item description is assigned to the item
+CategoryBonuses are the points awarded per item of a category
+CountItemQuantities makes the item count rules count the quantity of every item instead of the item lines
+
+the fixed rules (retailer name, total, items, item description, purchase date and time)
+always apply, a nil or empty RuleSet adds nothing to them
+*/
+type RuleSet struct {
+	Version         string          `json:"version"`
+	Categories      []CategoryRule  `json:"categories"`
+	CategoryBonuses []CategoryBonus `json:"categoryBonuses"`
+
+	CountItemQuantities bool `json:"countItemQuantities"`
+}
+
+/*
+CategoryRule is a struct that describes when an item belongs to a category
+Keywords match whole words of the item description ignoring case
+Patterns are regular expressions matched against the trimmed item description
+*/
+type CategoryRule struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords"`
+	Patterns []string `json:"patterns"`
+
+	matchers []*regexp.Regexp
+}
+
+// CategoryBonus is a struct that awards PointsPerItem points for every item of Category
+type CategoryBonus struct {
+	Category      string `json:"category"`
+	PointsPerItem int64  `json:"pointsPerItem"`
+}
+
+/*
+LoadRuleSet is a function that reads the rules file at path and compiles it
+returns an error if the file cannot be read or the rules are invalid
+*/
+func LoadRuleSet(path string) (*RuleSet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rules file: %w", err)
+	}
+
+	var rules RuleSet
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("parsing rules file %s: %w", path, err)
+	}
+	if err := rules.Compile(); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+/*
+Compile is a function that checks the rules and compiles the keywords and patterns of the categories
+it has to be called before Categorize when the RuleSet is not created with LoadRuleSet
+*/
+func (rules *RuleSet) Compile() error {
+	categories := make(map[string]bool)
+	for i := range rules.Categories {
+		category := &rules.Categories[i]
+		if category.Name == "" {
+			return fmt.Errorf("category %d has no name", i)
+		}
+		categories[category.Name] = true
+
+		category.matchers = nil
+		for _, keyword := range category.Keywords {
+			keyword = strings.TrimSpace(keyword)
+			if keyword == "" {
+				return fmt.Errorf("category %s has an empty keyword", category.Name)
+			}
+			keywordRegexp := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(keyword) + `\b`)
+			category.matchers = append(category.matchers, keywordRegexp)
+		}
+		for _, pattern := range category.Patterns {
+			patternRegexp, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("category %s: %w", category.Name, err)
+			}
+			category.matchers = append(category.matchers, patternRegexp)
+		}
+	}
+
+	for _, bonus := range rules.CategoryBonuses {
+		if !categories[bonus.Category] {
+			return fmt.Errorf("category bonus for unknown category %q", bonus.Category)
+		}
+	}
+	return nil
+}
+
+/*
+Categorize is a function that returns the category of an item description
+the categories are tried in the order of the rules file and the first match wins
+returns an empty string when no category matches
+*/
+func (rules *RuleSet) Categorize(description string) string {
+	if rules == nil {
+		return ""
+	}
+	description = strings.TrimSpace(description)
+	for _, category := range rules.Categories {
+		for _, matcher := range category.matchers {
+			if matcher.MatchString(description) {
+				return category.Name
+			}
+		}
+	}
+	return ""
+}
+
+// CategorizeItems is a function that assigns the category of every item from its short description
+func (rules *RuleSet) CategorizeItems(items []models.Item) {
+	for i := range items {
+		items[i].Category = rules.Categorize(items[i].ShortDescription)
+	}
+}
+
+/*
+PointsForItemCategories awards the bonus of the item category for every item on the receipt.
+with countQuantities every unit of the item is awarded the bonus, see ItemUnits
+*/
+func PointsForItemCategories(items []models.Item, bonuses []CategoryBonus, countQuantities bool) int64 {
+	var points int64
+	for _, item := range items {
+		units := int64(1)
+		if countQuantities {
+			units = ItemUnits(item)
+		}
+		for _, bonus := range bonuses {
+			if item.Category != "" && item.Category == bonus.Category {
+				points += bonus.PointsPerItem * units
+			}
+		}
+	}
+	return points
+}
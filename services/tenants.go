@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+/*
+TenantServices is a struct that contains the services of one tenant
+every tenant has its own store, so its own receipts, retailer registry and webhooks, and its own rules
+*/
+type TenantServices struct {
+	Receipts  ReceiptService
+	Retailers RetailerService
+	Jobs      JobService
+	Webhooks  WebhookService
+}
+
+/*
+TenantRegistry is an interface that returns the services of a tenant
+For is a method that returns the services of the tenant, creating them on first use
+Known is a method that reports whether the tenant has services or is configured, the reads of the other tenants have nothing to find
+*/
+type TenantRegistry interface {
+	For(tenantID string) *TenantServices
+	Known(tenantID string) bool
+}
+
+/*
+Tenants is a struct that implements the TenantRegistry
+
+Rules and Rates are used by every tenant, TenantRules replaces Rules for the tenants it contains
+NewStore creates the store of a tenant, an InMemoryDB when it is nil
+Jobs is the queue the asynchronous jobs of every tenant run in, the tenants have no JobService when it is nil
+Webhooks is the dispatcher posting the events of every tenant to its webhooks, the tenants have no WebhookService when it is nil
+Feed is pushed the receipts scored by every tenant, see ReceiptFeed, it is optional
+
+the map of tenants is behind a read write lock that is only held to look up the services,
+the stores have their own locks so requests of different tenants never wait on each other
+a tenant is created by the first request writing to it, the reads only find the known tenants, see Known and middleware.KnownTenant,
+so reading any tenant id does not grow the map
+*/
+type Tenants struct {
+	Rules       *RuleSet
+	TenantRules map[string]*RuleSet
+	Rates       *ConversionTable
+	NewStore    func(tenantID string) db.TenantStore
+	Jobs        *JobQueue
+	Webhooks    *WebhookDispatcher
+	Feed        *ReceiptFeed
+
+	lock    sync.RWMutex
+	tenants map[string]*TenantServices
+	stores  map[string]db.TenantStore
+}
+
+func (tenants *Tenants) For(tenantID string) *TenantServices {
+	tenants.lock.RLock()
+	services, ok := tenants.tenants[tenantID]
+	tenants.lock.RUnlock()
+	if ok {
+		return services
+	}
+
+	tenants.lock.Lock()
+	defer tenants.lock.Unlock()
+	if services, ok := tenants.tenants[tenantID]; ok {
+		return services
+	}
+	if tenants.tenants == nil {
+		tenants.tenants = make(map[string]*TenantServices)
+		tenants.stores = make(map[string]db.TenantStore)
+	}
+
+	var store db.TenantStore
+	if tenants.NewStore != nil {
+		store = tenants.NewStore(tenantID)
+	} else {
+		store = db.NewInMemoryDB()
+	}
+	rules := tenants.Rules
+	if tenantRules, ok := tenants.TenantRules[tenantID]; ok {
+		rules = tenantRules
+	}
+
+	retailerService := &RetailerServiceImpl{DB: store}
+	receiptService := &ReceiptServiceImpl{DB: store, Retailers: retailerService, Rules: rules, Rates: tenants.Rates, Feed: tenants.Feed, TenantID: tenantID}
+	services = &TenantServices{
+		Receipts:  receiptService,
+		Retailers: retailerService,
+	}
+	if tenants.Jobs != nil {
+		services.Jobs = &JobServiceImpl{DB: store, Queue: tenants.Jobs}
+	}
+	if tenants.Webhooks != nil {
+		webhookService := &WebhookServiceImpl{DB: store, Receipts: store, Dispatcher: tenants.Webhooks}
+		services.Webhooks = webhookService
+		receiptService.Webhooks = webhookService
+	}
+	tenants.tenants[tenantID] = services
+	tenants.stores[tenantID] = store
+	return services
+}
+
+/*
+Known is a function that reports whether the tenant was created so far,
+or is configured, models.DefaultTenant and the tenants with their own rules
+*/
+func (tenants *Tenants) Known(tenantID string) bool {
+	if tenantID == models.DefaultTenant {
+		return true
+	}
+	if _, ok := tenants.TenantRules[tenantID]; ok {
+		return true
+	}
+	tenants.lock.RLock()
+	defer tenants.lock.RUnlock()
+	_, ok := tenants.tenants[tenantID]
+	return ok
+}
+
+/*
+RulesVersions is a function that sets the versions of the rules of the tenants in the build info
+a tenant without its own rules uses the rules file, "none" when there is no rules file
+*/
+func (tenants *Tenants) RulesVersions(build *BuildInfo) {
+	build.RulesVersion = rulesVersion(tenants.Rules)
+	if len(tenants.TenantRules) == 0 {
+		return
+	}
+	build.TenantRulesVersions = make(map[string]string, len(tenants.TenantRules))
+	for tenantID, rules := range tenants.TenantRules {
+		build.TenantRulesVersions[tenantID] = rulesVersion(rules)
+	}
+}
+
+// rulesVersion returns the version of the rules, "none" without rules and "unversioned" for rules without a version
+func rulesVersion(rules *RuleSet) string {
+	switch {
+	case rules == nil:
+		return "none"
+	case rules.Version == "":
+		return "unversioned"
+	}
+	return rules.Version
+}
+
+/*
+Ping is a function that checks the stores of the tenants created so far
+returns the error of the first store that is unreachable
+*/
+func (tenants *Tenants) Ping(ctx context.Context) error {
+	tenants.lock.RLock()
+	defer tenants.lock.RUnlock()
+	for tenantID, store := range tenants.stores {
+		if err := pingStore(ctx, store); err != nil {
+			return fmt.Errorf("store of tenant %s: %w", tenantID, err)
+		}
+	}
+	return nil
+}
+
+/*
+Close is a function that closes the stores of the tenants created so far, see db.Closer
+every store is closed, returns the errors of the stores that failed to close
+*/
+func (tenants *Tenants) Close(ctx context.Context) error {
+	tenants.lock.Lock()
+	defer tenants.lock.Unlock()
+	var errs []error
+	for tenantID, store := range tenants.stores {
+		if closer, ok := store.(db.Closer); ok {
+			if err := closer.Close(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("closing the store of tenant %s: %w", tenantID, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pingStore pings the store if it can be pinged, see db.Pinger
+func pingStore(ctx context.Context, store db.TenantStore) error {
+	if pinger, ok := store.(db.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+/*
+LoadTenantRules is a function that loads the rules file of every tenant from a directory
+the rules of a tenant are in <tenant id>.json, e.g. brand-a.json for the tenant brand-a
+returns an error if a file is invalid or its name is not a valid tenant id
+*/
+func LoadTenantRules(dir string) (map[string]*RuleSet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("reading tenant rules: %w", err)
+	}
+
+	tenantRules := make(map[string]*RuleSet)
+	for _, path := range paths {
+		tenantID := strings.TrimSuffix(filepath.Base(path), ".json")
+		if !models.ValidTenantID(tenantID) {
+			return nil, fmt.Errorf("tenant rules %s: %q is not a valid tenant id", path, tenantID)
+		}
+		rules, err := LoadRuleSet(path)
+		if err != nil {
+			return nil, err
+		}
+		tenantRules[tenantID] = rules
+	}
+	return tenantRules, nil
+}
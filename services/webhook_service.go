@@ -0,0 +1,482 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/webhooks"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ErrNotDead is returned by Redeliver when the delivery is not a dead letter
+var ErrNotDead = errors.New("the delivery is not a dead letter")
+
+/*
+WebhookService is an interface that contains the methods to manage the webhooks of a tenant and to post its events to them
+AddWebhook is a method that adds a webhook, generating its secret when it has none
+GetWebhook, ListWebhooks and DeleteWebhook are methods that return and remove the webhooks
+ListDeliveries is a method that returns the delivery history of a webhook
+DeadLetters is a method that returns the deliveries whose every attempt failed
+Redeliver is a method that attempts a dead letter again, returns db.ErrNotFound or ErrNotDead when it cannot
+ReceiptScored is a method that posts the events of a receipt that was just scored to the webhooks subscribed to them
+*/
+type WebhookService interface {
+	AddWebhook(ctx context.Context, webhook *models.Webhook) (string, error)
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, bool)
+	ListWebhooks(ctx context.Context) []models.Webhook
+	DeleteWebhook(ctx context.Context, id string) bool
+	ListDeliveries(ctx context.Context, webhookID string) []models.WebhookDelivery
+	DeadLetters(ctx context.Context) []models.WebhookDelivery
+	Redeliver(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	ReceiptScored(ctx context.Context, receipt *models.Receipt)
+}
+
+/*
+WebhookServiceImpl is a struct that contains the DB the webhooks of a tenant are kept in and the dispatcher posting their events
+Receipts are the receipts of the tenant, the points of a member are the running total the store keeps, see db.DB.MemberPoints
+*/
+type WebhookServiceImpl struct {
+	DB         db.WebhookDB
+	Receipts   db.DB
+	Dispatcher *WebhookDispatcher
+}
+
+// AddWebhook is a function that adds the webhook, the secret is 32 random bytes when it has none
+func (webhookService *WebhookServiceImpl) AddWebhook(ctx context.Context, webhook *models.Webhook) (string, error) {
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+		webhook.Secret = "whsec_" + base64.RawURLEncoding.EncodeToString(secret)
+	}
+	webhook.CreatedAt = time.Now().UTC()
+	return webhookService.DB.AddWebhook(ctx, webhook), nil
+}
+
+func (webhookService *WebhookServiceImpl) GetWebhook(ctx context.Context, id string) (*models.Webhook, bool) {
+	return webhookService.DB.GetWebhook(ctx, id)
+}
+
+func (webhookService *WebhookServiceImpl) ListWebhooks(ctx context.Context) []models.Webhook {
+	return webhookService.DB.ListWebhooks(ctx)
+}
+
+// DeleteWebhook is a function that removes the webhook and its deliveries, the pending retries of its deliveries are dropped
+func (webhookService *WebhookServiceImpl) DeleteWebhook(ctx context.Context, id string) bool {
+	return webhookService.DB.DeleteWebhook(ctx, id)
+}
+
+func (webhookService *WebhookServiceImpl) ListDeliveries(ctx context.Context, webhookID string) []models.WebhookDelivery {
+	return webhookService.DB.ListDeliveries(ctx, webhookID)
+}
+
+func (webhookService *WebhookServiceImpl) DeadLetters(ctx context.Context) []models.WebhookDelivery {
+	dead := []models.WebhookDelivery{}
+	for _, delivery := range webhookService.DB.ListDeliveries(ctx, "") {
+		if delivery.Status == models.DeliveryDead {
+			dead = append(dead, delivery)
+		}
+	}
+	return dead
+}
+
+/*
+Redeliver is a function that makes the dead letter pending again and attempts it right away,
+it gets as many attempts as a new delivery, the attempts it already had are kept in its history
+*/
+func (webhookService *WebhookServiceImpl) Redeliver(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	delivery, ok := webhookService.DB.GetDelivery(ctx, id)
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	if delivery.Status != models.DeliveryDead {
+		return nil, ErrNotDead
+	}
+	delivery.Status = models.DeliveryPending
+	if err := webhookService.DB.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	webhookService.Dispatcher.Deliver(ctx, webhookService.DB, delivery)
+	return delivery, nil
+}
+
+/*
+ReceiptScored is a function that posts a receipt.scored event for the receipt, and a points.changed event when it has a member,
+to every webhook subscribed to them, the webhooks of a member only get the events of its own receipts
+the deliveries are stored as pending and attempted by the dispatcher, so the receipt is not held up by the webhooks
+*/
+func (webhookService *WebhookServiceImpl) ReceiptScored(ctx context.Context, receipt *models.Receipt) {
+	registered := webhookService.DB.ListWebhooks(ctx)
+	if len(registered) == 0 {
+		return
+	}
+	logger := logging.FromContext(ctx)
+
+	events := []models.WebhookEvent{newEvent(models.EventReceiptScored, receipt.MemberID, models.ReceiptScored{
+		ReceiptID: receipt.ID,
+		Retailer:  receipt.Retailer,
+		Total:     receipt.Total,
+		Currency:  receipt.Currency,
+		Points:    receipt.Points,
+		MemberID:  receipt.MemberID,
+	})}
+	if receipt.MemberID != "" && anySubscribes(registered, models.EventPointsChanged) {
+		events = append(events, newEvent(models.EventPointsChanged, receipt.MemberID, models.PointsChanged{
+			MemberID:    receipt.MemberID,
+			ReceiptID:   receipt.ID,
+			Points:      receipt.Points,
+			TotalPoints: webhookService.Receipts.MemberPoints(ctx, receipt.MemberID),
+		}))
+	}
+
+	for _, event := range events {
+		for _, webhook := range registered {
+			if !webhook.Subscribes(event.Type) || (webhook.MemberID != "" && webhook.MemberID != event.MemberID) {
+				continue
+			}
+			delivery := &models.WebhookDelivery{
+				WebhookID: webhook.ID,
+				Event:     event,
+				Status:    models.DeliveryPending,
+				Attempts:  []models.WebhookAttempt{},
+				CreatedAt: event.CreatedAt,
+			}
+			webhookService.DB.AddDelivery(ctx, delivery)
+			logger.Debug("webhook event", slog.String("event", event.Type), slog.String("webhookId", webhook.ID), slog.String("deliveryId", delivery.ID))
+			webhookService.Dispatcher.Deliver(ctx, webhookService.DB, delivery)
+		}
+	}
+}
+
+// newEvent returns an event of the type with the data, the data are always JSON
+func newEvent(eventType string, memberID string, data any) models.WebhookEvent {
+	encoded, _ := json.Marshal(data)
+	return models.WebhookEvent{ID: uuid.New().String(), Type: eventType, CreatedAt: time.Now().UTC(), Data: encoded, MemberID: memberID}
+}
+
+func anySubscribes(registered []models.Webhook, eventType string) bool {
+	for _, webhook := range registered {
+		if webhook.Subscribes(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// the defaults of a WebhookDispatcher
+const (
+	DefaultWebhookMaxAttempts = 8
+	DefaultWebhookBackoff     = 5 * time.Second
+	DefaultWebhookMaxBackoff  = time.Hour
+	DefaultWebhookTimeout     = 10 * time.Second
+)
+
+// ErrWebhookQueueFull is the error of the attempt that makes a delivery dead when the queue of the dispatcher is full
+var ErrWebhookQueueFull = errors.New("the queue of the webhook attempts is full")
+
+/*
+WebhookDispatcher is a struct that posts the events to the webhooks with a bounded pool of workers
+Client posts the events, see NewWebhookClient for the one of NewWebhookDispatcher
+every delivery is signed with the secret of its webhook, see webhooks.Sign, and a 2xx response delivers it,
+a failed attempt is retried after Backoff, doubled after every attempt up to MaxBackoff,
+until MaxAttempts attempts failed and the delivery is dead, a dead letter that is only attempted again when it is redelivered
+the retries are kept in memory, the pending retries are dropped when the dispatcher is closed
+the attempts due wait for a worker in a queue of bounded size, an attempt due when the queue is full is not made
+and its delivery is a dead letter right away, with ErrWebhookQueueFull as its last attempt, so a slow or unreachable webhook
+cannot pile up the attempts of every delivery behind it
+*/
+type WebhookDispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+
+	lock    sync.Mutex
+	closed  bool
+	queue   chan webhookAttempt
+	done    chan struct{}
+	workers sync.WaitGroup
+}
+
+// webhookAttempt is an attempt of a delivery waiting for a worker, with the store it is kept in and its number
+type webhookAttempt struct {
+	ctx      context.Context
+	store    db.WebhookDB
+	delivery string
+	number   int
+}
+
+/*
+NewWebhookDispatcher returns a dispatcher with workers workers posting the events and room for size attempts waiting for them,
+with the default attempts and backoff
+*/
+func NewWebhookDispatcher(workers int, size int) *WebhookDispatcher {
+	dispatcher := &WebhookDispatcher{
+		Client:      NewWebhookClient(DefaultWebhookTimeout, false),
+		MaxAttempts: DefaultWebhookMaxAttempts,
+		Backoff:     DefaultWebhookBackoff,
+		MaxBackoff:  DefaultWebhookMaxBackoff,
+		queue:       make(chan webhookAttempt, size),
+		done:        make(chan struct{}),
+	}
+	dispatcher.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go dispatcher.work()
+	}
+	return dispatcher
+}
+
+// ErrPrivateAddress fails the attempts to post an event to an address that is not public, see NewWebhookClient
+var ErrPrivateAddress = errors.New("the address of the webhook is not public")
+
+/*
+NewWebhookClient returns the client posting the events, an attempt has timeout to get its response
+the webhooks are URLs of the partners, so the client must not reach the network of the server through them:
+it does not follow redirects, the redirect is the response and fails the attempt, and it goes through no proxy
+unless allowPrivate, it refuses to connect to loopback, private, link-local, multicast and unspecified addresses with ErrPrivateAddress,
+the address is checked as it is dialed, after the name of the webhook is resolved, so a name resolving to one is refused too
+allowPrivate is for local development, with the webhooks on the same machine
+*/
+func NewWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refusePrivateAddress is the Control of the dialer of NewWebhookClient, it fails the connections to the addresses that are not public
+func refusePrivateAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// Deliver is a function that attempts the pending delivery as soon as a worker is free, it never blocks
+func (dispatcher *WebhookDispatcher) Deliver(ctx context.Context, store db.WebhookDB, delivery *models.WebhookDelivery) {
+	dispatcher.schedule(webhookAttempt{ctx: context.WithoutCancel(ctx), store: store, delivery: delivery.ID, number: 1}, 0)
+}
+
+// schedule queues the attempt for a worker after the delay, unless the dispatcher is closed first
+func (dispatcher *WebhookDispatcher) schedule(attempt webhookAttempt, delay time.Duration) {
+	dispatcher.lock.Lock()
+	defer dispatcher.lock.Unlock()
+	if dispatcher.closed {
+		return
+	}
+	time.AfterFunc(delay, func() { dispatcher.enqueue(attempt) })
+}
+
+// enqueue queues the attempt without waiting for room, the delivery is a dead letter when the queue is full
+func (dispatcher *WebhookDispatcher) enqueue(attempt webhookAttempt) {
+	select {
+	case <-dispatcher.done:
+		return
+	default:
+	}
+	select {
+	case dispatcher.queue <- attempt:
+	default:
+		dispatcher.deadLetter(attempt)
+	}
+}
+
+/*
+deadLetter makes the delivery of the attempt a dead letter without attempting it, when there is no room in the queue
+the attempt is stored with ErrWebhookQueueFull, so the delivery history tells why, and it can be redelivered like the others
+*/
+func (dispatcher *WebhookDispatcher) deadLetter(attempt webhookAttempt) {
+	delivery, ok := attempt.store.GetDelivery(attempt.ctx, attempt.delivery)
+	if !ok {
+		return
+	}
+	delivery.Attempts = append(delivery.Attempts, models.WebhookAttempt{At: time.Now().UTC(), Error: ErrWebhookQueueFull.Error()})
+	delivery.Status = models.DeliveryDead
+	delivery.NextAttemptAt = nil
+	logger := logging.FromContext(attempt.ctx)
+	if err := attempt.store.UpdateDelivery(attempt.ctx, delivery); err != nil {
+		logger.Error("webhook delivery not updated", slog.String("deliveryId", delivery.ID), slog.String("error", err.Error()))
+	}
+	metrics.WebhookAttempts.WithLabelValues(delivery.Event.Type, "dead").Inc()
+	logger.Warn("webhook delivery dead",
+		slog.String("webhookId", delivery.WebhookID),
+		slog.String("deliveryId", delivery.ID),
+		slog.String("event", delivery.Event.Type),
+		slog.Int("attempt", len(delivery.Attempts)),
+		slog.String("result", "dead"),
+		slog.String("error", ErrWebhookQueueFull.Error()),
+	)
+}
+
+// backoff returns the time to wait after the failed attempt of the number before the next one
+func (dispatcher *WebhookDispatcher) backoff(number int) time.Duration {
+	delay := dispatcher.Backoff
+	for i := 1; i < number && delay < dispatcher.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, dispatcher.MaxBackoff)
+}
+
+/*
+Close is a function that stops the retries and waits for the attempts in progress
+returns the error of ctx if it is done first, it is one of the httpserver.Shutdown Close functions
+*/
+func (dispatcher *WebhookDispatcher) Close(ctx context.Context) error {
+	dispatcher.lock.Lock()
+	if !dispatcher.closed {
+		dispatcher.closed = true
+		close(dispatcher.done)
+	}
+	dispatcher.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		dispatcher.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (dispatcher *WebhookDispatcher) work() {
+	defer dispatcher.workers.Done()
+	for {
+		select {
+		case attempt := <-dispatcher.queue:
+			dispatcher.attempt(attempt)
+		case <-dispatcher.done:
+			return
+		}
+	}
+}
+
+/*
+attempt posts the delivery to its webhook and stores the attempt
+the delivery is dropped when it or its webhook was removed in the meantime
+*/
+func (dispatcher *WebhookDispatcher) attempt(attempt webhookAttempt) {
+	delivery, ok := attempt.store.GetDelivery(attempt.ctx, attempt.delivery)
+	if !ok {
+		return
+	}
+	webhook, ok := attempt.store.GetWebhook(attempt.ctx, delivery.WebhookID)
+	if !ok {
+		return
+	}
+	ctx, span := tracing.Start(attempt.ctx, "webhook."+delivery.Event.Type)
+	defer span.End()
+	span.SetAttributes(attribute.String("webhook.id", webhook.ID), attribute.String("delivery.id", delivery.ID), attribute.Int("attempt", attempt.number))
+
+	result := dispatcher.post(ctx, webhook, delivery)
+	delivery.Attempts = append(delivery.Attempts, result)
+	delivery.NextAttemptAt = nil
+	outcome := "delivered"
+	switch {
+	case result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300:
+		delivery.Status = models.DeliveryDelivered
+	case attempt.number >= dispatcher.MaxAttempts:
+		delivery.Status, outcome = models.DeliveryDead, "dead"
+	default:
+		outcome = "retried"
+		delay := dispatcher.backoff(attempt.number)
+		next := result.At.Add(delay)
+		delivery.NextAttemptAt = &next
+		attempt.number++
+		dispatcher.schedule(attempt, delay)
+	}
+	if err := attempt.store.UpdateDelivery(ctx, delivery); err != nil {
+		span.RecordError(err)
+	}
+	if outcome != "delivered" {
+		span.SetStatus(codes.Error, "webhook attempt failed")
+	}
+
+	metrics.WebhookAttempts.WithLabelValues(delivery.Event.Type, outcome).Inc()
+	logger := logging.FromContext(ctx)
+	attrs := []any{
+		slog.String("webhookId", webhook.ID),
+		slog.String("deliveryId", delivery.ID),
+		slog.String("event", delivery.Event.Type),
+		slog.Int("attempt", len(delivery.Attempts)),
+		slog.Int("statusCode", result.StatusCode),
+		slog.String("result", outcome),
+	}
+	if result.Error != "" {
+		attrs = append(attrs, slog.String("error", result.Error))
+	}
+	if outcome == "dead" {
+		logger.Warn("webhook delivery dead", attrs...)
+	} else {
+		logger.Info("webhook attempt", attrs...)
+	}
+}
+
+// post posts the event of the delivery to the webhook, signed with its secret, and returns the attempt
+func (dispatcher *WebhookDispatcher) post(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) models.WebhookAttempt {
+	result := models.WebhookAttempt{At: time.Now().UTC()}
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "receipt-processor-webhooks")
+	request.Header.Set(webhooks.EventHeader, delivery.Event.Type)
+	request.Header.Set(webhooks.DeliveryHeader, delivery.ID)
+	request.Header.Set(webhooks.SignatureHeader, webhooks.Sign(webhook.Secret, result.At, body))
+
+	response, err := dispatcher.Client.Do(request)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer response.Body.Close()
+	// the body is read so the connection can be reused, it is not kept
+	io.Copy(io.Discard, io.LimitReader(response.Body, webhooks.MaxEventBytes))
+	result.StatusCode = response.StatusCode
+	return result
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "test-admin-token"
+
+const targetReceipt = `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-01",
+	"purchaseTime": "13:01",
+	"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+	"total": "6.49"
+}`
+
+func newAuthRouter() (*gin.Engine, *services.ReceiptServiceImpl) {
+	database := db.NewInMemoryDB()
+	apiKeyService := services.APIKeyServiceImpl{DB: database}
+	receiptService := services.ReceiptServiceImpl{DB: database}
+	receiptController := controllers.ReceiptController{ReceiptService: &receiptService}
+	apiKeyController := controllers.APIKeyController{APIKeyService: &apiKeyService}
+
+	authenticator := middleware.Authenticator{APIKeys: &apiKeyService, AdminToken: testAdminToken}
+
+	router := gin.New()
+	router.Use(middleware.RequestLogger(slog.Default()))
+	receiptApiRoutes := router.Group("/receipts", authenticator.Authenticate())
+	receiptApiRoutes.POST("/process", middleware.RequireScope(auth.ScopeReceiptsWrite), receiptController.ProcessReceipt)
+	receiptApiRoutes.GET("/:id/points", middleware.RequireScope(auth.ScopeReceiptsRead), receiptController.GetReceiptPoints)
+
+	adminApiRoutes := router.Group("/admin", authenticator.Authenticate(), middleware.RequireScope(auth.ScopeAdmin))
+	adminApiRoutes.GET("/api-keys", apiKeyController.GetAllAPIKeys)
+	adminApiRoutes.POST("/api-keys", apiKeyController.CreateAPIKey)
+	adminApiRoutes.DELETE("/api-keys/:id", apiKeyController.RevokeAPIKey)
+	return router, &receiptService
+}
+
+func sendWithHeader(router *gin.Engine, method string, url string, body string, header string, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	rr := httptest.NewRecorder()
+	serve(router, rr, req)
+	return rr
+}
+
+/*
+Testing the lifecycle of an API key
+a key created through the admin endpoints is accepted and the receipt is attributed to it
+once it is revoked it is rejected with 401
+*/
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	router, receiptService := newAuthRouter()
+
+	rr := sendWithHeader(router, "POST", "/admin/api-keys", `{"name": "Partner POS"}`, middleware.AdminTokenHeader, testAdminToken)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.NotEmpty(t, created["key"])
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", targetReceipt, middleware.APIKeyHeader, created["key"])
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var processed map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &processed))
+
+	receipt, ok := receiptService.GetReceiptDetails(context.Background(), processed["id"])
+	assert.True(t, ok)
+	assert.Equal(t, created["id"], receipt.APIKeyID)
+
+	rr = sendWithHeader(router, "GET", "/admin/api-keys", "", middleware.AdminTokenHeader, testAdminToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), created["key"])
+
+	rr = sendWithHeader(router, "DELETE", "/admin/api-keys/"+created["id"], "", middleware.AdminTokenHeader, testAdminToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = sendWithHeader(router, "GET", "/receipts/"+processed["id"]+"/points", "", middleware.APIKeyHeader, created["key"])
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = sendWithHeader(router, "DELETE", "/admin/api-keys/missing", "", middleware.AdminTokenHeader, testAdminToken)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+/*
+Testing for 401 when the API key or the admin token is missing or wrong
+*/
+
+func TestUnauthorizedRequests(t *testing.T) {
+	router, _ := newAuthRouter()
+
+	rr := sendWithHeader(router, "POST", "/receipts/process", targetReceipt, "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "Valid credentials are required", response["description"])
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", targetReceipt, middleware.APIKeyHeader, "rpk_unknown")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = sendWithHeader(router, "POST", "/admin/api-keys", `{"name": "Partner POS"}`, middleware.AdminTokenHeader, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", targetReceipt, middleware.AdminTokenHeader, testAdminToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	noTokenAuthenticator := middleware.Authenticator{}
+	noTokenRouter := gin.New()
+	noTokenRouter.GET("/admin/api-keys", noTokenAuthenticator.Authenticate(), func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"apiKeys": []models.APIKey{}}) })
+	rr = sendWithHeader(noTokenRouter, "GET", "/admin/api-keys", "", middleware.AdminTokenHeader, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+/*
+Testing that only the hash of an API key is stored
+*/
+
+func TestAPIKeyStoredHashed(t *testing.T) {
+	database := db.NewInMemoryDB()
+	apiKeyService := services.APIKeyServiceImpl{DB: database}
+
+	apiKey, key, err := apiKeyService.CreateAPIKey("Partner POS", models.DefaultTenant, 0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, apiKey.Hash)
+	assert.Equal(t, services.HashAPIKey(key), database.APIKeys[apiKey.ID].Hash)
+
+	authenticated, ok := apiKeyService.Authenticate(key)
+	assert.True(t, ok)
+	assert.Equal(t, apiKey.ID, authenticated.ID)
+}
@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns a lookupEnv of the variables
+func env(variables map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	}
+}
+
+/*
+Testing the precedence of the configuration
+the config file overrides the defaults, the environment variables override the config file
+and the flags override the environment variables
+*/
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeTestFile(t, "config.json", []byte(`{
+		"server": {"addr": ":9000", "writeTimeout": "1m", "trustedProxies": ["10.0.0.1"]},
+		"log": {"level": "warn"},
+		"limits": {"dailyQuota": 100}
+	}`))
+
+	cfg, options, err := config.Load("test", []string{"-config", path, "-log-level", "debug"}, env(map[string]string{
+		"RECEIPT_PROCESSOR_ADDR":            ":9100",
+		"RECEIPT_PROCESSOR_LOG_LEVEL":       "error",
+		"RECEIPT_PROCESSOR_AUTH":            "false",
+		"RECEIPT_PROCESSOR_TRUSTED_PROXIES": "10.0.0.0/8, 192.168.0.1",
+		"ADMIN_TOKEN":                       "secret",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, path, options.ConfigFile)
+	assert.False(t, options.PrintConfig)
+
+	assert.Equal(t, ":9100", cfg.Server.Addr)
+	assert.Equal(t, config.Duration(time.Minute), cfg.Server.WriteTimeout)
+	assert.Equal(t, config.Duration(5*time.Second), cfg.Server.ReadHeaderTimeout)
+	assert.Equal(t, config.List{"10.0.0.0/8", "192.168.0.1"}, cfg.Server.TrustedProxies)
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.True(t, cfg.Log.Redact)
+	assert.Equal(t, 100, cfg.Limits.DailyQuota)
+	assert.False(t, cfg.Auth.Required)
+	assert.Equal(t, "secret", cfg.Auth.AdminToken)
+	assert.NoError(t, cfg.Validate())
+}
+
+/*
+Testing the config file from the environment and the errors of loading
+*/
+
+func TestConfigLoadErrors(t *testing.T) {
+	path := writeTestFile(t, "config.json", []byte(`{"store": {"backend": "memory"}}`))
+	cfg, options, err := config.Load("test", []string{"-print-config"}, env(map[string]string{"RECEIPT_PROCESSOR_CONFIG": path}))
+	assert.NoError(t, err)
+	assert.Equal(t, path, options.ConfigFile)
+	assert.True(t, options.PrintConfig)
+	assert.Equal(t, config.Default(), *cfg)
+
+	typo := writeTestFile(t, "typo.json", []byte(`{"server": {"adr": ":9000"}}`))
+	_, _, err = config.Load("test", []string{"-config", typo}, env(nil))
+	assert.ErrorContains(t, err, `unknown field "adr"`)
+
+	_, _, err = config.Load("test", nil, env(map[string]string{"RECEIPT_PROCESSOR_READ_TIMEOUT": "soon"}))
+	assert.ErrorContains(t, err, `invalid value "soon" for RECEIPT_PROCESSOR_READ_TIMEOUT`)
+
+	_, _, err = config.Load("test", []string{"-daily-quota", "many"}, env(nil))
+	assert.Error(t, err)
+}
+
+/*
+Testing the validation of the configuration
+every problem is reported with the field of the config file it is about
+*/
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, config.Default().Validate())
+
+	cfg := config.Default()
+	cfg.Server.Addr = "8080"
+	cfg.Server.ReadTimeout = config.Duration(-time.Second)
+	cfg.Server.ShutdownTimeout = 0
+	cfg.Store.Backend = "postgres"
+	cfg.Limits.DailyQuota = -1
+	cfg.Log.Level = "verbose"
+	cfg.TLS.KeyFile = "key.pem"
+	err := cfg.Validate()
+	assert.Error(t, err)
+	for _, message := range []string{
+		`server.addr: "8080" is not a host:port address`,
+		"server.readTimeout: must not be negative",
+		"server.shutdownTimeout: must be positive",
+		`store.backend: "postgres" is not one of memory`,
+		"limits.dailyQuota: must not be negative",
+		"log.level: ",
+		"tls.certFile: is required with tls.keyFile",
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+
+	cfg = config.Default()
+	cfg.TLS.ClientAuth = "require"
+	cfg.TLS.PartnersFile = "partners.json"
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "tls.clientAuth: needs HTTPS")
+	assert.ErrorContains(t, err, "tls.clientCaFile: is required when tls.clientAuth is require")
+
+	cfg = config.Default()
+	cfg.TLS.PartnersFile = "partners.json"
+	assert.ErrorContains(t, cfg.Validate(), "tls.partnersFile: needs client certificates")
+	cfg.TLS.ClientAuth = "sometimes"
+	assert.ErrorContains(t, cfg.Validate(), `tls.clientAuth: "sometimes" is not one of none, optional, require`)
+
+	cfg = config.Default()
+	cfg.Server.GRPCAddr = cfg.Server.Addr
+	assert.ErrorContains(t, cfg.Validate(), "server.grpcAddr: must differ from server.addr")
+	cfg.Server.GRPCAddr = ""
+	assert.NoError(t, cfg.Validate())
+
+	cfg = config.Default()
+	cfg.Mail.Maildir = "/var/mail/receipts"
+	cfg.Mail.PollInterval = 0
+	cfg.Mail.Tenant = "Acme Inc"
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "mail.pollInterval: must be positive")
+	assert.ErrorContains(t, err, "mail.templatesFile: is required with mail.maildir unless mail.parseUnmatched is set")
+	assert.ErrorContains(t, err, `mail.tenant: "Acme Inc" is not a tenant id`)
+	cfg = config.Default()
+	cfg.Mail.Maildir = "/var/mail/receipts"
+	cfg.Mail.ParseUnmatched = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg = config.Default()
+	cfg.Jobs.Workers = 0
+	cfg.Jobs.QueueSize = -1
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "jobs.workers: must be at least 1")
+	assert.ErrorContains(t, err, "jobs.queueSize: must be at least 1")
+
+	cfg = config.Default()
+	cfg.Webhooks.QueueSize = 0
+	cfg.Webhooks.MaxAttempts = 0
+	cfg.Webhooks.MaxBackoff = config.Duration(time.Second)
+	cfg.Webhooks.Timeout = 0
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "webhooks.queueSize: must be at least 1")
+	assert.ErrorContains(t, err, "webhooks.maxAttempts: must be at least 1")
+	assert.ErrorContains(t, err, "webhooks.maxBackoff: must not be shorter than webhooks.backoff")
+	assert.ErrorContains(t, err, "webhooks.timeout: must be positive")
+
+	cfg = config.Default()
+	cfg.Stream.SubscriberBuffer = 0
+	cfg.Stream.Heartbeat = cfg.Server.WriteTimeout
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "stream.subscriberBuffer: must be at least 1")
+	assert.ErrorContains(t, err, "stream.heartbeat: must be shorter than server.writeTimeout")
+}
+
+/*
+Testing the printed configuration
+the admin token is masked and the durations are written as strings
+*/
+
+func TestConfigMasked(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.AdminToken = "secret"
+	printed, err := json.Marshal(cfg.Masked())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(printed), "secret")
+	assert.Contains(t, string(printed), `"adminToken":"[REDACTED]"`)
+	assert.Contains(t, string(printed), `"shutdownTimeout":"25s"`)
+	assert.Equal(t, "secret", cfg.Auth.AdminToken)
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+testing that the amounts of a receipt must have as many decimals as its currency has minor units
+*/
+
+func TestValidateCurrencyMinorUnits(t *testing.T) {
+	assert := assert.New(t)
+	validate := validators.NewValidator()
+
+	receipt := func(currency string, price string) *models.Receipt {
+		return &models.Receipt{
+			Retailer:     "Test Retailer",
+			PurchaseDate: "2023-01-01",
+			PurchaseTime: "12:00",
+			Items:        []models.Item{{ShortDescription: "Item 1", Price: price}},
+			Total:        price,
+			Currency:     currency,
+		}
+	}
+
+	assert.NoError(validate.Struct(receipt("", "10.00")))
+	assert.NoError(validate.Struct(receipt("EUR", "10.00")))
+	assert.NoError(validate.Struct(receipt("JPY", "1000")))
+	assert.NoError(validate.Struct(receipt("KWD", "1.250")))
+
+	assert.Error(validate.Struct(receipt("", "10")))
+	assert.Error(validate.Struct(receipt("JPY", "1000.00")))
+	assert.Error(validate.Struct(receipt("KWD", "1.25")))
+	assert.Error(validate.Struct(receipt("XYZ", "10.00")))
+	assert.Error(validate.Struct(receipt("usd", "10.00")))
+}
+
+/*
+testing the conversion of totals to the base currency
+*/
+
+func TestConvertCurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	table, err := services.LoadConversionTable("../rates.json")
+	assert.NoError(err)
+
+	total, ok := table.Convert("10.00", "USD")
+	assert.True(ok)
+	assert.Equal("10.00", total)
+
+	total, ok = table.Convert("10.00", "CAD")
+	assert.True(ok)
+	assert.Equal("7.30", total)
+
+	total, ok = table.Convert("1500", "JPY")
+	assert.True(ok)
+	assert.Equal("10.05", total)
+
+	_, ok = table.Convert("10.00", "CHF")
+	assert.False(ok)
+
+	var noTable *services.ConversionTable
+	_, ok = noTable.Convert("10.00", "CAD")
+	assert.False(ok)
+	total, ok = noTable.Convert("10.00", "")
+	assert.True(ok)
+	assert.Equal("10.00", total)
+}
+
+/*
+testing points for the receipt total in other currencies
+	100.00 CAD is 73.00 USD, a round dollar amount and a multiple of 0.25
+	10.00 EUR is 10.80 USD, neither
+	10.00 CHF has no rate
+*/
+
+func TestPointsForReceiptTotalInCurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	table, err := services.LoadConversionTable("../rates.json")
+	assert.NoError(err)
+
+	assert.Equal(int64(75), services.PointsForReceiptTotalInCurrency("100.00", "CAD", table))
+	assert.Equal(int64(0), services.PointsForReceiptTotalInCurrency("10.00", "EUR", table))
+	assert.Equal(int64(0), services.PointsForReceiptTotalInCurrency("10.00", "CHF", table))
+	assert.Equal(int64(75), services.PointsForReceiptTotalInCurrency("9.00", "", nil))
+}
+
+/*
+testing that invalid conversion tables are rejected with an error
+*/
+
+func TestLoadConversionTableInvalid(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "rates.json")
+
+	for _, content := range []string{
+		`{"base": "XYZ"}`,
+		`{"rates": {"XYZ": "1.00"}}`,
+		`{"rates": {"CAD": "-1"}}`,
+		`{"rates": {"CAD": "abc"}}`,
+	} {
+		assert.NoError(os.WriteFile(path, []byte(content), 0644))
+		_, err := services.LoadConversionTable(path)
+		assert.Error(err, content)
+	}
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/email"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// readTestMessage returns the sample message of testdata/email
+func readTestMessage(t *testing.T, name string) string {
+	content, err := os.ReadFile(filepath.Join("testdata/email", name))
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func newTestIngester(t *testing.T) (*email.Ingester, *services.ReceiptServiceImpl) {
+	templates, err := email.LoadTemplates("../email-templates.json")
+	assert.NoError(t, err)
+	service := &services.ReceiptServiceImpl{DB: db.NewInMemoryDB()}
+	return &email.Ingester{Receipts: service, Templates: templates}, service
+}
+
+/*
+Testing the parsing of the sample messages in testdata/email
+the encoded headers are decoded, the quoted-printable and base64 bodies are decoded to UTF-8 from their charset,
+attachments are skipped and the HTML part is read as text, a line per row with the cells separated by two spaces
+*/
+
+func TestParseMessage(t *testing.T) {
+	message, err := email.ParseMessage(strings.NewReader(readTestMessage(t, "target.eml")))
+	assert.NoError(t, err)
+	assert.Equal(t, "receipts@email.target.com", message.From)
+	assert.Equal(t, []string{"receipts+alice@example.com", "receipts+alice@example.com"}, message.To)
+	assert.Equal(t, "Your Target receipt — thank you!", message.Subject)
+	assert.Equal(t, time.Date(2022, 1, 1, 19, 5, 12, 0, time.UTC), message.Date.UTC())
+	assert.Equal(t, "Thanks for shopping at Target!\nView your receipt online: https://www.target.com/orders/1234\n", message.Text)
+	assert.Equal(t, strings.Join([]string{
+		"Thanks for shopping at Target!",
+		"Order date: January 1, 2022 at 1:01 PM",
+		"Item    Price",
+		"Mountain Dew 12PK  Qty 1  $6.49",
+		"Emils Cheese Pizza  Qty 2  $24.50",
+		"Target Circle Offer    -$1.00",
+		"Subtotal  $30.99",
+		"Tax  $2.48",
+		"Total  $32.47",
+		"Questions? Reply to this e-mail & we'll help.",
+	}, "\n"), (&email.Message{HTML: message.HTML}).Body())
+
+	message, err = email.ParseMessage(strings.NewReader(readTestMessage(t, "walmart.eml")))
+	assert.NoError(t, err)
+	assert.Equal(t, "Votre reçu Walmart", message.Subject)
+	assert.Contains(t, message.Text, "Merci d'avoir magasiné chez Walmart, à bientôt!")
+	assert.NotContains(t, message.Text, "999.99")
+	assert.Empty(t, message.HTML)
+
+	message, err = email.ParseMessage(strings.NewReader(readTestMessage(t, "corner-market.eml")))
+	assert.NoError(t, err)
+	text, err := os.ReadFile("testdata/text-receipts/corner-market.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, string(text), message.Body())
+
+	_, err = email.ParseMessage(strings.NewReader("not a message"))
+	assert.Error(t, err)
+}
+
+/*
+Testing the ingestion of the sample messages with the templates of email-templates.json
+the receipt is read with the template of the sender, the Date header is used when the template has no date or time,
+the plus address of the recipient is the member, and the messages no template matches are only parsed with ParseUnmatched
+*/
+
+func TestIngestEmail(t *testing.T) {
+	ingester, service := newTestIngester(t)
+	ctx := context.Background()
+
+	id, err := ingester.Ingest(ctx, strings.NewReader(readTestMessage(t, "target.eml")))
+	assert.NoError(t, err)
+	receipt, ok := service.GetReceiptDetails(ctx, id)
+	assert.True(t, ok)
+	assert.Equal(t, "Target", receipt.Retailer)
+	assert.Equal(t, "2022-01-01", receipt.PurchaseDate)
+	assert.Equal(t, "13:01", receipt.PurchaseTime)
+	assert.Equal(t, []models.Item{
+		{ShortDescription: "Mountain Dew 12PK", Price: "6.49", Quantity: "1"},
+		{ShortDescription: "Emils Cheese Pizza", Price: "24.50", Quantity: "2"},
+	}, receipt.Items)
+	assert.Equal(t, []models.Discount{{Description: "Target Circle Offer", Amount: "1.00"}}, receipt.Discounts)
+	assert.Equal(t, "30.99", receipt.Subtotal)
+	assert.Equal(t, "2.48", receipt.Tax)
+	assert.Equal(t, "32.47", receipt.Total)
+	assert.Equal(t, "alice", receipt.MemberID)
+
+	id, err = ingester.Ingest(ctx, strings.NewReader(readTestMessage(t, "walmart.eml")))
+	assert.NoError(t, err)
+	receipt, _ = service.GetReceiptDetails(ctx, id)
+	assert.Equal(t, "Walmart", receipt.Retailer)
+	assert.Equal(t, "2022-03-20", receipt.PurchaseDate)
+	assert.Equal(t, "14:33", receipt.PurchaseTime)
+	assert.Len(t, receipt.Items, 2)
+	assert.Equal(t, "4.80", receipt.Total)
+	assert.Empty(t, receipt.MemberID)
+
+	_, err = ingester.Ingest(ctx, strings.NewReader(readTestMessage(t, "corner-market.eml")))
+	assert.ErrorIs(t, err, email.ErrNoTemplate)
+	ingester.ParseUnmatched = true
+	id, err = ingester.Ingest(ctx, strings.NewReader(readTestMessage(t, "corner-market.eml")))
+	assert.NoError(t, err)
+	receipt, _ = service.GetReceiptDetails(ctx, id)
+	assert.Equal(t, "Corner Market & Deli", receipt.Retailer)
+	assert.Equal(t, "bob", receipt.MemberID)
+
+	_, err = ingester.Ingest(ctx, strings.NewReader(strings.Replace(readTestMessage(t, "target.eml"), "<b>Total</b>", "<b>Paid</b>", 1)))
+	assert.EqualError(t, err, "reading the receipt with the template of Target: the total is not found")
+	_, err = ingester.Ingest(ctx, strings.NewReader(strings.Replace(readTestMessage(t, "target.eml"), "$2.48", "$2.00", 1)))
+	assert.ErrorContains(t, err, "the receipt is invalid")
+	assert.Len(t, service.ListReceipts(ctx), 3)
+}
+
+/*
+Testing the errors of the templates file
+*/
+
+func TestLoadTemplates(t *testing.T) {
+	path := writeTestFile(t, "templates.json", []byte(`{"templates": [
+		{"retailer": "Target", "from": ["@target.com"], "items": "(?P<description>.+) (?P<amount>.+)", "total": "Total", "date": {"pattern": "(.+)"}}
+	]}`))
+	_, err := email.LoadTemplates(path)
+	assert.ErrorContains(t, err, "items: the group (?P<price>) is missing")
+	assert.ErrorContains(t, err, "total: the group with the value is missing")
+	assert.ErrorContains(t, err, "date: the layout is required with the pattern")
+
+	path = writeTestFile(t, "templates.json", []byte(`{"templates": [{"retailer": "Target", "items": "(?P<description>.+) (?P<price>.+)", "total": "(.+)"}]}`))
+	_, err = email.LoadTemplates(path)
+	assert.ErrorContains(t, err, "from or subject is required")
+
+	_, err = email.LoadTemplates("missing.json")
+	assert.ErrorContains(t, err, "reading templates file")
+}
+
+/*
+Testing the maildir watcher
+the messages of new are ingested and moved to cur, flagged when they are rejected,
+and the messages delivered while it runs are ingested on the next scan
+*/
+
+func TestMaildir(t *testing.T) {
+	ingester, service := newTestIngester(t)
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, sub), 0o700))
+	}
+	for _, name := range []string{"target.eml", "walmart.eml", "corner-market.eml"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "new", "1647801600.M1P1."+name), []byte(readTestMessage(t, name)), 0o600))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new", ".uidvalidity"), []byte("1"), 0o600))
+
+	maildir := &email.Maildir{Dir: dir, Interval: 10 * time.Millisecond, Ingester: ingester}
+	processed, rejected, err := maildir.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, processed)
+	assert.Equal(t, 1, rejected)
+	cur, err := filepath.Glob(filepath.Join(dir, "cur", "*"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "cur", "1647801600.M1P1.target.eml:2,S"),
+		filepath.Join(dir, "cur", "1647801600.M1P1.walmart.eml:2,S"),
+		filepath.Join(dir, "cur", "1647801600.M1P1.corner-market.eml:2,FS"),
+	}, cur)
+	left, err := os.ReadDir(filepath.Join(dir, "new"))
+	assert.NoError(t, err)
+	assert.Len(t, left, 1)
+
+	stop, err := maildir.Start()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tmp", "1647801601.M2P1.target.eml"), []byte(readTestMessage(t, "target.eml")), 0o600))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "tmp", "1647801601.M2P1.target.eml"), filepath.Join(dir, "new", "1647801601.M2P1.target.eml")))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "cur", "1647801601.M2P1.target.eml:2,S"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, stop(ctx))
+	assert.Len(t, service.ListReceipts(context.Background()), 3)
+}
@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/formats"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+)
+
+const targetReceiptXML = `<?xml version="1.0" encoding="UTF-8"?>
+<receipt>
+	<retailer>Target</retailer>
+	<purchaseDate>2022-01-01</purchaseDate>
+	<purchaseTime>13:01</purchaseTime>
+	<items><item><shortDescription>Mountain Dew 12PK</shortDescription><price>6.49</price></item></items>
+	<total>6.49</total>
+</receipt>`
+
+const targetReceiptCSV = "retailer,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+	"Target,2022-01-01,13:01,6.49,Mountain Dew 12PK,6.49\n"
+
+func newFormatsRouter() *gin.Engine {
+	receiptController := controllers.ReceiptController{ReceiptService: &services.ReceiptServiceImpl{DB: db.NewInMemoryDB()}}
+	router := gin.New()
+	router.POST("/receipts/process", receiptController.ProcessReceipt)
+	router.POST("/receipts/process-text", receiptController.ProcessReceiptText)
+	router.GET("/receipts/:id", receiptController.GetReceipt)
+	router.GET("/receipts/:id/points", receiptController.GetReceiptPoints)
+	return router
+}
+
+/*
+Testing that a receipt sent as XML or CSV is processed like the same receipt sent as JSON,
+and that the receipts, their points and their ids are returned in the format of the Accept header
+*/
+
+func TestReceiptFormats(t *testing.T) {
+	router := newFormatsRouter()
+
+	rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceiptXML, map[string]string{"Content-Type": "application/xml", "Accept": "application/xml"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "application/xml")
+	var processed struct {
+		ID string `xml:"id"`
+	}
+	assert.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &processed))
+	xmlID := processed.ID
+
+	rr = sendWithHeaders(router, "POST", "/receipts/process", "\uFEFF"+targetReceiptCSV, map[string]string{"Content-Type": "text/csv; charset=utf-8", "Accept": "text/csv"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	assert.Equal(t, "id", lines[0])
+	csvID := lines[1]
+
+	rr = sendJSON(router, "POST", "/receipts/process", targetReceipt)
+	var jsonProcessed map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jsonProcessed))
+	rr = sendJSON(router, "GET", "/receipts/"+jsonProcessed["id"], "")
+	var expected models.Receipt
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expected))
+
+	for _, id := range []string{xmlID, csvID} {
+		rr = sendWithHeaders(router, "GET", "/receipts/"+id, "", map[string]string{"Accept": "application/json"})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var receipt models.Receipt
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &receipt))
+		assert.Equal(t, expected.Points, receipt.Points)
+		assert.Equal(t, expected.Items, receipt.Items)
+		assert.Equal(t, expected.Breakdown, receipt.Breakdown)
+	}
+
+	rr = sendWithHeaders(router, "GET", "/receipts/"+xmlID, "", map[string]string{"Accept": "text/xml"})
+	var receipt models.Receipt
+	assert.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &receipt))
+	assert.Equal(t, xmlID, receipt.ID)
+	assert.Equal(t, expected.Breakdown, receipt.Breakdown)
+	assert.Equal(t, expected.PurchasedAt, receipt.PurchasedAt)
+	assert.Contains(t, rr.Body.String(), `<rule name="retailerName">6</rule>`)
+
+	rr = sendWithHeaders(router, "GET", "/receipts/"+csvID, "", map[string]string{"Accept": "text/csv"})
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	read, err := formats.ReadReceiptCSV(rr.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "Target", read.Retailer)
+	assert.Equal(t, "6.49", read.Total)
+	assert.Equal(t, []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, read.Items)
+
+	rr = sendWithHeaders(router, "GET", "/receipts/"+csvID, "", map[string]string{"Accept": "application/msgpack"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	receipt = models.Receipt{}
+	assert.NoError(t, codec.NewDecoderBytes(rr.Body.Bytes(), &codec.MsgpackHandle{}).Decode(&receipt))
+	assert.Equal(t, csvID, receipt.ID)
+	assert.Equal(t, expected.Points, receipt.Points)
+	assert.Equal(t, expected.Items, receipt.Items)
+
+	rr = sendWithHeaders(router, "GET", "/receipts/"+csvID+"/points", "", map[string]string{"Accept": "text/csv"})
+	assert.Equal(t, "points\n12\n", rr.Body.String())
+	rr = sendWithHeaders(router, "GET", "/receipts/"+csvID+"/points", "", map[string]string{"Accept": "text/html, application/xml;q=0.9"})
+	assert.Equal(t, "<receipt><points>12</points></receipt>", rr.Body.String())
+	rr = sendWithHeaders(router, "GET", "/receipts/"+csvID+"/points", "", map[string]string{"Accept": "*/*"})
+	assert.JSONEq(t, `{"points": 12}`, rr.Body.String())
+	rr = sendWithHeaders(router, "GET", "/receipts/"+csvID, "", map[string]string{"Accept": "text/html"})
+	assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+	rr = sendWithHeaders(router, "GET", "/receipts/unknown", "", map[string]string{"Accept": "text/csv"})
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+/*
+Testing that the receipts sent as XML and CSV are validated like the receipts sent as JSON
+*/
+
+func TestReceiptFormatsValidateLikeJSON(t *testing.T) {
+	router := newFormatsRouter()
+
+	accepted := 0
+	for _, body := range receiptValidationCases {
+		var receipt models.Receipt
+		assert.NoError(t, json.Unmarshal([]byte(body), &receipt))
+		asXML, err := xml.Marshal(&receipt)
+		assert.NoError(t, err)
+		var asCSV bytes.Buffer
+		assert.NoError(t, formats.WriteReceiptCSV(&asCSV, &receipt))
+
+		expected := sendJSON(router, "POST", "/receipts/process", body).Code
+		if expected == http.StatusOK {
+			accepted++
+		}
+		rr := sendWithHeaders(router, "POST", "/receipts/process", string(asXML), map[string]string{"Content-Type": "application/xml"})
+		assert.Equal(t, expected, rr.Code, body)
+		rr = sendWithHeaders(router, "POST", "/receipts/process", asCSV.String(), map[string]string{"Content-Type": "text/csv"})
+		assert.Equal(t, expected, rr.Code, body)
+	}
+	assert.Equal(t, 3, accepted)
+
+	for _, body := range []string{
+		`<receipt><retailer>Target</retailer>`,
+		"retailer,retailer\nTarget,Target\n",
+		"retailer,shortDescription,price\nTarget,Gatorade,2.25\nWalmart,Gatorade,2.25\n",
+		"",
+	} {
+		contentType := "text/csv"
+		if strings.HasPrefix(body, "<") {
+			contentType = "application/xml"
+		}
+		rr := sendWithHeaders(router, "POST", "/receipts/process", body, map[string]string{"Content-Type": contentType})
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		assert.JSONEq(t, `{"description": "The receipt is invalid"}`, rr.Body.String())
+	}
+}
+
+/*
+Testing the CSV of a receipt
+the columns are matched by name in any order, unknown columns are ignored, the receipt columns may be left empty after the first row,
+and discounts have rows of their own
+*/
+
+func TestReadReceiptCSV(t *testing.T) {
+	receipt, err := formats.ReadReceiptCSV(strings.NewReader(
+		"sku,price,shortDescription,retailer,purchaseDate,purchaseTime,subtotal,tax,total,discountDescription,discountAmount\n" +
+			"1001,2.25,Gatorade,Target,2022-01-01,13:01,4.50,0.20,4.20,,\n" +
+			"1002,2.25,Gatorade,,,,,,,,\n" +
+			",,,Target,,,,,,Coupon,0.50\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Receipt{
+		Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Subtotal: "4.50", Tax: "0.20", Total: "4.20",
+		Items:     []models.Item{{ShortDescription: "Gatorade", Price: "2.25"}, {ShortDescription: "Gatorade", Price: "2.25"}},
+		Discounts: []models.Discount{{Description: "Coupon", Amount: "0.50"}},
+	}, receipt)
+
+	var written bytes.Buffer
+	assert.NoError(t, formats.WriteReceiptCSV(&written, receipt))
+	read, err := formats.ReadReceiptCSV(&written)
+	assert.NoError(t, err)
+	assert.Equal(t, receipt, read)
+
+	_, err = formats.ReadReceiptCSV(strings.NewReader("retailer,total\nTarget,1.00\nTarget,2.00\n"))
+	assert.EqualError(t, err, `row 3: the total "2.00" differs from "1.00"`)
+}
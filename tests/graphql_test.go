@@ -0,0 +1,335 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/graphql"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore is a tenant store that counts the reads of the receipts by method
+type countingStore struct {
+	db.TenantStore
+	lock  sync.Mutex
+	reads map[string]int
+}
+
+func (store *countingStore) count(method string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.reads[method]++
+}
+
+func (store *countingStore) reset() map[string]int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	reads := store.reads
+	store.reads = map[string]int{}
+	return reads
+}
+
+func (store *countingStore) GetReceipt(ctx context.Context, id string) (int64, bool) {
+	store.count("GetReceipt")
+	return store.TenantStore.GetReceipt(ctx, id)
+}
+
+func (store *countingStore) GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool) {
+	store.count("GetReceiptDetails")
+	return store.TenantStore.GetReceiptDetails(ctx, id)
+}
+
+func (store *countingStore) GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt {
+	store.count("GetReceiptsDetails")
+	return store.TenantStore.GetReceiptsDetails(ctx, ids)
+}
+
+func (store *countingStore) ListReceipts(ctx context.Context) []models.Receipt {
+	store.count("ListReceipts")
+	return store.TenantStore.ListReceipts(ctx)
+}
+
+func newGraphQLRouter(tenants *services.Tenants, authenticator *middleware.Authenticator) *gin.Engine {
+	graphQLController := &controllers.GraphQLController{Tenants: tenants, APIKeys: authenticator.APIKeys}
+	router := gin.New()
+	graphQLRoutes := router.Group("/graphql", authenticator.Authenticate(), middleware.Tenant())
+	graphQLRoutes.POST("", graphQLController.Query)
+	graphQLRoutes.GET("", graphQLController.Query)
+	router.GET("/graphql/schema", graphQLController.Schema)
+	return router
+}
+
+// graphQLResult is a decoded GraphQL response, Data is kept as JSON to compare it with assert.JSONEq
+type graphQLResult struct {
+	Data   json.RawMessage  `json:"data"`
+	Errors []*graphql.Error `json:"errors"`
+}
+
+// sendGraphQL posts the query with the variables and the credentials in the header
+func sendGraphQL(t *testing.T, router *gin.Engine, query string, variables map[string]any, header string, value string) graphQLResult {
+	body, err := json.Marshal(graphql.Request{Query: query, Variables: variables})
+	assert.NoError(t, err)
+	rr := sendWithHeader(router, "POST", "/graphql", string(body), header, value)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result graphQLResult
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	return result
+}
+
+// receiptVariable returns the JSON receipt as the value of a ReceiptInput variable
+func receiptVariable(t *testing.T, body string) map[string]any {
+	var receipt map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(body), &receipt))
+	return receipt
+}
+
+const processReceiptMutation = `mutation Process($receipt: ReceiptInput!) {
+	processReceipt(receipt: $receipt) { id points memberId breakdown { rule points } }
+}`
+
+/*
+Testing the queries of receipts and members
+the receipts, their members and the receipts of the members are read with one read of the store per level,
+and members only find themselves and their own receipts
+*/
+
+func TestGraphQLReceiptsAndMembers(t *testing.T) {
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{HMACSecretFile: writeTestFile(t, "secret", []byte(testHMACSecret))})
+	assert.NoError(t, err)
+	store := &countingStore{TenantStore: db.NewInMemoryDB(), reads: map[string]int{}}
+	tenants := &services.Tenants{NewStore: func(string) db.TenantStore { return store }}
+	router := newGraphQLRouter(tenants, &middleware.Authenticator{JWT: verifier})
+	bearer := func(claims jwt.MapClaims) string { return "Bearer " + signHS256(t, claims) }
+	alice := bearer(memberClaims("alice", "receipts:read receipts:write"))
+	bob := bearer(memberClaims("bob", "receipts:read receipts:write"))
+	backOffice := bearer(memberClaims("back-office", "admin receipts:read"))
+
+	var ids []string
+	for _, member := range []string{alice, alice, bob} {
+		result := sendGraphQL(t, router, processReceiptMutation, map[string]any{"receipt": receiptVariable(t, targetReceipt)}, "Authorization", member)
+		assert.Empty(t, result.Errors)
+		var data struct {
+			ProcessReceipt struct {
+				ID        string              `json:"id"`
+				Points    int64               `json:"points"`
+				MemberID  string              `json:"memberId"`
+				Breakdown []models.RulePoints `json:"breakdown"`
+			} `json:"processReceipt"`
+		}
+		assert.NoError(t, json.Unmarshal(result.Data, &data))
+		assert.Equal(t, int64(12), data.ProcessReceipt.Points)
+		assert.Equal(t, []models.RulePoints{
+			{Rule: "retailerName", Points: 6}, {Rule: "total"}, {Rule: "itemCount"}, {Rule: "itemDescription"}, {Rule: "purchaseDate", Points: 6}, {Rule: "purchaseTime"},
+		}, data.ProcessReceipt.Breakdown)
+		ids = append(ids, data.ProcessReceipt.ID)
+	}
+
+	store.reset()
+	query := `query Dashboard($ids: [ID!]) {
+		receipts(ids: $ids) {
+			id points
+			items { shortDescription price category }
+			member { id receiptCount totalPoints receipts { id } }
+		}
+	}`
+	result := sendGraphQL(t, router, query, map[string]any{"ids": []string{ids[0], ids[1], ids[2], "unknown"}}, "Authorization", backOffice)
+	assert.Empty(t, result.Errors)
+	item := `{"shortDescription": "Mountain Dew 12PK", "price": "6.49", "category": null}`
+	aliceMember := `{"id": "alice", "receiptCount": 2, "totalPoints": 24, "receipts": [{"id": "` + ids[0] + `"}, {"id": "` + ids[1] + `"}]}`
+	bobMember := `{"id": "bob", "receiptCount": 1, "totalPoints": 12, "receipts": [{"id": "` + ids[2] + `"}]}`
+	assert.JSONEq(t, `{"receipts": [
+		{"id": "`+ids[0]+`", "points": 12, "items": [`+item+`], "member": `+aliceMember+`},
+		{"id": "`+ids[1]+`", "points": 12, "items": [`+item+`], "member": `+aliceMember+`},
+		{"id": "`+ids[2]+`", "points": 12, "items": [`+item+`], "member": `+bobMember+`}
+	]}`, string(result.Data))
+	assert.Equal(t, map[string]int{"GetReceiptsDetails": 1, "ListReceipts": 1}, store.reset())
+
+	result = sendGraphQL(t, router, `{ member(id: "bob") { id } receipts { id memberId } other: receipt(id: "`+ids[2]+`") { id } }`, nil, "Authorization", alice)
+	assert.Empty(t, result.Errors)
+	assert.JSONEq(t, `{"member": null, "receipts": [{"id": "`+ids[0]+`", "memberId": "alice"}, {"id": "`+ids[1]+`", "memberId": "alice"}], "other": null}`,
+		string(result.Data))
+
+	result = sendGraphQL(t, router, `{ receipts(memberId: "bob", first: 5) { id } }`, nil, "Authorization", backOffice)
+	assert.JSONEq(t, `{"receipts": [{"id": "`+ids[2]+`"}]}`, string(result.Data))
+	result = sendGraphQL(t, router, `{ receipts(first: -1) { id } }`, nil, "Authorization", backOffice)
+	assert.JSONEq(t, `null`, string(result.Data))
+	assert.Equal(t, "first must not be negative", result.Errors[0].Message)
+
+	result = sendGraphQL(t, router, processReceiptMutation, map[string]any{"receipt": receiptVariable(t, targetReceipt)}, "Authorization", backOffice)
+	assert.JSONEq(t, `null`, string(result.Data))
+	assert.Equal(t, "The receipts:write scope is required", result.Errors[0].Message)
+	assert.Equal(t, []any{"processReceipt"}, result.Errors[0].Path)
+}
+
+/*
+Testing that the processReceipt mutation rejects the same receipts as POST /receipts/process
+and counts against the daily quota of the API key
+*/
+
+func TestGraphQLProcessReceiptValidatesLikeHTTP(t *testing.T) {
+	receiptService := &services.ReceiptServiceImpl{DB: db.NewInMemoryDB()}
+	receiptController := controllers.ReceiptController{ReceiptService: receiptService}
+	graphQLController := &controllers.GraphQLController{ReceiptService: receiptService}
+	router := gin.New()
+	router.POST("/receipts/process", receiptController.ProcessReceipt)
+	router.POST("/graphql", graphQLController.Query)
+
+	accepted := 0
+	for _, body := range receiptValidationCases {
+		rr := sendJSON(router, "POST", "/receipts/process", body)
+		result := sendGraphQL(t, router, processReceiptMutation, map[string]any{"receipt": receiptVariable(t, body)}, "", "")
+		if rr.Code == http.StatusOK {
+			accepted++
+			assert.Empty(t, result.Errors, body)
+		} else {
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+			assert.JSONEq(t, `null`, string(result.Data), body)
+			assert.Equal(t, "The receipt is invalid", result.Errors[0].Message, body)
+		}
+	}
+	assert.Equal(t, 3, accepted)
+
+	result := sendGraphQL(t, router, processReceiptMutation, map[string]any{"receipt": map[string]any{"retailer": "Target"}}, "", "")
+	assert.Nil(t, result.Data)
+	assert.Contains(t, result.Errors[0].Message, `Variable "$receipt" got invalid value; field "ReceiptInput.purchaseDate" of required type "String!" was not provided`)
+
+	apiKeyService := &services.APIKeyServiceImpl{DB: db.NewInMemoryDB()}
+	_, key, _ := apiKeyService.CreateAPIKey("Partner POS", models.DefaultTenant, 1)
+	router = newGraphQLRouter(&services.Tenants{}, &middleware.Authenticator{APIKeys: apiKeyService})
+	result = sendGraphQL(t, router, processReceiptMutation, map[string]any{"receipt": receiptVariable(t, targetReceipt)}, middleware.APIKeyHeader, key)
+	assert.Empty(t, result.Errors)
+	body, _ := json.Marshal(graphql.Request{Query: processReceiptMutation, Variables: map[string]any{"receipt": receiptVariable(t, targetReceipt)}})
+	rr := sendWithHeader(router, "POST", "/graphql", string(body), middleware.APIKeyHeader, key)
+	assert.Equal(t, "0", rr.Header().Get(middleware.DailyQuotaRemainingHeader))
+	assert.Contains(t, rr.Body.String(), "The daily quota of the API key is used up")
+}
+
+/*
+Testing the GraphQL requests
+aliases, fragments, directives and variables, the errors of invalid requests with their locations,
+the queries sent with GET, and the schema
+*/
+
+func TestGraphQLRequests(t *testing.T) {
+	apiKeyService := &services.APIKeyServiceImpl{DB: db.NewInMemoryDB()}
+	_, key, _ := apiKeyService.CreateAPIKey("Partner POS", models.DefaultTenant, 0)
+	router := newGraphQLRouter(&services.Tenants{}, &middleware.Authenticator{APIKeys: apiKeyService, AdminToken: testAdminToken})
+	send := func(query string, variables map[string]any) graphQLResult {
+		return sendGraphQL(t, router, query, variables, middleware.APIKeyHeader, key)
+	}
+	processed := send(processReceiptMutation, map[string]any{"receipt": receiptVariable(t, targetReceipt)})
+	var data struct {
+		ProcessReceipt struct {
+			ID string `json:"id"`
+		} `json:"processReceipt"`
+	}
+	assert.NoError(t, json.Unmarshal(processed.Data, &data))
+	id := data.ProcessReceipt.ID
+
+	query := `
+		# the latest receipt
+		query Latest($skipPoints: Boolean!, $first: Int = 1) {
+			latest: receipts(first: $first) { ...Fields points @skip(if: $skipPoints) total @include(if: false) }
+			receipt(id: "` + id + `") { ... on Receipt { retailer } }
+		}
+		fragment Fields on Receipt { __typename id retailer }`
+	result := send(query, map[string]any{"skipPoints": true})
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, `{"latest":[{"__typename":"Receipt","id":"`+id+`","retailer":"Target"}],"receipt":{"retailer":"Target"}}`, string(result.Data))
+
+	for query, message := range map[string]string{
+		`{ receipts { id }`:                                       "Syntax Error: Expected Name, found <EOF>.",
+		`{ receipts { nope } }`:                                   `Cannot query field "nope" on type "Receipt".`,
+		`{ receipts }`:                                            `Field "receipts" of type "[Receipt!]!" must have a selection of subfields.`,
+		`{ receipt { id } }`:                                      `Field "receipt" argument "id" of type "ID!" is required, but it was not provided.`,
+		`{ receipts(first: "ten") { id } }`:                       `Argument "first" has invalid value; Int cannot represent "ten"`,
+		`{ receipts { id: retailer id } }`:                        `Fields "id" conflict because retailer and id are different fields.`,
+		`{ receipts { ...Missing } }`:                             `Unknown fragment "Missing".`,
+		`query A { receipts { id } } query B { receipts { id } }`: "Must provide operation name if query contains multiple operations.",
+		`{ receipts { ...A } } fragment A on Receipt { member { receipts { ...A } } }`:                                                   `Cannot spread fragment "A" within itself.`,
+		`{ receipts { member { receipts { member { receipts { member { receipts { member { receipts { member { id } } } } } } } } } } }`: "The query is nested deeper than 10 levels.",
+		`subscription { receipts { id } }`: "Subscriptions are not supported.",
+	} {
+		result := send(query, nil)
+		assert.Nil(t, result.Data, query)
+		if assert.NotEmpty(t, result.Errors, query) {
+			assert.Equal(t, message, result.Errors[0].Message, query)
+		}
+	}
+	result = send(`{ receipts { nope } }`, nil)
+	assert.Equal(t, []graphql.Location{{Line: 1, Column: 14}}, result.Errors[0].Locations)
+
+	result = sendGraphQL(t, router, `{ receipts { id } }`, nil, middleware.AdminTokenHeader, testAdminToken)
+	assert.JSONEq(t, `null`, string(result.Data))
+	assert.Equal(t, "The receipts:read scope is required", result.Errors[0].Message)
+
+	rr := sendWithHeader(router, "GET", "/graphql?query="+url.QueryEscape(`query($id: ID!) { receipt(id: $id) { points } }`)+
+		"&variables="+url.QueryEscape(`{"id": "`+id+`"}`), "", middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"data": {"receipt": {"points": 12}}}`, rr.Body.String())
+	rr = sendWithHeader(router, "GET", "/graphql?query="+url.QueryEscape(processReceiptMutation)+
+		"&variables="+url.QueryEscape(`{"receipt": `+targetReceipt+`}`), "", middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	result = send(`{ receipts { id } }`, nil)
+	assert.Equal(t, `{"receipts":[{"id":"`+id+`"}]}`, string(result.Data))
+	rr = sendWithHeader(router, "POST", "/graphql", `{"query": 1}`, middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = sendWithHeader(router, "POST", "/graphql", `{"query": "{ receipts { id } }"}`, "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = sendWithHeader(router, "GET", "/graphql/schema", "", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	for _, definition := range []string{"type Query {", "type Receipt {", "  breakdown: [RulePoints!]!", "  processReceipt(receipt: ReceiptInput!): Receipt!", "input ReceiptInput {"} {
+		assert.True(t, strings.Contains(rr.Body.String(), definition), definition)
+	}
+}
+
+/*
+Testing that the parser stops at the depth limit instead of overflowing the stack on a deeply nested query,
+and that Query rejects bodies and query parameters longer than MaxQueryBytes with 413
+*/
+func TestGraphQLRequestLimits(t *testing.T) {
+	node := &graphql.Object{Name: "Node"}
+	node.Fields = []*graphql.Field{{Name: "a", Type: "Node", Resolve: graphql.Each(func(source any) any { return source })}}
+	schema, err := graphql.NewSchema(node, nil)
+	assert.NoError(t, err)
+	for _, query := range []string{
+		strings.Repeat("{a", 3_000_000),
+		"{ a(b: " + strings.Repeat("[", 3_000_000) + ") }",
+		"query($b: " + strings.Repeat("[", 3_000_000) + "Int) { a }",
+	} {
+		_, errs := schema.Prepare(graphql.Request{Query: query})
+		if assert.NotEmpty(t, errs) {
+			assert.Equal(t, "The query is nested deeper than 100 levels.", errs[0].Message)
+		}
+	}
+
+	apiKeyService := &services.APIKeyServiceImpl{DB: db.NewInMemoryDB()}
+	_, key, _ := apiKeyService.CreateAPIKey("Partner POS", models.DefaultTenant, 0)
+	router := newGraphQLRouter(&services.Tenants{}, &middleware.Authenticator{APIKeys: apiKeyService, AdminToken: testAdminToken})
+	result := sendGraphQL(t, router, strings.Repeat("{ receipts { member ", 2000), nil, middleware.APIKeyHeader, key)
+	if assert.NotEmpty(t, result.Errors) {
+		assert.Equal(t, "The query is nested deeper than 10 levels.", result.Errors[0].Message)
+	}
+
+	long := "{ receipts { id } }" + strings.Repeat(" ", controllers.MaxQueryBytes)
+	body, err := json.Marshal(graphql.Request{Query: long})
+	assert.NoError(t, err)
+	rr := sendWithHeader(router, "POST", "/graphql", string(body), middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	rr = sendWithHeader(router, "GET", "/graphql?query="+url.QueryEscape(long), "", middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
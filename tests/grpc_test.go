@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/grpcapi"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	receiptv1 "github.com/rapolunagarjuna/receipt-processor-challenge/proto/receipt/v1"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// newGRPCClient serves the receipt server on an in-memory listener until the test ends, and returns a client of it
+func newGRPCClient(t *testing.T, receipts *grpcapi.ReceiptServer, interceptor *grpcapi.Interceptor) receiptv1.ReceiptServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpcapi.New(receipts, interceptor, nil)
+	go server.Serve(listener)
+	connection, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		connection.Close()
+		server.Stop()
+	})
+	return receiptv1.NewReceiptServiceClient(connection)
+}
+
+// withMetadata returns a context that sends the key value pairs as metadata
+func withMetadata(pairs ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), pairs...)
+}
+
+// receiptMessage parses a JSON receipt of the HTTP API into its message, the JSON names of the fields are the same
+func receiptMessage(t *testing.T, body string) *receiptv1.Receipt {
+	var receipt receiptv1.Receipt
+	assert.NoError(t, protojson.Unmarshal([]byte(body), &receipt))
+	return &receipt
+}
+
+// receiptValidationCases are receipts every API accepts or rejects like POST /receipts/process, three of them are valid
+var receiptValidationCases = []string{
+	targetReceipt,
+	`{"retailer": "Target", "purchaseDate": "2022-13-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "2.25"}], "total": "2.25"}`,
+	`{"retailer": "Target!", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "2.25"}], "total": "2.25"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "25:01", "items": [{"shortDescription": "Gatorade", "price": "2.25"}], "total": "2.25"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [], "total": "2.25"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "2.2"}], "total": "2.2"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "2.25"}], "subtotal": "2.25", "tax": "0.20", "total": "2.25"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "4.50", "quantity": "2", "unitPrice": "2.25"}], "total": "4.50"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "4.50", "quantity": "2", "unitPrice": "2.20"}], "total": "4.50"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "225"}], "currency": "JPY", "total": "225"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "2.25"}], "currency": "XXX", "total": "2.25"}`,
+	`{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Gatorade", "price": "2.25"}], "timezone": "Mars/Olympus", "total": "2.25"}`,
+}
+
+/*
+Testing the gRPC API
+a receipt processed with an API key gets the same points as over HTTP, is attributed to the key,
+and is listed page by page, the calls are authenticated, scoped and kept in their tenant
+*/
+
+func TestGRPCReceipts(t *testing.T) {
+	database := db.NewInMemoryDB()
+	apiKeyService := &services.APIKeyServiceImpl{DB: database}
+	tenants := &services.Tenants{}
+	authenticator := &middleware.Authenticator{APIKeys: apiKeyService, AdminToken: testAdminToken}
+	client := newGRPCClient(t, &grpcapi.ReceiptServer{Tenants: tenants, APIKeys: apiKeyService}, &grpcapi.Interceptor{Authenticator: authenticator})
+	apiKey, key, _ := apiKeyService.CreateAPIKey("Partner POS", "acme", 0)
+	ctx := withMetadata("x-api-key", key)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		processed, err := client.ProcessReceipt(ctx, &receiptv1.ProcessReceiptRequest{Receipt: receiptMessage(t, targetReceipt)})
+		assert.NoError(t, err)
+		ids = append(ids, processed.GetId())
+	}
+
+	points, err := client.GetPoints(ctx, &receiptv1.GetPointsRequest{Id: ids[0]})
+	assert.NoError(t, err)
+	expected, _ := tenants.For("acme").Receipts.GetReceipt(context.Background(), ids[0])
+	assert.Equal(t, expected, points.GetPoints())
+	assert.Equal(t, int64(12), points.GetPoints())
+
+	receipt, err := client.GetReceipt(ctx, &receiptv1.GetReceiptRequest{Id: ids[0]})
+	assert.NoError(t, err)
+	assert.Equal(t, "Target", receipt.GetReceipt().GetRetailer())
+	assert.Equal(t, "Mountain Dew 12PK", receipt.GetReceipt().GetItems()[0].GetShortDescription())
+	assert.Equal(t, apiKey.ID, receipt.GetReceipt().GetApiKeyId())
+	assert.NotNil(t, receipt.GetReceipt().GetCreatedAt())
+
+	page, err := client.ListReceipts(ctx, &receiptv1.ListReceiptsRequest{PageSize: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page.GetReceipts(), 2)
+	assert.NotEmpty(t, page.GetNextPageToken())
+	lastPage, err := client.ListReceipts(ctx, &receiptv1.ListReceiptsRequest{PageSize: 2, PageToken: page.GetNextPageToken()})
+	assert.NoError(t, err)
+	assert.Len(t, lastPage.GetReceipts(), 1)
+	assert.Empty(t, lastPage.GetNextPageToken())
+	listed := map[string]bool{}
+	for _, receipt := range append(page.GetReceipts(), lastPage.GetReceipts()...) {
+		listed[receipt.GetId()] = true
+	}
+	assert.Len(t, listed, 3)
+	_, err = client.ListReceipts(ctx, &receiptv1.ListReceiptsRequest{PageToken: "not a token"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.GetPoints(ctx, &receiptv1.GetPointsRequest{Id: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetPoints(withMetadata("x-admin-token", testAdminToken), &receiptv1.GetPointsRequest{Id: ids[0]})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.GetPoints(context.Background(), &receiptv1.GetPointsRequest{Id: ids[0]})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.GetPoints(withMetadata("x-api-key", key, "x-tenant-id", "globex"), &receiptv1.GetPointsRequest{Id: ids[0]})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, otherKey, _ := apiKeyService.CreateAPIKey("Globex POS", "globex", 0)
+	_, err = client.GetPoints(withMetadata("x-api-key", otherKey), &receiptv1.GetPointsRequest{Id: ids[0]})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+/*
+Testing that the gRPC API and the HTTP API reject the same receipts
+*/
+
+func TestGRPCValidatesLikeHTTP(t *testing.T) {
+	receiptService := &services.ReceiptServiceImpl{DB: db.NewInMemoryDB()}
+	receiptController := controllers.ReceiptController{ReceiptService: receiptService}
+	router := gin.New()
+	router.POST("/receipts/process", receiptController.ProcessReceipt)
+	client := newGRPCClient(t, &grpcapi.ReceiptServer{ReceiptService: receiptService}, &grpcapi.Interceptor{})
+
+	accepted := 0
+	for _, body := range receiptValidationCases {
+		rr := sendJSON(router, "POST", "/receipts/process", body)
+		_, err := client.ProcessReceipt(context.Background(), &receiptv1.ProcessReceiptRequest{Receipt: receiptMessage(t, body)})
+		if rr.Code == http.StatusOK {
+			accepted++
+			assert.NoError(t, err, body)
+		} else {
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), body)
+		}
+	}
+	assert.Equal(t, 3, accepted)
+
+	_, err := client.ProcessReceipt(context.Background(), &receiptv1.ProcessReceiptRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+/*
+Testing the daily quota of an API key over gRPC
+*/
+
+func TestGRPCDailyQuota(t *testing.T) {
+	database := db.NewInMemoryDB()
+	apiKeyService := &services.APIKeyServiceImpl{DB: database}
+	receipts := &grpcapi.ReceiptServer{ReceiptService: &services.ReceiptServiceImpl{DB: database}, APIKeys: apiKeyService}
+	client := newGRPCClient(t, receipts, &grpcapi.Interceptor{Authenticator: &middleware.Authenticator{APIKeys: apiKeyService}})
+	_, key, _ := apiKeyService.CreateAPIKey("Partner POS", models.DefaultTenant, 1)
+	ctx := withMetadata("x-api-key", key)
+
+	_, err := client.ProcessReceipt(ctx, &receiptv1.ProcessReceiptRequest{Receipt: receiptMessage(t, targetReceipt)})
+	assert.NoError(t, err)
+	_, err = client.ProcessReceipt(ctx, &receiptv1.ProcessReceiptRequest{Receipt: receiptMessage(t, targetReceipt)})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
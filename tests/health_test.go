@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// unreachableStore is a store whose backend is down
+type unreachableStore struct {
+	*db.InMemoryDB
+}
+
+func (store unreachableStore) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func newHealthRouter(healthService *services.HealthServiceImpl) *gin.Engine {
+	healthController := controllers.HealthController{HealthService: healthService}
+	router := gin.New()
+	router.GET("/healthz", healthController.Healthz)
+	router.GET("/readyz", healthController.Readyz)
+	router.GET("/version", healthController.Version)
+	return router
+}
+
+/*
+Testing readiness
+ready while every check passes, 503 with the failing check when the store is unreachable
+and once the service is shutting down, while /healthz keeps returning 200
+*/
+
+func TestReadiness(t *testing.T) {
+	storeDown := false
+	tenants := &services.Tenants{NewStore: func(string) db.TenantStore {
+		if storeDown {
+			return metrics.InstrumentStore(unreachableStore{db.NewInMemoryDB()})
+		}
+		return db.NewInMemoryDB()
+	}}
+	healthService := &services.HealthServiceImpl{Checks: []services.HealthCheck{{Name: "store", Check: tenants.Ping}}}
+	router := newHealthRouter(healthService)
+	tenants.For("tenant-a")
+
+	rr := sendWithHeader(router, "GET", "/readyz", "", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status": "ready", "checks": {"store": "ok"}}`, rr.Body.String())
+
+	storeDown = true
+	tenants.For("tenant-b")
+	rr = sendWithHeader(router, "GET", "/readyz", "", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status": "unavailable", "checks": {"store": "store of tenant tenant-b: connection refused"}}`, rr.Body.String())
+
+	healthService.Checks = nil
+	rr = sendWithHeader(router, "GET", "/readyz", "", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	healthService.ShutDown()
+	rr = sendWithHeader(router, "GET", "/readyz", "", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status": "unavailable", "checks": {"shutdown": "shutting down"}}`, rr.Body.String())
+
+	rr = sendWithHeader(router, "GET", "/healthz", "", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+/*
+Testing the build info and the versions of the rules of the tenants
+*/
+
+func TestVersion(t *testing.T) {
+	tenants := &services.Tenants{
+		Rules:       &services.RuleSet{Version: "3"},
+		TenantRules: map[string]*services.RuleSet{"acme": {}},
+	}
+	build := services.NewBuildInfo("abc123", "")
+	tenants.RulesVersions(&build)
+	router := newHealthRouter(&services.HealthServiceImpl{Build: build})
+
+	rr := sendWithHeader(router, "GET", "/version", "", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var version services.BuildInfo
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &version))
+	assert.Equal(t, "abc123", version.Commit)
+	assert.NotEmpty(t, version.BuildTime)
+	assert.NotEmpty(t, version.GoVersion)
+	assert.Equal(t, "3", version.RulesVersion)
+	assert.Equal(t, map[string]string{"acme": "unversioned"}, version.TenantRulesVersions)
+}
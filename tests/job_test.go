@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+var respondAsync = map[string]string{"Prefer": "respond-async"}
+
+func newJobsRouter(t *testing.T, queue *services.JobQueue) *gin.Engine {
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{HMACSecretFile: writeTestFile(t, "secret", []byte(testHMACSecret))})
+	assert.NoError(t, err)
+	tenants := &services.Tenants{Jobs: queue}
+	receiptController := controllers.ReceiptController{Tenants: tenants}
+	jobController := controllers.JobController{Tenants: tenants}
+	router := gin.New()
+	routes := router.Group("", (&middleware.Authenticator{JWT: verifier}).Authenticate(), middleware.Tenant())
+	routes.POST("/receipts/process", receiptController.ProcessReceipt)
+	routes.POST("/receipts/process-text", receiptController.ProcessReceiptText)
+	routes.GET("/receipts/:id/points", receiptController.GetReceiptPoints)
+	routes.GET("/jobs/:id", jobController.GetJob)
+	return router
+}
+
+// waitForJob polls the job until it is done and returns it
+func waitForJob(t *testing.T, router *gin.Engine, location string, headers map[string]string) models.Job {
+	var job models.Job
+	assert.Eventually(t, func() bool {
+		rr := sendWithHeaders(router, "GET", location, "", headers)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+		return job.Done()
+	}, 5*time.Second, 5*time.Millisecond)
+	return job
+}
+
+/*
+Testing the requests sent with Prefer: respond-async
+they get 202 with a queued job right away, the job ends with the status and the body the request would have had,
+the receipts sent as JSON are validated before the job is queued, and members only find their own jobs
+*/
+
+func TestAsyncProcessReceipt(t *testing.T) {
+	queue := services.NewJobQueue(2, 10)
+	defer queue.Close(context.Background())
+	router := newJobsRouter(t, queue)
+	alice := map[string]string{"Authorization": "Bearer " + signHS256(t, memberClaims("alice", "receipts:read receipts:write"))}
+	bob := map[string]string{"Authorization": "Bearer " + signHS256(t, memberClaims("bob", "receipts:read receipts:write"))}
+	withAlice := func(headers map[string]string) map[string]string {
+		merged := map[string]string{"Content-Type": "application/json"}
+		for name, value := range alice {
+			merged[name] = value
+		}
+		for name, value := range headers {
+			merged[name] = value
+		}
+		return merged
+	}
+
+	rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, withAlice(respondAsync))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, "respond-async", rr.Header().Get("Preference-Applied"))
+	var accepted models.Job
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &accepted))
+	assert.Equal(t, "/jobs/"+accepted.ID, rr.Header().Get("Location"))
+	assert.Equal(t, "process", accepted.Kind)
+	assert.Equal(t, models.JobQueued, accepted.Status)
+
+	job := waitForJob(t, router, rr.Header().Get("Location"), alice)
+	assert.Equal(t, models.JobSucceeded, job.Status)
+	assert.Equal(t, http.StatusOK, job.Code)
+	assert.NotNil(t, job.StartedAt)
+	assert.NotNil(t, job.FinishedAt)
+	var processed map[string]string
+	assert.NoError(t, json.Unmarshal(job.Result, &processed))
+	rr = sendWithHeaders(router, "GET", "/receipts/"+processed["id"]+"/points", "", alice)
+	assert.JSONEq(t, `{"points": 12}`, rr.Body.String())
+
+	rr = sendWithHeaders(router, "GET", "/jobs/"+job.ID, "", bob)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = sendWithHeaders(router, "GET", "/jobs/unknown", "", alice)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = sendWithHeaders(router, "POST", "/receipts/process", `{"retailer": "Target"}`, withAlice(respondAsync))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	text, err := os.ReadFile("testdata/text-receipts/damaged-ocr.txt")
+	assert.NoError(t, err)
+	rr = sendWithHeaders(router, "POST", "/receipts/process-text", string(text), withAlice(map[string]string{
+		"Content-Type": "text/plain", "Prefer": "wait=5, respond-async",
+	}))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	job = waitForJob(t, router, rr.Header().Get("Location"), alice)
+	assert.Equal(t, "process-text", job.Kind)
+	assert.Equal(t, models.JobFailed, job.Status)
+	assert.Equal(t, http.StatusBadRequest, job.Code)
+	var rejected struct {
+		Description string `json:"description"`
+	}
+	assert.NoError(t, json.Unmarshal(job.Result, &rejected))
+	assert.Equal(t, "The receipt is invalid", rejected.Description)
+
+	rr = sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, withAlice(nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+/*
+Testing the backpressure of the job queue
+once as many jobs wait as the queue holds, the requests get 503 with Retry-After and nothing is stored,
+closing the queue runs the jobs already queued and turns the new ones away
+*/
+
+func TestJobQueueBackpressure(t *testing.T) {
+	queue := services.NewJobQueue(1, 1)
+	store := db.NewInMemoryDB()
+	ctx := context.Background()
+	started, release := make(chan struct{}), make(chan struct{})
+	blocking := func(ctx context.Context) (int, any) {
+		close(started)
+		<-release
+		return http.StatusOK, map[string]string{"id": "blocked"}
+	}
+
+	running := &models.Job{Kind: "process"}
+	assert.NoError(t, queue.Submit(ctx, store, running, blocking))
+	<-started
+	waiting := &models.Job{Kind: "process"}
+	assert.NoError(t, queue.Submit(ctx, store, waiting, func(ctx context.Context) (int, any) { panic("the job broke") }))
+	assert.ErrorIs(t, queue.Submit(ctx, store, &models.Job{Kind: "process"}, blocking), services.ErrQueueFull)
+	assert.Len(t, store.Jobs, 2)
+
+	router := newJobsRouter(t, queue)
+	headers := map[string]string{"Content-Type": "application/json", "Prefer": "respond-async",
+		"Authorization": "Bearer " + signHS256(t, jwt.MapClaims{"sub": "alice", "scope": "receipts:write", "exp": time.Now().Add(time.Hour).Unix()})}
+	rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, headers)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"description": "Too many receipts are waiting to be processed, retry later"}`, rr.Body.String())
+
+	job, ok := store.GetJob(ctx, running.ID)
+	assert.True(t, ok)
+	assert.Equal(t, models.JobRunning, job.Status)
+
+	close(release)
+	closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.NoError(t, queue.Close(closeCtx))
+	job, _ = store.GetJob(ctx, running.ID)
+	assert.Equal(t, models.JobSucceeded, job.Status)
+	assert.JSONEq(t, `{"id": "blocked"}`, string(job.Result))
+	job, _ = store.GetJob(ctx, waiting.ID)
+	assert.Equal(t, models.JobFailed, job.Status)
+	assert.Equal(t, http.StatusInternalServerError, job.Code)
+
+	assert.ErrorIs(t, queue.Submit(ctx, store, &models.Job{Kind: "process"}, blocking), services.ErrQueueClosed)
+	rr = sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, headers)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+/*
+Testing that the jobs that are done are not kept forever
+a done job gets its expiresAt and is forgotten once it expired, and the oldest done jobs are forgotten above MaxFinishedJobs,
+the jobs that are not done are always kept
+*/
+
+func TestJobEviction(t *testing.T) {
+	store := db.NewInMemoryDB()
+	store.JobRetention = 50 * time.Millisecond
+	store.MaxFinishedJobs = 2
+	ctx := context.Background()
+	finish := func(job *models.Job) {
+		job.Status = models.JobSucceeded
+		finishedAt := time.Now().UTC()
+		job.FinishedAt = &finishedAt
+		assert.NoError(t, store.UpdateJob(ctx, job))
+	}
+
+	queued := &models.Job{Kind: "process", Status: models.JobQueued}
+	store.AddJob(ctx, queued)
+	done := make([]*models.Job, 3)
+	for i := range done {
+		done[i] = &models.Job{Kind: "process", Status: models.JobQueued}
+		store.AddJob(ctx, done[i])
+		finish(done[i])
+	}
+	_, ok := store.GetJob(ctx, done[0].ID)
+	assert.False(t, ok)
+	job, ok := store.GetJob(ctx, done[2].ID)
+	if assert.True(t, ok) && assert.NotNil(t, job.ExpiresAt) {
+		assert.True(t, job.ExpiresAt.After(*job.FinishedAt))
+	}
+
+	assert.Eventually(t, func() bool {
+		_, ok := store.GetJob(ctx, done[2].ID)
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok = store.GetJob(ctx, done[1].ID)
+	assert.False(t, ok)
+	_, ok = store.GetJob(ctx, queued.ID)
+	assert.True(t, ok)
+	assert.Len(t, store.Jobs, 1)
+}
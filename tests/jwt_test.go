@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+func writeTestFile(t *testing.T, name string, content []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, content, 0600))
+	return path
+}
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testHMACSecret))
+	assert.NoError(t, err)
+	return token
+}
+
+func memberClaims(subject string, scope string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   subject,
+		"scope": scope,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+/*
+testing the verification of HS256 tokens
+*/
+
+func TestVerifyHS256(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{
+		HMACSecretFile: writeTestFile(t, "secret", []byte(testHMACSecret+"\n")),
+		Issuer:         "https://members.example.com",
+	})
+	assert.NoError(err)
+
+	claims := memberClaims("member-1", "receipts:read receipts:write")
+	claims["iss"] = "https://members.example.com"
+	principal, err := verifier.Verify(signHS256(t, claims))
+	assert.NoError(err)
+	assert.Equal("member-1", principal.Subject)
+	assert.True(principal.HasScope(auth.ScopeReceiptsWrite))
+	assert.False(principal.HasScope(auth.ScopeAdmin))
+
+	claims["iss"] = "https://other.example.com"
+	_, err = verifier.Verify(signHS256(t, claims))
+	assert.Error(err)
+
+	expired := memberClaims("member-1", "receipts:read")
+	expired["iss"] = "https://members.example.com"
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = verifier.Verify(signHS256(t, expired))
+	assert.Error(err)
+
+	withoutExpiry := jwt.MapClaims{"sub": "member-1", "iss": "https://members.example.com"}
+	_, err = verifier.Verify(signHS256(t, withoutExpiry))
+	assert.Error(err)
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = verifier.Verify(unsigned)
+	assert.Error(err)
+
+	_, err = auth.NewJWTVerifier(auth.JWTOptions{HMACSecretFile: writeTestFile(t, "short", []byte("short"))})
+	assert.Error(err)
+}
+
+/*
+testing the verification of RS256 tokens with keys from a PEM file and a JWKS file
+*/
+
+func TestVerifyRS256(t *testing.T) {
+	assert := assert.New(t)
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(err)
+	pemFile := writeTestFile(t, "public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(privateKey.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.PublicKey.E)).Bytes()),
+		}},
+	})
+	jwksFile := writeTestFile(t, "jwks.json", jwks)
+
+	sign := func(key *rsa.PrivateKey, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub": "member-1",
+			"scp": []string{"receipts:read"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		assert.NoError(err)
+		return signed
+	}
+
+	pemVerifier, err := auth.NewJWTVerifier(auth.JWTOptions{RSAPublicKeyFile: pemFile})
+	assert.NoError(err)
+	principal, err := pemVerifier.Verify(sign(privateKey, ""))
+	assert.NoError(err)
+	assert.True(principal.HasScope(auth.ScopeReceiptsRead))
+	_, err = pemVerifier.Verify(sign(otherKey, ""))
+	assert.Error(err)
+
+	jwksVerifier, err := auth.NewJWTVerifier(auth.JWTOptions{JWKSFile: jwksFile})
+	assert.NoError(err)
+	_, err = jwksVerifier.Verify(sign(privateKey, "key-1"))
+	assert.NoError(err)
+	_, err = jwksVerifier.Verify(sign(privateKey, "key-2"))
+	assert.Error(err)
+}
+
+/*
+Testing the scopes of the routes and that members can only read their own receipts
+*/
+
+func TestBearerTokenScopesAndMembers(t *testing.T) {
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{HMACSecretFile: writeTestFile(t, "secret", []byte(testHMACSecret))})
+	assert.NoError(t, err)
+
+	database := db.NewInMemoryDB()
+	receiptService := services.ReceiptServiceImpl{DB: database}
+	receiptController := controllers.ReceiptController{ReceiptService: &receiptService}
+	apiKeyController := controllers.APIKeyController{APIKeyService: &services.APIKeyServiceImpl{DB: database}}
+	authenticator := middleware.Authenticator{JWT: verifier}
+
+	router := gin.New()
+	receiptApiRoutes := router.Group("/receipts", authenticator.Authenticate())
+	receiptApiRoutes.POST("/process", middleware.RequireScope(auth.ScopeReceiptsWrite), receiptController.ProcessReceipt)
+	receiptApiRoutes.GET("/:id", middleware.RequireScope(auth.ScopeReceiptsRead), receiptController.GetReceipt)
+	receiptApiRoutes.GET("/:id/points", middleware.RequireScope(auth.ScopeReceiptsRead), receiptController.GetReceiptPoints)
+	router.GET("/admin/api-keys", authenticator.Authenticate(), middleware.RequireScope(auth.ScopeAdmin), apiKeyController.GetAllAPIKeys)
+
+	bearer := func(claims jwt.MapClaims) string { return "Bearer " + signHS256(t, claims) }
+	memberOne := bearer(memberClaims("member-1", "receipts:read receipts:write"))
+	memberTwo := bearer(memberClaims("member-2", "receipts:read receipts:write"))
+	readOnly := bearer(memberClaims("member-1", "receipts:read"))
+	admin := bearer(memberClaims("back-office", "admin receipts:read"))
+
+	receiptWithMember := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "memberId": "member-2",
+		"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}], "total": "6.49"}`
+	rr := sendWithHeader(router, "POST", "/receipts/process", receiptWithMember, "Authorization", memberOne)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var processed map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &processed))
+	id := processed["id"]
+
+	receipt, _ := receiptService.GetReceiptDetails(context.Background(), id)
+	assert.Equal(t, "member-1", receipt.MemberID)
+
+	rr = sendWithHeader(router, "GET", "/receipts/"+id+"/points", "", "Authorization", memberOne)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = sendWithHeader(router, "GET", "/receipts/"+id+"/points", "", "Authorization", memberTwo)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = sendWithHeader(router, "GET", "/receipts/"+id, "", "Authorization", memberTwo)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = sendWithHeader(router, "GET", "/receipts/"+id, "", "Authorization", admin)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", targetReceipt, "Authorization", readOnly)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = sendWithHeader(router, "GET", "/admin/api-keys", "", "Authorization", memberOne)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = sendWithHeader(router, "GET", "/admin/api-keys", "", "Authorization", admin)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = sendWithHeader(router, "GET", "/receipts/"+id, "", "Authorization", "Bearer not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
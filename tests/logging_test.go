@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/logging"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLoggedRouter(options logging.Options) (*gin.Engine, *bytes.Buffer) {
+	var out bytes.Buffer
+	receiptService := services.ReceiptServiceImpl{DB: db.NewInMemoryDB()}
+	receiptController := controllers.ReceiptController{ReceiptService: &receiptService}
+	router := gin.New()
+	router.Use(middleware.RequestLogger(logging.New(&out, options)))
+	router.POST("/receipts/process", receiptController.ProcessReceipt)
+	router.GET("/receipts/:id/points", receiptController.GetReceiptPoints)
+	return router, &out
+}
+
+// logLines returns the JSON log lines written to out
+func logLines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &decoded))
+		lines = append(lines, decoded)
+	}
+	return lines
+}
+
+/*
+Testing the request id
+the id of the X-Request-ID header is kept, an invalid or missing one is replaced by a generated one,
+it is echoed in the response and logged with every line of the request
+*/
+
+func TestRequestID(t *testing.T) {
+	router, out := newLoggedRouter(logging.Options{Level: slog.LevelInfo})
+
+	rr := sendWithHeader(router, "GET", "/receipts/missing/points", "", middleware.RequestIDHeader, "req-123")
+	assert.Equal(t, "req-123", rr.Header().Get(middleware.RequestIDHeader))
+	lines := logLines(t, out)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "req-123", lines[0]["requestId"])
+	assert.Equal(t, "WARN", lines[0]["level"])
+	assert.Equal(t, "/receipts/:id/points", lines[0]["route"])
+	assert.Equal(t, float64(http.StatusNotFound), lines[0]["status"])
+	assert.Contains(t, lines[0], "latencyMs")
+
+	rr = sendWithHeader(router, "GET", "/receipts/missing/points", "", middleware.RequestIDHeader, "bad id\n")
+	assert.NotEqual(t, "bad id\n", rr.Header().Get(middleware.RequestIDHeader))
+	assert.Len(t, rr.Header().Get(middleware.RequestIDHeader), 36)
+
+	out.Reset()
+	rr = sendWithHeader(router, "POST", "/receipts/process", targetReceipt, "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	lines = logLines(t, out)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "receipt processed", lines[0]["msg"])
+	assert.Equal(t, float64(12), lines[0]["points"])
+	assert.Equal(t, rr.Header().Get(middleware.RequestIDHeader), lines[0]["requestId"])
+	assert.Equal(t, lines[0]["requestId"], lines[1]["requestId"])
+}
+
+/*
+Testing the reasons of a rejected receipt and the redaction of the retailer and item text
+*/
+
+func TestValidationFailuresLogged(t *testing.T) {
+	invalidReceipt := `{
+		"retailer": "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": [{"shortDescription": "Mountain Dew 12PK!", "price": "6.4"}],
+		"total": "6.49"
+	}`
+
+	router, out := newLoggedRouter(logging.Options{Level: slog.LevelInfo, RedactPII: true})
+	rr := sendWithHeader(router, "POST", "/receipts/process", invalidReceipt, "", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	lines := logLines(t, out)
+	assert.Equal(t, "receipt rejected", lines[0]["msg"])
+	validation := lines[0]["validation"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"tag": "decimal", "value": "6.4"}, validation["Receipt.Items[0].Price"])
+	assert.Equal(t, map[string]interface{}{"tag": "alphanumeric", "value": logging.Redacted}, validation["Receipt.Items[0].ShortDescription"])
+	assert.NotContains(t, out.String(), "Mountain Dew")
+
+	out.Reset()
+	sendWithHeader(router, "POST", "/receipts/process", targetReceipt, "", "")
+	assert.Equal(t, logging.Redacted, logLines(t, out)[0]["retailer"])
+
+	router, out = newLoggedRouter(logging.Options{Level: slog.LevelInfo})
+	sendWithHeader(router, "POST", "/receipts/process", invalidReceipt, "", "")
+	assert.Contains(t, out.String(), "Mountain Dew 12PK!")
+}
+
+/*
+Testing the log levels
+*/
+
+func TestLogLevel(t *testing.T) {
+	level, err := logging.ParseLevel("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+	_, err = logging.ParseLevel("loud")
+	assert.Error(t, err)
+
+	router, out := newLoggedRouter(logging.Options{Level: slog.LevelWarn})
+	sendWithHeader(router, "POST", "/receipts/process", targetReceipt, "", "")
+	assert.Empty(t, out.String())
+	sendWithHeader(router, "GET", "/receipts/missing/points", "", "", "")
+	assert.Len(t, logLines(t, out), 1)
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+Testing the metrics of a request through the router
+the route label is the route as registered and the failed validations are counted by field and tag
+*/
+
+func TestRequestMetrics(t *testing.T) {
+	receiptService := services.ReceiptServiceImpl{DB: db.NewInMemoryDB()}
+	receiptController := controllers.ReceiptController{ReceiptService: &receiptService}
+	router := gin.New()
+	router.Use(middleware.Metrics())
+	router.POST("/receipts/process", receiptController.ProcessReceipt)
+	router.GET("/receipts/:id/points", receiptController.GetReceiptPoints)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	notFound := metrics.HTTPRequests.WithLabelValues("GET", "/receipts/:id/points", "404")
+	before := testutil.ToFloat64(notFound)
+	rr := sendWithHeader(router, "GET", "/receipts/missing/points", "", "", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(notFound))
+
+	invalidDate := metrics.ValidationFailures.WithLabelValues("purchaseDate", "receiptDate")
+	before = testutil.ToFloat64(invalidDate)
+	rr = sendWithHeader(router, "POST", "/receipts/process", `{
+		"retailer": "Target",
+		"purchaseDate": "2022-13-01",
+		"purchaseTime": "13:01",
+		"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+		"total": "6.49"
+	}`, "", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(invalidDate))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rr = httptest.NewRecorder()
+	serve(router, rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `http_requests_total{method="GET",route="/receipts/:id/points",status="404"}`)
+	assert.Contains(t, rr.Body.String(), "go_goroutines")
+}
+
+/*
+Testing the scoring metrics, the points of every rule and of the receipt
+and the latency of the store operations of an instrumented store, and of the store of the API keys
+*/
+
+func TestScoringAndStoreMetrics(t *testing.T) {
+	store := metrics.InstrumentStore(db.NewInMemoryDB())
+	receiptService := services.ReceiptServiceImpl{DB: store}
+
+	retailerName := metrics.RulePoints.WithLabelValues("retailerName")
+	processedBefore := testutil.ToFloat64(metrics.ReceiptsProcessed)
+	retailerNameBefore := testutil.ToFloat64(retailerName)
+
+	receiptService.AddNewReceipt(context.Background(), &models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	})
+	assert.Equal(t, processedBefore+1, testutil.ToFloat64(metrics.ReceiptsProcessed))
+	assert.Equal(t, retailerNameBefore+6, testutil.ToFloat64(retailerName))
+
+	store.GetReceipt(context.Background(), "missing")
+	assert.Contains(t, gatherStoreOperations(t), "*db.InMemoryDB/AddNewReceipt")
+	assert.Contains(t, gatherStoreOperations(t), "*db.InMemoryDB/GetReceipt")
+
+	apiKeyService := services.APIKeyServiceImpl{DB: metrics.InstrumentAPIKeyStore(db.NewInMemoryDB())}
+	_, _, err := apiKeyService.CreateAPIKey("Partner", models.DefaultTenant, 0)
+	assert.NoError(t, err)
+	assert.Contains(t, gatherStoreOperations(t), "*db.InMemoryDB/AddAPIKey")
+}
+
+// gatherStoreOperations returns the store and operation labels of the store latencies that were observed
+func gatherStoreOperations(t *testing.T) []string {
+	families, err := metrics.Registry.Gather()
+	assert.NoError(t, err)
+	operations := []string{}
+	for _, family := range families {
+		if family.GetName() != "store_operation_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			operations = append(operations, labels["store"]+"/"+labels["operation"])
+		}
+	}
+	return operations
+}
@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedResponse is a response served to a test, checked against the OpenAPI document once the tests ran
+type recordedResponse struct {
+	method      string
+	path        string
+	status      int
+	contentType string
+	body        []byte
+}
+
+var (
+	recordedLock sync.Mutex
+	recorded     []recordedResponse
+)
+
+// serve serves the request and records the response, so no controller response can drift from the document
+func serve(router http.Handler, rr *httptest.ResponseRecorder, req *http.Request) {
+	router.ServeHTTP(rr, req)
+	recordedLock.Lock()
+	defer recordedLock.Unlock()
+	recorded = append(recorded, recordedResponse{
+		method:      req.Method,
+		path:        req.URL.Path,
+		status:      rr.Code,
+		contentType: rr.Header().Get("Content-Type"),
+		body:        bytes.Clone(rr.Body.Bytes()),
+	})
+}
+
+/*
+TestMain runs the tests, then checks every response they were served against the OpenAPI document
+the responses of routes the document does not have, like the routes of the middleware tests, are not checked
+*/
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	document, err := openapi.Build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "building the OpenAPI document:", err)
+		os.Exit(1)
+	}
+	for _, response := range recorded {
+		if err := checkResponse(document, response); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s returned %d, which does not match the OpenAPI document: %v\n%s\n",
+				response.method, response.path, response.status, err, response.body)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// findOperation returns the operation of the request, the path with the fewest parameters wins, nil if no path matches
+func findOperation(document *openapi.Document, method string, path string) (*openapi.Operation, bool) {
+	segments := strings.Split(path, "/")
+	var operations map[string]*openapi.Operation
+	fewest := -1
+	for template, candidate := range document.Paths {
+		templateSegments := strings.Split(template, "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+		parameters := 0
+		for i, segment := range templateSegments {
+			if strings.HasPrefix(segment, "{") {
+				parameters++
+			} else if segment != segments[i] {
+				parameters = -1
+				break
+			}
+		}
+		if parameters >= 0 && (fewest < 0 || parameters < fewest) {
+			operations, fewest = candidate, parameters
+		}
+	}
+	if operations == nil {
+		return nil, false
+	}
+	return operations[strings.ToLower(method)], true
+}
+
+// checkResponse returns an error if the document does not describe the response
+func checkResponse(document *openapi.Document, response recordedResponse) error {
+	operation, found := findOperation(document, response.method, response.path)
+	if !found {
+		return nil
+	}
+	if operation == nil {
+		return fmt.Errorf("the method is not documented")
+	}
+	documented, ok := operation.Responses[strconv.Itoa(response.status)]
+	if !ok {
+		return fmt.Errorf("the status is not documented")
+	}
+	if len(documented.Content) == 0 {
+		if len(response.body) > 0 {
+			return fmt.Errorf("the response has a body, the document has none")
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(response.contentType)
+	if err != nil {
+		return fmt.Errorf("the content type %q: %w", response.contentType, err)
+	}
+	content, ok := documented.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("the content type %s is not documented", mediaType)
+	}
+	if mediaType != openapi.JSON {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(response.body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("the body is not JSON: %w", err)
+	}
+	return checkSchema(document, content.Schema, value, "body")
+}
+
+// checkSchema returns an error if the value does not match the schema, properties the schema does not have are errors too
+func checkSchema(document *openapi.Document, schema *openapi.Schema, value interface{}, at string) error {
+	if schema.Ref != "" {
+		resolved, ok := document.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unknown reference %s", at, schema.Ref)
+		}
+		return checkSchema(document, resolved, value, at)
+	}
+	if value == nil && schema.Nullable {
+		return nil
+	}
+	if value == nil {
+		return fmt.Errorf("%s: is null", at)
+	}
+
+	switch schema.Type {
+	case "":
+		// a schema without a type, any value
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: is not an object", at)
+		}
+		if schema.Properties == nil && schema.AdditionalProperties == nil {
+			// a free-form object, like the document itself
+			return nil
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: the required property %s is missing", at, name)
+			}
+		}
+		for name, property := range object {
+			propertySchema, ok := schema.Properties[name]
+			if !ok {
+				propertySchema = schema.AdditionalProperties
+			}
+			if propertySchema == nil {
+				return fmt.Errorf("%s: the property %s is not documented", at, name)
+			}
+			if err := checkSchema(document, propertySchema, property, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: is not an array", at)
+		}
+		if schema.MinItems != nil && len(array) < *schema.MinItems {
+			return fmt.Errorf("%s: has fewer than %d items", at, *schema.MinItems)
+		}
+		for i, item := range array {
+			if err := checkSchema(document, schema.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: is not a string", at)
+		}
+		return checkString(schema, text, at)
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: is not an integer", at)
+		}
+		integer, err := number.Int64()
+		if err != nil {
+			return fmt.Errorf("%s: is not an integer", at)
+		}
+		if schema.Minimum != nil && integer < int64(*schema.Minimum) {
+			return fmt.Errorf("%s: is less than %d", at, *schema.Minimum)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: is not a number", at)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: is not a boolean", at)
+		}
+	default:
+		return fmt.Errorf("%s: unknown type %q", at, schema.Type)
+	}
+	return nil
+}
+
+func checkString(schema *openapi.Schema, text string, at string) error {
+	if schema.Pattern != "" && !regexp.MustCompile(schema.Pattern).MatchString(text) {
+		return fmt.Errorf("%s: %q does not match %s", at, text, schema.Pattern)
+	}
+	if len(schema.Enum) > 0 && !contains(schema.Enum, text) {
+		return fmt.Errorf("%s: %q is not one of the enum", at, text)
+	}
+	if schema.MinLength != nil && utf8.RuneCountInString(text) < *schema.MinLength {
+		return fmt.Errorf("%s: is shorter than %d", at, *schema.MinLength)
+	}
+	if schema.MaxLength != nil && utf8.RuneCountInString(text) > *schema.MaxLength {
+		return fmt.Errorf("%s: is longer than %d", at, *schema.MaxLength)
+	}
+	layouts := map[string]string{"date-time": time.RFC3339Nano, "date": time.DateOnly}
+	if layout, ok := layouts[schema.Format]; ok {
+		if _, err := time.Parse(layout, text); err != nil {
+			return fmt.Errorf("%s: %q is not a %s", at, text, schema.Format)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Testing the OpenAPI document
+it is served at /openapi.json with every route, and the responses that do not match it are caught
+*/
+
+func TestOpenAPIDocument(t *testing.T) {
+	router := gin.New()
+	router.GET("/openapi.json", gin.WrapH(openapi.Handler()))
+	rr := sendWithHeader(router, "GET", "/openapi.json", "", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var document openapi.Document
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &document))
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+	for _, path := range []string{"/receipts/process", "/receipts/{id}/points", "/receipts/{id}", "/receipts/stream", "/retailers", "/retailers/{id}",
+		"/admin/api-keys", "/admin/api-keys/{id}", "/healthz", "/readyz", "/version", "/metrics", "/openapi.json"} {
+		assert.Contains(t, document.Paths, path)
+	}
+	item := document.Components.Schemas["Item"]
+	assert.Equal(t, `^[\w\s\-&]+$`, item.Properties["shortDescription"].Pattern)
+	assert.Equal(t, []string{"shortDescription", "price"}, item.Required)
+
+	jsonResponse := func(method string, path string, status int, body string) recordedResponse {
+		return recordedResponse{method, path, status, "application/json; charset=utf-8", []byte(body)}
+	}
+	assert.NoError(t, checkResponse(&document, jsonResponse("GET", "/receipts/1/points", http.StatusOK, `{"points": 28}`)))
+	assert.NoError(t, checkResponse(&document, jsonResponse("GET", "/unknown", http.StatusTeapot, `{}`)))
+	assert.ErrorContains(t, checkResponse(&document, jsonResponse("GET", "/receipts/1/points", http.StatusOK, `{"points": "28"}`)), "not an integer")
+	assert.ErrorContains(t, checkResponse(&document, jsonResponse("GET", "/receipts/1/points", http.StatusTeapot, `{}`)), "status is not documented")
+	assert.ErrorContains(t, checkResponse(&document, jsonResponse("POST", "/receipts/process", http.StatusOK, `{"id": "1", "points": 28}`)), "points is not documented")
+	assert.ErrorContains(t, checkResponse(&document, jsonResponse("GET", "/receipts/1", http.StatusOK, `{"id": "1", "retailer": "Target"}`)), "purchaseDate is missing")
+	assert.ErrorContains(t, checkResponse(&document, jsonResponse("DELETE", "/retailers/1", http.StatusNoContent, `{}`)), "has a body")
+	assert.ErrorContains(t, checkResponse(&document, recordedResponse{"GET", "/retailers", http.StatusOK, "text/plain", nil}), "text/plain is not documented")
+}
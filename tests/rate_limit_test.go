@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock the tests move forward by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func newRateLimitedRouter(limiter *middleware.RateLimiter, apiKeyService *services.APIKeyServiceImpl) *gin.Engine {
+	authenticator := middleware.Authenticator{APIKeys: apiKeyService}
+	processed := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"id": "1"}) }
+	points := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"points": 0}) }
+
+	router := gin.New()
+	routes := router.Group("/receipts", limiter.LimitIP(), authenticator.Authenticate(), limiter.LimitKey())
+	routes.POST("/process", middleware.DailyQuota(apiKeyService), processed)
+	routes.GET("/:id/points", points)
+	return router
+}
+
+/*
+Testing the token bucket of an API key
+the burst is allowed, then 429 with Retry-After until the bucket refills
+*/
+
+func TestRateLimitPerKey(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := &middleware.RateLimiter{
+		Routes: map[string]middleware.RouteLimits{
+			"POST /receipts/process": {PerKey: middleware.Limit{RequestsPerSecond: 0.5, Burst: 2}},
+		},
+		Now: clock.Now,
+	}
+	apiKeyService := &services.APIKeyServiceImpl{DB: db.NewInMemoryDB()}
+	router := newRateLimitedRouter(limiter, apiKeyService)
+	_, keyA, _ := apiKeyService.CreateAPIKey("Partner A", models.DefaultTenant, 0)
+	_, keyB, _ := apiKeyService.CreateAPIKey("Partner B", models.DefaultTenant, 0)
+
+	rr := sendWithHeader(router, "POST", "/receipts/process", "", middleware.APIKeyHeader, keyA)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Reset"))
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", "", middleware.APIKeyHeader, keyA)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", "", middleware.APIKeyHeader, keyA)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+
+	// another key and another route have their own buckets, the default limits nothing
+	rr = sendWithHeader(router, "POST", "/receipts/process", "", middleware.APIKeyHeader, keyB)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = sendWithHeader(router, "GET", "/receipts/1/points", "", middleware.APIKeyHeader, keyA)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+
+	clock.now = clock.now.Add(2 * time.Second)
+	rr = sendWithHeader(router, "POST", "/receipts/process", "", middleware.APIKeyHeader, keyA)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+/*
+Testing the token bucket of a client IP
+it is shared by every API key of the IP and a rejected request takes no token from the other bucket
+*/
+
+func TestRateLimitPerIP(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := &middleware.RateLimiter{
+		Default: middleware.RouteLimits{
+			PerKey: middleware.Limit{RequestsPerSecond: 1, Burst: 2},
+			PerIP:  middleware.Limit{RequestsPerSecond: 1, Burst: 3},
+		},
+		Now: clock.Now,
+	}
+	apiKeyService := &services.APIKeyServiceImpl{DB: db.NewInMemoryDB()}
+	router := newRateLimitedRouter(limiter, apiKeyService)
+	_, keyA, _ := apiKeyService.CreateAPIKey("Partner A", models.DefaultTenant, 0)
+	_, keyB, _ := apiKeyService.CreateAPIKey("Partner B", models.DefaultTenant, 0)
+
+	codes := []int{}
+	for _, key := range []string{keyA, keyA, keyA, keyB, keyB} {
+		rr := sendWithHeader(router, "GET", "/receipts/1/points", "", middleware.APIKeyHeader, key)
+		codes = append(codes, rr.Code)
+	}
+	assert.Equal(t, []int{200, 200, 429, 200, 429}, codes)
+
+	clock.now = clock.now.Add(time.Second)
+	rr := sendWithHeader(router, "GET", "/receipts/1/points", "", middleware.APIKeyHeader, keyB)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+}
+
+/*
+Testing that the requests with invalid credentials are limited per client IP
+the bucket of the client IP is taken from before the credentials are checked
+*/
+
+func TestRateLimitInvalidCredentials(t *testing.T) {
+	limiter := &middleware.RateLimiter{
+		Default: middleware.RouteLimits{PerIP: middleware.Limit{RequestsPerSecond: 1, Burst: 2}},
+		Now:     (&fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}).Now,
+	}
+	router := newRateLimitedRouter(limiter, &services.APIKeyServiceImpl{DB: db.NewInMemoryDB()})
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		rr := sendWithHeader(router, "GET", "/receipts/1/points", "", middleware.APIKeyHeader, "not-a-key")
+		codes = append(codes, rr.Code)
+	}
+	assert.Equal(t, []int{401, 401, 429}, codes)
+}
+
+/*
+Testing the daily quota of an API key
+the quota of the key wins over the default, it is used up for the day and starts again the next UTC day
+*/
+
+func TestDailyQuota(t *testing.T) {
+	database := db.NewInMemoryDB()
+	apiKeyService := &services.APIKeyServiceImpl{DB: database, DefaultDailyQuota: 5}
+	apiKey, _, _ := apiKeyService.CreateAPIKey("Partner", models.DefaultTenant, 2)
+	otherKey, _, _ := apiKeyService.CreateAPIKey("Other", models.DefaultTenant, 0)
+	day := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+
+	quota, ok := apiKeyService.UseDailyQuota(apiKey.ID, day)
+	assert.True(t, ok)
+	assert.Equal(t, services.Quota{Limit: 2, Remaining: 1, Reset: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, quota)
+	_, ok = apiKeyService.UseDailyQuota(apiKey.ID, day)
+	assert.True(t, ok)
+	quota, ok = apiKeyService.UseDailyQuota(apiKey.ID, day)
+	assert.False(t, ok)
+	assert.Equal(t, 0, quota.Remaining)
+
+	quota, ok = apiKeyService.UseDailyQuota(otherKey.ID, day)
+	assert.True(t, ok)
+	assert.Equal(t, 5, quota.Limit)
+
+	quota, ok = apiKeyService.UseDailyQuota(apiKey.ID, day.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, 1, quota.Remaining)
+}
+
+/*
+Testing the 429 of the daily quota middleware and its headers
+*/
+
+func TestDailyQuotaMiddleware(t *testing.T) {
+	apiKeyService := &services.APIKeyServiceImpl{DB: db.NewInMemoryDB()}
+	router := newRateLimitedRouter(&middleware.RateLimiter{}, apiKeyService)
+	_, key, _ := apiKeyService.CreateAPIKey("Partner", models.DefaultTenant, 1)
+
+	rr := sendWithHeader(router, "POST", "/receipts/process", "", middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get(middleware.DailyQuotaLimitHeader))
+	assert.Equal(t, "0", rr.Header().Get(middleware.DailyQuotaRemainingHeader))
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", "", middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	rr = sendWithHeader(router, "GET", "/receipts/1/points", "", middleware.APIKeyHeader, key)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+/*
+Testing the rate limits file
+*/
+
+func TestLoadRateLimits(t *testing.T) {
+	limiter, err := middleware.LoadRateLimits("../ratelimits.json")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, limiter.Routes["POST /receipts/process"].PerKey.Burst)
+
+	path := writeTestFile(t, "ratelimits.json", []byte(`{"default": {"perIP": {"requestsPerSecond": -1, "burst": 1}}}`))
+	_, err = middleware.LoadRateLimits(path)
+	assert.Error(t, err)
+}
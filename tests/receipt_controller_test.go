@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
     "encoding/json"
     "net/http"
     "net/http/httptest"
@@ -19,16 +20,34 @@ type MockReceiptService struct {
 	mock.Mock
 }
 
-func (m *MockReceiptService) AddNewReceipt(receipt *models.Receipt) (string, int64) {
+func (m *MockReceiptService) AddNewReceipt(ctx context.Context, receipt *models.Receipt) (string, int64) {
 	args := m.Called(receipt)
 	return args.String(0), args.Get(1).(int64)
 }
 
-func (m *MockReceiptService) GetReceipt(id string) (int64, bool) {
+func (m *MockReceiptService) GetReceipt(ctx context.Context, id string) (int64, bool) {
 	args := m.Called(id)
 	return args.Get(0).(int64), args.Bool(1)
 }
 
+func (m *MockReceiptService) GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool) {
+	args := m.Called(id)
+	receipt, _ := args.Get(0).(*models.Receipt)
+	return receipt, args.Bool(1)
+}
+
+func (m *MockReceiptService) GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt {
+	args := m.Called(ids)
+	receipts, _ := args.Get(0).(map[string]*models.Receipt)
+	return receipts
+}
+
+func (m *MockReceiptService) ListReceipts(ctx context.Context) []models.Receipt {
+	args := m.Called()
+	receipts, _ := args.Get(0).([]models.Receipt)
+	return receipts
+}
+
 
 func TestProcessReceiptValidReceipt(t *testing.T) {
     router := gin.Default()
@@ -60,7 +79,7 @@ func TestProcessReceiptValidReceipt(t *testing.T) {
 
     rr := httptest.NewRecorder()
 
-    router.ServeHTTP(rr, req)
+    serve(router, rr, req)
 
     assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -99,7 +118,7 @@ func TestProcessReceiptInvalidRetailer(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
     err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -136,7 +155,7 @@ func TestProcessReceiptInvalidPurchaseDate(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -177,7 +196,7 @@ func TestProcessReceiptInvalidDateFormat(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -214,7 +233,7 @@ func TestProcessReceiptInvalidPurchaseTime(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -254,7 +273,7 @@ func TestProcessReceiptInvalidTimeFormat(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -291,7 +310,7 @@ func TestProcessReceiptInvalidTotal(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -331,7 +350,7 @@ func TestProcessReceiptInvalidTotalFormat(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -365,7 +384,7 @@ func TestProcessReceiptInvalidItems(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -402,7 +421,7 @@ func TestProcessReceiptInvalidShortDescription(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -442,7 +461,7 @@ func TestProcessReceiptInvalidItemPriceFormat(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -468,7 +487,7 @@ func TestGetReceiptIdIsNotFound(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]string
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -494,10 +513,135 @@ func TestGetReceiptIdIsFound(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	router.ServeHTTP(rr, req)
+	serve(router, rr, req)
 	var response map[string]int64
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, int64(100), response["points"])
 }
+
+/*
+Testing for 200 success code when the receipt id is found
+Also testing that both the canonical and the submitted retailer are returned
+*/
+
+func TestGetReceiptDetailsIsFound(t *testing.T) {
+	router := gin.Default()
+	mockService := MockReceiptService{}
+	mockService.On("GetReceiptDetails", "1").Return(&models.Receipt{
+		ID: "1",
+		Retailer: "M&M Corner Market",
+		SubmittedRetailer: "M & M CORNER MKT",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []models.Item{{ShortDescription: "Gatorade", Price: "2.25"}},
+		Total: "2.25",
+		Points: int64(109),
+	}, true)
+
+	receiptController := controllers.ReceiptController{ReceiptService: &mockService}
+
+	router.GET("/receipts/:id", receiptController.GetReceipt)
+
+	req := httptest.NewRequest("GET", "http://example.com/receipts/1", nil)
+
+	rr := httptest.NewRecorder()
+
+	serve(router, rr, req)
+	var response models.Receipt
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "M&M Corner Market", response.Retailer)
+	assert.Equal(t, "M & M CORNER MKT", response.SubmittedRetailer)
+	assert.Equal(t, int64(109), response.Points)
+}
+
+/*
+Testing for 404 error code when the receipt id is not found
+*/
+
+func TestGetReceiptDetailsIsNotFound(t *testing.T) {
+	router := gin.Default()
+	mockService := MockReceiptService{}
+	mockService.On("GetReceiptDetails", "1").Return(nil, false)
+
+	receiptController := controllers.ReceiptController{ReceiptService: &mockService}
+
+	router.GET("/receipts/:id", receiptController.GetReceipt)
+
+	req := httptest.NewRequest("GET", "http://example.com/receipts/1", nil)
+
+	rr := httptest.NewRecorder()
+
+	serve(router, rr, req)
+	var response map[string]string
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "No receipt found for that id", response["description"])
+}
+
+/*
+Testing the arithmetic consistency of quantity, unit price, subtotal, discounts and tax
+a consistent receipt returns 200, every inconsistent one returns 400
+*/
+
+func TestProcessReceiptArithmetic(t *testing.T) {
+	validReceipt := func() models.Receipt {
+		return models.Receipt{
+			Retailer: "Test Retailer",
+			PurchaseDate: "2023-01-01",
+			PurchaseTime: "12:00",
+			Items: []models.Item{
+				{ShortDescription: "Item 1", Price: "10.00", Quantity: "4", UnitPrice: "2.50"},
+				{ShortDescription: "Bananas", Price: "1.48", Quantity: "1.235", UnitPrice: "1.20"},
+			},
+			Subtotal: "11.48",
+			Discounts: []models.Discount{{Description: "Coupon", Amount: "1.00"}},
+			Tax: "0.84",
+			Total: "11.32",
+		}
+	}
+
+	wrongSubtotal := validReceipt()
+	wrongSubtotal.Subtotal = "11.50"
+	wrongTotal := validReceipt()
+	wrongTotal.Total = "12.32"
+	wrongPrice := validReceipt()
+	wrongPrice.Items[0].Quantity = "3"
+	wrongQuantity := validReceipt()
+	wrongQuantity.Items[0].Quantity = "0"
+	taxWithoutSubtotal := validReceipt()
+	taxWithoutSubtotal.Subtotal = ""
+	taxWithoutSubtotal.Total = "11.33"
+
+	cases := []struct {
+		receipt models.Receipt
+		status  int
+	}{
+		{validReceipt(), http.StatusOK},
+		{wrongSubtotal, http.StatusBadRequest},
+		{wrongTotal, http.StatusBadRequest},
+		{wrongPrice, http.StatusBadRequest},
+		{wrongQuantity, http.StatusBadRequest},
+		{taxWithoutSubtotal, http.StatusBadRequest},
+	}
+
+	for _, testCase := range cases {
+		router := gin.Default()
+		mockService := MockReceiptService{}
+		mockService.On("AddNewReceipt", mock.Anything).Return("1", int64(100))
+		receiptController := controllers.ReceiptController{ReceiptService: &mockService}
+		router.POST("/receipts/process", receiptController.ProcessReceipt)
+
+		jsonBody, _ := json.Marshal(testCase.receipt)
+		req := httptest.NewRequest("POST", "http://example.com/receipts/process", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		serve(router, rr, req)
+		assert.Equal(t, testCase.status, rr.Code, string(jsonBody))
+	}
+}
@@ -1,7 +1,10 @@
 package tests
 
 import (
+	"context"
 	"testing"
+	"time"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
 	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
 
@@ -13,16 +16,40 @@ type MockDB struct {
 	mock.Mock
 }
 
-func (m *MockDB) GetReceipt(id string) (int64, bool) {
+func (m *MockDB) GetReceipt(ctx context.Context, id string) (int64, bool) {
 	args := m.Called(id)
 	return args.Get(0).(int64), args.Bool(1)
 }
 
-func (m *MockDB) AddNewReceipt(points int64) string {
-	args := m.Called(points)
+func (m *MockDB) GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool) {
+	args := m.Called(id)
+	receipt, _ := args.Get(0).(*models.Receipt)
+	return receipt, args.Bool(1)
+}
+
+func (m *MockDB) AddNewReceipt(ctx context.Context, receipt *models.Receipt) string {
+	args := m.Called(receipt)
 	return args.String(0)
 }
 
+func (m *MockDB) GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt {
+	args := m.Called(ids)
+	receipts, _ := args.Get(0).(map[string]*models.Receipt)
+	return receipts
+}
+
+func (m *MockDB) ListReceipts(ctx context.Context) []models.Receipt {
+	args := m.Called()
+	receipts, _ := args.Get(0).([]models.Receipt)
+	return receipts
+}
+
+func (m *MockDB) MemberPoints(ctx context.Context, memberID string) int64 {
+	args := m.Called(memberID)
+	points, _ := args.Get(0).(int64)
+	return points
+}
+
 /*
 	testing whether the service is working as expected
 	when a new receipt is added
@@ -104,7 +131,7 @@ func TestAddNewReceiptTargetExample(t *testing.T) {
 		DB: &dbMock,
 	}
 
-	id, points := receiptService.AddNewReceipt(&receipt)
+	id, points := receiptService.AddNewReceipt(context.Background(), &receipt)
 	assert.Equal(int64(28), points)
 	assert.Equal("1", id)
 }
@@ -176,7 +203,7 @@ func TestAddNewReceiptMandMExample(t *testing.T) {
 		DB: &dbMock,
 	}
 
-	id, points := receiptService.AddNewReceipt(&receipt)
+	id, points := receiptService.AddNewReceipt(context.Background(), &receipt)
 	assert.Equal(int64(109), points)
 	assert.Equal("1", id)
 }
@@ -190,7 +217,7 @@ func TestGetReceipt(t *testing.T) {
 		DB: dbMock,
 	}
 
-	points, ok := receiptService.GetReceipt("1")
+	points, ok := receiptService.GetReceipt(context.Background(), "1")
 
 	assert.Equal(t, int64(100), points)
 	assert.True(t, ok)
@@ -205,7 +232,7 @@ func TestGetReceiptNotFound(t *testing.T) {
 		DB: dbMock,
 	}
 
-	points, ok := receiptService.GetReceipt("1")
+	points, ok := receiptService.GetReceipt(context.Background(), "1")
 
 	assert.Equal(t, int64(0), points)
 	assert.False(t, ok)
@@ -337,3 +364,59 @@ func TestPointsForReceiptPurchaseTime(t *testing.T) {
 
 
 
+
+/*
+testing points for items counting quantities
+3 + 1 (no quantity) + 1 (weighed) = 5 units, 2 pairs @ 5 points each
+*/
+
+func TestPointsForItemQuantities(t *testing.T) {
+	assert := assert.New(t)
+
+	items := []models.Item{
+		{ShortDescription: "Gatorade", Price: "6.75", Quantity: "3", UnitPrice: "2.25"},
+		{ShortDescription: "Gatorade", Price: "2.25"},
+		{ShortDescription: "Bananas", Price: "1.48", Quantity: "1.235", UnitPrice: "1.20"},
+	}
+
+	assert.Equal(int64(5), services.PointsForItems(items))
+	assert.Equal(int64(10), services.PointsForItemQuantities(items))
+}
+
+/*
+testing that the store keeps its own copy of the receipts
+changing the discounts, the items or the timestamps of a receipt that was added or returned does not change the stored receipt
+*/
+
+func TestStoredReceiptIsCopied(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := db.NewInMemoryDB()
+
+	createdAt := time.Date(2022, 1, 1, 13, 1, 0, 0, time.UTC)
+	submittedAt := createdAt
+	receipt := &models.Receipt{
+		Retailer:  "Target",
+		Items:     []models.Item{{ShortDescription: "Gatorade", Price: "2.25"}},
+		Discounts: []models.Discount{{Description: "Coupon", Amount: "1.00"}},
+		Total:     "1.25",
+		CreatedAt: &submittedAt,
+	}
+	id := store.AddNewReceipt(ctx, receipt)
+	receipt.Discounts[0].Amount = "2.00"
+	*receipt.CreatedAt = createdAt.Add(time.Hour)
+
+	returned, ok := store.GetReceiptDetails(ctx, id)
+	assert.True(ok)
+	returned.Discounts[0].Amount = "3.00"
+	returned.Discounts = append(returned.Discounts, models.Discount{Description: "Extra", Amount: "1.00"})
+	returned.Items[0].Price = "9.99"
+	*returned.CreatedAt = createdAt.Add(2 * time.Hour)
+	listed := store.ListReceipts(ctx)
+	listed[0].Discounts[0].Description = "Changed"
+
+	stored, _ := store.GetReceiptDetails(ctx, id)
+	assert.Equal([]models.Discount{{Description: "Coupon", Amount: "1.00"}}, stored.Discounts)
+	assert.Equal("2.25", stored.Items[0].Price)
+	assert.Equal(createdAt, *stored.CreatedAt)
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRetailerRouter() *gin.Engine {
+	router := gin.Default()
+	retailerService := services.RetailerServiceImpl{DB: db.NewInMemoryDB()}
+	retailerController := controllers.RetailerController{RetailerService: &retailerService}
+
+	router.GET("/retailers", retailerController.GetAllRetailers)
+	router.POST("/retailers", retailerController.AddRetailer)
+	router.GET("/retailers/:id", retailerController.GetRetailer)
+	router.PUT("/retailers/:id", retailerController.UpdateRetailer)
+	router.DELETE("/retailers/:id", retailerController.DeleteRetailer)
+	return router
+}
+
+func sendJSON(router *gin.Engine, method string, url string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	serve(router, rr, req)
+	return rr
+}
+
+/*
+Testing the create, read, update and delete of a retailer
+*/
+
+func TestRetailerCrud(t *testing.T) {
+	router := newRetailerRouter()
+
+	rr := sendJSON(router, "POST", "/retailers", `{"name": "M&M Corner Market", "aliases": ["M & M CORNER MKT"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	id := created["id"]
+
+	rr = sendJSON(router, "GET", "/retailers/"+id, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var retailer models.Retailer
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &retailer))
+	assert.Equal(t, []string{"M & M CORNER MKT"}, retailer.Aliases)
+
+	rr = sendJSON(router, "PUT", "/retailers/"+id, `{"name": "M&M Corner Market", "aliases": ["MM Market"]}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "MM Market")
+
+	rr = sendJSON(router, "GET", "/retailers", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "MM Market")
+
+	rr = sendJSON(router, "DELETE", "/retailers/"+id, "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = sendJSON(router, "GET", "/retailers/"+id, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+/*
+Testing for 400 when the retailer is invalid and 409 when an alias is taken
+*/
+
+func TestAddRetailerInvalidAndConflict(t *testing.T) {
+	router := newRetailerRouter()
+
+	rr := sendJSON(router, "POST", "/retailers", `{"name": ""}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = sendJSON(router, "POST", "/retailers", `{"name": "Target", "aliases": ["Tgt!"]}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = sendJSON(router, "POST", "/retailers", `{"name": "Target", "aliases": ["Tgt"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = sendJSON(router, "POST", "/retailers", `{"name": "T G T"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "The retailer name or an alias is already registered", response["description"])
+
+	rr = sendJSON(router, "PUT", "/retailers/missing", `{"name": "Walmart"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
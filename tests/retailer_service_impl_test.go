@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+testing the normalized key of retailer names
+*/
+
+func TestNormalizeRetailerName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("MMCORNERMARKET", models.NormalizeRetailerName("M&M Corner Market"))
+	assert.Equal("MMCORNERMARKET", models.NormalizeRetailerName("  m & m corner-market "))
+	assert.Equal("", models.NormalizeRetailerName("&"))
+}
+
+/*
+testing that a receipt submitted with an alias is stored with the canonical retailer
+and keeps the submitted retailer name
+the points for the retailer name are calculated from the canonical name
+*/
+
+func TestAddNewReceiptNormalizesRetailer(t *testing.T) {
+	assert := assert.New(t)
+	database := db.NewInMemoryDB()
+	retailerService := services.RetailerServiceImpl{DB: database}
+	receiptService := services.ReceiptServiceImpl{DB: database, Retailers: &retailerService}
+
+	retailerId, err := retailerService.AddRetailer(&models.Retailer{
+		Name:    "M&M Corner Market",
+		Aliases: []string{"M & M CORNER MKT"},
+	})
+	assert.NoError(err)
+
+	id, points := receiptService.AddNewReceipt(context.Background(), &models.Receipt{
+		Retailer:     "m & m corner mkt",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+		Total: "9.00",
+	})
+	assert.Equal(int64(109), points)
+
+	receipt, ok := receiptService.GetReceiptDetails(context.Background(), id)
+	assert.True(ok)
+	assert.Equal("M&M Corner Market", receipt.Retailer)
+	assert.Equal("m & m corner mkt", receipt.SubmittedRetailer)
+	assert.Equal(retailerId, receipt.RetailerID)
+	assert.Equal(int64(109), receipt.Points)
+}
+
+/*
+testing that a retailer which is not registered is kept as submitted
+*/
+
+func TestAddNewReceiptUnknownRetailer(t *testing.T) {
+	assert := assert.New(t)
+	database := db.NewInMemoryDB()
+	retailerService := services.RetailerServiceImpl{DB: database}
+	receiptService := services.ReceiptServiceImpl{DB: database, Retailers: &retailerService}
+
+	id, _ := receiptService.AddNewReceipt(context.Background(), &models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	})
+
+	receipt, ok := receiptService.GetReceiptDetails(context.Background(), id)
+	assert.True(ok)
+	assert.Equal("Target", receipt.Retailer)
+	assert.Equal("Target", receipt.SubmittedRetailer)
+	assert.Equal("", receipt.RetailerID)
+}
+
+/*
+testing that names and aliases cannot be shared between retailers
+and that updating and deleting a retailer updates the aliases it resolves
+*/
+
+func TestRetailerAliases(t *testing.T) {
+	assert := assert.New(t)
+	retailerService := services.RetailerServiceImpl{DB: db.NewInMemoryDB()}
+
+	id, err := retailerService.AddRetailer(&models.Retailer{Name: "Target", Aliases: []string{"Target Store 1234"}})
+	assert.NoError(err)
+
+	_, err = retailerService.AddRetailer(&models.Retailer{Name: "TARGET"})
+	assert.ErrorIs(err, db.ErrConflict)
+
+	retailer, ok := retailerService.ResolveRetailer("target store-1234")
+	assert.True(ok)
+	assert.Equal(id, retailer.ID)
+
+	err = retailerService.UpdateRetailer(&models.Retailer{ID: id, Name: "Target", Aliases: []string{"Tgt"}})
+	assert.NoError(err)
+	_, ok = retailerService.ResolveRetailer("Target Store 1234")
+	assert.False(ok)
+	_, ok = retailerService.ResolveRetailer("TGT")
+	assert.True(ok)
+
+	err = retailerService.UpdateRetailer(&models.Retailer{ID: "missing", Name: "Walmart"})
+	assert.ErrorIs(err, db.ErrNotFound)
+
+	assert.True(retailerService.DeleteRetailer(id))
+	_, ok = retailerService.ResolveRetailer("Target")
+	assert.False(ok)
+	assert.Empty(retailerService.GetAllRetailers())
+}
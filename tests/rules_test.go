@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+testing the item classifier of the rules file shipped with the repository
+*/
+
+func TestCategorizeWithRulesFile(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := services.LoadRuleSet("../rules.json")
+	assert.NoError(err)
+
+	assert.Equal("beverages", rules.Categorize("Mountain Dew 12PK"))
+	assert.Equal("beverages", rules.Categorize("Gatorade"))
+	assert.Equal("dairy", rules.Categorize("  2% Milk  "))
+	assert.Equal("produce", rules.Categorize("Bananas"))
+	assert.Equal("produce", rules.Categorize("ORGANIC KALE"))
+	assert.Equal("", rules.Categorize("Paper Towels"))
+	assert.Equal("", rules.Categorize("Teapot"))
+}
+
+/*
+testing that invalid rules files are rejected with an error
+*/
+
+func TestLoadRuleSetInvalid(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	write := func(content string) string {
+		path := filepath.Join(dir, "rules.json")
+		assert.NoError(os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	_, err := services.LoadRuleSet(filepath.Join(dir, "missing.json"))
+	assert.Error(err)
+
+	_, err = services.LoadRuleSet(write(`{"categories": [{"name": "dairy", "patterns": ["(milk"]}]}`))
+	assert.Error(err)
+
+	_, err = services.LoadRuleSet(write(`{"categories": [{"name": "dairy", "keywords": ["milk"]}], "categoryBonuses": [{"category": "produce", "pointsPerItem": 5}]}`))
+	assert.Error(err)
+}
+
+/*
+testing points for item categories
+*/
+
+func TestPointsForItemCategories(t *testing.T) {
+	assert := assert.New(t)
+
+	points := services.PointsForItemCategories([]models.Item{
+		{ShortDescription: "Bananas", Price: "1.00", Category: "produce"},
+		{ShortDescription: "Apples", Price: "2.00", Category: "produce"},
+		{ShortDescription: "Milk", Price: "3.00", Category: "dairy"},
+		{ShortDescription: "Paper Towels", Price: "4.00"},
+	}, []services.CategoryBonus{{Category: "produce", PointsPerItem: 5}}, false)
+
+	assert.Equal(int64(10), points)
+}
+
+/*
+testing that the categories are stored with the items and the bonuses are added to the points
+"Target" with 3 items, odd day, before 2pm
+	6 points - retailer name
+	5 points - 1 pair of items
+	0 points - no item description has a length that is a multiple of 3
+	6 points - purchase day is odd
+	10 points - 2 produce items @ 5 points each
+*/
+
+func TestAddNewReceiptWithCategories(t *testing.T) {
+	assert := assert.New(t)
+	rules, err := services.LoadRuleSet("../rules.json")
+	assert.NoError(err)
+
+	receiptService := services.ReceiptServiceImpl{DB: db.NewInMemoryDB(), Rules: rules}
+
+	id, points := receiptService.AddNewReceipt(context.Background(), &models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []models.Item{
+			{ShortDescription: "Bananas", Price: "1.20"},
+			{ShortDescription: "Spinach", Price: "2.10"},
+			{ShortDescription: "Whole Milk", Price: "3.35", Category: "produce"},
+		},
+		Total: "6.65",
+	})
+	assert.Equal(int64(27), points)
+
+	receipt, ok := receiptService.GetReceiptDetails(context.Background(), id)
+	assert.True(ok)
+	assert.Equal("produce", receipt.Items[0].Category)
+	assert.Equal("produce", receipt.Items[1].Category)
+	assert.Equal("dairy", receipt.Items[2].Category)
+}
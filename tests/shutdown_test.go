@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/httpserver"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/metrics"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+// runSlowServer runs a server whose /slow requests wait until release is closed, and returns its address
+func runSlowServer(t *testing.T, ctx context.Context, release chan struct{}, shutdown httpserver.Shutdown) (string, chan error) {
+	router := gin.New()
+	router.GET("/slow", func(c *gin.Context) {
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := httpserver.New(router, httpserver.Options{ReadHeaderTimeout: time.Second})
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- httpserver.Run(ctx, server, listener, shutdown)
+	}()
+	return "http://" + listener.Addr().String(), stopped
+}
+
+/*
+Testing the graceful shutdown
+the request in flight when the server is asked to stop finishes, readiness fails before the drain,
+new connections are refused and the stores are closed after the drain
+*/
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	steps := make(chan string, 2)
+	store := db.NewInMemoryDB()
+	ctx, stop := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	addr, stopped := runSlowServer(t, ctx, release, httpserver.Shutdown{
+		BeforeDrain: func() { steps <- "not ready" },
+		Timeout:     5 * time.Second,
+		Close: []func(ctx context.Context) error{func(ctx context.Context) error {
+			steps <- "store closed"
+			return store.Close(ctx)
+		}},
+	})
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := http.Get(addr + "/slow")
+		assert.NoError(t, err)
+		responses <- response
+	}()
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	assert.Equal(t, "not ready", <-steps)
+	time.Sleep(100 * time.Millisecond)
+	_, err := http.Get(addr + "/slow")
+	assert.Error(t, err)
+
+	close(release)
+	response := <-responses
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response.Body.Close()
+	assert.NoError(t, <-stopped)
+	assert.Equal(t, "store closed", <-steps)
+	assert.ErrorIs(t, store.Ping(context.Background()), db.ErrClosed)
+}
+
+/*
+Testing a request that does not finish within the shutdown timeout
+the server gives up on it and the stores are still closed
+*/
+
+func TestShutdownTimeout(t *testing.T) {
+	closed := make(chan bool, 1)
+	ctx, stop := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	addr, stopped := runSlowServer(t, ctx, release, httpserver.Shutdown{
+		Timeout: 100 * time.Millisecond,
+		Close: []func(ctx context.Context) error{func(ctx context.Context) error {
+			closed <- true
+			return nil
+		}},
+	})
+
+	go http.Get(addr + "/slow")
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	err := <-stopped
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "draining requests")
+	assert.True(t, <-closed)
+}
+
+/*
+Testing closing the stores of the tenants through the metrics and tracing wrappers
+*/
+
+func TestTenantsClose(t *testing.T) {
+	tenants := &services.Tenants{NewStore: func(string) db.TenantStore {
+		return tracing.TraceStore(metrics.InstrumentStore(db.NewInMemoryDB()))
+	}}
+	tenants.For("tenant-a")
+	tenants.For("tenant-b")
+	assert.NoError(t, tenants.Ping(context.Background()))
+
+	assert.NoError(t, tenants.Close(context.Background()))
+	assert.ErrorIs(t, tenants.Ping(context.Background()), db.ErrClosed)
+}
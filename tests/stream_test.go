@@ -0,0 +1,281 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStreamRouter(t *testing.T, feed *services.ReceiptFeed, writeTimeout time.Duration) *gin.Engine {
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{HMACSecretFile: writeTestFile(t, "secret", []byte(testHMACSecret))})
+	assert.NoError(t, err)
+	tenants := &services.Tenants{Feed: feed}
+	receiptController := controllers.ReceiptController{Tenants: tenants}
+	streamController := controllers.StreamController{Feed: feed, Heartbeat: 20 * time.Millisecond, WriteTimeout: writeTimeout}
+	router := gin.New()
+	routes := router.Group("", (&middleware.Authenticator{JWT: verifier, AdminToken: testAdminToken}).Authenticate(), middleware.Tenant())
+	routes.POST("/receipts/process", receiptController.ProcessReceipt)
+	routes.GET("/receipts/stream", streamController.StreamReceipts)
+	return router
+}
+
+// streamEvent is an event read from a stream
+type streamEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openStream opens the stream of the URL and returns its events, the channel is closed when the stream ends
+func openStream(t *testing.T, url string, headers map[string]string) <-chan streamEvent {
+	request, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+	for header, value := range headers {
+		request.Header.Set(header, value)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	events := make(chan streamEvent, 100)
+	go func() {
+		defer close(events)
+		var event streamEvent
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ":")
+			switch field {
+			case "id":
+				event.id = value
+			case "event":
+				event.event = value
+			case "data":
+				event.data += value
+			case "":
+				if value == "" && event.event != "" {
+					events <- event
+					event = streamEvent{}
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// nextReceipt returns the next receipt of the stream, failing when there is none within a second
+func nextReceipt(t *testing.T, events <-chan streamEvent) (string, models.StreamedReceipt) {
+	var receipt models.StreamedReceipt
+	select {
+	case event, ok := <-events:
+		if !assert.True(t, ok, "the stream ended") || !assert.Equal(t, models.EventReceiptScored, event.event) {
+			return "", receipt
+		}
+		assert.NoError(t, json.Unmarshal([]byte(event.data), &receipt))
+		return event.id, receipt
+	case <-time.After(time.Second):
+		assert.Fail(t, "no receipt was streamed")
+	}
+	return "", receipt
+}
+
+// assertNoEvent fails when the stream gets an event soon
+func assertNoEvent(t *testing.T, events <-chan streamEvent) {
+	select {
+	case event := <-events:
+		assert.Fail(t, "unexpected event", "%+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+/*
+Testing the stream of the receipts scored end to end
+every stream only gets the receipts of its filter, a member its own, the admin token those of every tenant
+and an admin bearer token those of its tenant,
+a stream resuming after an event first gets the receipts it missed, and the streams end when the feed is closed
+*/
+
+func TestReceiptStream(t *testing.T) {
+	feed := services.NewReceiptFeed(10, 10)
+	router := newStreamRouter(t, feed, 0)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ops := map[string]string{middleware.AdminTokenHeader: testAdminToken}
+	inBrandA := func(member string) map[string]string {
+		claims := memberClaims(member, "receipts:read receipts:write")
+		claims["tenant"] = "brand-a"
+		return map[string]string{"Authorization": "Bearer " + signHS256(t, claims), "Content-Type": "application/json"}
+	}
+	targets := openStream(t, server.URL+"/receipts/stream?retailer=target", ops)
+	brandA := openStream(t, server.URL+"/receipts/stream?tenant=brand-a", ops)
+	bobs := openStream(t, server.URL+"/receipts/stream", inBrandA("bob"))
+	adminClaims := memberClaims("ops", "receipts:read admin")
+	adminClaims["tenant"] = "brand-a"
+	brandAAdmin := openStream(t, server.URL+"/receipts/stream", map[string]string{"Authorization": "Bearer " + signHS256(t, adminClaims)})
+
+	for _, submitted := range []struct {
+		headers map[string]string
+		receipt string
+	}{
+		{memberHeaders(t, "alice"), targetReceipt},
+		{inBrandA("alice"), strings.Replace(targetReceipt, "Target", "Walmart", 1)},
+		{inBrandA("bob"), targetReceipt},
+	} {
+		rr := sendWithHeaders(router, "POST", "/receipts/process", submitted.receipt, submitted.headers)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	firstID, receipt := nextReceipt(t, targets)
+	assert.Equal(t, "1", firstID)
+	assert.Equal(t, models.StreamedReceipt{TenantID: models.DefaultTenant, ReceiptID: receipt.ReceiptID, Retailer: "Target", Total: "6.49", Points: 12, MemberID: "alice", CreatedAt: receipt.CreatedAt}, receipt)
+	id, receipt := nextReceipt(t, targets)
+	assert.Equal(t, "3", id)
+	assert.Equal(t, "brand-a", receipt.TenantID)
+	assertNoEvent(t, targets)
+
+	_, receipt = nextReceipt(t, brandA)
+	assert.Equal(t, "Walmart", receipt.Retailer)
+	_, receipt = nextReceipt(t, brandA)
+	assert.Equal(t, "bob", receipt.MemberID)
+	assertNoEvent(t, brandA)
+
+	id, receipt = nextReceipt(t, bobs)
+	assert.Equal(t, "3", id)
+	assert.Equal(t, "bob", receipt.MemberID)
+	assertNoEvent(t, bobs)
+
+	id, _ = nextReceipt(t, brandAAdmin)
+	assert.Equal(t, "2", id)
+	id, _ = nextReceipt(t, brandAAdmin)
+	assert.Equal(t, "3", id)
+	assertNoEvent(t, brandAAdmin)
+
+	resumed := openStream(t, server.URL+"/receipts/stream", map[string]string{middleware.AdminTokenHeader: testAdminToken, controllers.LastEventIDHeader: firstID})
+	id, _ = nextReceipt(t, resumed)
+	assert.Equal(t, "2", id)
+	id, _ = nextReceipt(t, resumed)
+	assert.Equal(t, "3", id)
+
+	feed.Close()
+	for _, events := range []<-chan streamEvent{targets, brandA, bobs, brandAAdmin, resumed} {
+		select {
+		case _, open := <-events:
+			assert.False(t, open)
+		case <-time.After(time.Second):
+			assert.Fail(t, "the stream did not end")
+		}
+	}
+}
+
+/*
+Testing the requests the stream refuses
+an invalid Last-Event-ID, a tenant other than the one of the credentials, and any request once the feed is closed
+*/
+
+func TestReceiptStreamInvalid(t *testing.T) {
+	feed := services.NewReceiptFeed(10, 10)
+	router := newStreamRouter(t, feed, 0)
+
+	rr := sendWithHeaders(router, "GET", "/receipts/stream", "", map[string]string{
+		"Authorization":               memberHeaders(t, "alice")["Authorization"],
+		controllers.LastEventIDHeader: "yesterday",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	claims := memberClaims("ops", "receipts:read admin")
+	claims["tenant"] = "brand-a"
+	rr = sendWithHeaders(router, "GET", "/receipts/stream?tenant=brand-b", "", map[string]string{"Authorization": "Bearer " + signHS256(t, claims)})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	feed.Close()
+	rr = sendWithHeaders(router, "GET", "/receipts/stream", "", memberHeaders(t, "alice"))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+/*
+Testing the subscriptions of the feed
+publishing never waits for a subscription, the one without room for a receipt is ended as a slow consumer,
+a subscription resuming after an event replays the receipts kept after it, and is told when some are no longer kept
+*/
+
+func TestReceiptFeed(t *testing.T) {
+	feed := services.NewReceiptFeed(3, 1)
+	slow, err := feed.Subscribe(services.ReceiptFilter{}, false, 0)
+	assert.NoError(t, err)
+	otherTenant, err := feed.Subscribe(services.ReceiptFilter{TenantID: "brand-b"}, false, 0)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		feed.Publish("brand-a", &models.Receipt{ID: string(rune('a' + i)), Retailer: "Target", Total: "1.00"})
+	}
+	receipt := <-slow.Receipts
+	assert.Equal(t, uint64(1), receipt.ID)
+	_, open := <-slow.Receipts
+	assert.False(t, open)
+	assert.ErrorIs(t, slow.Err(), services.ErrSlowConsumer)
+
+	replayed := func(subscription *services.ReceiptSubscription) []uint64 {
+		ids := []uint64{}
+		for _, receipt := range subscription.Replay {
+			ids = append(ids, receipt.ID)
+		}
+		return ids
+	}
+	resumed, err := feed.Subscribe(services.ReceiptFilter{}, true, 4)
+	assert.NoError(t, err)
+	assert.False(t, resumed.Missed)
+	assert.Equal(t, []uint64{5}, replayed(resumed))
+	resumed, err = feed.Subscribe(services.ReceiptFilter{}, true, 1)
+	assert.NoError(t, err)
+	assert.True(t, resumed.Missed)
+	assert.Equal(t, []uint64{3, 4, 5}, replayed(resumed))
+	resumed, err = feed.Subscribe(services.ReceiptFilter{}, true, 99)
+	assert.NoError(t, err)
+	assert.True(t, resumed.Missed)
+	assert.Equal(t, []uint64{3, 4, 5}, replayed(resumed))
+
+	feed.Close()
+	_, open = <-otherTenant.Receipts
+	assert.False(t, open)
+	assert.ErrorIs(t, otherTenant.Err(), services.ErrFeedClosed)
+	_, err = feed.Subscribe(services.ReceiptFilter{}, false, 0)
+	assert.ErrorIs(t, err, services.ErrFeedClosed)
+}
+
+/*
+Testing a stream outliving the write timeout of the server
+every write to the stream gets the write timeout again, so the stream still gets the receipts long after it
+*/
+
+func TestReceiptStreamWriteTimeout(t *testing.T) {
+	feed := services.NewReceiptFeed(10, 10)
+	router := newStreamRouter(t, feed, 100*time.Millisecond)
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+	defer feed.Close()
+
+	events := openStream(t, server.URL+"/receipts/stream", memberHeaders(t, "alice"))
+	time.Sleep(300 * time.Millisecond)
+	rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, memberHeaders(t, "alice"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, receipt := nextReceipt(t, events)
+	assert.Equal(t, "alice", receipt.MemberID)
+}
@@ -0,0 +1,266 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTenantRouter(tenants *services.Tenants) (*gin.Engine, *services.APIKeyServiceImpl) {
+	apiKeyService := services.APIKeyServiceImpl{DB: db.NewInMemoryDB()}
+	receiptController := controllers.ReceiptController{Tenants: tenants}
+	retailerController := controllers.RetailerController{Tenants: tenants}
+	apiKeyController := controllers.APIKeyController{APIKeyService: &apiKeyService}
+	authenticator := middleware.Authenticator{APIKeys: &apiKeyService, AdminToken: testAdminToken}
+
+	router := gin.New()
+	receiptApiRoutes := router.Group("/receipts", authenticator.Authenticate(), middleware.Tenant())
+	receiptApiRoutes.POST("/process", middleware.RequireScope(auth.ScopeReceiptsWrite), receiptController.ProcessReceipt)
+	receiptApiRoutes.GET("/:id", middleware.RequireScope(auth.ScopeReceiptsRead), middleware.KnownTenant(tenants), receiptController.GetReceipt)
+	receiptApiRoutes.GET("/:id/points", middleware.RequireScope(auth.ScopeReceiptsRead), middleware.KnownTenant(tenants), receiptController.GetReceiptPoints)
+
+	retailerApiRoutes := router.Group("/retailers", authenticator.Authenticate(), middleware.RequireScope(auth.ScopeAdmin), middleware.Tenant(), middleware.KnownTenant(tenants))
+	retailerApiRoutes.GET("", retailerController.GetAllRetailers)
+	retailerApiRoutes.POST("", retailerController.AddRetailer)
+
+	adminApiRoutes := router.Group("/admin", authenticator.Authenticate(), middleware.RequireScope(auth.ScopeAdmin))
+	adminApiRoutes.GET("/api-keys", apiKeyController.GetAllAPIKeys)
+	adminApiRoutes.POST("/api-keys", apiKeyController.CreateAPIKey)
+	return router, &apiKeyService
+}
+
+func createTenantKey(t *testing.T, apiKeyService *services.APIKeyServiceImpl, tenantID string) string {
+	_, key, err := apiKeyService.CreateAPIKey("Partner", tenantID, 0)
+	assert.NoError(t, err)
+	return key
+}
+
+/*
+Testing that a receipt of one tenant is not found with the API key of another tenant
+*/
+
+func TestReceiptsIsolatedPerTenant(t *testing.T) {
+	router, apiKeyService := newTenantRouter(&services.Tenants{})
+	keyA := createTenantKey(t, apiKeyService, "tenant-a")
+	keyB := createTenantKey(t, apiKeyService, "tenant-b")
+
+	rr := sendWithHeader(router, "POST", "/receipts/process", targetReceipt, middleware.APIKeyHeader, keyA)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var processed map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &processed))
+
+	rr = sendWithHeader(router, "GET", "/receipts/"+processed["id"]+"/points", "", middleware.APIKeyHeader, keyA)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = sendWithHeader(router, "GET", "/receipts/"+processed["id"]+"/points", "", middleware.APIKeyHeader, keyB)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = sendWithHeader(router, "GET", "/receipts/"+processed["id"], "", middleware.APIKeyHeader, keyB)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+/*
+Testing the X-Tenant-ID header
+naming another tenant than the API key returns 403, an invalid tenant returns 400
+*/
+
+func TestTenantHeader(t *testing.T) {
+	router, apiKeyService := newTenantRouter(&services.Tenants{})
+	keyA := createTenantKey(t, apiKeyService, "tenant-a")
+
+	req := func(tenantID string) int {
+		rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, map[string]string{
+			middleware.APIKeyHeader: keyA,
+			middleware.TenantHeader: tenantID,
+		})
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, req("tenant-a"))
+	assert.Equal(t, http.StatusForbidden, req("tenant-b"))
+
+	rr := sendWithHeaders(router, "GET", "/retailers", "", map[string]string{
+		middleware.AdminTokenHeader: testAdminToken,
+		middleware.TenantHeader:     "Not A Tenant",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+/*
+Testing the tenant of the bearer tokens
+a token without a tenant claim belongs to the default tenant, so it cannot pick another one with X-Tenant-ID,
+a token with a tenant claim only acts for that tenant and a token with an invalid tenant is rejected
+*/
+
+func TestTenantOfBearerTokens(t *testing.T) {
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{HMACSecretFile: writeTestFile(t, "secret", []byte(testHMACSecret))})
+	assert.NoError(t, err)
+	router := gin.New()
+	receiptController := controllers.ReceiptController{Tenants: &services.Tenants{}}
+	router.POST("/receipts/process", (&middleware.Authenticator{JWT: verifier}).Authenticate(), middleware.Tenant(), receiptController.ProcessReceipt)
+
+	req := func(tenantClaim string, tenantID string) int {
+		claims := memberClaims("member-1", "receipts:read receipts:write")
+		if tenantClaim != "" {
+			claims["tenant"] = tenantClaim
+		}
+		rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, map[string]string{
+			"Authorization":         "Bearer " + signHS256(t, claims),
+			middleware.TenantHeader: tenantID,
+		})
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusForbidden, req("", "other"))
+	assert.Equal(t, http.StatusOK, req("", models.DefaultTenant))
+	assert.Equal(t, http.StatusOK, req("other", "other"))
+	assert.Equal(t, http.StatusForbidden, req("other", models.DefaultTenant))
+	assert.Equal(t, http.StatusUnauthorized, req("Not A Tenant", ""))
+}
+
+/*
+Testing that every tenant has its own retailer registry and its own rules
+the registry is chosen by the X-Tenant-ID header of the admin token,
+tenant-b uses its own rules with a bonus for beverages
+*/
+
+func TestRetailersAndRulesPerTenant(t *testing.T) {
+	beverages := &services.RuleSet{
+		Categories:      []services.CategoryRule{{Name: "beverages", Keywords: []string{"dew"}}},
+		CategoryBonuses: []services.CategoryBonus{{Category: "beverages", PointsPerItem: 10}},
+	}
+	assert.NoError(t, beverages.Compile())
+	tenants := &services.Tenants{TenantRules: map[string]*services.RuleSet{"tenant-b": beverages}}
+	router, apiKeyService := newTenantRouter(tenants)
+
+	rr := sendWithHeaders(router, "POST", "/retailers", `{"name": "Target", "aliases": ["Target Store"]}`, map[string]string{
+		middleware.AdminTokenHeader: testAdminToken,
+		middleware.TenantHeader:     "tenant-a",
+	})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = sendWithHeaders(router, "GET", "/retailers", "", map[string]string{
+		middleware.AdminTokenHeader: testAdminToken,
+		middleware.TenantHeader:     "tenant-b",
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "Target")
+
+	points := func(key string) int64 {
+		rr := sendWithHeader(router, "POST", "/receipts/process", targetReceipt, middleware.APIKeyHeader, key)
+		var processed map[string]string
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &processed))
+		rr = sendWithHeader(router, "GET", "/receipts/"+processed["id"]+"/points", "", middleware.APIKeyHeader, key)
+		var response map[string]int64
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response["points"]
+	}
+	assert.Equal(t, points(createTenantKey(t, apiKeyService, "tenant-a"))+10, points(createTenantKey(t, apiKeyService, "tenant-b")))
+}
+
+/*
+Testing that a bearer token of a tenant only creates and lists the API keys of its tenant
+*/
+
+func TestAPIKeysOfTenantAdmin(t *testing.T) {
+	router, apiKeyService := newTenantRouter(&services.Tenants{})
+	createTenantKey(t, apiKeyService, "tenant-a")
+	createTenantKey(t, apiKeyService, "tenant-b")
+
+	tenantAdmin := gin.New()
+	apiKeyController := controllers.APIKeyController{APIKeyService: apiKeyService}
+	setPrincipal := func(c *gin.Context) {
+		c.Set(middleware.PrincipalKey, &auth.Principal{Subject: "ops", Scopes: []string{auth.ScopeAdmin}, TenantID: "tenant-a"})
+	}
+	tenantAdmin.GET("/admin/api-keys", setPrincipal, apiKeyController.GetAllAPIKeys)
+	tenantAdmin.POST("/admin/api-keys", setPrincipal, apiKeyController.CreateAPIKey)
+
+	rr := sendWithHeader(tenantAdmin, "GET", "/admin/api-keys", "", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var listed map[string][]models.APIKey
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	assert.Len(t, listed["apiKeys"], 1)
+	assert.Equal(t, "tenant-a", listed["apiKeys"][0].TenantID)
+
+	rr = sendWithHeader(tenantAdmin, "POST", "/admin/api-keys", `{"name": "Partner", "tenant": "tenant-b"}`, "", "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = sendWithHeader(router, "GET", "/admin/api-keys", "", middleware.AdminTokenHeader, testAdminToken)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	assert.Len(t, listed["apiKeys"], 2)
+}
+
+/*
+Testing that the tenants get distinct stores and the same tenant always gets the same one
+*/
+
+func TestTenantsFor(t *testing.T) {
+	tenants := &services.Tenants{}
+	assert.Same(t, tenants.For("tenant-a"), tenants.For("tenant-a"))
+	assert.NotSame(t, tenants.For("tenant-a"), tenants.For("tenant-b"))
+
+	id, _ := tenants.For("tenant-a").Receipts.AddNewReceipt(context.Background(), &models.Receipt{
+		Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "1.00",
+		Items: []models.Item{{ShortDescription: "Gum", Price: "1.00"}},
+	})
+	_, ok := tenants.For("tenant-a").Receipts.GetReceipt(context.Background(), id)
+	assert.True(t, ok)
+	_, ok = tenants.For("tenant-b").Receipts.GetReceipt(context.Background(), id)
+	assert.False(t, ok)
+}
+
+/*
+Testing that the reads of a tenant that is not known return 404 without creating it
+the default tenant and the tenants with their own rules are known, the other tenants once they are written to
+*/
+
+func TestUnknownTenantReads(t *testing.T) {
+	tenants := &services.Tenants{TenantRules: map[string]*services.RuleSet{"brand-a": nil}}
+	router, apiKeyService := newTenantRouter(tenants)
+	inTenant := func(tenantID string) map[string]string {
+		return map[string]string{middleware.AdminTokenHeader: testAdminToken, middleware.TenantHeader: tenantID}
+	}
+	keyB := createTenantKey(t, apiKeyService, "brand-b")
+
+	for _, tenantID := range []string{models.DefaultTenant, "brand-a"} {
+		assert.True(t, tenants.Known(tenantID))
+		rr := sendWithHeaders(router, "GET", "/retailers", "", inTenant(tenantID))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	rr := sendWithHeaders(router, "GET", "/retailers", "", inTenant("brand-b"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.JSONEq(t, `{"description": "No tenant found for that ID"}`, rr.Body.String())
+	for _, url := range []string{"/receipts/unknown", "/receipts/unknown/points"} {
+		rr = sendWithHeader(router, "GET", url, "", middleware.APIKeyHeader, keyB)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	}
+	assert.False(t, tenants.Known("brand-b"))
+
+	rr = sendWithHeader(router, "POST", "/receipts/process", targetReceipt, middleware.APIKeyHeader, keyB)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, tenants.Known("brand-b"))
+	rr = sendWithHeaders(router, "GET", "/retailers", "", inTenant("brand-b"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func sendWithHeaders(router *gin.Engine, method string, url string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	for header, value := range headers {
+		req.Header.Set(header, value)
+	}
+	rr := httptest.NewRecorder()
+	serve(router, rr, req)
+	return rr
+}
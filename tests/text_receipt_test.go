@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/formats"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden outputs of the text receipts in testdata")
+
+/*
+Testing the text receipt parser against the sample receipts in testdata/text-receipts
+every NAME.txt is parsed and compared with NAME.json, run go test ./tests -run TestParseReceiptText -update to rewrite them
+all but the damaged OCR sample parse to valid receipts
+*/
+
+func TestParseReceiptText(t *testing.T) {
+	samples, err := filepath.Glob("testdata/text-receipts/*.txt")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, samples)
+
+	for _, sample := range samples {
+		t.Run(filepath.Base(sample), func(t *testing.T) {
+			text, err := os.ReadFile(sample)
+			assert.NoError(t, err)
+			parsed := formats.ParseReceiptText(string(text))
+			output, err := json.MarshalIndent(parsed, "", "  ")
+			assert.NoError(t, err)
+
+			golden := strings.TrimSuffix(sample, ".txt") + ".json"
+			if *updateGolden {
+				assert.NoError(t, os.WriteFile(golden, append(output, '\n'), 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(output))
+
+			err = validators.NewValidator().Struct(parsed.Receipt)
+			if strings.Contains(sample, "damaged") {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+/*
+Testing POST /receipts/process-text
+a valid receipt is processed and returned with its id, points and confidences,
+an invalid one is rejected with what the parser read from it
+*/
+
+func TestProcessReceiptText(t *testing.T) {
+	router := newFormatsRouter()
+
+	text, err := os.ReadFile("testdata/text-receipts/target.txt")
+	assert.NoError(t, err)
+	rr := sendWithHeaders(router, "POST", "/receipts/process-text", string(text), map[string]string{"Content-Type": "text/plain"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var processed struct {
+		ID string `json:"id"`
+		formats.TextReceipt
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &processed))
+	assert.NotEmpty(t, processed.ID)
+	assert.Equal(t, int64(12), processed.Receipt.Points)
+	assert.Equal(t, 0.9, processed.Confidence["retailer"])
+
+	rr = sendJSON(router, "GET", "/receipts/"+processed.ID+"/points", "")
+	assert.JSONEq(t, `{"points": 12}`, rr.Body.String())
+
+	text, err = os.ReadFile("testdata/text-receipts/damaged-ocr.txt")
+	assert.NoError(t, err)
+	rr = sendWithHeaders(router, "POST", "/receipts/process-text", string(text), map[string]string{"Content-Type": "text/plain"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var rejected struct {
+		Description string `json:"description"`
+		formats.TextReceipt
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rejected))
+	assert.Equal(t, "The receipt is invalid", rejected.Description)
+	assert.Equal(t, 0.0, rejected.Confidence["purchaseTime"])
+
+	rr = sendWithHeaders(router, "POST", "/receipts/process-text", "", map[string]string{"Content-Type": "text/plain"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = sendWithHeaders(router, "POST", "/receipts/process-text", strings.Repeat("x", 100_000), map[string]string{"Content-Type": "text/plain"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
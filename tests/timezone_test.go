@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/validators"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+testing the IANA names and UTC offsets accepted as timezones
+*/
+
+func TestParseTimezone(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, name := range []string{"America/New_York", "Europe/Berlin", "UTC", "Z", "+05:30", "-0400"} {
+		_, err := models.ParseTimezone(name)
+		assert.NoError(err, name)
+	}
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons", "+25:00", "+05:75", "EST5"} {
+		_, err := models.ParseTimezone(name)
+		assert.Error(err, name)
+	}
+}
+
+/*
+testing the instant of wall clock times around daylight saving time changes
+	2024-03-10 02:30 does not exist in New York, the clocks go from 02:00 EST to 03:00 EDT
+	2024-11-03 01:30 happens twice in New York, first in EDT and then in EST
+	2024-04-07 02:30 happens twice in Sydney, first in AEDT and then in AEST
+*/
+
+func TestPurchaseInstantDaylightSavingTime(t *testing.T) {
+	assert := assert.New(t)
+	newYork, _ := time.LoadLocation("America/New_York")
+	sydney, _ := time.LoadLocation("Australia/Sydney")
+
+	instant, err := models.PurchaseInstant("2024-03-10", "02:30", newYork)
+	assert.NoError(err)
+	assert.Equal(time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC), instant.UTC())
+	assert.Equal("03:30", instant.Format("15:04"))
+
+	instant, err = models.PurchaseInstant("2024-11-03", "01:30", newYork)
+	assert.NoError(err)
+	assert.Equal(time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), instant.UTC())
+
+	instant, err = models.PurchaseInstant("2024-04-07", "02:30", sydney)
+	assert.NoError(err)
+	assert.Equal(time.Date(2024, 4, 6, 15, 30, 0, 0, time.UTC), instant.UTC())
+
+	instant, err = models.PurchaseInstant("2024-03-09", "14:30", newYork)
+	assert.NoError(err)
+	assert.Equal(time.Date(2024, 3, 9, 19, 30, 0, 0, time.UTC), instant.UTC())
+}
+
+/*
+testing that the purchase date and time rules are evaluated in the local time of the store
+the retailer "Target" is in New York, every receipt has 1 item and a total of 1.00
+	81 points - 6 for the retailer name, 75 for the total
+	+6 points - the local purchase day is odd
+	+10 points - the local purchase time is between 2:00pm and 4:00pm
+*/
+
+func TestAddNewReceiptInStoreLocalTime(t *testing.T) {
+	database := db.NewInMemoryDB()
+	retailerService := services.RetailerServiceImpl{DB: database}
+	receiptService := services.ReceiptServiceImpl{DB: database, Retailers: &retailerService}
+	_, err := retailerService.AddRetailer(&models.Retailer{Name: "Target", Timezone: "America/New_York"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name         string
+		purchaseDate string
+		purchaseTime string
+		timezone     string
+		points       int64
+		purchasedAt  time.Time
+	}{
+		{"18:30 UTC the day before DST starts is 13:30 EST", "2024-03-09", "18:30", "UTC", 87, time.Date(2024, 3, 9, 18, 30, 0, 0, time.UTC)},
+		{"18:30 UTC the day DST starts is 14:30 EDT", "2024-03-10", "18:30", "UTC", 91, time.Date(2024, 3, 10, 18, 30, 0, 0, time.UTC)},
+		{"03:30 UTC on the 3rd is 23:30 EDT on the 2nd", "2024-11-03", "03:30", "UTC", 81, time.Date(2024, 11, 3, 3, 30, 0, 0, time.UTC)},
+		{"skipped 02:30 in store time is 03:30 EDT", "2024-03-10", "02:30", "", 81, time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC)},
+		{"15:30 at -05:00 in July is 16:30 EDT", "2024-07-01", "15:30", "-05:00", 87, time.Date(2024, 7, 1, 20, 30, 0, 0, time.UTC)},
+		{"15:30 at -05:00 in January is 15:30 EST", "2024-01-01", "15:30", "-05:00", 97, time.Date(2024, 1, 1, 20, 30, 0, 0, time.UTC)},
+	}
+
+	for _, testCase := range cases {
+		id, points := receiptService.AddNewReceipt(context.Background(), &models.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: testCase.purchaseDate,
+			PurchaseTime: testCase.purchaseTime,
+			Timezone:     testCase.timezone,
+			Items:        []models.Item{{ShortDescription: "Item", Price: "1.00"}},
+			Total:        "1.00",
+		})
+		assert.Equal(t, testCase.points, points, testCase.name)
+
+		receipt, _ := receiptService.GetReceiptDetails(context.Background(), id)
+		assert.Equal(t, testCase.purchasedAt, *receipt.PurchasedAt, testCase.name)
+		assert.Equal(t, time.UTC, receipt.CreatedAt.Location(), testCase.name)
+	}
+}
+
+/*
+testing that receipts without any timezone are scored as submitted
+*/
+
+func TestAddNewReceiptWithoutTimezone(t *testing.T) {
+	receiptService := services.ReceiptServiceImpl{DB: db.NewInMemoryDB()}
+
+	id, points := receiptService.AddNewReceipt(context.Background(), &models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2024-03-09",
+		PurchaseTime: "14:30",
+		Items:        []models.Item{{ShortDescription: "Item", Price: "1.00"}},
+		Total:        "1.00",
+	})
+	assert.Equal(t, int64(97), points)
+
+	receipt, _ := receiptService.GetReceiptDetails(context.Background(), id)
+	assert.Nil(t, receipt.PurchasedAt)
+	assert.NotNil(t, receipt.CreatedAt)
+}
+
+/*
+testing that receipts and retailers with an unknown timezone are invalid
+*/
+
+func TestValidateTimezone(t *testing.T) {
+	validate := validators.NewValidator()
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2024-03-09",
+		PurchaseTime: "14:30",
+		Items:        []models.Item{{ShortDescription: "Item", Price: "1.00"}},
+		Total:        "1.00",
+		Timezone:     "Europe/Berlin",
+	}
+	assert.NoError(t, validate.Struct(&receipt))
+
+	receipt.Timezone = "Mars/Olympus_Mons"
+	assert.Error(t, validate.Struct(&receipt))
+
+	assert.NoError(t, validate.Struct(&models.Retailer{Name: "Target", Timezone: "+05:30"}))
+	assert.Error(t, validate.Struct(&models.Retailer{Name: "Target", Timezone: "EST5"}))
+}
@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/httpserver"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCertificate is a certificate signed by a test CA, or self-signed when it is the CA
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// newTestCertificate issues a certificate with the subject and serial, signed by the parent or self-signed when it is nil
+func newTestCertificate(t *testing.T, subject pkix.Name, serial int64, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeCertificate writes the certificate and key files, modified at the given time
+func writeCertificate(t *testing.T, dir string, certificate *testCertificate, modified time.Time) (string, string) {
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, certificate.certPEM, 0600))
+	assert.NoError(t, os.WriteFile(keyFile, certificate.keyPEM, 0600))
+	assert.NoError(t, os.Chtimes(certFile, modified, modified))
+	assert.NoError(t, os.Chtimes(keyFile, modified, modified))
+	return certFile, keyFile
+}
+
+// runTLSServer serves the handler with the TLS options until the test ends, and returns its address
+func runTLSServer(t *testing.T, handler http.Handler, options httpserver.TLSOptions) string {
+	tlsConfig, err := httpserver.NewTLSConfig(options)
+	assert.NoError(t, err)
+	server := httpserver.New(handler, httpserver.Options{ReadHeaderTimeout: time.Second})
+	server.TLSConfig = tlsConfig
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, stop := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- httpserver.Run(ctx, server, listener, httpserver.Shutdown{Timeout: time.Second})
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-stopped
+	})
+	return "https://" + listener.Addr().String()
+}
+
+// tlsClient returns a client trusting the CA, presenting the client certificate when it is not nil
+func tlsClient(ca *testCertificate, client *testCertificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	config := &tls.Config{RootCAs: roots}
+	if client != nil {
+		config.Certificates = []tls.Certificate{{Certificate: [][]byte{client.certificate.Raw}, PrivateKey: client.key}}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: true}}
+}
+
+/*
+Testing serving HTTPS
+the server speaks HTTP/2 and serves a rotated certificate to new connections without restarting
+*/
+
+func TestTLSServesHTTP2AndReloadsCertificate(t *testing.T) {
+	ca := newTestCertificate(t, pkix.Name{CommonName: "test CA"}, 1, nil)
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, newTestCertificate(t, pkix.Name{CommonName: "server"}, 2, ca), time.Now().Add(-time.Minute))
+
+	router := gin.New()
+	router.GET("/proto", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Request.Proto)
+	})
+	addr := runTLSServer(t, router, httpserver.TLSOptions{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Nanosecond})
+	client := tlsClient(ca, nil)
+
+	response, err := client.Get(addr + "/proto")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(t, "HTTP/2.0", string(body))
+	assert.Equal(t, int64(2), response.TLS.PeerCertificates[0].SerialNumber.Int64())
+
+	writeCertificate(t, dir, newTestCertificate(t, pkix.Name{CommonName: "server"}, 3, ca), time.Now())
+	client.CloseIdleConnections()
+	response, err = client.Get(addr + "/proto")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, int64(3), response.TLS.PeerCertificates[0].SerialNumber.Int64())
+
+	assert.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0600))
+	assert.NoError(t, os.Chtimes(certFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	client.CloseIdleConnections()
+	response, err = client.Get(addr + "/proto")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, int64(3), response.TLS.PeerCertificates[0].SerialNumber.Int64())
+}
+
+/*
+Testing mutual TLS
+a client certificate whose subject is mapped to a partner authenticates as the partner,
+without a certificate or with an unmapped one the request is not authenticated
+and with client certificates required the connection is refused
+*/
+
+func TestMutualTLSPartners(t *testing.T) {
+	ca := newTestCertificate(t, pkix.Name{CommonName: "test CA"}, 1, nil)
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, newTestCertificate(t, pkix.Name{CommonName: "server"}, 2, ca), time.Now())
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, ca.certPEM, 0600))
+	partner := newTestCertificate(t, pkix.Name{CommonName: "pos-1", Organization: []string{"Acme Corp"}}, 4, ca)
+	stranger := newTestCertificate(t, pkix.Name{CommonName: "pos-9"}, 5, ca)
+	assert.Equal(t, "CN=pos-1,O=Acme Corp", partner.certificate.Subject.String())
+
+	partners, err := auth.NewPartners([]auth.Partner{{ID: "acme-pos", Subject: "CN=pos-1,O=Acme Corp", TenantID: "acme"}})
+	assert.NoError(t, err)
+	authenticator := middleware.Authenticator{Partners: partners}
+	router := gin.New()
+	router.GET("/whoami", authenticator.Authenticate(), middleware.RequireScope(auth.ScopeReceiptsWrite), middleware.Tenant(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(middleware.PartnerIDKey)+" "+middleware.TenantID(c))
+	})
+	options := httpserver.TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: httpserver.ClientAuthOptional}
+	addr := runTLSServer(t, router, options)
+
+	response, err := tlsClient(ca, partner).Get(addr + "/whoami")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "acme-pos acme", string(body))
+
+	for _, client := range []*testCertificate{nil, stranger} {
+		response, err = tlsClient(ca, client).Get(addr + "/whoami")
+		assert.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	}
+
+	options.ClientAuth = httpserver.ClientAuthRequire
+	addr = runTLSServer(t, router, options)
+	_, err = tlsClient(ca, nil).Get(addr + "/whoami")
+	assert.Error(t, err)
+	response, err = tlsClient(ca, partner).Get(addr + "/whoami")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+/*
+Testing the partners that are rejected
+*/
+
+func TestPartnersInvalid(t *testing.T) {
+	_, err := auth.NewPartners([]auth.Partner{{ID: "a", Subject: "CN=pos-1"}, {ID: "b", Subject: "CN=pos-1"}})
+	assert.ErrorContains(t, err, "already mapped")
+	_, err = auth.NewPartners([]auth.Partner{{ID: "a"}})
+	assert.ErrorContains(t, err, "the id and the subject are required")
+	_, err = auth.NewPartners([]auth.Partner{{ID: "a", Subject: "CN=pos-1", Scopes: []string{"receipts:delete"}}})
+	assert.ErrorContains(t, err, "unknown scope")
+	_, err = auth.NewPartners([]auth.Partner{{ID: "a", Subject: "CN=pos-1", TenantID: "Not A Tenant"}})
+	assert.ErrorContains(t, err, "the tenant")
+
+	path := writeTestFile(t, "partners.json", []byte(`[{"id": "acme-pos", "subject": "CN=pos-1"}]`))
+	_, err = auth.LoadPartners(path)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that records the spans in memory until the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	tracing.SetupPropagation()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+/*
+Testing the spans of processing a receipt
+the server span continues the trace of the traceparent header, the controller, service,
+every scoring rule and the store have their own span in the same trace
+*/
+
+func TestTracingProcessReceipt(t *testing.T) {
+	recorder := recordSpans(t)
+	store := tracing.TraceStore(db.NewInMemoryDB())
+	receiptService := services.ReceiptServiceImpl{DB: store}
+	receiptController := controllers.ReceiptController{ReceiptService: &receiptService}
+	router := gin.New()
+	router.Use(middleware.Tracing())
+	router.POST("/receipts/process", receiptController.ProcessReceipt)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	rr := sendWithHeader(router, "POST", "/receipts/process", targetReceipt, "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{
+		"POST /receipts/process",
+		"ReceiptController.ProcessReceipt",
+		"ReceiptService.AddNewReceipt",
+		"rule.retailerName",
+		"rule.total",
+		"rule.itemCount",
+		"rule.itemDescription",
+		"rule.purchaseDate",
+		"rule.purchaseTime",
+		"store.AddNewReceipt",
+	} {
+		assert.Contains(t, spans, name)
+	}
+
+	server := spans["POST /receipts/process"]
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	service := spans["ReceiptService.AddNewReceipt"]
+	assert.Equal(t, spans["ReceiptController.ProcessReceipt"].SpanContext().SpanID(), service.Parent().SpanID())
+	assert.Equal(t, service.SpanContext().SpanID(), spans["rule.retailerName"].Parent().SpanID())
+	assert.Equal(t, service.SpanContext().SpanID(), spans["store.AddNewReceipt"].Parent().SpanID())
+
+	for _, attribute := range spans["rule.retailerName"].Attributes() {
+		if attribute.Key == "points" {
+			assert.Equal(t, int64(6), attribute.Value.AsInt64())
+		}
+	}
+}
+
+/*
+Testing that Setup writes the spans to the trace file as JSON once it is shut down
+*/
+
+func TestTracingSetupFile(t *testing.T) {
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := tracing.Setup(path)
+	assert.NoError(t, err)
+	_, span := tracing.Start(context.Background(), "test")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var exported map[string]interface{}
+	assert.NoError(t, json.NewDecoder(bytes.NewReader(data)).Decode(&exported))
+	assert.Equal(t, "test", exported["Name"])
+}
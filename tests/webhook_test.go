@@ -0,0 +1,333 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/auth"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/controllers"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/middleware"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/services"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWebhooksRouter(t *testing.T, dispatcher *services.WebhookDispatcher) *gin.Engine {
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{HMACSecretFile: writeTestFile(t, "secret", []byte(testHMACSecret))})
+	assert.NoError(t, err)
+	tenants := &services.Tenants{Webhooks: dispatcher}
+	receiptController := controllers.ReceiptController{Tenants: tenants}
+	webhookController := controllers.WebhookController{Tenants: tenants}
+	router := gin.New()
+	routes := router.Group("", (&middleware.Authenticator{JWT: verifier}).Authenticate(), middleware.Tenant())
+	routes.POST("/receipts/process", receiptController.ProcessReceipt)
+	webhookRoutes := routes.Group("/webhooks", middleware.RequireScope(auth.ScopeReceiptsRead))
+	write := middleware.RequireScope(auth.ScopeReceiptsWrite, auth.ScopeAdmin)
+	webhookRoutes.GET("", webhookController.GetAllWebhooks)
+	webhookRoutes.POST("", write, webhookController.AddWebhook)
+	webhookRoutes.GET("/dead-letters", webhookController.GetDeadLetters)
+	webhookRoutes.POST("/dead-letters/:id/redeliver", write, webhookController.Redeliver)
+	webhookRoutes.GET("/:id", webhookController.GetWebhook)
+	webhookRoutes.DELETE("/:id", write, webhookController.DeleteWebhook)
+	webhookRoutes.GET("/:id/deliveries", webhookController.GetDeliveries)
+	return router
+}
+
+// memberHeaders returns the headers of the JSON requests of a member
+func memberHeaders(t *testing.T, member string) map[string]string {
+	return map[string]string{
+		"Authorization": "Bearer " + signHS256(t, memberClaims(member, "receipts:read receipts:write")),
+		"Content-Type":  "application/json",
+	}
+}
+
+// addTestWebhook adds a webhook of the URL with the secret and returns it as it was created
+func addTestWebhook(t *testing.T, router *gin.Engine, headers map[string]string, url string, secret string, events ...string) models.Webhook {
+	body, err := json.Marshal(models.Webhook{URL: url, Events: events, Secret: secret})
+	assert.NoError(t, err)
+	rr := sendWithHeaders(router, "POST", "/webhooks", string(body), headers)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var webhook models.Webhook
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &webhook))
+	return webhook
+}
+
+// getDeliveries returns the deliveries of the response of a deliveries route
+func getDeliveries(t *testing.T, router *gin.Engine, url string, headers map[string]string) []models.WebhookDelivery {
+	rr := sendWithHeaders(router, "GET", url, "", headers)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Deliveries
+}
+
+/*
+Testing the signatures of the deliveries
+a signature only matches the body and the secret it was made with, and is rejected once it is older than the tolerance
+*/
+
+func TestWebhookSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id": "1", "type": "receipt.scored"}`)
+	signature := webhooks.Sign("whsec_test_secret", now, body)
+	assert.True(t, strings.HasPrefix(signature, "t=1700000000,v1="))
+
+	assert.NoError(t, webhooks.Verify("whsec_test_secret", signature, body, now.Add(time.Minute), webhooks.DefaultTolerance))
+	assert.ErrorIs(t, webhooks.Verify("whsec_other_secret", signature, body, now, webhooks.DefaultTolerance), webhooks.ErrInvalidSignature)
+	assert.ErrorIs(t, webhooks.Verify("whsec_test_secret", signature, []byte(`{"id": "2"}`), now, webhooks.DefaultTolerance), webhooks.ErrInvalidSignature)
+	assert.ErrorIs(t, webhooks.Verify("whsec_test_secret", signature, body, now.Add(time.Hour), webhooks.DefaultTolerance), webhooks.ErrExpiredSignature)
+	assert.ErrorIs(t, webhooks.Verify("whsec_test_secret", "v1=00", body, now, webhooks.DefaultTolerance), webhooks.ErrInvalidSignature)
+
+	receiver := &webhooks.Receiver{Secret: "whsec_test_secret"}
+	request := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+	request.Header.Set(webhooks.SignatureHeader, signature)
+	rr := httptest.NewRecorder()
+	receiver.ServeHTTP(rr, request)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Empty(t, receiver.Events())
+}
+
+/*
+Testing the webhooks end to end with the test receiver
+the events of a member's receipts are posted to its webhooks only, signed, retried after a failed attempt,
+the points.changed event has the points of all the receipts of the member,
+a delivery whose every attempt failed is a dead letter until it is redelivered, and a removed webhook gets nothing more
+*/
+
+func TestWebhooks(t *testing.T) {
+	dispatcher := services.NewWebhookDispatcher(2, 100)
+	dispatcher.Client = services.NewWebhookClient(time.Second, true)
+	dispatcher.MaxAttempts = 3
+	dispatcher.Backoff = 20 * time.Millisecond
+	dispatcher.MaxBackoff = 40 * time.Millisecond
+	defer dispatcher.Close(context.Background())
+	router := newWebhooksRouter(t, dispatcher)
+	alice, bob := memberHeaders(t, "alice"), memberHeaders(t, "bob")
+
+	aliceReceiver := &webhooks.Receiver{Secret: "alice-webhook-secret", FailFirst: 1}
+	aliceServer := httptest.NewServer(aliceReceiver)
+	defer aliceServer.Close()
+	bobReceiver := &webhooks.Receiver{Secret: "bob-webhook-secret", FailFirst: 3}
+	bobServer := httptest.NewServer(bobReceiver)
+	defer bobServer.Close()
+
+	for _, invalid := range []string{
+		`{"url": "ftp://example.com/hook", "events": ["receipt.scored"]}`,
+		`{"url": "https://example.com/hook", "events": ["receipt.deleted"]}`,
+		`{"url": "https://example.com/hook", "events": []}`,
+		`{"url": "https://example.com/hook", "events": ["receipt.scored"], "secret": "short"}`,
+	} {
+		rr := sendWithHeaders(router, "POST", "/webhooks", invalid, alice)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, invalid)
+	}
+
+	aliceWebhook := addTestWebhook(t, router, alice, aliceServer.URL, "alice-webhook-secret", models.EventReceiptScored, models.EventPointsChanged)
+	assert.Equal(t, "alice-webhook-secret", aliceWebhook.Secret)
+	bobWebhook := addTestWebhook(t, router, bob, bobServer.URL, "bob-webhook-secret", models.EventReceiptScored)
+	generated := addTestWebhook(t, router, memberHeaders(t, "carol"), "https://example.com/hook", "", models.EventPointsChanged)
+	assert.True(t, strings.HasPrefix(generated.Secret, "whsec_"))
+
+	rr := sendWithHeaders(router, "GET", "/webhooks", "", alice)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var listed struct {
+		Webhooks []models.Webhook `json:"webhooks"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	assert.Len(t, listed.Webhooks, 1)
+	assert.Equal(t, aliceWebhook.ID, listed.Webhooks[0].ID)
+	assert.Empty(t, listed.Webhooks[0].Secret)
+	rr = sendWithHeaders(router, "GET", "/webhooks/"+aliceWebhook.ID, "", bob)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	for i := 0; i < 2; i++ {
+		rr = sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, alice)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	assert.Eventually(t, func() bool { return len(aliceReceiver.Events()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	var totals []int64
+	for _, received := range aliceReceiver.Events() {
+		switch received.Event.Type {
+		case models.EventReceiptScored:
+			var scored models.ReceiptScored
+			assert.NoError(t, json.Unmarshal(received.Event.Data, &scored))
+			assert.Equal(t, int64(12), scored.Points)
+			assert.Equal(t, "alice", scored.MemberID)
+		case models.EventPointsChanged:
+			var changed models.PointsChanged
+			assert.NoError(t, json.Unmarshal(received.Event.Data, &changed))
+			assert.Equal(t, int64(12), changed.Points)
+			totals = append(totals, changed.TotalPoints)
+		}
+	}
+	assert.ElementsMatch(t, []int64{12, 24}, totals)
+
+	deliveries := getDeliveries(t, router, "/webhooks/"+aliceWebhook.ID+"/deliveries", alice)
+	assert.Len(t, deliveries, 4)
+	attempts := 0
+	for _, delivery := range deliveries {
+		assert.Equal(t, models.DeliveryDelivered, delivery.Status)
+		attempts += len(delivery.Attempts)
+	}
+	assert.Equal(t, 5, attempts)
+	assert.Empty(t, bobReceiver.Events())
+
+	rr = sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, bob)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var dead []models.WebhookDelivery
+	assert.Eventually(t, func() bool {
+		dead = getDeliveries(t, router, "/webhooks/dead-letters", bob)
+		return len(dead) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, bobWebhook.ID, dead[0].WebhookID)
+	assert.Len(t, dead[0].Attempts, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, dead[0].Attempts[2].StatusCode)
+	assert.GreaterOrEqual(t, dead[0].Attempts[1].At.Sub(dead[0].Attempts[0].At), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, dead[0].Attempts[2].At.Sub(dead[0].Attempts[1].At), 40*time.Millisecond)
+	assert.Empty(t, getDeliveries(t, router, "/webhooks/dead-letters", alice))
+
+	rr = sendWithHeaders(router, "POST", "/webhooks/dead-letters/"+dead[0].ID+"/redeliver", "", alice)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = sendWithHeaders(router, "POST", "/webhooks/dead-letters/"+dead[0].ID+"/redeliver", "", bob)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Eventually(t, func() bool { return len(bobReceiver.Events()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, dead[0].ID, bobReceiver.Events()[0].Delivery)
+	assert.Eventually(t, func() bool {
+		deliveries := getDeliveries(t, router, "/webhooks/"+bobWebhook.ID+"/deliveries", bob)
+		return len(deliveries) == 1 && deliveries[0].Status == models.DeliveryDelivered && len(deliveries[0].Attempts) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	rr = sendWithHeaders(router, "POST", "/webhooks/dead-letters/"+dead[0].ID+"/redeliver", "", bob)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = sendWithHeaders(router, "DELETE", "/webhooks/"+aliceWebhook.ID, "", alice)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = sendWithHeaders(router, "GET", "/webhooks/"+aliceWebhook.ID+"/deliveries", "", alice)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, alice)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, aliceReceiver.Events(), 4)
+}
+
+/*
+Testing the addresses the events are posted to
+the client of the dispatcher refuses the loopback address of the test receiver unless private addresses are allowed,
+and a redirect is not followed, it fails the attempt
+*/
+
+func TestWebhookAddresses(t *testing.T) {
+	receiver := &webhooks.Receiver{Secret: "alice-webhook-secret"}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+	redirectServer := httptest.NewServer(http.RedirectHandler(receiverServer.URL, http.StatusFound))
+	defer redirectServer.Close()
+
+	deadLetter := func(dispatcher *services.WebhookDispatcher, url string) models.WebhookAttempt {
+		dispatcher.MaxAttempts = 1
+		defer dispatcher.Close(context.Background())
+		router := newWebhooksRouter(t, dispatcher)
+		alice := memberHeaders(t, "alice")
+		addTestWebhook(t, router, alice, url, "alice-webhook-secret", models.EventReceiptScored)
+		rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, alice)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var dead []models.WebhookDelivery
+		assert.Eventually(t, func() bool {
+			dead = getDeliveries(t, router, "/webhooks/dead-letters", alice)
+			return len(dead) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		if len(dead) != 1 || len(dead[0].Attempts) != 1 {
+			t.FailNow()
+		}
+		return dead[0].Attempts[0]
+	}
+
+	attempt := deadLetter(services.NewWebhookDispatcher(1, 100), receiverServer.URL)
+	assert.Contains(t, attempt.Error, services.ErrPrivateAddress.Error())
+	assert.Zero(t, attempt.StatusCode)
+
+	allowPrivate := services.NewWebhookDispatcher(1, 100)
+	allowPrivate.Client = services.NewWebhookClient(time.Second, true)
+	attempt = deadLetter(allowPrivate, redirectServer.URL)
+	assert.Equal(t, http.StatusFound, attempt.StatusCode)
+	assert.Empty(t, receiver.Events())
+}
+
+/*
+Testing the scopes of the webhook routes
+reading the webhooks needs receipts:read, changing them receipts:write or admin as well
+*/
+
+func TestWebhookScopes(t *testing.T) {
+	dispatcher := services.NewWebhookDispatcher(1, 100)
+	defer dispatcher.Close(context.Background())
+	router := newWebhooksRouter(t, dispatcher)
+	withScope := func(scope string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + signHS256(t, memberClaims("alice", scope)), "Content-Type": "application/json"}
+	}
+	webhook := `{"url": "https://example.com/hook", "events": ["receipt.scored"]}`
+
+	rr := sendWithHeaders(router, "GET", "/webhooks", "", withScope("receipts:write"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = sendWithHeaders(router, "GET", "/webhooks", "", withScope("receipts:read"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	for _, request := range []struct{ method, url, body string }{
+		{"POST", "/webhooks", webhook},
+		{"DELETE", "/webhooks/unknown", ""},
+		{"POST", "/webhooks/dead-letters/unknown/redeliver", ""},
+	} {
+		rr = sendWithHeaders(router, request.method, request.url, request.body, withScope("receipts:read"))
+		assert.Equal(t, http.StatusForbidden, rr.Code, request.url)
+		assert.JSONEq(t, `{"description": "The receipts:write or admin scope is required"}`, rr.Body.String())
+	}
+
+	rr = sendWithHeaders(router, "POST", "/webhooks", webhook, withScope("receipts:read receipts:write"))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created models.Webhook
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	rr = sendWithHeaders(router, "DELETE", "/webhooks/"+created.ID, "", withScope("receipts:read admin"))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
+
+/*
+Testing that the attempts do not pile up behind a webhook that does not answer
+with one worker busy and the queue full, the delivery of the next attempt is a dead letter right away
+*/
+
+func TestWebhookQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slowServer.Close()
+	dispatcher := services.NewWebhookDispatcher(1, 1)
+	dispatcher.Client = services.NewWebhookClient(5*time.Second, true)
+	dispatcher.MaxAttempts = 1
+	defer dispatcher.Close(context.Background())
+	defer close(release)
+	router := newWebhooksRouter(t, dispatcher)
+	alice := memberHeaders(t, "alice")
+	addTestWebhook(t, router, alice, slowServer.URL, "alice-webhook-secret", models.EventReceiptScored)
+
+	for i := 0; i < 3; i++ {
+		rr := sendWithHeaders(router, "POST", "/receipts/process", targetReceipt, alice)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	var dead []models.WebhookDelivery
+	assert.Eventually(t, func() bool {
+		dead = getDeliveries(t, router, "/webhooks/dead-letters", alice)
+		return len(dead) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, delivery := range dead {
+		if assert.Len(t, delivery.Attempts, 1) {
+			assert.Equal(t, services.ErrWebhookQueueFull.Error(), delivery.Attempts[0].Error)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/db"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+TracedStore is a db.TenantStore that wraps every receipt operation of the store it wraps in a span,
+a child of the span in the context of the operation, with the type of the wrapped store as the store attribute
+so every store implementation is traced the same way without instrumenting it
+the retailer operations take no context and are passed through
+*/
+type TracedStore struct {
+	db.TenantStore
+	name string
+}
+
+// TraceStore wraps a store so its receipt operations are traced
+func TraceStore(store db.TenantStore) *TracedStore {
+	return &TracedStore{TenantStore: store, name: fmt.Sprintf("%T", store)}
+}
+
+// start starts the span of an operation
+func (store *TracedStore) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return Start(ctx, "store."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("store", store.name)))
+}
+
+// Ping pings the wrapped store if it can be pinged, see db.Pinger
+func (store *TracedStore) Ping(ctx context.Context) error {
+	if pinger, ok := store.TenantStore.(db.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped store if it can be closed, see db.Closer
+func (store *TracedStore) Close(ctx context.Context) error {
+	if closer, ok := store.TenantStore.(db.Closer); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
+
+func (store *TracedStore) GetReceipt(ctx context.Context, id string) (int64, bool) {
+	ctx, span := store.start(ctx, "GetReceipt")
+	defer span.End()
+	points, ok := store.TenantStore.GetReceipt(ctx, id)
+	span.SetAttributes(attribute.Bool("found", ok))
+	return points, ok
+}
+
+func (store *TracedStore) GetReceiptDetails(ctx context.Context, id string) (*models.Receipt, bool) {
+	ctx, span := store.start(ctx, "GetReceiptDetails")
+	defer span.End()
+	receipt, ok := store.TenantStore.GetReceiptDetails(ctx, id)
+	span.SetAttributes(attribute.Bool("found", ok))
+	return receipt, ok
+}
+
+func (store *TracedStore) AddNewReceipt(ctx context.Context, receipt *models.Receipt) string {
+	ctx, span := store.start(ctx, "AddNewReceipt")
+	defer span.End()
+	id := store.TenantStore.AddNewReceipt(ctx, receipt)
+	span.SetAttributes(attribute.String("receipt.id", id))
+	return id
+}
+
+func (store *TracedStore) ListReceipts(ctx context.Context) []models.Receipt {
+	ctx, span := store.start(ctx, "ListReceipts")
+	defer span.End()
+	receipts := store.TenantStore.ListReceipts(ctx)
+	span.SetAttributes(attribute.Int("receipts", len(receipts)))
+	return receipts
+}
+
+func (store *TracedStore) MemberPoints(ctx context.Context, memberID string) int64 {
+	ctx, span := store.start(ctx, "MemberPoints")
+	defer span.End()
+	return store.TenantStore.MemberPoints(ctx, memberID)
+}
+
+func (store *TracedStore) GetReceiptsDetails(ctx context.Context, ids []string) map[string]*models.Receipt {
+	ctx, span := store.start(ctx, "GetReceiptsDetails")
+	defer span.End()
+	receipts := store.TenantStore.GetReceiptsDetails(ctx, ids)
+	span.SetAttributes(attribute.Int("ids", len(ids)), attribute.Int("receipts", len(receipts)))
+	return receipts
+}
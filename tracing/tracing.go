@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name of the spans of the service
+const ServiceName = "receipt-processor"
+
+// tracerName is the instrumentation name of every span of the service
+const tracerName = "github.com/rapolunagarjuna/receipt-processor-challenge"
+
+/*
+Start starts a span as a child of the span in ctx, see trace.Tracer
+the tracer is taken from the global tracer provider on every call, so the spans go to the provider
+installed last and are dropped until Setup installs one
+*/
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+/*
+Setup is a function that installs the global tracer provider and the W3C trace context propagator
+the spans are written as JSON lines to the file at path, or to stdout when path is "-",
+so tracing is usable without a collector
+returns the function that flushes the spans and closes the file on shutdown
+*/
+func Setup(path string) (func(context.Context) error, error) {
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if path != "-" {
+		var err error
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening trace file: %w", err)
+		}
+		out = file
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	SetupPropagation()
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// SetupPropagation installs the W3C traceparent and baggage propagator, incoming trace ids are kept
+func SetupPropagation() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
@@ -0,0 +1,133 @@
+package validators
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+// QuantityPattern is the pattern of the quantity tag, it is published in the OpenAPI document
+const QuantityPattern = "^\\d+(\\.\\d{1,3})?$"
+
+var quantityRegexp = regexp.MustCompile(QuantityPattern)
+
+// ValidateQuantity validates positive quantities with up to three decimal places (weighed items).
+func ValidateQuantity(fl validator.FieldLevel) bool {
+	quantity := fl.Field().String()
+	if !quantityRegexp.MatchString(quantity) {
+		return false
+	}
+	thousandths, _ := ParseFixed(quantity, 3)
+	return thousandths > 0
+}
+
+/*
+ValidateItemArithmetic is a struct level validation of models.Item
+when unitPrice is present, price must be unitPrice times the quantity (1 when absent)
+rounded half up to the minor unit of the currency of the receipt
+fails with the "price" tag on the Price field
+*/
+func ValidateItemArithmetic(sl validator.StructLevel) {
+	item := sl.Current().Interface().(models.Item)
+	if item.UnitPrice == "" {
+		return
+	}
+
+	decimals := models.CurrencyMinorUnits[models.DefaultCurrency]
+	if receipt, ok := reflect.Indirect(sl.Top()).Interface().(models.Receipt); ok {
+		decimals = receipt.MinorUnits()
+	}
+	price, priceOk := ParseFixed(item.Price, decimals)
+	unitPrice, unitPriceOk := ParseFixed(item.UnitPrice, decimals)
+	quantity, quantityOk := int64(1000), true
+	if item.Quantity != "" {
+		quantity, quantityOk = ParseFixed(item.Quantity, 3)
+	}
+	if !priceOk || !unitPriceOk || !quantityOk {
+		// the field validations already report the malformed value
+		return
+	}
+
+	if (quantity*unitPrice+500)/1000 != price {
+		sl.ReportError(item.Price, "price", "Price", "price", "")
+	}
+}
+
+/*
+ValidateReceiptArithmetic is a struct level validation of models.Receipt
+it only applies when subtotal, discounts or tax are present so receipts with just a total stay valid
+subtotal 						-> must be the sum of the item prices, fails with the "subtotal" tag
+total 							-> must be subtotal - the discount amounts + tax, fails with the "total" tag
+when subtotal is absent the sum of the item prices is used in its place
+the amounts are compared in the minor units of the currency of the receipt
+*/
+func ValidateReceiptArithmetic(sl validator.StructLevel) {
+	receipt := sl.Current().Interface().(models.Receipt)
+	if receipt.Subtotal == "" && receipt.Tax == "" && len(receipt.Discounts) == 0 {
+		return
+	}
+	decimals := receipt.MinorUnits()
+
+	var itemsSum int64
+	for _, item := range receipt.Items {
+		price, ok := ParseFixed(item.Price, decimals)
+		if !ok {
+			return
+		}
+		itemsSum += price
+	}
+
+	subtotal := itemsSum
+	if receipt.Subtotal != "" {
+		var ok bool
+		if subtotal, ok = ParseFixed(receipt.Subtotal, decimals); !ok {
+			return
+		}
+		if subtotal != itemsSum {
+			sl.ReportError(receipt.Subtotal, "subtotal", "Subtotal", "subtotal", "")
+		}
+	}
+
+	expectedTotal := subtotal
+	for _, discount := range receipt.Discounts {
+		amount, ok := ParseFixed(discount.Amount, decimals)
+		if !ok {
+			return
+		}
+		expectedTotal -= amount
+	}
+	if receipt.Tax != "" {
+		tax, ok := ParseFixed(receipt.Tax, decimals)
+		if !ok {
+			return
+		}
+		expectedTotal += tax
+	}
+
+	if total, ok := ParseFixed(receipt.Total, decimals); ok && total != expectedTotal {
+		sl.ReportError(receipt.Total, "total", "Total", "total", "")
+	}
+}
+
+/*
+ParseFixed parses a non negative decimal string into an integer number of 10^-decimals units
+"12.5" with 2 decimals is 1250, "1.250" with 3 decimals is 1250
+returns false when the string is not a number or has more than decimals decimal places
+*/
+func ParseFixed(value string, decimals int) (int64, bool) {
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || len(fraction) > decimals {
+		return 0, false
+	}
+	fraction += strings.Repeat("0", decimals-len(fraction))
+
+	units, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil || units < 0 || strings.ContainsAny(whole+fraction, "+-") {
+		return 0, false
+	}
+	return units, true
+}
@@ -4,8 +4,45 @@ import (
 	"github.com/go-playground/validator/v10"
 	"time"
 	"regexp"
+	"fmt"
+	"reflect"
+	"strings"
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
 )
 
+/*
+NewValidator returns a validator with all the custom validations of this package registered
+receiptDate, receiptTime, decimal, alphanumeric, quantity, currency, timezone, tenant, webhookURL and webhookEvent are the tags used by the models
+the arithmetic of items and receipts is checked by the struct level validations in arithmetic_validator.go
+the Field of a validation error is the JSON name of the field, e.g. purchaseDate, its StructField the Go name, see jsonName
+*/
+func NewValidator() *validator.Validate {
+	var validate = validator.New()
+	validate.RegisterTagNameFunc(jsonName)
+	validate.RegisterValidation("receiptDate", ValidateReceiptDate)
+	validate.RegisterValidation("receiptTime", ValidateReceiptTime)
+	validate.RegisterValidation("decimal", ValidateDecimal)
+	validate.RegisterValidation("alphanumeric", ValidateAlphanumeric)
+	validate.RegisterValidation("quantity", ValidateQuantity)
+	validate.RegisterValidation("currency", ValidateCurrency)
+	validate.RegisterValidation("timezone", ValidateTimezone)
+	validate.RegisterValidation("tenant", ValidateTenant)
+	validate.RegisterValidation("webhookURL", ValidateWebhookURL)
+	validate.RegisterValidation("webhookEvent", ValidateWebhookEvent)
+	validate.RegisterStructValidation(ValidateItemArithmetic, models.Item{})
+	validate.RegisterStructValidation(ValidateReceiptArithmetic, models.Receipt{})
+	return validate
+}
+
+// jsonName returns the name of the field in JSON, the Go name is used for the fields without one
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
 func ValidateReceiptDate(fl validator.FieldLevel) bool {
 	_, err := time.Parse("2006-01-02", fl.Field().String())
 	return err == nil
@@ -16,14 +53,65 @@ func ValidateReceiptTime(fl validator.FieldLevel) bool {
 	return err == nil
 }
 
+// AlphanumericPattern is the pattern of the alphanumeric tag, it is published in the OpenAPI document
+const AlphanumericPattern = "^[\\w\\s\\-&]+$"
+
 // ValidateAlphanumeric validates alphanumeric strings (including whitespace, hyphens, and ampersands).
 func ValidateAlphanumeric(fl validator.FieldLevel) bool {
-	match, _ := regexp.MatchString("^[\\w\\s\\-&]+$", fl.Field().String())
+	match, _ := regexp.MatchString(AlphanumericPattern, fl.Field().String())
 	return match
 }
 
-// ValidateDecimal validates numeric strings with two decimal places.
+/*
+ValidateDecimal validates numeric strings with as many decimal places as the currency of the receipt has minor units.
+two decimal places for USD (and receipts without a currency), none for JPY
+*/
 func ValidateDecimal(fl validator.FieldLevel) bool {
-	match, _ := regexp.MatchString("^\\d+\\.\\d{2}$", fl.Field().String())
+	decimals := minorUnits(fl)
+	pattern := "^\\d+$"
+	if decimals > 0 {
+		pattern = fmt.Sprintf("^\\d+\\.\\d{%d}$", decimals)
+	}
+	match, _ := regexp.MatchString(pattern, fl.Field().String())
  	return match
+}
+
+// ValidateCurrency validates ISO 4217 currency codes.
+func ValidateCurrency(fl validator.FieldLevel) bool {
+	_, ok := models.CurrencyMinorUnits[fl.Field().String()]
+	return ok
+}
+
+// ValidateTimezone validates IANA timezone names and UTC offsets of the form +05:30 or -0400.
+func ValidateTimezone(fl validator.FieldLevel) bool {
+	_, err := models.ParseTimezone(fl.Field().String())
+	return err == nil
+}
+
+// ValidateTenant validates tenant ids, lower case letters, digits, hyphens and underscores.
+func ValidateTenant(fl validator.FieldLevel) bool {
+	return models.ValidTenantID(fl.Field().String())
+}
+
+// ValidateWebhookURL validates the URLs of webhooks, absolute http or https URLs without credentials.
+func ValidateWebhookURL(fl validator.FieldLevel) bool {
+	return models.ValidWebhookURL(fl.Field().String())
+}
+
+// ValidateWebhookEvent validates the event types webhooks subscribe to, see models.WebhookEvents.
+func ValidateWebhookEvent(fl validator.FieldLevel) bool {
+	for _, eventType := range models.WebhookEvents {
+		if fl.Field().String() == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// minorUnits returns the minor units of the currency of the receipt being validated, 2 outside of a receipt
+func minorUnits(fl validator.FieldLevel) int {
+	if receipt, ok := reflect.Indirect(fl.Top()).Interface().(models.Receipt); ok {
+		return receipt.MinorUnits()
+	}
+	return models.CurrencyMinorUnits[models.DefaultCurrency]
 }
\ No newline at end of file
@@ -0,0 +1,87 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rapolunagarjuna/receipt-processor-challenge/models"
+)
+
+// MaxEventBytes is the size of the largest delivery the Receiver reads
+const MaxEventBytes = 1 << 20
+
+/*
+Receiver is an http.Handler that receives the deliveries of a webhook like a partner app would,
+so the webhooks can be tried out and tested without a partner, see cmd/webhook-receiver
+every delivery is verified with Secret, 401 when its signature does not match and 400 when its body is not an event,
+FailFirst answers the first deliveries with 503 so the retries can be seen, OnEvent is called with every event received, one at a time
+the same event may be received more than once when a response is lost, Events keeps them all, with the id of their delivery
+*/
+type Receiver struct {
+	Secret    string
+	Tolerance time.Duration
+	FailFirst int
+	OnEvent   func(received Received)
+
+	lock     sync.Mutex
+	requests int
+	received []Received
+}
+
+// Received is an event received by the Receiver with the id of the delivery it came with
+type Received struct {
+	Delivery string              `json:"delivery"`
+	Event    models.WebhookEvent `json:"event"`
+}
+
+func (receiver *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxEventBytes))
+	if err != nil {
+		http.Error(w, "the body cannot be read", http.StatusBadRequest)
+		return
+	}
+	tolerance := receiver.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	if err := Verify(receiver.Secret, r.Header.Get(SignatureHeader), body, time.Now(), tolerance); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	receiver.lock.Lock()
+	receiver.requests++
+	fail := receiver.requests <= receiver.FailFirst
+	receiver.lock.Unlock()
+	if fail {
+		http.Error(w, "failing on purpose", http.StatusServiceUnavailable)
+		return
+	}
+
+	received := Received{Delivery: r.Header.Get(DeliveryHeader)}
+	if err := json.Unmarshal(body, &received.Event); err != nil || received.Event.Type != r.Header.Get(EventHeader) {
+		http.Error(w, "the body is not an event", http.StatusBadRequest)
+		return
+	}
+	receiver.lock.Lock()
+	receiver.received = append(receiver.received, received)
+	if receiver.OnEvent != nil {
+		receiver.OnEvent(received)
+	}
+	receiver.lock.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Events returns the events received so far in the order they were received
+func (receiver *Receiver) Events() []Received {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return append([]Received(nil), receiver.received...)
+}
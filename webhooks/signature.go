@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the headers of every delivery
+const (
+	// SignatureHeader is the signature of the delivery, see Sign
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader is the type of the event, e.g. receipt.scored
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader is the id of the delivery, the same for every attempt of the delivery
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// DefaultTolerance is how old a signature Verify accepts, so a captured delivery cannot be replayed later
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned by Verify when the signature header is malformed or does not match the body
+	ErrInvalidSignature = errors.New("the signature does not match the body")
+	// ErrExpiredSignature is returned by Verify when the signature is older than the tolerance
+	ErrExpiredSignature = errors.New("the signature is too old")
+)
+
+/*
+Sign is a function that returns the signature header of a delivery, t=<unix seconds>,v1=<hex>
+v1 is the HMAC-SHA256 of "<unix seconds>.<body>" with the secret of the webhook,
+the timestamp is signed with the body so the receiver can reject old deliveries, see Verify
+*/
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac(secret, unix, body))
+}
+
+/*
+Verify is a function that checks the signature header of a delivery against its body, see Sign
+returns ErrInvalidSignature when it does not match and ErrExpiredSignature when it is further than tolerance from now
+*/
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expected := mac(secret, unix, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+				return fmt.Errorf("%w, it was made %s ago", ErrExpiredSignature, age.Round(time.Second))
+			}
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret string, unix string, body []byte) []byte {
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(unix))
+	hash.Write([]byte("."))
+	hash.Write(body)
+	return hash.Sum(nil)
+}